@@ -13,19 +13,34 @@ import (
 	"os"
 
 	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/openvex/vexctl/pkg/attestation"
 	"github.com/openvex/vexctl/pkg/ctl"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
 type attestOptions struct {
 	outFileOption
-	attach bool
-	sign   bool
-	refs   []string
+	registryOptions
+	attach        bool
+	sign          bool
+	signingKey    string
+	sigstore      attestation.SigningOptions
+	tlogUpload    bool
+	verifyDigests bool
+	refs          []string
+	sbomDigest    string
+	concurrency   int
+	failFast      bool
+	skipExisting  bool
+	dryRun        bool
+	useReferrers  bool
+	toChildren    bool
 }
 
 func (o *attestOptions) AddFlags(cmd *cobra.Command) {
 	o.outFileOption.AddFlags(cmd)
+	o.registryOptions.AddFlags(cmd)
 	cmd.PersistentFlags().BoolVarP(
 		&o.attach,
 		"attach",
@@ -42,6 +57,104 @@ func (o *attestOptions) AddFlags(cmd *cobra.Command) {
 		"sign the attestation with sigstore",
 	)
 
+	cmd.PersistentFlags().StringVar(
+		&o.signingKey,
+		"key",
+		"",
+		"cosign key to sign with, a file path or KMS URI (implies --sign, keyless signing is used when not set)",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&o.sigstore.FulcioURL,
+		"fulcio-url",
+		"",
+		"Fulcio instance issuing keyless signing certificates (default is the public instance)",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&o.sigstore.RekorURL,
+		"rekor-url",
+		"",
+		"Rekor transparency log to record signatures in (default is the public instance)",
+	)
+
+	cmd.PersistentFlags().BoolVar(
+		&o.tlogUpload,
+		"tlog-upload",
+		true,
+		"record the signed attestation in the Rekor transparency log",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&o.sigstore.OIDCIssuer,
+		"oidc-issuer",
+		"",
+		"OIDC provider used to get a keyless signing identity (default is the public instance)",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&o.sigstore.IdentityToken,
+		"identity-token",
+		"",
+		"OIDC token to use for keyless signing instead of ambient credentials or the browser flow",
+	)
+
+	cmd.PersistentFlags().BoolVar(
+		&o.verifyDigests,
+		"verify-digests",
+		false,
+		"check that the subject digests match the images currently in the registry",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&o.sbomDigest,
+		"sbom-attestation",
+		"",
+		"digest of a related SBOM attestation to link when attaching (eg sha256:abc...)",
+	)
+
+	cmd.PersistentFlags().IntVar(
+		&o.concurrency,
+		"concurrency",
+		ctl.DefaultConcurrency,
+		"number of images to attach the attestation to at the same time",
+	)
+
+	cmd.PersistentFlags().BoolVar(
+		&o.failFast,
+		"fail-fast",
+		false,
+		"stop attaching to the remaining images after the first failure",
+	)
+
+	cmd.PersistentFlags().BoolVar(
+		&o.skipExisting,
+		"skip-existing",
+		false,
+		"do not push the attestation to images that already have it attached",
+	)
+
+	cmd.PersistentFlags().BoolVar(
+		&o.dryRun,
+		"dry-run",
+		false,
+		"list the images the attestation would be attached to without pushing it",
+	)
+
+	cmd.PersistentFlags().BoolVar(
+		&o.useReferrers,
+		"use-referrers",
+		false,
+		"attach the attestation as an OCI 1.1 referrer of the images instead of using the cosign tag scheme",
+	)
+
+	cmd.PersistentFlags().BoolVar(
+		&o.toChildren,
+		"attach-to-children",
+		false,
+		"attest and attach to the platform images of multi-arch image indexes instead of the index",
+	)
+
 	cmd.PersistentFlags().StringArrayVarP(
 		&o.refs,
 		"refs",
@@ -61,12 +174,16 @@ func (o *attestOptions) Validate() error {
 		}
 	}
 
-	if o.attach {
+	if o.attach || o.signingKey != "" {
 		o.sign = true
 	}
 
+	if o.sbomDigest != "" && !o.attach {
+		sErr = errors.Join(sErr, errors.New("--sbom-attestation can only be used with --attach"))
+	}
+
 	return errors.Join(
-		sErr, o.outFileOption.Validate(),
+		sErr, o.outFileOption.Validate(), o.registryOptions.Validate(),
 	)
 }
 
@@ -119,6 +236,11 @@ When signing an attestation, the standard sigstore signing flow will be triggere
 if credentials are not found in the environment. Refer to the sigstore
 documentation for details.
 
+To sign with a cosign key instead, pass its path or KMS URI in --key. The
+password of encrypted keys is read from $COSIGN_PASSWORD or prompted:
+
+  %s attest --key=cosign.key data.vex.json
+
 Attaching Attestations
 ----------------------
 
@@ -146,7 +268,7 @@ to user/test, even if the OpenVEX document has product entries for other images:
 %s attest --attach vex.json user/test
 
 
-`, appname, appname, appname, appname, appname, appname, appname, appname, appname),
+`, appname, appname, appname, appname, appname, appname, appname, appname, appname, appname),
 		Use:               "attest",
 		SilenceUsage:      false,
 		SilenceErrors:     false,
@@ -165,16 +287,42 @@ to user/test, even if the OpenVEX document has product entries for other images:
 
 			vexctl := ctl.New()
 			vexctl.Options.Sign = opts.sign
+			vexctl.Options.SigningKey = opts.signingKey
+			vexctl.Options.Sigstore = opts.sigstore
+			vexctl.Options.TlogUpload = opts.tlogUpload
+			vexctl.Options.VerifyRegistryDigests = opts.verifyDigests
+			vexctl.Options.SBOMAttestationDigest = opts.sbomDigest
+			vexctl.Options.Concurrency = opts.concurrency
+			vexctl.Options.FailFast = opts.failFast
+			vexctl.Options.SkipExisting = opts.skipExisting
+			vexctl.Options.DryRun = opts.dryRun
+			vexctl.Options.UseReferrers = opts.useReferrers
+			vexctl.Options.AttachToChildren = opts.toChildren
+			opts.registryOptions.Apply(&vexctl.Options)
 
 			attestation, err := vexctl.Attest(args[0], args[1:])
 			if err != nil {
 				return fmt.Errorf("generating attestation: %w", err)
 			}
 
+			subjects := ctl.DescribeSubjects(attestation)
+			logrus.Infof("Attesting %d subjects:", len(subjects))
+			for _, s := range subjects {
+				logrus.Infof("  %s", s)
+			}
+
 			if opts.attach {
-				if err := vexctl.Attach(ctx, attestation); err != nil {
+				result, err := vexctl.Attach(ctx, attestation)
+				if err != nil {
 					return fmt.Errorf("attaching attestation: %w", err)
 				}
+				if opts.dryRun {
+					logrus.Infof("Dry run: attestation would be attached to %d images", len(result.Planned))
+				} else {
+					logrus.Infof(
+						"Attestation attached to %d images, %d already had it", result.Written, result.Skipped,
+					)
+				}
 			}
 
 			var out io.Writer = os.Stdout
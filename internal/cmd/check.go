@@ -0,0 +1,143 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/openvex/vexctl/pkg/ctl"
+)
+
+// exitCodeError is returned by commands that have to exit with a specific
+// code, Execute exits with it after logging the message.
+type exitCodeError struct {
+	code int
+	msg  string
+}
+
+func (e *exitCodeError) Error() string {
+	return e.msg
+}
+
+type checkOptions struct {
+	filterOptions
+	policyPath string
+}
+
+func (o *checkOptions) Validate() error {
+	if o.policyPath == "" {
+		return errors.New("a policy file must be specified with --policy")
+	}
+	return o.filterOptions.Validate()
+}
+
+func addCheck(parentCmd *cobra.Command) {
+	opts := checkOptions{}
+	checkCmd := &cobra.Command{
+		Short: fmt.Sprintf("%s check: gate a results set using a policy", appname),
+		Long: fmt.Sprintf(`%s check: gate a results set using a policy
+
+The check subcommand filters a scanner results file with one or more VEX
+documents (just like %s filter) and then evaluates a policy against the
+filtered results and the VEX data. It takes the same flags as filter to read
+the VEX documents, verify image attestations and match the results.
+
+The policy maps conditions to exit codes, the command exits with the first
+non-zero code of the rules that fire and prints a JSON report of all the
+rules that fired.
+
+Policies are written in JSON or YAML:
+
+  rules:
+    - name: critical findings
+      exitCode: 3
+      minSeverity: critical        # low | medium | high | critical
+    - name: required assessments
+      exitCode: 4
+      requiredStatements:          # vulnerabilities that must have a statement
+        - CVE-2023-1234
+    - name: stale statements
+      exitCode: 5
+      maxStatementAge: 720h        # statements not updated in 30 days
+
+Examples:
+
+vexctl check --policy=policy.yaml myreport.sarif.json data1.vex.json data2.vex.json
+
+`, appname, appname),
+		Use:               "check",
+		SilenceUsage:      false,
+		SilenceErrors:     false,
+		PersistentPreRunE: initLogging,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 2 {
+				fmt.Println(cmd.Long)
+				return errors.New("not enough arguments")
+			}
+			if err := opts.Validate(); err != nil {
+				return fmt.Errorf("validating options: %w", err)
+			}
+
+			policy, err := ctl.LoadPolicy(opts.policyPath)
+			if err != nil {
+				return fmt.Errorf("loading policy: %w", err)
+			}
+
+			ctx := context.Background()
+			vexctl := ctl.New()
+			if err := opts.Apply(&vexctl.Options); err != nil {
+				return err
+			}
+
+			report, summary, err := vexctl.FilterFiles(ctx, args[0], args[1:])
+			if err != nil {
+				return fmt.Errorf("filtering report: %w", err)
+			}
+			logrus.Info(summary)
+
+			result, err := policy.Evaluate(report, summary.Documents, time.Now())
+			if err != nil {
+				return fmt.Errorf("evaluating policy: %w", err)
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(result); err != nil {
+				return fmt.Errorf("writing policy results: %w", err)
+			}
+
+			if result.ExitCode != 0 {
+				// The policy failed, the command was used correctly
+				cmd.SilenceUsage = true
+				cmd.SilenceErrors = true
+				return &exitCodeError{
+					code: result.ExitCode,
+					msg:  fmt.Sprintf("%d policy rules fired, exiting with code %d", len(result.Fired), result.ExitCode),
+				}
+			}
+			return nil
+		},
+	}
+
+	checkCmd.PersistentFlags().StringVar(
+		&opts.policyPath,
+		"policy",
+		"",
+		"JSON or YAML file with the policy rules to evaluate",
+	)
+
+	opts.filterOptions.AddFlags(checkCmd)
+
+	parentCmd.AddCommand(checkCmd)
+}
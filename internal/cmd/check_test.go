@@ -0,0 +1,52 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cmd
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openvex/vexctl/pkg/ctl"
+)
+
+func TestCheckExitCode(t *testing.T) {
+	parent := &cobra.Command{Use: "vexctl"}
+	addCheck(parent)
+	parent.SetArgs([]string{
+		"check", "--policy=../../pkg/ctl/testdata/policy/gate.yaml",
+		"../../pkg/ctl/testdata/nginx.sarif.json", "../../pkg/ctl/testdata/v020-1.vex.json",
+	})
+
+	// The policy fails, the code is returned instead of exiting
+	err := parent.Execute()
+	var exitErr *exitCodeError
+	require.True(t, errors.As(err, &exitErr), err)
+	require.NotZero(t, exitErr.code)
+}
+
+func TestCheckOptionsApply(t *testing.T) {
+	opts := checkOptions{}
+	cmd := &cobra.Command{Use: "check"}
+	opts.filterOptions.AddFlags(cmd)
+	require.NoError(t, cmd.PersistentFlags().Parse([]string{
+		"--key=cosign.pub", "--retry-attempts=5", "--product-match=purlPrefix",
+	}))
+	opts.policyPath = "policy.yaml"
+	require.NoError(t, opts.Validate())
+
+	vexctl := ctl.New()
+	require.NoError(t, opts.Apply(&vexctl.Options))
+	require.Equal(t, "cosign.pub", vexctl.Options.VerifyKey)
+	require.Equal(t, 5, vexctl.Options.RetryAttempts)
+	require.Equal(t, ctl.ProductMatchPurlPrefix, vexctl.Options.ProductMatchMode)
+
+	// The filter options are validated too
+	opts.skipVerify = true
+	require.Error(t, opts.Validate())
+}
@@ -11,27 +11,283 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
-	"github.com/openvex/go-vex/pkg/sarif"
 	"github.com/openvex/go-vex/pkg/vex"
-
 	"github.com/openvex/vexctl/pkg/ctl"
 )
 
 type filterOptions struct {
-	reportFormat string
-	products     []string
+	reportFormat   string
+	products       []string
+	verifyKey      string
+	rekorPublicKey string
+	verifyTimeout  time.Duration
+	certIdentity   string
+	certIssuer     string
+	ignoreTlog     bool
+	tlogInclusion  bool
+	rekorURL       string
+	skipVerify     bool
+	useReferrers   bool
+	since          string
+	latest         bool
+	registryOptions
+	idFromMessage  bool
+	strictProducts bool
+	productMatch   string
+	ruleIDPrefixes []string
+	ruleIDAliases  map[string]string
+	matchCWE       bool
+	failUntriaged  bool
+	justifications []string
+	suppression    string
+	watch          bool
+	watchInterval  time.Duration
 }
 
 func (o *filterOptions) Validate() error {
 	if o.reportFormat != "vex" && o.reportFormat != "csaf" && o.reportFormat != "cyclonedx" {
 		return errors.New("invalid vex document format (must be one of vex, cyclonedx or csaf)")
 	}
+	if o.suppression != string(ctl.SuppressionModeRemove) && o.suppression != string(ctl.SuppressionModeMark) {
+		return fmt.Errorf("invalid suppression mode %q (must be remove or mark)", o.suppression)
+	}
+	if o.verifyKey == "" && o.certIdentity == "" && (o.rekorPublicKey != "" || o.verifyTimeout != 0) {
+		return errors.New("--rekor-public-key and --verify-timeout require a verification --key or --certificate-identity")
+	}
+	if o.skipVerify && (o.verifyKey != "" || o.certIdentity != "") {
+		return errors.New("--skip-verify cannot be used with --key or --certificate-identity")
+	}
+	if o.tlogInclusion && (o.ignoreTlog || o.rekorPublicKey != "") {
+		return errors.New("--verify-tlog-inclusion cannot be used with --insecure-ignore-tlog or --rekor-public-key")
+	}
+	if o.since != "" {
+		if _, err := time.Parse(time.RFC3339, o.since); err != nil {
+			return fmt.Errorf("invalid --attestations-since time, must be RFC3339: %w", err)
+		}
+	}
+	if o.watch && o.watchInterval <= 0 {
+		return fmt.Errorf("invalid --watch-interval %s, must be positive", o.watchInterval)
+	}
+	for _, j := range o.justifications {
+		if !vex.Justification(j).Valid() {
+			return fmt.Errorf("invalid justification %q, must be one of %s", j, strings.Join(vex.Justifications(), ", "))
+		}
+	}
+	return o.registryOptions.Validate()
+}
+
+// Apply sets the matching and verification options in the vexctl options
+func (o *filterOptions) Apply(opts *ctl.Options) error {
+	opts.Products = o.products
+	opts.Format = o.reportFormat
+	opts.VerifyKey = o.verifyKey
+	opts.RekorPublicKeyPath = o.rekorPublicKey
+	opts.VerifyTimeout = o.verifyTimeout
+	opts.CertIdentity = o.certIdentity
+	opts.CertOIDCIssuer = o.certIssuer
+	opts.IgnoreTlog = o.ignoreTlog
+	opts.VerifyTlogInclusion = o.tlogInclusion
+	opts.Sigstore.RekorURL = o.rekorURL
+	opts.SkipVerify = o.skipVerify
+	opts.UseReferrers = o.useReferrers
+	opts.PredicateType = vex.TypeURI
+	opts.Latest = o.latest
+	if o.since != "" {
+		since, err := time.Parse(time.RFC3339, o.since)
+		if err != nil {
+			return fmt.Errorf("parsing --attestations-since: %w", err)
+		}
+		opts.Since = since
+	}
+	o.registryOptions.Apply(opts)
+	opts.VulnIDFromMessage = o.idFromMessage
+	opts.StrictProductMatching = o.strictProducts
+	opts.ProductMatchMode = ctl.ProductMatchMode(o.productMatch)
+	opts.RuleIDPrefixes = o.ruleIDPrefixes
+	opts.RuleIDAliases = o.ruleIDAliases
+	opts.MatchCWE = o.matchCWE
+	opts.SuppressionMode = ctl.SuppressionMode(o.suppression)
+	opts.FailOnUntriaged = o.failUntriaged
+	for _, j := range o.justifications {
+		opts.AllowedJustifications = append(opts.AllowedJustifications, vex.Justification(j))
+	}
 	return nil
 }
 
+func (o *filterOptions) AddFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(
+		&o.reportFormat,
+		"format",
+		"vex",
+		"format of the vex document (vex | csaf | cyclonedx)",
+	)
+
+	cmd.PersistentFlags().StringSliceVar(
+		&o.products,
+		"product",
+		[]string{},
+		"IDs of products in a CSAF document to VEX (defaults to first one found)",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&o.verifyKey,
+		"key",
+		"",
+		"public key to verify the signatures of attestations read from images",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&o.rekorPublicKey,
+		"rekor-public-key",
+		"",
+		"file with the Rekor public key(s) to verify transparency log entries offline",
+	)
+
+	cmd.PersistentFlags().DurationVar(
+		&o.verifyTimeout,
+		"verify-timeout",
+		0,
+		"maximum time to wait for attestation verification (eg 30s, default no limit)",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&o.certIdentity,
+		"certificate-identity",
+		"",
+		"identity (eg email or workflow URI) expected in keyless signatures of image attestations",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&o.certIssuer,
+		"certificate-oidc-issuer",
+		"",
+		"OIDC issuer expected in keyless signatures of image attestations",
+	)
+
+	cmd.PersistentFlags().BoolVar(
+		&o.ignoreTlog,
+		"insecure-ignore-tlog",
+		false,
+		"do not require transparency log entries when verifying image attestations",
+	)
+
+	cmd.PersistentFlags().BoolVar(
+		&o.tlogInclusion,
+		"verify-tlog-inclusion",
+		false,
+		"verify the transparency log inclusion proofs of image attestations online",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&o.rekorURL,
+		"rekor-url",
+		"",
+		"Rekor transparency log to verify inclusion proofs against (default is the public instance)",
+	)
+
+	cmd.PersistentFlags().BoolVar(
+		&o.skipVerify,
+		"skip-verify",
+		false,
+		"read image attestations without verifying their signatures (insecure)",
+	)
+
+	cmd.PersistentFlags().BoolVar(
+		&o.useReferrers,
+		"use-referrers",
+		false,
+		"look for attestations attached to images as OCI 1.1 referrers before the cosign tag scheme",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&o.since,
+		"attestations-since",
+		"",
+		"only read image attestations of VEX documents issued at or after this RFC3339 time",
+	)
+
+	cmd.PersistentFlags().BoolVar(
+		&o.latest,
+		"latest-attestation",
+		false,
+		"only read the image attestation with the most recent VEX document",
+	)
+
+	cmd.PersistentFlags().BoolVar(
+		&o.idFromMessage,
+		"vuln-id-from-message",
+		false,
+		"look for CVE/GHSA identifiers in result messages when rule IDs are not recognized",
+	)
+
+	cmd.PersistentFlags().StringSliceVar(
+		&o.ruleIDPrefixes,
+		"rule-id-prefix",
+		[]string{},
+		fmt.Sprintf("additional SARIF rule ID prefixes to recognize as vulnerabilities (built in: CVE, %s)", strings.Join(ctl.DefaultRuleIDPrefixes, ", ")),
+	)
+
+	cmd.PersistentFlags().StringToStringVar(
+		&o.ruleIDAliases,
+		"rule-id-alias",
+		map[string]string{},
+		"map SARIF rule IDs to the vulnerability they are matched as (eg INTERNAL-123=CVE-2023-1234, can be repeated)",
+	)
+
+	cmd.PersistentFlags().BoolVar(
+		&o.matchCWE,
+		"match-cwe",
+		false,
+		"match CWE rule IDs to statements mentioning the CWE in their vulnerability description (coarse)",
+	)
+
+	cmd.PersistentFlags().StringSliceVar(
+		&o.justifications,
+		"allowed-justification",
+		[]string{},
+		"only suppress results with not_affected statements that have these justifications (can be repeated)",
+	)
+
+	cmd.PersistentFlags().BoolVar(
+		&o.failUntriaged,
+		"fail-on-untriaged",
+		false,
+		"exit with an error when the report has vulnerabilities without a VEX statement",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&o.suppression,
+		"suppression-mode",
+		string(ctl.SuppressionModeRemove),
+		"what to do with results suppressed by VEX: remove them or mark them as suppressed in the report",
+	)
+
+	cmd.PersistentFlags().BoolVar(
+		&o.strictProducts,
+		"strict-products",
+		false,
+		"only filter results when the scanned artifact (location or purl) matches the statement products",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&o.productMatch,
+		"product-match",
+		string(ctl.ProductMatchExact),
+		fmt.Sprintf(
+			"how artifacts are compared to the statement products: %s or %s to match purls ignoring their version",
+			ctl.ProductMatchExact, ctl.ProductMatchPurlPrefix,
+		),
+	)
+
+	o.registryOptions.AddFlags(cmd)
+}
+
 func addFilter(parentCmd *cobra.Command) {
 	opts := filterOptions{}
 	filterCmd := &cobra.Command{
@@ -47,13 +303,26 @@ Examples:
 # VEX a SARIF report from vex files:
 vexctl filter myreport.sarif.json data1.vex.json data2.vex.json
 
+# Re-run the filter every time the report or the VEX files change:
+vexctl filter --watch myreport.sarif.json data1.vex.json
+
 # VEX a SARIF report from an atestation in an image:
 vexctl filter myreport.sarif.json cgr.dev/image@sha256:e4cf37d568d195b4b5af4c3.....
 
+# VEX a SARIF report from a document published on the web:
+vexctl filter myreport.sarif.json https://example.com/product.openvex.json
+
 VEX information can be read from CSAF, CycloneDX or our own simpler VEX
 format.
 
-It can also be read from an attestation attached to a container image.
+It can also be read from an attestation attached to a container image. The
+attestation signatures are verified before using the VEX data, either with
+a public key passed with --key or, for keyless signatures, against the signer
+identity in --certificate-identity and --certificate-oidc-issuer. Attestations
+that fail verification are ignored. Reading unverified attestations requires
+--skip-verify. In restricted networks, --rekor-public-key lets you check the
+transparency log entries offline and --verify-timeout makes verification fail
+fast instead of hanging.
 
 When dealing with CSAF files, you can specify which of the products in the
 document should be VEX'ed by specifying --product=PRODUCT_ID.
@@ -75,8 +344,9 @@ document should be VEX'ed by specifying --product=PRODUCT_ID.
 
 			ctx := context.Background()
 			vexctl := ctl.New()
-			vexctl.Options.Products = opts.products
-			vexctl.Options.Format = opts.reportFormat
+			if err := opts.Apply(&vexctl.Options); err != nil {
+				return err
+			}
 
 			// TODO: Autodetect piped stdin
 			reportFileName := args[0]
@@ -92,41 +362,37 @@ document should be VEX'ed by specifying --product=PRODUCT_ID.
 				reportFileName = tmp.Name()
 			}
 
-			// Open all docs
-			report, err := sarif.Open(reportFileName)
-			if err != nil {
-				return fmt.Errorf("opening sarif report")
-			}
-			vexes := []*vex.VEX{}
-			for i := 1; i < len(args); i++ {
-				doc, err := vexctl.VexFromURI(ctx, args[i])
-				if err != nil {
-					return fmt.Errorf("opening %s: %w", args[i], err)
+			if opts.watch {
+				if args[0] == "-" {
+					return errors.New("--watch cannot read the report from stdin")
 				}
-				vexes = append(vexes, doc)
+				return watchFilter(ctx, vexctl, reportFileName, args[1:], opts.watchInterval)
 			}
 
-			report, err = vexctl.Apply(report, vexes)
+			report, summary, err := vexctl.FilterFiles(ctx, reportFileName, args[1:])
 			if err != nil {
-				return fmt.Errorf("applying vexes to report: %w", err)
+				return fmt.Errorf("filtering report: %w", err)
 			}
+			logrus.Info(summary)
 
 			return report.ToJSON(os.Stdout)
 		},
 	}
 
-	filterCmd.PersistentFlags().StringVar(
-		&opts.reportFormat,
-		"format",
-		"vex",
-		"format of the vex document (vex | csaf | cyclonedx)",
+	opts.AddFlags(filterCmd)
+
+	filterCmd.PersistentFlags().BoolVar(
+		&opts.watch,
+		"watch",
+		false,
+		"watch the report and VEX files and print a new summary when they change",
 	)
 
-	filterCmd.PersistentFlags().StringSliceVar(
-		&opts.products,
-		"product",
-		[]string{},
-		"IDs of products in a CSAF document to VEX (defaults to first one found)",
+	filterCmd.PersistentFlags().DurationVar(
+		&opts.watchInterval,
+		"watch-interval",
+		time.Second,
+		"how often to check the watched files for changes",
 	)
 
 	parentCmd.AddCommand(filterCmd)
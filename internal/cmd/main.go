@@ -6,7 +6,9 @@ SPDX-License-Identifier: Apache-2.0
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"os"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -36,9 +38,16 @@ For more information see the --attest and --filter subcomands
 }
 
 type commandLineOptions struct {
-	logLevel string
+	logLevel  string
+	logFormat string
+	noColor   bool
 }
 
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
 var commandLineOpts = commandLineOptions{}
 
 func init() {
@@ -49,7 +58,22 @@ func init() {
 		fmt.Sprintf("the logging verbosity, either %s", log.LevelNames()),
 	)
 
+	rootCmd.PersistentFlags().StringVar(
+		&commandLineOpts.logFormat,
+		"log-format",
+		logFormatText,
+		fmt.Sprintf("format of the log output, either %q or %q", logFormatText, logFormatJSON),
+	)
+
+	rootCmd.PersistentFlags().BoolVar(
+		&commandLineOpts.noColor,
+		"no-color",
+		false,
+		"disable colors in the log output and add timestamps (also enabled by the NO_COLOR env var)",
+	)
+
 	addFilter(rootCmd)
+	addCheck(rootCmd)
 	addAttest(rootCmd)
 	addMerge(rootCmd)
 	addCreate(rootCmd)
@@ -60,12 +84,34 @@ func init() {
 }
 
 func initLogging(*cobra.Command, []string) error {
-	return log.SetupGlobalLogger(commandLineOpts.logLevel)
+	if err := log.SetupGlobalLogger(commandLineOpts.logLevel); err != nil {
+		return err
+	}
+
+	switch commandLineOpts.logFormat {
+	case logFormatText:
+		if commandLineOpts.noColor || os.Getenv("NO_COLOR") != "" {
+			logrus.SetFormatter(&logrus.TextFormatter{
+				DisableColors: true,
+				FullTimestamp: true,
+			})
+		}
+	case logFormatJSON:
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		return fmt.Errorf("invalid log format %q, must be %q or %q", commandLineOpts.logFormat, logFormatText, logFormatJSON)
+	}
+	return nil
 }
 
 // Execute builds the command
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
+		var exitErr *exitCodeError
+		if errors.As(err, &exitErr) {
+			logrus.Info(exitErr)
+			os.Exit(exitErr.code)
+		}
 		logrus.Fatal(err)
 	}
 }
@@ -10,9 +10,13 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
+	"github.com/openvex/go-vex/pkg/vex"
+
 	"github.com/openvex/vexctl/pkg/ctl"
 )
 
@@ -20,6 +24,20 @@ type mergeOptions struct {
 	vexDocOptions
 	productsListOption
 	vulnerabilityListOption
+	changelogPath  string
+	trustedAuthors []string
+	deduplicate    bool
+	onConflict     string
+	strategy       string
+	productMatch   string
+	sourceOrder    bool
+	directories    []string
+	recursive      bool
+	keepGoing      bool
+	currentTime    bool
+	statuses       []string
+	annotateSource bool
+	requireJustify bool
 }
 
 func (mo *mergeOptions) AddFlags(cmd *cobra.Command) {
@@ -29,11 +47,19 @@ func (mo *mergeOptions) AddFlags(cmd *cobra.Command) {
 }
 
 func (mo *mergeOptions) Validate() error {
-	return errors.Join(
+	errs := []error{
 		mo.productsListOption.Validate(),
 		mo.vulnerabilityListOption.Validate(),
 		mo.vexDocOptions.Validate(),
-	)
+	}
+	for _, status := range mo.statuses {
+		if !vex.Status(status).Valid() {
+			errs = append(errs, fmt.Errorf(
+				"invalid status %q, must be one of %s", status, strings.Join(vex.Statuses(), ", "),
+			))
+		}
+	}
+	return errors.Join(errs...)
 }
 
 func addMerge(parentCmd *cobra.Command) {
@@ -57,23 +83,80 @@ Examples:
 # Merge vulnerability data from two documents into one
 %s merge --vulnerability=CVE-2022-3294 document1.vex.json document2.vex.json
 
-`, appname, appname, appname, appname),
+# Merge only the statements from documents by trusted authors
+%s merge --trusted-author="Wolfi J Inkinson" document1.vex.json document2.vex.json
+
+# Merge all the *.vex.json and *.openvex.json documents in a directory tree
+%s merge --directory=vex/ --recursive
+
+`, appname, appname, appname, appname, appname, appname),
 		Use:               "merge",
 		SilenceUsage:      false,
 		SilenceErrors:     false,
 		PersistentPreRunE: initLogging,
 		RunE: func(_ *cobra.Command, args []string) error {
+			if err := opts.Validate(); err != nil {
+				return fmt.Errorf("validating options: %w", err)
+			}
+
+			statuses := []vex.Status{}
+			for _, status := range opts.statuses {
+				statuses = append(statuses, vex.Status(status))
+			}
+
 			vexctl := ctl.New()
+			vexctl.Options.ContinueOnLoadError = opts.keepGoing
 
 			// TODO(puerco): Change this to vex merge options when we move
 			// the merge logic out of vexctl
-			newVex, err := vexctl.MergeFiles(context.Background(), &ctl.MergeOptions{
+			mergeOpts := &ctl.MergeOptions{
 				DocumentID:      opts.vexDocOptions.DocumentID,
 				Author:          opts.vexDocOptions.Author,
 				AuthorRole:      opts.vexDocOptions.AuthorRole,
 				Products:        opts.Products,
 				Vulnerabilities: opts.Vulnerabilities,
-			}, args)
+				Statuses:        statuses,
+				TrustedAuthors:  opts.trustedAuthors,
+				KeepDuplicates:  !opts.deduplicate,
+				OnConflict:      ctl.ConflictPolicy(opts.onConflict),
+				Strategy:        ctl.MergeStrategy(opts.strategy),
+				UseCurrentTime:  opts.currentTime,
+				AnnotateSource:  opts.annotateSource,
+
+				RequireJustification: opts.requireJustify,
+				PreserveSourceOrder:  opts.sourceOrder,
+				ProductMatchMode:     ctl.ProductMatchMode(opts.productMatch),
+			}
+
+			if opts.changelogPath != "" {
+				f, err := os.Create(opts.changelogPath)
+				if err != nil {
+					return fmt.Errorf("opening changelog file: %w", err)
+				}
+				defer f.Close()
+				mergeOpts.ChangelogWriter = f
+			}
+
+			ctx := context.Background()
+			docs, err := vexctl.LoadFiles(ctx, args)
+			if err != nil {
+				if !opts.keepGoing {
+					return fmt.Errorf("loading documents: %w", err)
+				}
+				logrus.Warnf("some documents could not be loaded: %v", err)
+			}
+			for _, dir := range opts.directories {
+				dirDocs, err := vexctl.LoadDirectory(ctx, dir, opts.recursive)
+				if err != nil {
+					if !opts.keepGoing {
+						return err
+					}
+					logrus.Warnf("some documents could not be loaded: %v", err)
+				}
+				docs = append(docs, dirDocs...)
+			}
+
+			newVex, err := vexctl.Merge(ctx, mergeOpts, docs)
 			if err != nil {
 				return fmt.Errorf("merging documents: %w", err)
 			}
@@ -88,5 +171,112 @@ Examples:
 	opts.vulnerabilityListOption.AddFlags(mergeCmd)
 	opts.vexDocOptions.AddFlags(mergeCmd)
 
+	mergeCmd.PersistentFlags().StringSliceVar(
+		&opts.statuses,
+		"status",
+		[]string{},
+		fmt.Sprintf("only merge statements with these statuses (%s)", strings.Join(vex.Statuses(), ", ")),
+	)
+
+	mergeCmd.PersistentFlags().StringVar(
+		&opts.changelogPath,
+		"changelog",
+		"",
+		"write a JSON changelog of the superseded statements to this file",
+	)
+
+	mergeCmd.PersistentFlags().BoolVar(
+		&opts.deduplicate,
+		"deduplicate",
+		true,
+		"collapse repeated statements from the merged documents into the most recent one",
+	)
+
+	mergeCmd.PersistentFlags().StringVar(
+		&opts.onConflict,
+		"on-conflict",
+		string(ctl.ConflictKeepBoth),
+		fmt.Sprintf(
+			"what to do with statements with different statuses for the same vulnerability, product and time (%s, %s or %s)",
+			ctl.ConflictError, ctl.ConflictKeepLatest, ctl.ConflictKeepBoth,
+		),
+	)
+
+	mergeCmd.PersistentFlags().StringVar(
+		&opts.strategy,
+		"strategy",
+		string(ctl.MergeAccumulate),
+		fmt.Sprintf(
+			"keep all the statements (%s) or only the newest one about each vulnerability and product (%s)",
+			ctl.MergeAccumulate, ctl.MergeSupersede,
+		),
+	)
+
+	mergeCmd.PersistentFlags().StringVar(
+		&opts.productMatch,
+		"product-match",
+		string(ctl.ProductMatchExact),
+		fmt.Sprintf(
+			"how --product is compared to the statement products: %s or %s to match purls ignoring their version",
+			ctl.ProductMatchExact, ctl.ProductMatchPurlPrefix,
+		),
+	)
+
+	mergeCmd.PersistentFlags().BoolVar(
+		&opts.sourceOrder,
+		"preserve-source-order",
+		false,
+		"group the merged statements by document in the order they are passed, sorting only within each group",
+	)
+
+	mergeCmd.PersistentFlags().StringSliceVar(
+		&opts.trustedAuthors,
+		"trusted-author",
+		[]string{},
+		"only merge statements from documents by these authors (can be repeated)",
+	)
+
+	mergeCmd.PersistentFlags().BoolVar(
+		&opts.currentTime,
+		"use-current-time",
+		false,
+		"timestamp the merged document with the current time instead of the newest source document",
+	)
+
+	mergeCmd.PersistentFlags().BoolVar(
+		&opts.annotateSource,
+		"annotate-source",
+		false,
+		"record the document each statement came from in its status notes",
+	)
+
+	mergeCmd.PersistentFlags().BoolVar(
+		&opts.requireJustify,
+		"require-justification",
+		false,
+		"fail when a not_affected statement has no justification or impact statement",
+	)
+
+	mergeCmd.PersistentFlags().StringSliceVar(
+		&opts.directories,
+		"directory",
+		[]string{},
+		"merge the *.vex.json and *.openvex.json documents found in this directory (can be repeated)",
+	)
+
+	mergeCmd.PersistentFlags().BoolVar(
+		&opts.recursive,
+		"recursive",
+		false,
+		"look for documents in the subdirectories of --directory",
+	)
+
+	mergeCmd.PersistentFlags().BoolVar(
+		&opts.keepGoing,
+		"keep-going",
+		false,
+		"skip documents that fail to load instead of aborting",
+	)
+
 	parentCmd.AddCommand(mergeCmd)
 }
@@ -14,6 +14,8 @@ import (
 
 	"github.com/openvex/go-vex/pkg/vex"
 	"github.com/spf13/cobra"
+
+	"github.com/openvex/vexctl/pkg/ctl"
 )
 
 type vexDocOptions struct {
@@ -269,6 +271,113 @@ func (of *outFileOption) Validate() error {
 	return nil
 }
 
+// registryOptions control how to talk to registries. The credentials
+// override the ones read from the docker config and the cloud credential
+// helpers.
+type registryOptions struct {
+	username      string
+	password      string
+	token         string
+	allowInsecure bool
+	plainHTTP     bool
+	retryAttempts int
+	retryBackoff  time.Duration
+	tagPrefix     string
+	tagSuffix     string
+}
+
+func (ro *registryOptions) Validate() error {
+	if ro.token != "" && (ro.username != "" || ro.password != "") {
+		return errors.New("--registry-token cannot be used with --registry-username or --registry-password")
+	}
+	if ro.retryAttempts < 1 {
+		return errors.New("--retry-attempts must be at least 1")
+	}
+	opts := ctl.Options{AttestationTagPrefix: ro.tagPrefix, AttestationTagSuffix: ro.tagSuffix}
+	if _, err := ctl.AttestationTag(opts, "sha256:"+strings.Repeat("0", 64)); err != nil {
+		return fmt.Errorf("checking --attestation-tag-prefix and --attestation-tag-suffix: %w", err)
+	}
+	return nil
+}
+
+func (ro *registryOptions) AddFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(
+		&ro.username,
+		"registry-username",
+		"",
+		"username to authenticate to the registry (default is to use the docker config)",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&ro.password,
+		"registry-password",
+		"",
+		"password to authenticate to the registry",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&ro.token,
+		"registry-token",
+		"",
+		"bearer token to authenticate to the registry",
+	)
+
+	cmd.PersistentFlags().BoolVar(
+		&ro.allowInsecure,
+		"allow-insecure-registry",
+		false,
+		"do not verify the registry TLS certificate (signatures are still verified)",
+	)
+
+	cmd.PersistentFlags().BoolVar(
+		&ro.plainHTTP,
+		"allow-http-registry",
+		false,
+		"allow talking to registries over plain HTTP",
+	)
+
+	cmd.PersistentFlags().IntVar(
+		&ro.retryAttempts,
+		"retry-attempts",
+		ctl.DefaultRetryAttempts,
+		"number of attempts of registry operations that fail with transient errors",
+	)
+
+	cmd.PersistentFlags().DurationVar(
+		&ro.retryBackoff,
+		"retry-backoff",
+		ctl.DefaultRetryBackoff,
+		"delay before retrying a failed registry operation, doubled on each retry",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&ro.tagPrefix,
+		"attestation-tag-prefix",
+		"",
+		"prefix of the tags attestations are stored in (<prefix>sha256-<digest>.<suffix>)",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&ro.tagSuffix,
+		"attestation-tag-suffix",
+		ctl.DefaultAttestationTagSuffix,
+		"suffix of the tags attestations are stored in (<prefix>sha256-<digest>.<suffix>)",
+	)
+}
+
+// Apply sets the registry options in the vexctl options
+func (ro *registryOptions) Apply(opts *ctl.Options) {
+	opts.RegistryUsername = ro.username
+	opts.RegistryPassword = ro.password
+	opts.RegistryToken = ro.token
+	opts.AllowInsecure = ro.allowInsecure
+	opts.PlainHTTP = ro.plainHTTP
+	opts.RetryAttempts = ro.retryAttempts
+	opts.RetryBackoff = ro.retryBackoff
+	opts.AttestationTagPrefix = ro.tagPrefix
+	opts.AttestationTagSuffix = ro.tagSuffix
+}
+
 func timeFromEnv() (time.Time, error) {
 	t := time.Now()
 	nt, err := vex.DateFromEnv()
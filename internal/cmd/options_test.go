@@ -11,6 +11,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/openvex/go-vex/pkg/vex"
 	"github.com/stretchr/testify/require"
@@ -179,3 +180,34 @@ func TestAddOptionsValidate(t *testing.T) {
 		})
 	}
 }
+
+func TestFilterOptionsValidate(t *testing.T) {
+	newOpts := func(watch bool, interval time.Duration) filterOptions {
+		return filterOptions{
+			reportFormat:    "vex",
+			suppression:     "remove",
+			registryOptions: registryOptions{retryAttempts: 1},
+			watch:           watch,
+			watchInterval:   interval,
+		}
+	}
+	for _, tc := range []struct {
+		name    string
+		sut     filterOptions
+		mustErr bool
+	}{
+		{"no watch", newOpts(false, 0), false},
+		{"watch", newOpts(true, time.Second), false},
+		{"zero watch interval", newOpts(true, 0), true},
+		{"negative watch interval", newOpts(true, -time.Second), true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.sut.Validate()
+			if tc.mustErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
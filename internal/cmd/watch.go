@@ -0,0 +1,108 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/openvex/vexctl/pkg/ctl"
+)
+
+// watchDebounce is how long the watched files need to stay unchanged
+// before filtering runs again. Editors often write files in several steps.
+const watchDebounce = 500 * time.Millisecond
+
+// fileState captures what we check to detect changes in a watched file
+type fileState struct {
+	exists  bool
+	modTime time.Time
+	size    int64
+}
+
+// statFiles returns the state of a list of files
+func statFiles(paths []string) map[string]fileState {
+	states := map[string]fileState{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			states[path] = fileState{}
+			continue
+		}
+		states[path] = fileState{exists: true, modTime: info.ModTime(), size: info.Size()}
+	}
+	return states
+}
+
+// watchFilter runs the filter and reruns it every time the report or the
+// local VEX files change until interrupted.
+func watchFilter(ctx context.Context, vexctl *ctl.VexCtl, reportPath string, vexURIs []string, interval time.Duration) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	// Only local files are watched, VEX data from images is read on each run
+	paths := []string{reportPath}
+	for _, uri := range vexURIs {
+		if _, err := os.Stat(uri); err == nil {
+			paths = append(paths, uri)
+		}
+	}
+
+	run := func() {
+		_, summary, err := vexctl.FilterFiles(ctx, reportPath, vexURIs)
+		if err != nil {
+			logrus.Warnf("Filtering failed, waiting for changes: %v", err)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "[%s] %s\n", time.Now().Format(time.TimeOnly), summary)
+	}
+
+	run()
+	last := statFiles(paths)
+	var changed time.Time
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		current := statFiles(paths)
+		for _, path := range paths {
+			if current[path] != last[path] {
+				changed = time.Now()
+				break
+			}
+		}
+		last = current
+
+		if changed.IsZero() || time.Since(changed) < watchDebounce {
+			continue
+		}
+
+		// Files may be deleted and recreated when saved, wait until they are back
+		missing := false
+		for _, path := range paths {
+			if !current[path].exists {
+				logrus.Debugf("Waiting for %s to be recreated", path)
+				missing = true
+			}
+		}
+		if missing {
+			continue
+		}
+
+		changed = time.Time{}
+		run()
+	}
+}
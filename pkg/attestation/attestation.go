@@ -17,10 +17,12 @@ import (
 	"github.com/google/go-containerregistry/pkg/crane"
 	intoto "github.com/in-toto/in-toto-golang/in_toto"
 	ovattest "github.com/openvex/go-vex/pkg/attestation"
+	"github.com/sigstore/cosign/v2/cmd/cosign/cli/generate"
 	"github.com/sigstore/cosign/v2/cmd/cosign/cli/options"
 	"github.com/sigstore/cosign/v2/cmd/cosign/cli/rekor"
 	"github.com/sigstore/cosign/v2/cmd/cosign/cli/sign"
 	"github.com/sigstore/cosign/v2/pkg/cosign"
+	sigs "github.com/sigstore/cosign/v2/pkg/signature"
 	"github.com/sigstore/rekor/pkg/generated/models"
 	"github.com/sigstore/sigstore/pkg/signature/dsse"
 	signatureoptions "github.com/sigstore/sigstore/pkg/signature/options"
@@ -50,6 +52,10 @@ type SignatureData struct {
 	// signedPayload contains the resulting blob after the attestation was
 	// signed.
 	signedPayload []byte
+
+	// publicKey is the PEM encoded public key of the signer, it is used to
+	// record signatures made with keys (which have no cert) in rekor.
+	publicKey []byte
 }
 
 func New() *Attestation {
@@ -62,14 +68,97 @@ func New() *Attestation {
 // Sign the attestation
 func (att *Attestation) Sign() error {
 	ctx, ko := initSigning()
+	return att.sign(ctx, &ko)
+}
+
+// SignWithKey signs the attestation with the cosign key in keyRef. The key
+// can be a file path, a KMS URI (eg awskms://, gcpkms://, hashivault://) or
+// a kubernetes secret (k8s://). When keyRef is empty, the attestation is
+// signed with the keyless flow just like Sign.
+func (att *Attestation) SignWithKey(ctx context.Context, keyRef string) error {
+	return att.SignWithOptions(ctx, keyRef, SigningOptions{})
+}
+
+// SigningOptions point keyless signing to a sigstore instance. Empty
+// fields take the values of the public sigstore instance.
+type SigningOptions struct {
+	FulcioURL    string // Fulcio instance that issues the signing certificate
+	RekorURL     string // Rekor transparency log where signatures are recorded
+	OIDCIssuer   string // Issuer of the OIDC tokens used in the interactive flow
+	OIDCClientID string // OIDC client ID used in the interactive flow
+
+	// IdentityToken is an OIDC token to exchange for the signing
+	// certificate. When empty, ambient credentials (eg in GitHub Actions)
+	// are used if available, falling back to the interactive flow.
+	IdentityToken string
+
+	// SkipTlogUpload signs without recording the signature in the Rekor
+	// transparency log. It can be uploaded later with UploadToTlog.
+	SkipTlogUpload bool
+}
+
+// SignWithOptions signs the attestation with the key in keyRef or, when
+// keyRef is empty, with a certificate issued by Fulcio. The certificate and
+// its chain are kept in the SignatureData so they are attached along with
+// the DSSE envelope and can be used to verify the signer identity.
+func (att *Attestation) SignWithOptions(ctx context.Context, keyRef string, opts SigningOptions) error {
+	_, ko := initSigning()
+	ko.KeyRef = keyRef
+	ko.PassFunc = generate.GetPass
+	ko.IDToken = opts.IdentityToken
+	if opts.FulcioURL != "" {
+		ko.FulcioURL = opts.FulcioURL
+	}
+	if opts.RekorURL != "" {
+		ko.RekorURL = opts.RekorURL
+	}
+	if opts.OIDCIssuer != "" {
+		ko.OIDCIssuer = opts.OIDCIssuer
+	}
+	if opts.OIDCClientID != "" {
+		ko.OIDCClientID = opts.OIDCClientID
+	}
+	if opts.SkipTlogUpload {
+		if err := signAttestation(ctx, &ko, att); err != nil {
+			return fmt.Errorf("signing attestation: %w", err)
+		}
+		return nil
+	}
+	return att.sign(ctx, &ko)
+}
+
+// UploadToTlog records the signed attestation in the Rekor instance at
+// rekorURL (the public instance when empty) and keeps the log entry in the
+// SignatureData. Attestations that already have an entry are not uploaded
+// again.
+func (att *Attestation) UploadToTlog(ctx context.Context, rekorURL string) error {
+	if !att.Signed || att.SignatureData == nil {
+		return errors.New("attestation has to be signed before recording it in the transparency log")
+	}
+	if att.SignatureData.Entry != nil {
+		return nil
+	}
+	_, ko := initSigning()
+	if rekorURL != "" {
+		ko.RekorURL = rekorURL
+	}
+	if err := appendSignatureDataToTLog(ctx, &ko, att); err != nil {
+		return fmt.Errorf("recording signature data to transparency log: %w", err)
+	}
+	return nil
+}
 
+// sign signs the attestation and records the signature in rekor
+func (att *Attestation) sign(ctx context.Context, ko *options.KeyOpts) error {
 	// Sign the attestaion.
-	if err := signAttestation(ctx, &ko, att); err != nil {
+	if err := signAttestation(ctx, ko, att); err != nil {
 		return fmt.Errorf("signing attestation: %w", err)
 	}
 
-	// Register the signature in rekor
-	if err := appendSignatureDataToTLog(ctx, &ko, att); err != nil {
+	// Register the signature in rekor. If uploading fails, the signature
+	// data is destroyed to keep signing atomic.
+	if err := appendSignatureDataToTLog(ctx, ko, att); err != nil {
+		att.SignatureData = nil
 		return fmt.Errorf("recording signature data to transparency log: %w", err)
 	}
 
@@ -164,11 +253,22 @@ func signAttestation(ctx context.Context, ko *options.KeyOpts, att *Attestation)
 		return fmt.Errorf("signing attestation: %w", err)
 	}
 
+	// Signatures made with a key have no certificate, the public key
+	// is needed to record them in the transparency log.
+	var publicKey []byte
+	if len(sv.Cert) == 0 {
+		publicKey, err = sigs.PublicKeyPem(sv, signatureoptions.WithContext(ctx))
+		if err != nil {
+			return fmt.Errorf("getting signer public key: %w", err)
+		}
+	}
+
 	// Assign the new data to the attestation
 	att.SignatureData = &SignatureData{
 		CertData:      sv.Cert,
 		Chain:         sv.Chain,
 		signedPayload: signedPayload,
+		publicKey:     publicKey,
 	}
 	att.Signed = true
 
@@ -178,21 +278,21 @@ func signAttestation(ctx context.Context, ko *options.KeyOpts, att *Attestation)
 // appendSignatureDataToTLog records the signature data to the transparency log
 // (rekor). The proof of inclusion will be added to the attestation's SignatureData
 // struct.
-// If uploading fails, the signature data will be destroyed to guarantee an atomic
-// operation of attesation.Sign()
 func appendSignatureDataToTLog(ctx context.Context, ko *options.KeyOpts, att *Attestation) error {
 	tlogClient, err := rekor.NewClient(ko.RekorURL)
 	if err != nil {
-		att.SignatureData = nil
 		return fmt.Errorf("creating rekor client: %w", err)
 	}
 
 	// ...and upload the signature data
+	verifier := att.SignatureData.CertData
+	if len(verifier) == 0 {
+		verifier = att.SignatureData.publicKey
+	}
 	entry, err := cosign.TLogUploadDSSEEnvelope(
-		ctx, tlogClient, att.SignatureData.signedPayload, att.SignatureData.CertData,
+		ctx, tlogClient, att.SignatureData.signedPayload, verifier,
 	)
 	if err != nil {
-		att.SignatureData = nil
 		return fmt.Errorf("uploading to transparency log: %w", err)
 	}
 
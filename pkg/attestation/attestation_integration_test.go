@@ -0,0 +1,57 @@
+//go:build integration
+
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package attestation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/stretchr/testify/require"
+)
+
+// stagingSigstore points keyless signing to the sigstore staging instance.
+// The cosign TUF root must be initialized with the staging mirror:
+//
+//	cosign initialize --mirror=https://tuf-repo-cdn.sigstage.dev --root=root.json
+var stagingSigstore = SigningOptions{
+	FulcioURL:  "https://fulcio.sigstage.dev",
+	RekorURL:   "https://rekor.sigstage.dev",
+	OIDCIssuer: "https://oauth2.sigstage.dev/auth",
+}
+
+func TestSignKeylessStaging(t *testing.T) {
+	opts := stagingSigstore
+	opts.IdentityToken = os.Getenv("SIGSTORE_ID_TOKEN")
+	if opts.IdentityToken == "" && os.Getenv("ACTIONS_ID_TOKEN_REQUEST_URL") == "" {
+		t.Skip("no OIDC token available, set SIGSTORE_ID_TOKEN or run in GitHub Actions")
+	}
+
+	att := New()
+	require.NoError(t, att.AddSubjects([]intoto.Subject{
+		{Name: "example.com/test", Digest: map[string]string{"sha256": "0000000000000000000000000000000000000000000000000000000000000000"}},
+	}))
+
+	require.NoError(t, att.SignWithOptions(context.Background(), "", opts))
+	require.True(t, att.Signed)
+	require.NotEmpty(t, att.SignatureData.CertData)
+	require.NotNil(t, att.SignatureData.Entry)
+
+	var b bytes.Buffer
+	require.NoError(t, att.ToJSON(&b))
+	envelope := struct {
+		PayloadType string `json:"payloadType"`
+		Signatures  []any  `json:"signatures"`
+	}{}
+	require.NoError(t, json.Unmarshal(b.Bytes(), &envelope))
+	require.Equal(t, "application/vnd.in-toto+json", envelope.PayloadType)
+	require.Len(t, envelope.Signatures, 1)
+}
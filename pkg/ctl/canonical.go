@@ -0,0 +1,62 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/openvex/vexctl/pkg/attestation"
+)
+
+// CanonicalAttestationBytes serializes an attestation, or its DSSE envelope
+// when signed, as canonical JSON: object keys are sorted and insignificant
+// whitespace is removed, so the same logical attestation always produces
+// the same bytes.
+func CanonicalAttestationBytes(att *attestation.Attestation) ([]byte, error) {
+	var b bytes.Buffer
+	if err := att.ToJSON(&b); err != nil {
+		return nil, fmt.Errorf("serializing attestation to json: %w", err)
+	}
+	data, err := canonicalJSON(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("canonicalizing attestation: %w", err)
+	}
+	return data, nil
+}
+
+// canonicalJSON rewrites the stream of JSON values in data with sorted
+// object keys and no insignificant whitespace. Values are separated by
+// newlines.
+func canonicalJSON(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	for {
+		var v any
+		err := decoder.Decode(&v)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decoding json: %w", err)
+		}
+		// The encoder sorts map keys and ends each value with a newline
+		if err := encoder.Encode(v); err != nil {
+			return nil, fmt.Errorf("encoding json: %w", err)
+		}
+	}
+	if b.Len() == 0 {
+		return nil, errors.New("no json data to canonicalize")
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), nil
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openvex/go-vex/pkg/vex"
+	"github.com/openvex/vexctl/pkg/attestation"
+)
+
+func TestCanonicalAttestationBytes(t *testing.T) {
+	ts := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// Build the attestation setting its fields
+	built := attestation.New()
+	built.Predicate = vex.New()
+	built.Predicate.ID = "https://example.com/vex/1"
+	built.Predicate.Author = "Jane <jane@example.com>"
+	built.Predicate.Timestamp = &ts
+	built.Predicate.Statements = []vex.Statement{{
+		Vulnerability: vex.Vulnerability{Name: "CVE-2024-1234"},
+		Products:      []vex.Product{{Component: vex.Component{ID: "pkg:oci/test"}}},
+		Status:        vex.StatusFixed,
+	}}
+	require.NoError(t, built.AddSubjects([]intoto.Subject{
+		{Name: "example.com/test", Digest: map[string]string{"sha256": "abc", "sha512": "def"}},
+	}))
+
+	// Decode it again from indented JSON with its keys in another order
+	var b bytes.Buffer
+	require.NoError(t, built.ToJSON(&b))
+	generic := map[string]any{}
+	require.NoError(t, json.Unmarshal(b.Bytes(), &generic))
+	indented, err := json.MarshalIndent(generic, "", "    ")
+	require.NoError(t, err)
+	decoded := attestation.New()
+	require.NoError(t, json.Unmarshal(indented, decoded))
+
+	a, err := CanonicalAttestationBytes(built)
+	require.NoError(t, err)
+	c, err := CanonicalAttestationBytes(decoded)
+	require.NoError(t, err)
+	require.Equal(t, string(a), string(c))
+	require.NotContains(t, string(a), "\n")
+	require.Contains(t, string(a), `"author":"Jane <jane@example.com>"`)
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	a, err := canonicalJSON([]byte(`{"b": 1, "a": {"d": [1, 2.50], "c": "x"}}`))
+	require.NoError(t, err)
+	b, err := canonicalJSON([]byte("{\n  \"a\": {\"c\": \"x\", \"d\": [1, 2.50]},\n  \"b\": 1\n}\n"))
+	require.NoError(t, err)
+	require.Equal(t, `{"a":{"c":"x","d":[1,2.50]},"b":1}`, string(a))
+	require.Equal(t, a, b)
+
+	_, err = canonicalJSON([]byte(""))
+	require.Error(t, err)
+	_, err = canonicalJSON([]byte(`{"a":`))
+	require.Error(t, err)
+}
@@ -0,0 +1,620 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// csafDocument is a CSAF 2.0 document in the VEX profile (csaf_vex)
+//
+// https://docs.oasis-open.org/csaf/csaf/v2.0/os/csaf-v2.0-os.html#45-profile-5-vex
+type csafDocument struct {
+	Document        csafMetadata        `json:"document"`
+	ProductTree     csafProductTree     `json:"product_tree"`
+	Vulnerabilities []csafVulnerability `json:"vulnerabilities"`
+}
+
+type csafMetadata struct {
+	Category    string          `json:"category"`
+	CSAFVersion string          `json:"csaf_version"`
+	Notes       []csafNote      `json:"notes"`
+	Publisher   csafPublisher   `json:"publisher"`
+	References  []csafReference `json:"references,omitempty"`
+	Title       string          `json:"title"`
+	Tracking    csafTracking    `json:"tracking"`
+}
+
+type csafNote struct {
+	Category string `json:"category"`
+	Text     string `json:"text"`
+	Title    string `json:"title,omitempty"`
+}
+
+type csafPublisher struct {
+	Category  string `json:"category"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+type csafReference struct {
+	Category string `json:"category"`
+	Summary  string `json:"summary"`
+	URL      string `json:"url"`
+}
+
+type csafTracking struct {
+	CurrentReleaseDate string         `json:"current_release_date"`
+	ID                 string         `json:"id"`
+	InitialReleaseDate string         `json:"initial_release_date"`
+	RevisionHistory    []csafRevision `json:"revision_history"`
+	Status             string         `json:"status"`
+	Version            string         `json:"version"`
+}
+
+type csafRevision struct {
+	Date    string `json:"date"`
+	Number  string `json:"number"`
+	Summary string `json:"summary"`
+}
+
+type csafProductTree struct {
+	Branches         []csafBranch       `json:"branches,omitempty"`
+	FullProductNames []csafProduct      `json:"full_product_names,omitempty"`
+	Relationships    []csafRelationship `json:"relationships,omitempty"`
+	ProductGroups    []csafProductGroup `json:"product_groups,omitempty"`
+}
+
+type csafBranch struct {
+	Category string       `json:"category"`
+	Name     string       `json:"name"`
+	Branches []csafBranch `json:"branches,omitempty"`
+	Product  *csafProduct `json:"product,omitempty"`
+}
+
+type csafRelationship struct {
+	FullProductName csafProduct `json:"full_product_name"`
+}
+
+type csafProductGroup struct {
+	GroupID    string   `json:"group_id"`
+	ProductIDs []string `json:"product_ids"`
+}
+
+type csafProduct struct {
+	Name                 string         `json:"name"`
+	ProductID            string         `json:"product_id"`
+	IdentificationHelper map[string]any `json:"product_identification_helper,omitempty"`
+}
+
+type csafVulnerability struct {
+	CVE           string              `json:"cve,omitempty"`
+	IDs           []csafID            `json:"ids,omitempty"`
+	Notes         []csafNote          `json:"notes"`
+	ProductStatus map[string][]string `json:"product_status"`
+	Flags         []csafFlag          `json:"flags,omitempty"`
+	Threats       []csafThreat        `json:"threats,omitempty"`
+	Remediations  []csafRemediation   `json:"remediations,omitempty"`
+}
+
+type csafID struct {
+	SystemName string `json:"system_name"`
+	Text       string `json:"text"`
+}
+
+type csafFlag struct {
+	Label      string   `json:"label"`
+	GroupIDs   []string `json:"group_ids,omitempty"`
+	ProductIDs []string `json:"product_ids,omitempty"`
+}
+
+type csafThreat struct {
+	Category   string   `json:"category"`
+	Details    string   `json:"details"`
+	GroupIDs   []string `json:"group_ids,omitempty"`
+	ProductIDs []string `json:"product_ids,omitempty"`
+}
+
+type csafRemediation struct {
+	Category   string   `json:"category"`
+	Details    string   `json:"details"`
+	GroupIDs   []string `json:"group_ids,omitempty"`
+	ProductIDs []string `json:"product_ids,omitempty"`
+}
+
+// csafProductStatuses maps the VEX statuses to the CSAF product status
+// categories.
+var csafProductStatuses = map[vex.Status]string{
+	vex.StatusNotAffected:        "known_not_affected",
+	vex.StatusAffected:           "known_affected",
+	vex.StatusFixed:              "fixed",
+	vex.StatusUnderInvestigation: "under_investigation",
+}
+
+// cveRegexp matches the vulnerability names that go in the CSAF cve field
+var cveRegexp = regexp.MustCompile(`^CVE-[0-9]{4}-[0-9]{4,}$`)
+
+// ToCSAF renders a VEX document as a CSAF 2.0 document in the VEX profile.
+// Products are listed in the product tree using their VEX identifier as the
+// CSAF product ID, with their purl or CPE as identification helper. The
+// statements about a vulnerability are grouped in one CSAF vulnerability,
+// not_affected justifications become flags with the same label, impact
+// statements threats of category impact and action statements
+// remediations. When a document has several statements about the same
+// product and vulnerability, the latest one is exported.
+func ToCSAF(doc *vex.VEX) ([]byte, error) {
+	if doc == nil {
+		return nil, errors.New("cannot render CSAF, vex document is nil")
+	}
+	if doc.ID == "" {
+		return nil, errors.New("cannot render CSAF, vex document has no ID")
+	}
+
+	docTime := time.Now().UTC()
+	if doc.Timestamp != nil {
+		docTime = doc.Timestamp.UTC()
+	}
+	currentTime := docTime
+	if doc.LastUpdated != nil {
+		currentTime = doc.LastUpdated.UTC()
+	}
+	version := doc.Version
+	if version < 1 {
+		version = 1
+	}
+	author := doc.Author
+	if author == "" {
+		author = vex.DefaultAuthor
+	}
+
+	csafDoc := csafDocument{
+		Document: csafMetadata{
+			Category:    "csaf_vex",
+			CSAFVersion: "2.0",
+			Notes: []csafNote{{
+				Category: "summary",
+				Text:     fmt.Sprintf("VEX data exported from the OpenVEX document %s", doc.ID),
+				Title:    "OpenVEX document",
+			}},
+			Publisher: csafPublisher{
+				Category:  "other",
+				Name:      author,
+				Namespace: csafNamespace(doc.ID),
+			},
+			Title: fmt.Sprintf("VEX data for %s", doc.ID),
+			Tracking: csafTracking{
+				CurrentReleaseDate: currentTime.Format(time.RFC3339),
+				ID:                 doc.ID,
+				InitialReleaseDate: docTime.Format(time.RFC3339),
+				RevisionHistory: []csafRevision{{
+					Date:    currentTime.Format(time.RFC3339),
+					Number:  strconv.Itoa(version),
+					Summary: "Exported from OpenVEX",
+				}},
+				Status:  "final",
+				Version: strconv.Itoa(version),
+			},
+		},
+		ProductTree:     csafProductTree{Branches: []csafBranch{}},
+		Vulnerabilities: []csafVulnerability{},
+	}
+	if u, err := url.Parse(doc.ID); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		csafDoc.Document.References = []csafReference{{
+			Category: "external",
+			Summary:  "OpenVEX document",
+			URL:      doc.ID,
+		}}
+	}
+
+	latest, components, err := latestProductStatements(doc, docTime)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range sortedKeys(components) {
+		product := csafProductFromComponent(components[id])
+		csafDoc.ProductTree.Branches = append(csafDoc.ProductTree.Branches, csafBranch{
+			Category: "product_name",
+			Name:     product.Name,
+			Product:  &product,
+		})
+	}
+	for _, name := range sortedKeys(latest) {
+		csafDoc.Vulnerabilities = append(csafDoc.Vulnerabilities, csafVulnerabilityFromStatements(name, latest[name]))
+	}
+
+	data, err := json.MarshalIndent(csafDoc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshaling CSAF document: %w", err)
+	}
+	return data, nil
+}
+
+// latestProductStatements returns the latest statement about each product
+// and vulnerability in the document, indexed by vulnerability name and
+// product identifier, and the components of the products. Statements without
+// a timestamp are dated docTime.
+func latestProductStatements(doc *vex.VEX, docTime time.Time) (
+	latest map[string]map[string]*vex.Statement, components map[string]*vex.Component, err error,
+) {
+	// Statements are sorted oldest first so later ones replace them
+	statements := make([]*vex.Statement, 0, len(doc.Statements))
+	for i := range doc.Statements {
+		statements = append(statements, &doc.Statements[i])
+	}
+	statementTime := func(s *vex.Statement) time.Time {
+		if s.Timestamp != nil {
+			return *s.Timestamp
+		}
+		return docTime
+	}
+	sort.SliceStable(statements, func(i, j int) bool {
+		return statementTime(statements[i]).Before(statementTime(statements[j]))
+	})
+
+	latest = map[string]map[string]*vex.Statement{}
+	components = map[string]*vex.Component{}
+	for _, s := range statements {
+		if !s.Status.Valid() {
+			return nil, nil, fmt.Errorf("statement for %s has invalid status %q", s.Vulnerability.Name, s.Status)
+		}
+		name := string(s.Vulnerability.Name)
+		if _, ok := latest[name]; !ok {
+			latest[name] = map[string]*vex.Statement{}
+		}
+		for i := range s.Products {
+			id := productIdentifier(&s.Products[i].Component)
+			if id == "" {
+				continue
+			}
+			components[id] = &s.Products[i].Component
+			latest[name][id] = s
+		}
+	}
+	return latest, components, nil
+}
+
+// csafVulnerabilityFromStatements builds the CSAF vulnerability entry from
+// the latest statement about each product.
+func csafVulnerabilityFromStatements(name string, statements map[string]*vex.Statement) csafVulnerability {
+	v := csafVulnerability{ProductStatus: map[string][]string{}}
+	if cveRegexp.MatchString(name) {
+		v.CVE = name
+	} else {
+		v.IDs = []csafID{{SystemName: "OpenVEX", Text: name}}
+	}
+
+	productIDs := sortedKeys(statements)
+	description := name
+	notes := map[string][]string{}
+	flags := map[string][]string{}
+	threats := map[string][]string{}
+	remediations := map[string][]string{}
+	for _, id := range productIDs {
+		s := statements[id]
+		category := csafProductStatuses[s.Status]
+		v.ProductStatus[category] = append(v.ProductStatus[category], id)
+		if s.Vulnerability.Description != "" {
+			description = s.Vulnerability.Description
+		}
+		if s.StatusNotes != "" {
+			notes[s.StatusNotes] = append(notes[s.StatusNotes], id)
+		}
+		switch s.Status {
+		case vex.StatusNotAffected:
+			if s.Justification != "" {
+				flags[string(s.Justification)] = append(flags[string(s.Justification)], id)
+			}
+			if s.ImpactStatement != "" {
+				threats[s.ImpactStatement] = append(threats[s.ImpactStatement], id)
+			}
+		case vex.StatusAffected:
+			details := s.ActionStatement
+			if details == "" {
+				details = "No action statement provided"
+			}
+			remediations[details] = append(remediations[details], id)
+		}
+	}
+
+	v.Notes = []csafNote{{Category: "description", Text: description, Title: "Vulnerability description"}}
+	for _, text := range sortedKeys(notes) {
+		v.Notes = append(v.Notes, csafNote{Category: "details", Text: text, Title: "Status notes"})
+	}
+	for _, label := range sortedKeys(flags) {
+		v.Flags = append(v.Flags, csafFlag{Label: label, ProductIDs: flags[label]})
+	}
+	for _, details := range sortedKeys(threats) {
+		v.Threats = append(v.Threats, csafThreat{Category: "impact", Details: details, ProductIDs: threats[details]})
+	}
+	for _, details := range sortedKeys(remediations) {
+		v.Remediations = append(v.Remediations, csafRemediation{
+			Category: "workaround", Details: details, ProductIDs: remediations[details],
+		})
+	}
+	return v
+}
+
+// csafProductFromComponent returns the CSAF product for a VEX component. Its
+// purl and CPE are set as the identification helpers.
+func csafProductFromComponent(c *vex.Component) csafProduct {
+	id := productIdentifier(c)
+	p := csafProduct{Name: id, ProductID: id}
+	helpers := map[string]any{}
+	for t, ident := range c.Identifiers {
+		switch t {
+		case vex.PURL:
+			helpers["purl"] = ident
+		case vex.CPE22, vex.CPE23:
+			helpers["cpe"] = ident
+		}
+	}
+	if _, ok := helpers["purl"]; !ok && strings.HasPrefix(c.ID, "pkg:") {
+		helpers["purl"] = c.ID
+	}
+	if _, ok := helpers["cpe"]; !ok && strings.HasPrefix(c.ID, "cpe:") {
+		helpers["cpe"] = c.ID
+	}
+	if len(helpers) > 0 {
+		p.IdentificationHelper = helpers
+	}
+	return p
+}
+
+// csafNamespace returns the publisher namespace for a document, the origin
+// of its ID when it is a URL.
+func csafNamespace(docID string) string {
+	if u, err := url.Parse(docID); err == nil && u.Scheme != "" && u.Host != "" {
+		return fmt.Sprintf("%s://%s", u.Scheme, u.Host)
+	}
+	return vex.DefaultNamespace
+}
+
+// sortedKeys returns the keys of a map sorted
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// vexStatusesFromCSAF maps the CSAF product status categories to VEX
+// statuses. The recommended category has no VEX equivalent.
+var vexStatusesFromCSAF = map[string]vex.Status{
+	"known_not_affected":  vex.StatusNotAffected,
+	"known_affected":      vex.StatusAffected,
+	"first_affected":      vex.StatusAffected,
+	"last_affected":       vex.StatusAffected,
+	"fixed":               vex.StatusFixed,
+	"first_fixed":         vex.StatusFixed,
+	"under_investigation": vex.StatusUnderInvestigation,
+}
+
+// csafStatusOrder is the order statements are created in for each
+// vulnerability.
+var csafStatusOrder = []string{
+	"known_not_affected", "known_affected", "first_affected", "last_affected",
+	"fixed", "first_fixed", "under_investigation", "recommended",
+}
+
+// FromCSAF parses a CSAF 2.0 document and returns its VEX data as an OpenVEX
+// document. Each vulnerability gets a statement for each status of the
+// products in it, products with the same justification, impact and action
+// statements are grouped in the same statement. Products are identified by
+// the purl in their identification helper or, when they don't have one, by
+// their CSAF product ID. Justifications are read from the flags, impact
+// statements from the threats of category impact and action statements from
+// the remediations. Data that cannot be mapped is logged as a warning.
+func FromCSAF(data []byte) (*vex.VEX, error) {
+	return FromCSAFWithOptions(data, Options{})
+}
+
+// FromCSAFWithOptions is like FromCSAF but logs the warnings about the data
+// that cannot be mapped to opts.Logger.
+func FromCSAFWithOptions(data []byte, opts Options) (*vex.VEX, error) {
+	log := opts.log()
+	csafDoc := csafDocument{}
+	if err := json.Unmarshal(data, &csafDoc); err != nil {
+		return nil, fmt.Errorf("parsing CSAF document: %w", err)
+	}
+	if csafDoc.Document.CSAFVersion == "" {
+		return nil, errors.New("document is not CSAF, csaf_version is missing")
+	}
+
+	doc := vex.New()
+	doc.ID = csafDoc.Document.Tracking.ID
+	if csafDoc.Document.Publisher.Name != "" {
+		doc.Author = csafDoc.Document.Publisher.Name
+		doc.AuthorRole = csafDoc.Document.Publisher.Category
+	}
+	if v, err := strconv.Atoi(csafDoc.Document.Tracking.Version); err == nil {
+		doc.Version = v
+	}
+	if t, err := time.Parse(time.RFC3339, csafDoc.Document.Tracking.InitialReleaseDate); err == nil {
+		doc.Timestamp = &t
+	}
+	if t, err := time.Parse(time.RFC3339, csafDoc.Document.Tracking.CurrentReleaseDate); err == nil {
+		doc.LastUpdated = &t
+	}
+
+	products := csafDoc.ProductTree.products()
+	groups := map[string][]string{}
+	for _, g := range csafDoc.ProductTree.ProductGroups {
+		groups[g.GroupID] = g.ProductIDs
+	}
+	// expand returns the products referenced directly and through groups
+	expand := func(productIDs, groupIDs []string) []string {
+		ids := slices.Clone(productIDs)
+		for _, g := range groupIDs {
+			if _, ok := groups[g]; !ok {
+				log.Warnf("CSAF product group %s is not defined in the product tree", g)
+			}
+			ids = append(ids, groups[g]...)
+		}
+		return ids
+	}
+
+	for _, v := range csafDoc.Vulnerabilities {
+		vuln := vex.Vulnerability{}
+		switch {
+		case v.CVE != "":
+			vuln.Name = vex.VulnerabilityID(v.CVE)
+		case len(v.IDs) > 0:
+			vuln.Name = vex.VulnerabilityID(v.IDs[0].Text)
+		default:
+			log.Warnf("Skipping CSAF vulnerability without cve or ids")
+			continue
+		}
+		for _, id := range v.IDs {
+			if id.Text != string(vuln.Name) {
+				vuln.Aliases = append(vuln.Aliases, vex.VulnerabilityID(id.Text))
+			}
+		}
+		for _, n := range v.Notes {
+			if n.Category == "description" && n.Text != string(vuln.Name) {
+				vuln.Description = n.Text
+			}
+		}
+
+		justifications := map[string]vex.Justification{}
+		for _, f := range v.Flags {
+			j := vex.Justification(f.Label)
+			if !j.Valid() {
+				log.Warnf("Ignoring CSAF flag %q in %s, it is not a VEX justification", f.Label, vuln.Name)
+				continue
+			}
+			for _, id := range expand(f.ProductIDs, f.GroupIDs) {
+				justifications[id] = j
+			}
+		}
+		impacts := map[string]string{}
+		for _, t := range v.Threats {
+			if t.Category != "impact" {
+				continue
+			}
+			for _, id := range expand(t.ProductIDs, t.GroupIDs) {
+				impacts[id] = t.Details
+			}
+		}
+		actions := map[string]string{}
+		for _, r := range v.Remediations {
+			for _, id := range expand(r.ProductIDs, r.GroupIDs) {
+				if actions[id] != "" {
+					actions[id] += "\n"
+				}
+				actions[id] += r.Details
+			}
+		}
+
+		for category := range v.ProductStatus {
+			if !slices.Contains(csafStatusOrder, category) {
+				log.Warnf("Ignoring unknown CSAF product status %q in %s", category, vuln.Name)
+			}
+		}
+		for _, category := range csafStatusOrder {
+			productIDs := v.ProductStatus[category]
+			if len(productIDs) == 0 {
+				continue
+			}
+			status, ok := vexStatusesFromCSAF[category]
+			if !ok {
+				log.Warnf("Ignoring %d %s products in %s, the status has no VEX equivalent", len(productIDs), category, vuln.Name)
+				continue
+			}
+
+			// Products with the same details share a statement
+			statements := map[string]*vex.Statement{}
+			keys := []string{}
+			for _, id := range productIDs {
+				s := vex.Statement{Vulnerability: vuln, Status: status}
+				switch status {
+				case vex.StatusNotAffected:
+					s.Justification = justifications[id]
+					s.ImpactStatement = impacts[id]
+					if s.Justification == "" && s.ImpactStatement == "" {
+						log.Warnf("%s is not affected by %s but has no justification or impact statement", id, vuln.Name)
+					}
+				case vex.StatusAffected:
+					s.ActionStatement = actions[id]
+				}
+				key := fmt.Sprintf("%s\x00%s\x00%s", s.Justification, s.ImpactStatement, s.ActionStatement)
+				if _, ok := statements[key]; !ok {
+					statements[key] = &s
+					keys = append(keys, key)
+				}
+				statements[key].Products = append(statements[key].Products, csafVEXProduct(log, id, products))
+			}
+			for _, key := range keys {
+				doc.Statements = append(doc.Statements, *statements[key])
+			}
+		}
+	}
+	return &doc, nil
+}
+
+// products returns the products defined in the product tree indexed by
+// their product ID.
+func (tree *csafProductTree) products() map[string]csafProduct {
+	products := map[string]csafProduct{}
+	var walk func([]csafBranch)
+	walk = func(branches []csafBranch) {
+		for _, b := range branches {
+			if b.Product != nil {
+				products[b.Product.ProductID] = *b.Product
+			}
+			walk(b.Branches)
+		}
+	}
+	walk(tree.Branches)
+	for _, p := range tree.FullProductNames {
+		products[p.ProductID] = p
+	}
+	for _, r := range tree.Relationships {
+		products[r.FullProductName.ProductID] = r.FullProductName
+	}
+	return products
+}
+
+// csafVEXProduct returns the VEX product for a CSAF product ID. The purl and
+// CPE in the product identification helper are added as identifiers.
+func csafVEXProduct(log logrus.FieldLogger, id string, products map[string]csafProduct) vex.Product {
+	product := vex.Product{Component: vex.Component{ID: id}}
+	p, ok := products[id]
+	if !ok {
+		log.Warnf("CSAF product %s is not defined in the product tree", id)
+		return product
+	}
+	identifiers := map[vex.IdentifierType]string{}
+	if purl, ok := p.IdentificationHelper["purl"].(string); ok && purl != "" {
+		identifiers[vex.PURL] = purl
+		product.ID = purl
+	}
+	if cpe, ok := p.IdentificationHelper["cpe"].(string); ok && cpe != "" {
+		t := vex.CPE23
+		if strings.HasPrefix(cpe, "cpe:/") {
+			t = vex.CPE22
+		}
+		identifiers[t] = cpe
+	}
+	if len(identifiers) > 0 {
+		product.Identifiers = identifiers
+	}
+	return product
+}
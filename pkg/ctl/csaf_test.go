@@ -0,0 +1,184 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+func TestToCSAF(t *testing.T) {
+	doc, err := vex.Open("testdata/export.openvex.json")
+	require.NoError(t, err)
+
+	data, err := ToCSAF(doc)
+	require.NoError(t, err)
+	golden, err := os.ReadFile("testdata/csaf/export.csaf.json")
+	require.NoError(t, err)
+	require.JSONEq(t, string(golden), string(data))
+	requireValidJSON(t, data, "https://docs.oasis-open.org/csaf/csaf/v2.0/csaf_json_schema.json", map[string]string{
+		"https://docs.oasis-open.org/csaf/csaf/v2.0/csaf_json_schema.json": "testdata/csaf/schema/csaf_json_schema.json",
+		"https://www.first.org/cvss/cvss-v2.0.json":                        "testdata/csaf/schema/cvss-v2.0.json",
+		"https://www.first.org/cvss/cvss-v3.0.json":                        "testdata/csaf/schema/cvss-v3.0.json",
+		"https://www.first.org/cvss/cvss-v3.1.json":                        "testdata/csaf/schema/cvss-v3.1.json",
+	})
+
+	// The CSAF reader gets back the latest status of each product
+	path := filepath.Join(t.TempDir(), "export.csaf.json")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	csafDoc, err := vex.Open(path)
+	require.NoError(t, err)
+
+	statuses := []string{}
+	for _, s := range csafDoc.Statements {
+		// The CSAF reader only reads the cve field, not other IDs
+		if s.Vulnerability.Name == "" {
+			continue
+		}
+		require.Len(t, s.Products, 1)
+		statuses = append(statuses, string(s.Vulnerability.Name)+" "+s.Products[0].ID+" "+string(s.Status))
+	}
+	sort.Strings(statuses)
+	require.Equal(t, []string{
+		"CVE-2023-1234 pkg:apk/wolfi/bash@1.0.0 not_affected",
+		"CVE-2023-1234 pkg:oci/test@sha256%3A74634d9736a45ca9f6e1187e783492199e020f4a5c19d0b1abc2b604f894ac99 not_affected",
+		"CVE-2023-5678 glibc affected",
+		"CVE-2023-5678 pkg:apk/wolfi/bash@1.0.0 fixed",
+	}, statuses)
+
+	// FromCSAF also reads the other vulnerability IDs
+	imported, err := FromCSAF(data)
+	require.NoError(t, err)
+	statuses = []string{}
+	for _, s := range imported.Statements {
+		for _, p := range s.Products {
+			statuses = append(statuses, string(s.Vulnerability.Name)+" "+p.ID+" "+string(s.Status))
+		}
+	}
+	sort.Strings(statuses)
+	require.Equal(t, []string{
+		"CVE-2023-1234 pkg:apk/wolfi/bash@1.0.0 not_affected",
+		"CVE-2023-1234 pkg:oci/test@sha256%3A74634d9736a45ca9f6e1187e783492199e020f4a5c19d0b1abc2b604f894ac99 not_affected",
+		"CVE-2023-5678 glibc affected",
+		"CVE-2023-5678 pkg:apk/wolfi/bash@1.0.0 fixed",
+		"GHSA-xxxx-yyyy-zzzz pkg:apk/wolfi/bash@1.0.0 under_investigation",
+	}, statuses)
+
+	_, err = ToCSAF(nil)
+	require.Error(t, err)
+	invalid := vex.New()
+	invalid.ID = "https://example.com/vex"
+	invalid.Statements = []vex.Statement{{Vulnerability: vex.Vulnerability{Name: "CVE-2023-1234"}, Status: "wontfix"}}
+	_, err = ToCSAF(&invalid)
+	require.Error(t, err)
+}
+
+func TestFromCSAF(t *testing.T) {
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+
+	data, err := os.ReadFile("testdata/csaf/advisory.csaf.json")
+	require.NoError(t, err)
+	doc, err := FromCSAF(data)
+	require.NoError(t, err)
+
+	require.Equal(t, "EXAMPLE-VEX-2024-0001", doc.ID)
+	require.Equal(t, "Example Company", doc.Author)
+	require.Equal(t, 2, doc.Version)
+	require.Equal(t, time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC), doc.Timestamp.UTC())
+	require.Equal(t, time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC), doc.LastUpdated.UTC())
+
+	server1 := vex.Product{Component: vex.Component{
+		ID: "pkg:oci/example-server@sha256%3A74634d9736a45ca9f6e1187e783492199e020f4a5c19d0b1abc2b604f894ac99",
+		Identifiers: map[vex.IdentifierType]string{
+			vex.PURL: "pkg:oci/example-server@sha256%3A74634d9736a45ca9f6e1187e783492199e020f4a5c19d0b1abc2b604f894ac99",
+		},
+	}}
+	server2 := vex.Product{Component: vex.Component{
+		ID:          "CSAFPID-0002",
+		Identifiers: map[vex.IdentifierType]string{vex.CPE23: "cpe:2.3:a:example:server:2.0:*:*:*:*:*:*:*"},
+	}}
+	agent := vex.Product{Component: vex.Component{ID: "CSAFPID-0003"}}
+	cve := vex.Vulnerability{
+		Name:        "CVE-2024-0001",
+		Aliases:     []vex.VulnerabilityID{"EXAMPLE-2024-17"},
+		Description: "Remote code execution in the parser",
+	}
+	ghsa := vex.Vulnerability{Name: "GHSA-xxxx-yyyy-zzzz", Description: "Denial of service"}
+
+	require.Equal(t, []vex.Statement{
+		{
+			Vulnerability: cve, Products: []vex.Product{server1}, Status: vex.StatusNotAffected,
+			Justification: vex.VulnerableCodeNotInExecutePath,
+		},
+		{
+			Vulnerability: cve, Products: []vex.Product{server2}, Status: vex.StatusNotAffected,
+			Justification: vex.VulnerableCodeNotInExecutePath, ImpactStatement: "The parser is disabled",
+		},
+		{
+			Vulnerability: cve, Products: []vex.Product{agent}, Status: vex.StatusAffected,
+			ActionStatement: "Update to Example Agent 3.2",
+		},
+		{Vulnerability: ghsa, Products: []vex.Product{server1, server2}, Status: vex.StatusFixed},
+		{Vulnerability: ghsa, Products: []vex.Product{agent}, Status: vex.StatusUnderInvestigation},
+	}, doc.Statements)
+
+	warnings := []string{}
+	for _, e := range hook.AllEntries() {
+		warnings = append(warnings, e.Message)
+	}
+	require.Len(t, warnings, 2)
+	require.Contains(t, warnings[0], "recommended")
+	require.Contains(t, warnings[1], "not_a_justification")
+
+	// The warnings go to the logger in the options when set
+	hook.Reset()
+	logger, loggerHook := logtest.NewNullLogger()
+	_, err = FromCSAFWithOptions(data, Options{Logger: logger})
+	require.NoError(t, err)
+	require.Len(t, loggerHook.AllEntries(), 2)
+	require.Empty(t, hook.AllEntries())
+
+	_, err = FromCSAF([]byte(`{"document": {}}`))
+	require.Error(t, err)
+	_, err = FromCSAF([]byte(`not json`))
+	require.Error(t, err)
+}
+
+// requireValidJSON validates data against the JSON schema at schemaURL.
+// resources maps the URLs of the schema and those it references to local
+// copies in testdata, so the tests do not download them.
+func requireValidJSON(t *testing.T, data []byte, schemaURL string, resources map[string]string) {
+	t.Helper()
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat = true
+	for url, path := range resources {
+		f, err := os.Open(path)
+		require.NoError(t, err)
+		defer f.Close()
+		require.NoError(t, compiler.AddResource(url, f))
+	}
+	schema, err := compiler.Compile(schemaURL)
+	require.NoError(t, err)
+
+	// The validator expects numbers decoded as json.Number
+	var v any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	require.NoError(t, decoder.Decode(&v))
+	require.NoError(t, schema.Validate(v))
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// csvHeader are the column names of the CSV rendering of a VEX document
+var csvHeader = []string{
+	"vulnerability", "product", "status", "justification", "impact_statement", "timestamp",
+}
+
+// ToCSV writes the statements of a VEX document to w as CSV, one row per
+// statement and product. Statements listing more than one product are expanded
+// into multiple rows. Statements without a timestamp inherit the document's.
+func ToCSV(doc *vex.VEX, w io.Writer) error {
+	if doc == nil {
+		return fmt.Errorf("cannot write CSV, vex document is nil")
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return fmt.Errorf("writing CSV header: %w", err)
+	}
+
+	for i := range doc.Statements {
+		s := &doc.Statements[i]
+		ts := ""
+		switch {
+		case s.Timestamp != nil:
+			ts = s.Timestamp.Format(time.RFC3339)
+		case doc.Timestamp != nil:
+			ts = doc.Timestamp.Format(time.RFC3339)
+		}
+
+		products := []string{}
+		for _, p := range s.Products {
+			products = append(products, productIdentifier(&p.Component))
+		}
+		// Statements without products still get a row
+		if len(products) == 0 {
+			products = append(products, "")
+		}
+
+		for _, p := range products {
+			if err := cw.Write([]string{
+				string(s.Vulnerability.Name), p, string(s.Status),
+				string(s.Justification), s.ImpactStatement, ts,
+			}); err != nil {
+				return fmt.Errorf("writing CSV row for statement #%d: %w", i, err)
+			}
+		}
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("flushing CSV data: %w", err)
+	}
+	return nil
+}
+
+// productIdentifier returns the string that best identifies a component. The
+// component's ID is preferred, then its purl, then any other identifier and
+// finally one of its hashes.
+func productIdentifier(c *vex.Component) string {
+	if c.ID != "" {
+		return c.ID
+	}
+	if id, ok := c.Identifiers[vex.PURL]; ok {
+		return id
+	}
+
+	// Sort the rest to make the choice deterministic
+	ids := []string{}
+	for _, id := range c.Identifiers {
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		for _, h := range c.Hashes {
+			ids = append(ids, string(h))
+		}
+	}
+	sort.Strings(ids)
+	if len(ids) > 0 {
+		return ids[0]
+	}
+	return ""
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+func TestToCSV(t *testing.T) {
+	ts := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	doc := vex.New()
+	doc.Timestamp = &ts
+	doc.Statements = []vex.Statement{
+		{
+			Vulnerability: vex.Vulnerability{Name: "CVE-2023-1234"},
+			Products: []vex.Product{
+				{Component: vex.Component{ID: "pkg:oci/image1"}},
+				{Component: vex.Component{Identifiers: map[vex.IdentifierType]string{vex.PURL: "pkg:oci/image2"}}},
+			},
+			Status:          vex.StatusNotAffected,
+			Justification:   vex.VulnerableCodeNotPresent,
+			ImpactStatement: "The vulnerable code, \"parse()\", was removed,\nsee the changelog",
+		},
+		{
+			Vulnerability: vex.Vulnerability{Name: "CVE-2023-5678"},
+			Products:      []vex.Product{{Component: vex.Component{ID: "pkg:oci/image1"}}},
+			Status:        vex.StatusUnderInvestigation,
+		},
+	}
+
+	var b bytes.Buffer
+	require.NoError(t, ToCSV(&doc, &b))
+
+	records, err := csv.NewReader(&b).ReadAll()
+	require.NoError(t, err)
+	require.Equal(t, [][]string{
+		csvHeader,
+		{
+			"CVE-2023-1234", "pkg:oci/image1", "not_affected", "vulnerable_code_not_present",
+			"The vulnerable code, \"parse()\", was removed,\nsee the changelog", "2023-10-01T12:00:00Z",
+		},
+		{
+			"CVE-2023-1234", "pkg:oci/image2", "not_affected", "vulnerable_code_not_present",
+			"The vulnerable code, \"parse()\", was removed,\nsee the changelog", "2023-10-01T12:00:00Z",
+		},
+		{"CVE-2023-5678", "pkg:oci/image1", "under_investigation", "", "", "2023-10-01T12:00:00Z"},
+	}, records)
+
+	require.Error(t, ToCSV(nil, &b))
+}
@@ -7,17 +7,56 @@ package ctl
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/openvex/go-vex/pkg/sarif"
 	"github.com/openvex/go-vex/pkg/vex"
 	"github.com/sirupsen/logrus"
 
+	ggcrtypes "github.com/google/go-containerregistry/pkg/v1/types"
 	intoto "github.com/in-toto/in-toto-golang/in_toto"
 	"github.com/openvex/vexctl/pkg/attestation"
 )
 
-const errNotAttestable = "some entries are not attestable as they don't have a hash: %v"
+// reasonNoDigests is why purls without hashes cannot be attested
+const reasonNoDigests = "they lack digests"
+
+// UnattestableProduct is a product that cannot be an attestation subject
+type UnattestableProduct struct {
+	Name   string // Product identifier
+	Reason string // Why the product cannot be attested
+}
+
+// unattestableMessage describes the products left out of an attestation
+func unattestableMessage(refs []productRef) string {
+	names := []string{}
+	for _, r := range refs {
+		names = append(names, r.Name)
+	}
+	return fmt.Sprintf(
+		"%d products cannot be attested because %s: %s", len(refs), reasonNoDigests, strings.Join(names, ", "),
+	)
+}
+
+// intotoDigestNames maps the VEX hash algorithms to the names used in the
+// in-toto subject digest sets, when they differ.
+var intotoDigestNames = map[vex.Algorithm]string{
+	vex.SHA256:  "sha256",
+	vex.SHA384:  "sha384",
+	vex.SHA512:  "sha512",
+	vex.SHA3224: "sha3_224",
+	vex.SHA3256: "sha3_256",
+	vex.SHA3384: "sha3_384",
+	vex.SHA3512: "sha3_512",
+}
 
 type VexCtl struct {
 	impl    Implementation
@@ -28,6 +67,168 @@ type Options struct {
 	Products []string // List of products to match in CSAF docs
 	Format   string   // Firmat of the vex documents
 	Sign     bool     // When true, attestations will be signed before attaching
+
+	SigningKey string // Cosign key reference (file, KMS URI) used to sign, keyless when empty
+	Keyless    bool   // Sign unsigned attestations with a Fulcio certificate when attaching
+
+	// Sigstore is the sigstore instance used for keyless signing, the
+	// public instance when empty. Its RekorURL is also where attestations
+	// are uploaded and their inclusion proofs verified.
+	Sigstore attestation.SigningOptions
+
+	TlogUpload          bool // Record signed attestations in Rekor, on by default in New
+	VerifyTlogInclusion bool // Verify the Rekor inclusion proofs of attestations read from images
+
+	RegistryUsername string // Username to authenticate to registries, overrides the docker config
+	RegistryPassword string // Password to authenticate to registries
+	RegistryToken    string // Bearer token to authenticate to registries, overrides the docker config
+	AllowInsecure    bool   // Skip TLS verification of registries, does not affect signature verification
+	PlainHTTP        bool   // Allow talking to registries over plain HTTP
+
+	AttestationTagPrefix string // Prefix of the tags attestations are stored in with the cosign tag scheme
+	AttestationTagSuffix string // Suffix of the attestation tags, <prefix>sha256-<hex>.<suffix> (default att)
+
+	RetryAttempts int           // Attempts of registry operations failing with transient errors (default 3)
+	RetryBackoff  time.Duration // Delay before retrying registry operations, doubled on each retry (default 1s)
+
+	FetchTimeout    time.Duration // Max time to download VEX documents from URLs (default 30s)
+	MaxDocumentSize int64         // Largest VEX document read from URLs or stdin, in bytes (default 10 MiB)
+
+	VerifyKey          string        // Public key used to verify attestations read from images
+	RekorPublicKeyPath string        // Rekor public key(s) file, enables offline tlog verification
+	VerifyTimeout      time.Duration // Max time to wait for signature verification (0 = no limit)
+	CertIdentity       string        // Signer identity expected in keyless signatures of image attestations
+	CertOIDCIssuer     string        // OIDC issuer expected in keyless signatures of image attestations
+	IgnoreTlog         bool          // Do not require transparency log entries when verifying signatures
+	SkipVerify         bool          // Read image attestations without verifying their signatures
+	PredicateType      string        // Only read image attestations annotated with this predicate type (eg vex.TypeURI)
+	PayloadType        string        // DSSE payload type of the attestations attached and read (default IntotoPayloadType)
+	Since              time.Time     // Only read image attestations of documents issued at or after this time
+	Latest             bool          // Only read the image attestation with the most recent document
+
+	VerifyRegistryDigests bool // Check subject digests against the registry when attesting
+
+	VulnIDFromMessage bool     // Look for vulnerability IDs in SARIF result messages as a last resort
+	RuleIDPrefixes    []string // Rule ID prefixes recognized as vulnerabilities besides DefaultRuleIDPrefixes
+	MatchCWE          bool     // Match CWE rule IDs to statements that mention the CWE in their vulnerability
+
+	// RuleIDPatterns registers the expressions that extract the canonical
+	// vulnerability ID from rule IDs by prefix. They override and extend
+	// DefaultRuleIDPatterns, registering a prefix makes it recognized.
+	RuleIDPatterns map[string]*regexp.Regexp
+
+	// RuleIDAliases maps the rule IDs of SARIF results to the vulnerability
+	// IDs they are matched as, eg for scanners with proprietary rule IDs.
+	// Rule IDs not in the map are parsed as usual.
+	RuleIDAliases map[string]string
+
+	StrictProductMatching bool // Only filter results found in an artifact listed in the statement products
+	FailOnUntriaged       bool // Return an UntriagedError when results have no matching VEX statement
+
+	ProductMatchMode ProductMatchMode // How result artifacts are compared to the statement products (default exact)
+
+	// StatusActions maps VEX statuses to what happens to the matching
+	// scanner results. Statuses not in the map use DefaultStatusActions().
+	StatusActions map[vex.Status]FilterAction
+
+	// AllowedJustifications, when set, limits the not_affected statements
+	// that suppress results to those with one of these justifications.
+	AllowedJustifications []vex.Justification
+
+	SBOMAttestationDigest string // Digest of a related SBOM attestation to link when attaching
+	Concurrency           int    // Number of references to attach attestations to or read from at once (default 4)
+	FailFast              bool   // Stop attaching to the remaining references after the first failure
+	SkipExisting          bool   // Do not push attestations already attached to the images
+	DryRun                bool   // Resolve and log the images Attach would write to without signing or pushing
+
+	// AttachToChildren attaches attestations to the platform images of
+	// image indexes instead of the index itself. When attesting, the
+	// platform images are added as subjects along with the index.
+	AttachToChildren bool
+
+	// UseReferrers attaches attestations as OCI 1.1 referrers of type
+	// ReferrerArtifactType and looks for them in the referrers index when
+	// reading. The cosign tag scheme is used when it fails.
+	UseReferrers bool
+
+	SuppressionMode SuppressionMode // How suppressed results are handled (default remove)
+
+	ContinueOnLoadError bool // Collect the errors of files that fail to load instead of aborting
+
+	// Logger receives the log output of vexctl. When nil, the global
+	// logrus logger is used.
+	Logger logrus.FieldLogger
+}
+
+// log returns the logger configured in the options
+func (opts Options) log() logrus.FieldLogger {
+	if opts.Logger == nil {
+		return logrus.StandardLogger()
+	}
+	return opts.Logger
+}
+
+// SuppressionMode controls what happens to the SARIF results suppressed
+// by VEX statements.
+type SuppressionMode string
+
+const (
+	// SuppressionModeRemove deletes the suppressed results from the report
+	SuppressionModeRemove SuppressionMode = "remove"
+
+	// SuppressionModeMark keeps the results, recording the VEX statement
+	// that suppressed them in their suppressions array.
+	SuppressionModeMark SuppressionMode = "mark"
+)
+
+// FilterAction is what the filter does with a result matched by a VEX statement
+type FilterAction string
+
+const (
+	// FilterActionSuppress removes the result from the report
+	FilterActionSuppress FilterAction = "suppress"
+
+	// FilterActionKeep leaves the result in the report
+	FilterActionKeep FilterAction = "keep"
+)
+
+// defaultStatusActions are the filter actions applied to each status when
+// not overridden in the options. Results matched by statements with a status
+// not listed here (ie new or custom statuses) are always kept.
+var defaultStatusActions = map[vex.Status]FilterAction{
+	vex.StatusNotAffected:        FilterActionSuppress,
+	vex.StatusFixed:              FilterActionSuppress,
+	vex.StatusAffected:           FilterActionKeep,
+	vex.StatusUnderInvestigation: FilterActionKeep,
+}
+
+// DefaultStatusActions returns a copy of the filter actions applied to each
+// status when not overridden in Options.StatusActions.
+func DefaultStatusActions() map[vex.Status]FilterAction {
+	return maps.Clone(defaultStatusActions)
+}
+
+// statusAction returns the filter action configured for a VEX status
+func (opts *Options) statusAction(status vex.Status) FilterAction {
+	if action, ok := opts.StatusActions[status]; ok {
+		return action
+	}
+	if action, ok := defaultStatusActions[status]; ok {
+		return action
+	}
+	return FilterActionKeep
+}
+
+// statementAction returns the filter action for the results matched by a
+// statement. not_affected statements with a justification that is not in
+// opts.AllowedJustifications keep the results.
+func (opts *Options) statementAction(s *vex.Statement) FilterAction {
+	action := opts.statusAction(s.Status)
+	if action == FilterActionSuppress && s.Status == vex.StatusNotAffected &&
+		len(opts.AllowedJustifications) > 0 && !slices.Contains(opts.AllowedJustifications, s.Justification) {
+		return FilterActionKeep
+	}
+	return action
 }
 
 // ProductRefs is a struct that captures a resolved component reference string
@@ -35,12 +236,27 @@ type Options struct {
 type productRef struct {
 	Name   string
 	Hashes map[vex.Algorithm]vex.Hash
+
+	// MediaType is the media type of image references, when it was looked
+	// up in the registry. It tells image indexes apart from images.
+	MediaType ggcrtypes.MediaType
+}
+
+// isIndex returns true when the reference is known to be an image index
+func (p productRef) isIndex() bool {
+	return p.MediaType.IsIndex()
 }
 
 func New() *VexCtl {
-	return &VexCtl{
-		impl: &defaultVexCtlImplementation{},
+	impl := &defaultVexCtlImplementation{}
+	vexctl := &VexCtl{
+		impl: impl,
+		Options: Options{
+			TlogUpload: true,
+		},
 	}
+	impl.options = &vexctl.Options
+	return vexctl
 }
 
 // ApplyFiles takes a list of paths to vex files and applies them to a report
@@ -55,18 +271,168 @@ func (vexctl *VexCtl) ApplyFiles(r *sarif.Report, files []string) (*sarif.Report
 
 // Apply takes a sarif report and applies one or more vex documents
 func (vexctl *VexCtl) Apply(r *sarif.Report, vexDocs []*vex.VEX) (finalReport *sarif.Report, err error) {
-	// Sort the docs by date
-	vexDocs = vexctl.impl.Sort(vexDocs)
+	finalReport, _, err = vexctl.ApplyWithStats(r, vexDocs)
+	return finalReport, err
+}
+
+// ApplyWithStats is like Apply but it also returns the counts of results
+// suppressed and retained by the VEX data.
+func (vexctl *VexCtl) ApplyWithStats(r *sarif.Report, vexDocs []*vex.VEX) (*sarif.Report, *ApplyStats, error) {
+	// Apply the documents to the report, they are sorted by date so that
+	// later documents override the earlier ones
+	finalReport, stats, err := vexctl.impl.ApplyVEXWithStats(vexctl.Options, r, vexDocs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("applying %d vex documents: %w", len(vexDocs), err)
+	}
+
+	return finalReport, stats, nil
+}
+
+// FilterSummary reports the results of a filter run
+type FilterSummary struct {
+	Results    int // Results in the original report
+	Suppressed int // Results suppressed by the VEX data
+	Remaining  int // Results left in the report after applying the VEX data
+
+	// Documents are the VEX documents read by FilterFiles, eg to evaluate
+	// a policy against them
+	Documents []*vex.VEX
+}
+
+// String returns the summary in a printable form
+func (fs *FilterSummary) String() string {
+	return fmt.Sprintf(
+		"%d results, %d suppressed by VEX, %d remaining",
+		fs.Results, fs.Suppressed, fs.Remaining,
+	)
+}
+
+// FilterFiles reads a SARIF report and the VEX data from its sources (files
+// or images) and applies them. All inputs are read fresh on every call so it
+// can be re-run when they change.
+func (vexctl *VexCtl) FilterFiles(
+	ctx context.Context, reportPath string, vexURIs []string,
+) (*sarif.Report, *FilterSummary, error) {
+	report, err := sarif.Open(reportPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening sarif report: %w", err)
+	}
 
-	// Apply the sorted documents to the report
-	for i, doc := range vexDocs {
-		finalReport, err = vexctl.impl.ApplySingleVEX(r, doc)
+	vexes := []*vex.VEX{}
+	for _, uri := range vexURIs {
+		doc, err := vexctl.VexFromURI(ctx, uri)
 		if err != nil {
-			return nil, fmt.Errorf("applying vex document #%d: %w", i, err)
+			return nil, nil, fmt.Errorf("opening %s: %w", uri, err)
 		}
+		vexes = append(vexes, doc)
+	}
+
+	summary := &FilterSummary{Results: countResults(report), Documents: vexes}
+	report, stats, err := vexctl.ApplyWithStats(report, vexes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("applying vexes to report: %w", err)
+	}
+	summary.Suppressed = stats.Suppressed()
+	summary.Remaining = countResults(report)
+
+	return report, summary, nil
+}
+
+// BatchSummary reports the results of filtering several reports
+type BatchSummary struct {
+	FilterSummary                           // Totals of the reports filtered
+	Reports       map[string]*FilterSummary // Summary of each report, by path
+	Outputs       map[string]string         // Path where each filtered report was written
+}
+
+// ReportErrors maps the SARIF reports that could not be filtered to the error
+type ReportErrors map[string]error
+
+// Error lists the failed reports in order
+func (re ReportErrors) Error() string {
+	msgs := []string{}
+	for _, path := range sortedKeys(re) {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", path, re[path]))
 	}
+	return fmt.Sprintf("filtering %d reports failed: %s", len(re), strings.Join(msgs, "; "))
+}
 
-	return finalReport, nil
+// FilterReports applies the VEX documents to each of the SARIF reports in
+// reportPaths and writes the filtered reports alongside them, see
+// FilteredReportPath. A report that cannot be read or filtered does not stop
+// the rest, the failures are returned as ReportErrors along with the
+// summary of the reports that were filtered.
+func (vexctl *VexCtl) FilterReports(reportPaths []string, vexDocs []*vex.VEX) (*BatchSummary, error) {
+	batch := &BatchSummary{
+		Reports: map[string]*FilterSummary{},
+		Outputs: map[string]string{},
+	}
+	errs := ReportErrors{}
+	for _, path := range reportPaths {
+		summary, output, err := vexctl.filterReport(path, vexDocs)
+		if err != nil {
+			errs[path] = err
+			continue
+		}
+		batch.Reports[path] = summary
+		batch.Outputs[path] = output
+		batch.Results += summary.Results
+		batch.Suppressed += summary.Suppressed
+		batch.Remaining += summary.Remaining
+	}
+	if len(errs) > 0 {
+		return batch, errs
+	}
+	return batch, nil
+}
+
+// filterReport applies the VEX documents to the report at path and writes
+// the filtered report, returning its summary and where it was written.
+func (vexctl *VexCtl) filterReport(path string, vexDocs []*vex.VEX) (*FilterSummary, string, error) {
+	report, err := sarif.Open(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("opening sarif report: %w", err)
+	}
+
+	summary := &FilterSummary{Results: countResults(report)}
+	report, stats, err := vexctl.ApplyWithStats(report, vexDocs)
+	if err != nil {
+		return nil, "", err
+	}
+	summary.Suppressed = stats.Suppressed()
+	summary.Remaining = countResults(report)
+
+	output := FilteredReportPath(path)
+	f, err := os.Create(output)
+	if err != nil {
+		return nil, "", fmt.Errorf("creating filtered report: %w", err)
+	}
+	defer f.Close()
+	if err := report.ToJSON(f); err != nil {
+		return nil, "", fmt.Errorf("writing filtered report: %w", err)
+	}
+	return summary, output, nil
+}
+
+// FilteredReportPath returns the path where FilterReports writes the
+// filtered copy of a report: .filtered is inserted before its .sarif.json,
+// .sarif or .json extension, or added along with .sarif.json otherwise.
+func FilteredReportPath(path string) string {
+	for _, ext := range []string{".sarif.json", ".sarif", ".json"} {
+		if strings.HasSuffix(path, ext) {
+			return strings.TrimSuffix(path, ext) + ".filtered" + ext
+		}
+	}
+	return path + ".filtered.sarif.json"
+}
+
+// countResults returns the number of results in all the runs of a report
+func countResults(report *sarif.Report) int {
+	n := 0
+	for _, run := range report.Runs {
+		n += len(run.Results)
+	}
+	return n
 }
 
 // Attest generates an attestation from a list of identifiers
@@ -98,14 +464,31 @@ func (vexctl *VexCtl) Attest(vexDataPath string, subjectStrings []string) (*atte
 		return nil, fmt.Errorf("normalizing VEX products to attest: %w", err)
 	}
 
+	switch {
+	case vexctl.Options.AttachToChildren:
+		imageSubjects, err = vexctl.impl.ExpandImageIndexes(context.Background(), vexctl.Options, imageSubjects)
+		if err != nil {
+			return nil, fmt.Errorf("expanding image index subjects: %w", err)
+		}
+	case vexctl.Options.VerifyRegistryDigests:
+		// The registry is checked anyway, point out the subjects that
+		// are image indexes as their platform images are not attested.
+		imageSubjects = vexctl.impl.ResolveImageMediaTypes(context.Background(), vexctl.Options, imageSubjects)
+		for _, s := range imageSubjects {
+			if s.isIndex() {
+				vexctl.Options.log().Warnf("%s is an image index, set AttachToChildren to attest its platform images", s.Name)
+			}
+		}
+	}
+
 	if len(unattestableSubjects) != 0 {
 		// If subjects are manual, fail
 		if len(subjectStrings) > 0 {
-			return nil, fmt.Errorf(errNotAttestable, unattestableSubjects)
+			return nil, errors.New(unattestableMessage(unattestableSubjects))
 		}
 		// If we are just checking an existing document, we dont err. We skip
 		// any unattestable subjects.
-		logrus.Warnf(errNotAttestable, unattestableSubjects)
+		vexctl.Options.log().Warn(unattestableMessage(unattestableSubjects))
 	}
 
 	allSubjects := []productRef{}
@@ -116,12 +499,11 @@ func (vexctl *VexCtl) Attest(vexDataPath string, subjectStrings []string) (*atte
 		d := map[string]string{}
 		// TODO(puerco): Move this logic to the go-vex hash structs
 		for a, h := range sub.Hashes {
-			switch a {
-			case vex.SHA256:
-				d["sha256"] = string(h)
-			case vex.SHA512:
-				d["sha512"] = string(h)
+			alg, ok := intotoDigestNames[a]
+			if !ok {
+				alg = string(a)
 			}
+			d[alg] = string(h)
 		}
 		subs = append(subs, intoto.Subject{
 			Name:   sub.Name,
@@ -138,23 +520,188 @@ func (vexctl *VexCtl) Attest(vexDataPath string, subjectStrings []string) (*atte
 		return nil, fmt.Errorf("checking subjects: %w", err)
 	}
 
-	// Sign the attestation
-	if vexctl.Options.Sign {
-		if err := att.Sign(); err != nil {
-			return att, fmt.Errorf("signing attestation: %w", err)
+	if vexctl.Options.VerifyRegistryDigests {
+		ctx := context.Background()
+		regOpts := RegistryOptions{CraneOptions: craneOptions(ctx, vexctl.Options)}
+		if err := vexctl.impl.VerifySubjectDigests(ctx, att, regOpts); err != nil {
+			return nil, fmt.Errorf("checking subject digests in the registry: %w", err)
+		}
+	}
+
+	// Sign the attestation. Signing records it in the transparency log,
+	// so a dry run leaves it unsigned.
+	if vexctl.Options.Sign && vexctl.Options.DryRun {
+		vexctl.Options.log().Info("Dry run: not signing the attestation")
+	} else if vexctl.Options.Sign {
+		if _, err := vexctl.SignAttestation(context.Background(), att); err != nil {
+			return att, err
 		}
 	}
 
 	return att, nil
 }
 
-// Attach attaches an attestation to a list of images
-func (vexctl *VexCtl) Attach(ctx context.Context, att *attestation.Attestation, refs ...string) (err error) {
-	if err := vexctl.impl.Attach(ctx, att, refs...); err != nil {
-		return fmt.Errorf("attaching attestation: %w", err)
+// WriteAttestationFile writes a signed attestation to an .intoto.jsonl file
+func (vexctl *VexCtl) WriteAttestationFile(att *attestation.Attestation, path string) error {
+	return vexctl.impl.WriteAttestationFile(att, path)
+}
+
+// VerifyAttestationFile verifies an .intoto.jsonl attestation file with the
+// public key in keyRef and returns the VEX document it attests. No registry
+// or transparency log is used, making it suitable for air-gapped systems.
+func (vexctl *VexCtl) VerifyAttestationFile(path, keyRef string) (*vex.VEX, error) {
+	doc, err := vexctl.impl.VerifyAttestationFile(context.Background(), path, keyRef)
+	if err != nil {
+		return nil, fmt.Errorf("verifying attestation file: %w", err)
+	}
+	return doc, nil
+}
+
+// UnattestableProducts returns the products of the document that Attest
+// leaves out of the attestation subjects and why. Purls without hashes
+// cannot be attested as there is no digest to record in the subject.
+func (vexctl *VexCtl) UnattestableProducts(doc *vex.VEX) ([]UnattestableProduct, error) {
+	products, err := vexctl.impl.ListDocumentProducts(doc)
+	if err != nil {
+		return nil, fmt.Errorf("listing document products: %w", err)
+	}
+	_, _, unattestable, err := vexctl.impl.NormalizeProducts(products)
+	if err != nil {
+		return nil, fmt.Errorf("normalizing VEX products: %w", err)
 	}
+	ret := []UnattestableProduct{}
+	for _, p := range unattestable {
+		ret = append(ret, UnattestableProduct{Name: p.Name, Reason: reasonNoDigests})
+	}
+	return ret, nil
+}
 
-	return nil
+// ResolveAttachTargets returns the image references Attach writes the
+// attestation of doc to when no references are passed: the container
+// images among the document products, with oci purls translated to image
+// references. Other products are skipped. No network calls are made.
+func (vexctl *VexCtl) ResolveAttachTargets(doc *vex.VEX) ([]string, error) {
+	products, err := vexctl.impl.ListDocumentProducts(doc)
+	if err != nil {
+		return nil, fmt.Errorf("listing document products: %w", err)
+	}
+	images, _, _, err := vexctl.impl.NormalizeProducts(products)
+	if err != nil {
+		return nil, fmt.Errorf("normalizing VEX products: %w", err)
+	}
+	refs := []string{}
+	for _, img := range images {
+		if !slices.Contains(refs, img.Name) {
+			refs = append(refs, img.Name)
+		}
+	}
+	return refs, nil
+}
+
+// SignAttestation signs an attestation with the key in Options.SigningKey
+// (or keyless when not set) and returns its DSSE envelope, ready to Attach.
+func (vexctl *VexCtl) SignAttestation(ctx context.Context, att *attestation.Attestation) ([]byte, error) {
+	sigOpts := vexctl.Options.Sigstore
+	sigOpts.SkipTlogUpload = sigOpts.SkipTlogUpload || !vexctl.Options.TlogUpload
+	envelope, err := vexctl.impl.SignAttestationWithOptions(ctx, att, vexctl.Options.SigningKey, sigOpts)
+	if err != nil {
+		return nil, fmt.Errorf("signing attestation: %w", err)
+	}
+	return envelope, nil
+}
+
+// SubjectInfo describes an attestation subject and its digests
+type SubjectInfo struct {
+	Name    string   `json:"name"`
+	Digests []string `json:"digests"` // Digests as algorithm:value, sorted
+}
+
+// String returns the subject info in a printable form
+func (si SubjectInfo) String() string {
+	if len(si.Digests) == 0 {
+		return si.Name
+	}
+	return fmt.Sprintf("%s (%s)", si.Name, strings.Join(si.Digests, ", "))
+}
+
+// DescribeSubjects returns the subjects of an attestation with their digests
+// in a stable form suitable to print or compare.
+func DescribeSubjects(att *attestation.Attestation) []SubjectInfo {
+	ret := []SubjectInfo{}
+	if att == nil {
+		return ret
+	}
+	for _, sub := range att.Subject {
+		info := SubjectInfo{Name: sub.Name, Digests: []string{}}
+		for algo, val := range sub.Digest {
+			info.Digests = append(info.Digests, fmt.Sprintf("%s:%s", algo, val))
+		}
+		sort.Strings(info.Digests)
+		ret = append(ret, info)
+	}
+	return ret
+}
+
+// Attach attaches an attestation to a list of images. The result counts the
+// images it was pushed to and, with Options.SkipExisting, the ones skipped
+// because they already had it.
+func (vexctl *VexCtl) Attach(ctx context.Context, att *attestation.Attestation, refs ...string) (AttachResult, error) {
+	// Sigstore does not support attaching unsigned attestations. A dry run
+	// does not push them, so they are not signed to keep them out of the
+	// transparency log.
+	if !att.Signed && (vexctl.Options.Keyless || vexctl.Options.SigningKey != "") && !vexctl.Options.DryRun {
+		if _, err := vexctl.SignAttestation(ctx, att); err != nil {
+			return AttachResult{}, err
+		}
+	}
+
+	// Attestations signed without recording them in the transparency log
+	// get uploaded before attaching them.
+	if att.Signed && vexctl.Options.TlogUpload && !vexctl.Options.DryRun {
+		if err := vexctl.impl.UploadToTlog(ctx, att, vexctl.Options.Sigstore.RekorURL); err != nil {
+			return AttachResult{}, err
+		}
+	}
+
+	result, err := vexctl.impl.Attach(ctx, vexctl.Options, att, refs...)
+	if err != nil {
+		return result, fmt.Errorf("attaching attestation: %w", err)
+	}
+
+	return result, nil
+}
+
+// PinProductDigests returns a copy of the document with its tag-based OCI
+// product purls pinned to the digests they resolve to in the registry.
+func (vexctl *VexCtl) PinProductDigests(ctx context.Context, doc *vex.VEX, regOpts RegistryOptions) (*vex.VEX, error) {
+	pinned, err := vexctl.impl.PinProductDigests(ctx, doc, regOpts)
+	if err != nil {
+		return nil, fmt.Errorf("pinning product digests: %w", err)
+	}
+	return pinned, nil
+}
+
+// ListVulnerabilities returns the sorted vulnerability names and aliases
+// referenced in a document
+func (vexctl *VexCtl) ListVulnerabilities(doc *vex.VEX) ([]vex.VulnerabilityID, error) {
+	ids, err := vexctl.impl.ListDocumentVulnerabilities(doc)
+	if err != nil {
+		return nil, fmt.Errorf("listing vulnerabilities: %w", err)
+	}
+	return ids, nil
+}
+
+// ReadImageAttestationsByDigest reads the VEX attestations of the image
+// pinned by a digest reference, without resolving any tags
+func (vexctl *VexCtl) ReadImageAttestationsByDigest(ctx context.Context, digest string) ([]*vex.VEX, error) {
+	return vexctl.impl.ReadImageAttestationsByDigest(ctx, vexctl.Options, digest)
+}
+
+// ReadImageAttestationsMulti reads the VEX attestations of several images
+// at once. The documents are returned by reference, the references that
+// could not be read are listed in the returned RefErrors.
+func (vexctl *VexCtl) ReadImageAttestationsMulti(ctx context.Context, refs []string) (map[string][]*vex.VEX, error) {
+	return vexctl.impl.ReadImageAttestationsMulti(ctx, vexctl.Options, refs)
 }
 
 // VexFromURI return a vex doc from a path, image ref or URI
@@ -170,6 +717,8 @@ func (vexctl *VexCtl) VexFromURI(ctx context.Context, uri string) (vexData *vex.
 		if err == nil {
 			vexData = vexes[0]
 		}
+	case "url":
+		vexData, err = vexctl.impl.FetchVexData(ctx, vexctl.Options, uri)
 	case "image":
 		vexes, err = vexctl.impl.ReadImageAttestations(ctx, vexctl.Options, uri)
 		if err == nil {
@@ -179,7 +728,7 @@ func (vexctl *VexCtl) VexFromURI(ctx context.Context, uri string) (vexData *vex.
 			vexData = vexes[0]
 		}
 	default:
-		return nil, fmt.Errorf("unable to resolve source type (file or image)")
+		return nil, fmt.Errorf("unable to resolve source type (file, url or image)")
 	}
 
 	if err != nil {
@@ -197,11 +746,35 @@ func (vexctl *VexCtl) Merge(ctx context.Context, opts *MergeOptions, vexes []*ve
 	return doc, nil
 }
 
+// LoadFiles loads VEX documents from a list of files. See
+// Options.ContinueOnLoadError for how errors in individual files are handled.
+func (vexctl *VexCtl) LoadFiles(ctx context.Context, filePaths []string) ([]*vex.VEX, error) {
+	docs, err := vexctl.impl.LoadFiles(ctx, vexctl.Options, filePaths)
+	if err != nil {
+		return docs, fmt.Errorf("loading files: %w", err)
+	}
+	return docs, nil
+}
+
+// LoadDirectory loads the VEX documents in a directory, walking its
+// subdirectories when recursive is set. See Options.ContinueOnLoadError for
+// how errors in individual files are handled.
+func (vexctl *VexCtl) LoadDirectory(ctx context.Context, root string, recursive bool) ([]*vex.VEX, error) {
+	docs, err := vexctl.impl.LoadDirectory(ctx, root, recursive, vexctl.Options.ContinueOnLoadError)
+	if err != nil {
+		return docs, fmt.Errorf("loading documents from %s: %w", root, err)
+	}
+	return docs, nil
+}
+
 // MergeFiles is like Merge but takes filepaths instead of actual VEX documents
 func (vexctl *VexCtl) MergeFiles(ctx context.Context, opts *MergeOptions, filePaths []string) (*vex.VEX, error) {
-	vexes, err := vexctl.impl.LoadFiles(ctx, filePaths)
+	vexes, err := vexctl.impl.LoadFiles(ctx, vexctl.Options, filePaths)
 	if err != nil {
-		return nil, fmt.Errorf("loading files: %w", err)
+		if !vexctl.Options.ContinueOnLoadError || len(vexes) == 0 {
+			return nil, fmt.Errorf("loading files: %w", err)
+		}
+		vexctl.Options.log().Warnf("Merging the documents that loaded, some failed: %v", err)
 	}
 
 	// Merge'em Dano
@@ -6,12 +6,25 @@ SPDX-License-Identifier: Apache-2.0
 package ctl
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	gosarif "github.com/owenrumney/go-sarif/sarif"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/require"
 
 	"github.com/openvex/go-vex/pkg/sarif"
 	"github.com/openvex/go-vex/pkg/vex"
+	"github.com/openvex/vexctl/pkg/attestation"
 )
 
 func TestVexReport(t *testing.T) {
@@ -38,6 +51,9 @@ func TestVexReport(t *testing.T) {
 		{"testdata/sarif/sample-2vulns.json", 2, "testdata/sarif/nginx-grype.sarif.json", 1, 99, 96},
 		{"testdata/sarif/sample-2vulns.json", 2, "testdata/sarif/nginx-trivy.sarif.json", 1, 99, 96},
 		{"testdata/sarif/sample-2vulns.json", 2, "testdata/sarif/nginx-snyk.sarif.json", 2, 65, 63},
+
+		// Results without a rule ID, resolved through their rule index
+		{"testdata/sarif/sample.openvex.json", 1, "testdata/sarif/trivy-ruleindex.sarif.json", 1, 3, 1},
 	} {
 		vexDoc, err := vex.Open(tc.vexDoc)
 		require.NoError(t, err)
@@ -50,9 +66,1141 @@ func TestVexReport(t *testing.T) {
 		require.Len(t, report.Runs, tc.lenRuns)
 		require.Len(t, report.Runs[0].Results, tc.lenResults)
 
-		newReport, err := impl.ApplySingleVEX(report, vexDoc)
+		newReport, err := impl.ApplySingleVEX(Options{}, report, vexDoc)
 		require.NoError(t, err)
 		require.Len(t, newReport.Runs, tc.lenRuns)
 		require.Len(t, newReport.Runs[0].Results, tc.lenAfterFilter)
 	}
 }
+
+func TestApplyPrunesRules(t *testing.T) {
+	impl := defaultVexCtlImplementation{}
+	vexDoc, err := vex.Open("testdata/sarif/sample.openvex.json")
+	require.NoError(t, err)
+	report, err := sarif.Open("testdata/sarif/trivy-ruleindex.sarif.json")
+	require.NoError(t, err)
+
+	newReport, err := impl.ApplySingleVEX(Options{}, report, vexDoc)
+	require.NoError(t, err)
+	requireValidSARIF(t, newReport)
+	rules := newReport.Runs[0].Tool.Driver.Rules
+	require.Len(t, rules, 1)
+	require.Equal(t, "CVE-2023-0464", rules[0].ID)
+	require.Len(t, newReport.Runs[0].Results, 1)
+	require.Equal(t, uint(0), *newReport.Runs[0].Results[0].RuleIndex)
+
+	// The original report is not modified
+	requireValidSARIF(t, report)
+	require.Len(t, report.Runs[0].Tool.Driver.Rules, 2)
+	require.Len(t, report.Runs[0].Results, 3)
+	require.Equal(t, uint(1), *report.Runs[0].Results[1].RuleIndex)
+
+	// Suppressed results are kept when marking, and so are their rules
+	marked, err := impl.ApplySingleVEX(Options{SuppressionMode: SuppressionModeMark}, report, vexDoc)
+	require.NoError(t, err)
+	requireValidSARIF(t, marked)
+	require.Len(t, marked.Runs[0].Tool.Driver.Rules, 2)
+}
+
+// requireValidSARIF checks the constraints of the SARIF 2.1.0 schema that
+// filtering can break: the required properties of runs and results and
+// that results reference rules that exist.
+func requireValidSARIF(t *testing.T, report *sarif.Report) {
+	t.Helper()
+	var b strings.Builder
+	require.NoError(t, report.ToJSON(&b))
+	doc := struct {
+		Version string `json:"version"`
+		Runs    []struct {
+			Tool struct {
+				Driver *struct {
+					Name  string `json:"name"`
+					Rules []struct {
+						ID *string `json:"id"`
+					} `json:"rules"`
+				} `json:"driver"`
+			} `json:"tool"`
+			Results []struct {
+				RuleID    *string `json:"ruleId"`
+				RuleIndex *int    `json:"ruleIndex"`
+				Message   *struct {
+					Text *string `json:"text"`
+					ID   *string `json:"id"`
+				} `json:"message"`
+			} `json:"results"`
+		} `json:"runs"`
+	}{}
+	require.NoError(t, json.Unmarshal([]byte(b.String()), &doc))
+
+	require.Equal(t, "2.1.0", doc.Version)
+	require.NotNil(t, doc.Runs)
+	for _, run := range doc.Runs {
+		require.NotNil(t, run.Tool.Driver, "runs need a tool driver")
+		require.NotEmpty(t, run.Tool.Driver.Name, "tool drivers need a name")
+		for _, rule := range run.Tool.Driver.Rules {
+			require.NotNil(t, rule.ID, "rules need an id")
+		}
+		for _, res := range run.Results {
+			require.NotNil(t, res.Message, "results need a message")
+			require.True(t, res.Message.Text != nil || res.Message.ID != nil, "messages need a text or id")
+			if res.RuleIndex == nil {
+				continue
+			}
+			require.GreaterOrEqual(t, *res.RuleIndex, 0)
+			require.Less(t, *res.RuleIndex, len(run.Tool.Driver.Rules), "dangling rule index")
+			if res.RuleID != nil {
+				require.Equal(t, *res.RuleID, *run.Tool.Driver.Rules[*res.RuleIndex].ID)
+			}
+		}
+	}
+}
+
+// newTestReport returns a SARIF report with a single run containing results
+func newTestReport(results ...*gosarif.Result) *sarif.Report {
+	report := sarif.New()
+	report.Version = "2.1.0"
+	report.Runs = []*gosarif.Run{{
+		Tool:    gosarif.Tool{Driver: &gosarif.ToolComponent{Name: "test-scanner"}},
+		Results: results,
+	}}
+	return report
+}
+
+// newTestResult returns a SARIF result with a rule ID and a message
+func newTestResult(ruleID, message string) *gosarif.Result {
+	res := &gosarif.Result{Message: gosarif.Message{Text: &message}}
+	if ruleID != "" {
+		res.RuleID = &ruleID
+	}
+	return res
+}
+
+// newTestDocument returns a VEX document with the passed statements
+func newTestDocument(statements ...vex.Statement) *vex.VEX {
+	doc := vex.New()
+	doc.Statements = statements
+	return &doc
+}
+
+func TestApplyVulnIDFromMessage(t *testing.T) {
+	impl := defaultVexCtlImplementation{}
+	doc := newTestDocument(vex.Statement{
+		Vulnerability: vex.Vulnerability{Name: "CVE-2023-12345"},
+		Products:      []vex.Product{{Component: vex.Component{ID: "pkg:oci/test"}}},
+		Status:        vex.StatusNotAffected,
+		Justification: vex.VulnerableCodeNotPresent,
+	})
+
+	for _, tc := range []struct {
+		name           string
+		opts           Options
+		ruleID         string
+		message        string
+		expectedLength int
+	}{
+		{"opt-in, CVE in message", Options{VulnIDFromMessage: true}, "SCANNER-001", "openssl is vulnerable to CVE-2023-12345 (upgrade)", 0},
+		{"opt-in, no rule ID", Options{VulnIDFromMessage: true}, "", "Found CVE-2023-12345 in package openssl", 0},
+		{"not enabled", Options{}, "SCANNER-001", "openssl is vulnerable to CVE-2023-12345 (upgrade)", 1},
+		{"opt-in, other CVE in message", Options{VulnIDFromMessage: true}, "SCANNER-001", "openssl is vulnerable to CVE-2023-99999", 1},
+		{"opt-in, structured ID wins", Options{VulnIDFromMessage: true}, "CVE-2023-11111", "Related to CVE-2023-12345", 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			report := newTestReport(newTestResult(tc.ruleID, tc.message))
+			newReport, err := impl.ApplySingleVEX(tc.opts, report, doc)
+			require.NoError(t, err)
+			require.Len(t, newReport.Runs[0].Results, tc.expectedLength)
+		})
+	}
+}
+
+func TestDescribeSubjects(t *testing.T) {
+	att := attestation.New()
+	att.Subject = []intoto.Subject{
+		{
+			Name: "ghcr.io/test/image:canary",
+			Digest: map[string]string{
+				"sha512": "b7a5ca5bba7b4fd9b4bb1d8f1e5e2e0a",
+				"sha256": "74634d9736a45ca9f6e1187e783492199e020f4a5c19d0b1abc2b604f894ac99",
+			},
+		},
+		{Name: "pkg:apk/wolfi/bash@1.0.0", Digest: map[string]string{}},
+	}
+
+	subjects := DescribeSubjects(att)
+	require.Equal(t, []SubjectInfo{
+		{
+			Name: "ghcr.io/test/image:canary",
+			Digests: []string{
+				"sha256:74634d9736a45ca9f6e1187e783492199e020f4a5c19d0b1abc2b604f894ac99",
+				"sha512:b7a5ca5bba7b4fd9b4bb1d8f1e5e2e0a",
+			},
+		},
+		{Name: "pkg:apk/wolfi/bash@1.0.0", Digests: []string{}},
+	}, subjects)
+	require.Len(t, subjects, len(att.Subject))
+	require.Equal(t, "pkg:apk/wolfi/bash@1.0.0", subjects[1].String())
+	require.Equal(t, "ghcr.io/test/image:canary (sha256:74634d9736a45ca9f6e1187e783492199e020f4a5c19d0b1abc2b604f894ac99, sha512:b7a5ca5bba7b4fd9b4bb1d8f1e5e2e0a)", subjects[0].String())
+	require.Empty(t, DescribeSubjects(nil))
+}
+
+func TestResolveAttachTargets(t *testing.T) {
+	vexctl := &VexCtl{impl: &defaultVexCtlImplementation{}}
+	digest := "f271e74b17ced29b915d351685fd4644785c6d1559dd1f2d4189a5e851ef753a"
+	for _, tc := range []struct {
+		name     string
+		products []vex.Product
+		expected []string
+	}{
+		{
+			name: "oci purls",
+			products: []vex.Product{
+				{Component: vex.Component{ID: "pkg:oci/alpine@sha256%3A" + digest}},
+				{Component: vex.Component{ID: "pkg:oci/kube-apiserver?repository_url=registry.k8s.io&tag=v1.26.0"}},
+			},
+			expected: []string{
+				"docker.io/library/alpine@sha256:" + digest,
+				"registry.k8s.io/kube-apiserver:v1.26.0",
+			},
+		},
+		{
+			name: "plain references",
+			products: []vex.Product{
+				{Component: vex.Component{ID: "nginx"}},
+				{Component: vex.Component{ID: "registry.k8s.io/kube-apiserver:v1.26.0"}},
+			},
+			expected: []string{"docker.io/library/nginx:latest", "registry.k8s.io/kube-apiserver:v1.26.0"},
+		},
+		{
+			name: "other products are skipped",
+			products: []vex.Product{
+				{Component: vex.Component{ID: "pkg:apk/wolfi/bash@1.0.0"}},
+				{Component: vex.Component{
+					ID:     "pkg:apk/wolfi/git@2.41.0",
+					Hashes: map[vex.Algorithm]vex.Hash{vex.SHA256: vex.Hash(digest)},
+				}},
+				{Component: vex.Component{ID: "pkg:oci/nginx"}},
+			},
+			expected: []string{"docker.io/library/nginx:latest"},
+		},
+		{
+			name: "duplicates",
+			products: []vex.Product{
+				{Component: vex.Component{ID: "pkg:oci/nginx"}},
+				{Component: vex.Component{ID: "nginx"}},
+			},
+			expected: []string{"docker.io/library/nginx:latest"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			doc := newTestDocument(vex.Statement{
+				Vulnerability: vex.Vulnerability{Name: "CVE-2023-12345"},
+				Products:      tc.products,
+				Status:        vex.StatusUnderInvestigation,
+			})
+			refs, err := vexctl.ResolveAttachTargets(doc)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, refs)
+		})
+	}
+}
+
+func TestAttestUnattestableProducts(t *testing.T) {
+	doc := newTestDocument(vex.Statement{
+		Vulnerability: vex.Vulnerability{Name: "CVE-2023-12345"},
+		Products: []vex.Product{
+			{Component: vex.Component{ID: "pkg:apk/wolfi/bash@1.0.0"}},
+			{Component: vex.Component{
+				ID:     "pkg:apk/wolfi/git@2.41.0",
+				Hashes: map[vex.Algorithm]vex.Hash{vex.SHA256: "74634d9736a45ca9f6e1187e783492199e020f4a5c19d0b1abc2b604f894ac99"},
+			}},
+			{Component: vex.Component{ID: "pkg:apk/wolfi/curl@8.1.0"}},
+		},
+		Status:        vex.StatusNotAffected,
+		Justification: vex.ComponentNotPresent,
+	})
+	path := filepath.Join(t.TempDir(), "doc.vex.json")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, doc.ToJSON(f))
+	require.NoError(t, f.Close())
+
+	vexctl := &VexCtl{impl: &defaultVexCtlImplementation{}}
+	products, err := vexctl.UnattestableProducts(doc)
+	require.NoError(t, err)
+	require.Equal(t, []UnattestableProduct{
+		{Name: "pkg:apk/wolfi/bash@1.0.0", Reason: "they lack digests"},
+		{Name: "pkg:apk/wolfi/curl@8.1.0", Reason: "they lack digests"},
+	}, products)
+
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+	att, err := vexctl.Attest(path, nil)
+	require.NoError(t, err)
+	require.Len(t, att.Subject, 1)
+	require.Equal(t, "pkg:apk/wolfi/git@2.41.0", att.Subject[0].Name)
+
+	warnings := []string{}
+	for _, e := range hook.AllEntries() {
+		if e.Level == logrus.WarnLevel {
+			warnings = append(warnings, e.Message)
+		}
+	}
+	require.Equal(t, []string{
+		"2 products cannot be attested because they lack digests: pkg:apk/wolfi/bash@1.0.0, pkg:apk/wolfi/curl@8.1.0",
+	}, warnings)
+
+	// Unattestable subjects passed explicitly are an error
+	_, err = vexctl.Attest(path, []string{"pkg:apk/wolfi/bash@1.0.0"})
+	require.ErrorContains(t, err, "1 products cannot be attested")
+}
+
+func TestAttestOtherSubjects(t *testing.T) {
+	sha256Hash := vex.Hash("74634d9736a45ca9f6e1187e783492199e020f4a5c19d0b1abc2b604f894ac99")
+	sha512Hash := vex.Hash(strings.Repeat("ab", 64))
+	doc := newTestDocument(vex.Statement{
+		Vulnerability: vex.Vulnerability{Name: "CVE-2023-12345"},
+		Products: []vex.Product{
+			{Component: vex.Component{ID: "pkg:generic/openssl@3.0.0", Hashes: map[vex.Algorithm]vex.Hash{vex.SHA256: sha256Hash}}},
+			{Component: vex.Component{ID: "pkg:apk/wolfi/git@2.41.0", Hashes: map[vex.Algorithm]vex.Hash{vex.SHA512: sha512Hash}}},
+		},
+		Status:        vex.StatusNotAffected,
+		Justification: vex.ComponentNotPresent,
+	})
+	path := filepath.Join(t.TempDir(), "doc.vex.json")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, doc.ToJSON(f))
+	require.NoError(t, f.Close())
+
+	vexctl := &VexCtl{impl: &defaultVexCtlImplementation{}}
+	att, err := vexctl.Attest(path, nil)
+	require.NoError(t, err)
+	subjects := map[string]map[string]string{}
+	for _, s := range att.Subject {
+		subjects[s.Name] = s.Digest
+	}
+	require.Equal(t, map[string]map[string]string{
+		"pkg:generic/openssl@3.0.0": {"sha256": string(sha256Hash)},
+		"pkg:apk/wolfi/git@2.41.0":  {"sha512": string(sha512Hash)},
+	}, subjects)
+
+	// The subjects are attested but not pushed to a registry
+	require.Empty(t, imageSubjectRefs(Options{}, att))
+}
+
+// signRecorder counts the calls that would sign an attestation or
+// record it in the transparency log
+type signRecorder struct {
+	defaultVexCtlImplementation
+	signed   int
+	uploaded int
+}
+
+func (r *signRecorder) SignAttestationWithOptions(
+	context.Context, *attestation.Attestation, string, attestation.SigningOptions,
+) ([]byte, error) {
+	r.signed++
+	return nil, errors.New("signing is not expected")
+}
+
+func (r *signRecorder) UploadToTlog(context.Context, *attestation.Attestation, string) error {
+	r.uploaded++
+	return errors.New("tlog upload is not expected")
+}
+
+func TestAttestDryRun(t *testing.T) {
+	doc := newTestDocument(vex.Statement{
+		Vulnerability: vex.Vulnerability{Name: "CVE-2023-12345"},
+		Products: []vex.Product{
+			{Component: vex.Component{
+				ID:     "pkg:apk/wolfi/git@2.41.0",
+				Hashes: map[vex.Algorithm]vex.Hash{vex.SHA256: "74634d9736a45ca9f6e1187e783492199e020f4a5c19d0b1abc2b604f894ac99"},
+			}},
+		},
+		Status:        vex.StatusNotAffected,
+		Justification: vex.ComponentNotPresent,
+	})
+	path := filepath.Join(t.TempDir(), "doc.vex.json")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, doc.ToJSON(f))
+	require.NoError(t, f.Close())
+
+	recorder := &signRecorder{}
+	vexctl := &VexCtl{impl: recorder, Options: Options{
+		Sign: true, Keyless: true, TlogUpload: true, DryRun: true,
+	}}
+	att, err := vexctl.Attest(path, nil)
+	require.NoError(t, err)
+	require.False(t, att.Signed)
+
+	_, err = vexctl.Attach(context.Background(), att)
+	require.NoError(t, err)
+
+	// Attestations signed earlier are not uploaded either
+	att.Signed = true
+	_, err = vexctl.Attach(context.Background(), att)
+	require.NoError(t, err)
+
+	require.Zero(t, recorder.signed)
+	require.Zero(t, recorder.uploaded)
+}
+
+func TestApplyStatusActions(t *testing.T) {
+	impl := defaultVexCtlImplementation{}
+	for _, tc := range []struct {
+		name           string
+		status         vex.Status
+		actions        map[vex.Status]FilterAction
+		expectedLength int
+	}{
+		{"default not_affected", vex.StatusNotAffected, nil, 0},
+		{"default fixed", vex.StatusFixed, nil, 0},
+		{"default affected", vex.StatusAffected, nil, 1},
+		{"default under_investigation", vex.StatusUnderInvestigation, nil, 1},
+		{"custom: keep fixed", vex.StatusFixed, map[vex.Status]FilterAction{vex.StatusFixed: FilterActionKeep}, 1},
+		{"custom: suppress under_investigation", vex.StatusUnderInvestigation, map[vex.Status]FilterAction{vex.StatusUnderInvestigation: FilterActionSuppress}, 0},
+		{"custom map, unlisted status uses default", vex.StatusNotAffected, map[vex.Status]FilterAction{vex.StatusFixed: FilterActionKeep}, 0},
+		{"unknown status is kept", vex.Status("mitigated"), nil, 1},
+		{"unknown status with custom action", vex.Status("mitigated"), map[vex.Status]FilterAction{"mitigated": FilterActionSuppress}, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			doc := newTestDocument(vex.Statement{
+				Vulnerability: vex.Vulnerability{Name: "CVE-2023-12345"},
+				Products:      []vex.Product{{Component: vex.Component{ID: "pkg:oci/test"}}},
+				Status:        tc.status,
+			})
+			report := newTestReport(newTestResult("CVE-2023-12345", "test finding"))
+			newReport, err := impl.ApplySingleVEX(Options{StatusActions: tc.actions}, report, doc)
+			require.NoError(t, err)
+			require.Len(t, newReport.Runs[0].Results, tc.expectedLength)
+		})
+	}
+}
+
+func TestDefaultStatusActions(t *testing.T) {
+	// Callers get a copy, changing it does not change the defaults
+	actions := DefaultStatusActions()
+	require.Equal(t, FilterActionSuppress, actions[vex.StatusNotAffected])
+	actions[vex.StatusNotAffected] = FilterActionKeep
+
+	require.Equal(t, FilterActionSuppress, DefaultStatusActions()[vex.StatusNotAffected])
+	opts := Options{}
+	require.Equal(t, FilterActionSuppress, opts.statusAction(vex.StatusNotAffected))
+}
+
+func TestApplyAllowedJustifications(t *testing.T) {
+	impl := defaultVexCtlImplementation{}
+	strong := []vex.Justification{vex.VulnerableCodeNotPresent, vex.ComponentNotPresent}
+	for _, tc := range []struct {
+		name           string
+		status         vex.Status
+		justification  vex.Justification
+		allowed        []vex.Justification
+		expectedLength int
+	}{
+		{"no allow list", vex.StatusNotAffected, vex.InlineMitigationsAlreadyExist, nil, 0},
+		{"allowed justification", vex.StatusNotAffected, vex.VulnerableCodeNotPresent, strong, 0},
+		{"disallowed justification", vex.StatusNotAffected, vex.InlineMitigationsAlreadyExist, strong, 1},
+		{"missing justification", vex.StatusNotAffected, "", strong, 1},
+		{"fixed is not affected by the list", vex.StatusFixed, "", strong, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			doc := newTestDocument(vex.Statement{
+				Vulnerability: vex.Vulnerability{Name: "CVE-2023-12345"},
+				Products:      []vex.Product{{Component: vex.Component{ID: "pkg:oci/test"}}},
+				Status:        tc.status,
+				Justification: tc.justification,
+			})
+			report := newTestReport(newTestResult("CVE-2023-12345", "test finding"))
+			newReport, err := impl.ApplySingleVEX(Options{AllowedJustifications: tc.allowed}, report, doc)
+			require.NoError(t, err)
+			require.Len(t, newReport.Runs[0].Results, tc.expectedLength)
+		})
+	}
+}
+
+func TestApplyLogLevels(t *testing.T) {
+	logger, hook := logtest.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	impl := defaultVexCtlImplementation{logger: logger}
+
+	doc := newTestDocument(vex.Statement{
+		Vulnerability: vex.Vulnerability{Name: "CVE-2023-12345"},
+		Products:      []vex.Product{{Component: vex.Component{ID: "pkg:oci/test"}}},
+		Status:        vex.StatusNotAffected,
+	})
+	report := newTestReport(newTestResult("CVE-2023-12345", "test finding"))
+	_, err := impl.ApplySingleVEX(Options{}, report, doc)
+	require.NoError(t, err)
+
+	require.NotEmpty(t, hook.AllEntries())
+	found := false
+	for _, entry := range hook.AllEntries() {
+		require.Equal(t, logrus.DebugLevel, entry.Level, entry.Message)
+		if entry.Message == "Inspecting SARIF run #0 containing 1 results" {
+			found = true
+		}
+	}
+	require.True(t, found)
+}
+
+func TestFilterFilesRerun(t *testing.T) {
+	copyFile := func(t *testing.T, src, dst string) {
+		data, err := os.ReadFile(src)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(dst, data, os.FileMode(0o644)))
+	}
+
+	dir := t.TempDir()
+	reportPath := filepath.Join(dir, "report.sarif.json")
+	vexPath := filepath.Join(dir, "data.vex.json")
+	copyFile(t, "testdata/sarif/nginx-grype.sarif.json", reportPath)
+	copyFile(t, "testdata/sarif/sample.openvex.json", vexPath)
+
+	vexctl := New()
+	ctx := context.Background()
+	_, summary, err := vexctl.FilterFiles(ctx, reportPath, []string{vexPath})
+	require.NoError(t, err)
+	require.Equal(t, "99 results, 1 suppressed by VEX, 98 remaining", summary.String())
+	require.Len(t, summary.Documents, 1)
+
+	// Rerunning with the same files gives the same results
+	_, summary, err = vexctl.FilterFiles(ctx, reportPath, []string{vexPath})
+	require.NoError(t, err)
+	require.Equal(t, "99 results, 1 suppressed by VEX, 98 remaining", summary.String())
+
+	// Changes to the VEX data are picked up
+	copyFile(t, "testdata/sarif/sample-2vulns.json", vexPath)
+	report, summary, err := vexctl.FilterFiles(ctx, reportPath, []string{vexPath})
+	require.NoError(t, err)
+	require.Equal(t, "99 results, 3 suppressed by VEX, 96 remaining", summary.String())
+	require.Len(t, report.Runs[0].Results, 96)
+
+	// A deleted input fails the run but it recovers when recreated
+	require.NoError(t, os.Remove(vexPath))
+	_, _, err = vexctl.FilterFiles(ctx, reportPath, []string{vexPath})
+	require.Error(t, err)
+	copyFile(t, "testdata/sarif/sample.openvex.json", vexPath)
+	_, summary, err = vexctl.FilterFiles(ctx, reportPath, []string{vexPath})
+	require.NoError(t, err)
+	require.Equal(t, "99 results, 1 suppressed by VEX, 98 remaining", summary.String())
+}
+
+func TestFilterReports(t *testing.T) {
+	dir := t.TempDir()
+	grype := filepath.Join(dir, "grype.sarif.json")
+	trivy := filepath.Join(dir, "trivy.sarif")
+	broken := filepath.Join(dir, "broken.sarif.json")
+	for src, dst := range map[string]string{
+		"testdata/sarif/nginx-grype.sarif.json": grype,
+		"testdata/sarif/nginx-trivy.sarif.json": trivy,
+	} {
+		data, err := os.ReadFile(src)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(dst, data, os.FileMode(0o644)))
+	}
+	require.NoError(t, os.WriteFile(broken, []byte("{not json"), os.FileMode(0o644)))
+
+	doc, err := vex.Open("testdata/sarif/sample.openvex.json")
+	require.NoError(t, err)
+
+	batch, err := New().FilterReports([]string{grype, broken, trivy}, []*vex.VEX{doc})
+	var reportErrs ReportErrors
+	require.ErrorAs(t, err, &reportErrs)
+	require.Len(t, reportErrs, 1)
+	require.Contains(t, reportErrs, broken)
+
+	require.Len(t, batch.Reports, 2)
+	require.Equal(t, FilterSummary{Results: 99, Suppressed: 1, Remaining: 98}, *batch.Reports[grype])
+	total := FilterSummary{}
+	for _, path := range []string{grype, trivy} {
+		summary := batch.Reports[path]
+		require.Equal(t, summary.Results, summary.Suppressed+summary.Remaining)
+		total.Results += summary.Results
+		total.Suppressed += summary.Suppressed
+		total.Remaining += summary.Remaining
+
+		filtered, err := sarif.Open(batch.Outputs[path])
+		require.NoError(t, err)
+		require.Equal(t, summary.Remaining, countResults(filtered))
+	}
+	require.Equal(t, total, batch.FilterSummary)
+	require.Equal(t, filepath.Join(dir, "grype.filtered.sarif.json"), batch.Outputs[grype])
+	require.Equal(t, filepath.Join(dir, "trivy.filtered.sarif"), batch.Outputs[trivy])
+}
+
+func TestFilteredReportPath(t *testing.T) {
+	for path, expected := range map[string]string{
+		"scan.sarif.json":   "scan.filtered.sarif.json",
+		"dir/scan.sarif":    "dir/scan.filtered.sarif",
+		"scan.json":         "scan.filtered.json",
+		"scan":              "scan.filtered.sarif.json",
+		"scan.sarif.report": "scan.sarif.report.filtered.sarif.json",
+	} {
+		require.Equal(t, expected, FilteredReportPath(path), path)
+	}
+}
+
+func TestApplyStrictProductMatching(t *testing.T) {
+	impl := defaultVexCtlImplementation{}
+	doc := newTestDocument(vex.Statement{
+		Vulnerability: vex.Vulnerability{Name: "CVE-2023-12345"},
+		Products:      []vex.Product{{Component: vex.Component{ID: "pkg:oci/image1"}}},
+		Status:        vex.StatusNotAffected,
+		Justification: vex.VulnerableCodeNotPresent,
+	})
+
+	withPurl := func(purl string) *gosarif.Result {
+		res := newTestResult("CVE-2023-12345", "test finding")
+		res.Properties = gosarif.Properties{"purl": purl}
+		return res
+	}
+	withLocation := func(uri string) *gosarif.Result {
+		res := newTestResult("CVE-2023-12345", "test finding")
+		res.Locations = []*gosarif.Location{{
+			PhysicalLocation: &gosarif.PhysicalLocation{
+				ArtifactLocation: &gosarif.ArtifactLocation{URI: &uri},
+			},
+		}}
+		return res
+	}
+
+	for _, tc := range []struct {
+		name           string
+		strict         bool
+		result         *gosarif.Result
+		expectedLength int
+	}{
+		{"permissive, product purl", false, withPurl("pkg:oci/image1"), 0},
+		{"permissive, other purl", false, withPurl("pkg:oci/image2"), 1},
+		{"permissive, other location", false, withLocation("usr/lib/libssl.so.3"), 0},
+		{"permissive, no artifact", false, newTestResult("CVE-2023-12345", "test finding"), 0},
+		{"strict, product purl", true, withPurl("pkg:oci/image1"), 0},
+		{"strict, product location", true, withLocation("pkg:oci/image1"), 0},
+		{"strict, other artifact", true, withPurl("pkg:oci/image2"), 1},
+		{"strict, other location", true, withLocation("usr/lib/libssl.so.3"), 1},
+		{"strict, no artifact", true, newTestResult("CVE-2023-12345", "test finding"), 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			report := newTestReport(tc.result)
+			newReport, err := impl.ApplySingleVEX(Options{StrictProductMatching: tc.strict}, report, doc)
+			require.NoError(t, err)
+			require.Len(t, newReport.Runs[0].Results, tc.expectedLength)
+		})
+	}
+}
+
+func TestApplySubcomponents(t *testing.T) {
+	impl := defaultVexCtlImplementation{}
+	doc := newTestDocument(vex.Statement{
+		Vulnerability: vex.Vulnerability{Name: "CVE-2023-12345"},
+		Products: []vex.Product{
+			{
+				Component: vex.Component{ID: "pkg:oci/image1"},
+				Subcomponents: []vex.Subcomponent{
+					{Component: vex.Component{ID: "pkg:apk/wolfi/openssl@3.1.1"}},
+				},
+			},
+		},
+		Status:        vex.StatusNotAffected,
+		Justification: vex.VulnerableCodeNotPresent,
+	})
+
+	withPurl := func(purl string) *gosarif.Result {
+		res := newTestResult("CVE-2023-12345", "test finding")
+		res.Properties = gosarif.Properties{"purl": purl}
+		return res
+	}
+
+	for _, tc := range []struct {
+		name           string
+		strict         bool
+		result         *gosarif.Result
+		expectedLength int
+	}{
+		{"subcomponent purl", false, withPurl("pkg:apk/wolfi/openssl@3.1.1"), 0},
+		{"strict, subcomponent purl", true, withPurl("pkg:apk/wolfi/openssl@3.1.1"), 0},
+		{"other subcomponent", false, withPurl("pkg:apk/wolfi/curl@8.4.0"), 1},
+		{"strict, other subcomponent", true, withPurl("pkg:apk/wolfi/curl@8.4.0"), 1},
+		{"product purl", true, withPurl("pkg:oci/image1"), 1},
+		{"no component", false, newTestResult("CVE-2023-12345", "test finding"), 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			newReport, err := impl.ApplySingleVEX(Options{StrictProductMatching: tc.strict}, newTestReport(tc.result), doc)
+			require.NoError(t, err)
+			require.Len(t, newReport.Runs[0].Results, tc.expectedLength)
+		})
+	}
+}
+
+func TestApplyResultProducts(t *testing.T) {
+	impl := defaultVexCtlImplementation{}
+	doc := newTestDocument(
+		vex.Statement{
+			Vulnerability: vex.Vulnerability{Name: "CVE-2023-12345"},
+			Products:      []vex.Product{{Component: vex.Component{ID: "pkg:apk/wolfi/openssl@3.1.1"}}},
+			Status:        vex.StatusNotAffected,
+			Justification: vex.VulnerableCodeNotPresent,
+		},
+		vex.Statement{
+			Vulnerability:   vex.Vulnerability{Name: "CVE-2023-12345"},
+			Products:        []vex.Product{{Component: vex.Component{ID: "pkg:apk/wolfi/openssl@3.0.0"}}},
+			Status:          vex.StatusAffected,
+			ActionStatement: "Upgrade to openssl 3.1.1",
+		},
+	)
+
+	withPurl := func(purl string) *gosarif.Result {
+		res := newTestResult("CVE-2023-12345", "test finding")
+		res.Properties = gosarif.Properties{"purl": purl}
+		return res
+	}
+	withLogicalLocation := func(fqn string) *gosarif.Result {
+		res := newTestResult("CVE-2023-12345", "test finding")
+		res.Locations = []*gosarif.Location{{
+			LogicalLocations: []*gosarif.LogicalLocation{{FullyQualifiedName: &fqn}},
+		}}
+		return res
+	}
+
+	for _, tc := range []struct {
+		name           string
+		result         *gosarif.Result
+		expectedLength int
+	}{
+		{"purl of not affected package", withPurl("pkg:apk/wolfi/openssl@3.1.1"), 0},
+		{"purl of affected package", withPurl("pkg:apk/wolfi/openssl@3.0.0"), 1},
+		{"logical location of not affected package", withLogicalLocation("pkg:apk/wolfi/openssl@3.1.1"), 0},
+		{"logical location of affected package", withLogicalLocation("pkg:apk/wolfi/openssl@3.0.0"), 1},
+		{"purl without statements", withPurl("pkg:apk/wolfi/curl@8.0.0"), 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			newReport, err := impl.ApplySingleVEX(Options{}, newTestReport(tc.result), doc)
+			require.NoError(t, err)
+			require.Len(t, newReport.Runs[0].Results, tc.expectedLength)
+		})
+	}
+}
+
+func TestApplyRuleIDPrefixes(t *testing.T) {
+	impl := defaultVexCtlImplementation{}
+	for _, tc := range []struct {
+		ruleID         string
+		opts           Options
+		expectedLength int
+	}{
+		{"OSV-2023-1234", Options{}, 0},
+		{"ALAS-2023-1234", Options{}, 0},
+		{"DSA-5432-1", Options{}, 0},
+		{"ELSA-2023-1234", Options{}, 0},
+		{"GO-2023-1234", Options{}, 0},
+		{"GHSA-xxxx-yyyy-zzzz", Options{}, 0},
+		{"MAL-2023-1234", Options{}, 1},
+		{"MAL-2023-1234", Options{RuleIDPrefixes: []string{"MAL"}}, 0},
+	} {
+		t.Run(tc.ruleID, func(t *testing.T) {
+			doc := newTestDocument(vex.Statement{
+				Vulnerability: vex.Vulnerability{Name: vex.VulnerabilityID(tc.ruleID)},
+				Products:      []vex.Product{{Component: vex.Component{ID: "pkg:oci/test"}}},
+				Status:        vex.StatusNotAffected,
+				Justification: vex.VulnerableCodeNotPresent,
+			})
+			report := newTestReport(newTestResult(tc.ruleID, "test finding"))
+			newReport, err := impl.ApplySingleVEX(tc.opts, report, doc)
+			require.NoError(t, err)
+			require.Len(t, newReport.Runs[0].Results, tc.expectedLength)
+		})
+	}
+}
+
+func TestApplyRuleIDAliases(t *testing.T) {
+	impl := defaultVexCtlImplementation{}
+	doc := newTestDocument(vex.Statement{
+		Vulnerability: vex.Vulnerability{Name: "CVE-2023-1234"},
+		Products:      []vex.Product{{Component: vex.Component{ID: "pkg:oci/test"}}},
+		Status:        vex.StatusNotAffected,
+		Justification: vex.VulnerableCodeNotPresent,
+	})
+	aliases := map[string]string{"INTERNAL-123": "CVE-2023-1234", "INTERNAL-456": "CVE-2023-5678"}
+	for _, tc := range []struct {
+		ruleID         string
+		opts           Options
+		expectedLength int
+	}{
+		{"INTERNAL-123", Options{}, 1},
+		{"INTERNAL-123", Options{RuleIDAliases: aliases}, 0},
+		{"INTERNAL-456", Options{RuleIDAliases: aliases}, 1},
+		{"INTERNAL-789", Options{RuleIDAliases: aliases}, 1},
+		{"CVE-2023-1234", Options{RuleIDAliases: aliases}, 0},
+	} {
+		t.Run(tc.ruleID, func(t *testing.T) {
+			report := newTestReport(newTestResult(tc.ruleID, "test finding"))
+			newReport, err := impl.ApplySingleVEX(tc.opts, report, doc)
+			require.NoError(t, err)
+			require.Len(t, newReport.Runs[0].Results, tc.expectedLength)
+		})
+	}
+}
+
+func TestApplySuppressionMode(t *testing.T) {
+	impl := defaultVexCtlImplementation{}
+	newDoc := func(id string, justification vex.Justification, impact string) *vex.VEX {
+		doc := newTestDocument(vex.Statement{
+			Vulnerability:   vex.Vulnerability{Name: "CVE-2023-12345"},
+			Products:        []vex.Product{{Component: vex.Component{ID: "pkg:oci/test"}}},
+			Status:          vex.StatusNotAffected,
+			Justification:   justification,
+			ImpactStatement: impact,
+		})
+		doc.ID = id
+		return doc
+	}
+
+	// Default mode removes the result
+	report := newTestReport(newTestResult("CVE-2023-12345", "test finding"))
+	newReport, err := impl.ApplySingleVEX(Options{}, report, newDoc("doc-1", vex.VulnerableCodeNotPresent, ""))
+	require.NoError(t, err)
+	require.Empty(t, newReport.Runs[0].Results)
+
+	// Mark mode keeps it with a suppression
+	opts := Options{SuppressionMode: SuppressionModeMark}
+	report = newTestReport(
+		newTestResult("CVE-2023-12345", "test finding"),
+		newTestResult("CVE-2023-99999", "other finding"),
+	)
+	newReport, err = impl.ApplySingleVEX(opts, report, newDoc("doc-1", vex.VulnerableCodeNotPresent, ""))
+	require.NoError(t, err)
+	require.Len(t, newReport.Runs[0].Results, 2)
+	require.Empty(t, newReport.Runs[0].Results[1].Suppressions)
+
+	suppressions := newReport.Runs[0].Results[0].Suppressions
+	require.Len(t, suppressions, 1)
+	require.Equal(t, "external", suppressions[0].Kind)
+	require.Equal(t, string(vex.VulnerableCodeNotPresent), *suppressions[0].Justification)
+	require.Equal(t, "doc-1", suppressions[0].Properties[suppressionDocumentProperty])
+
+	// A later document replaces the suppression
+	newReport, err = impl.ApplySingleVEX(opts, newReport, newDoc("doc-2", vex.InlineMitigationsAlreadyExist, "input is sanitized"))
+	require.NoError(t, err)
+	suppressions = newReport.Runs[0].Results[0].Suppressions
+	require.Len(t, suppressions, 1)
+	require.Equal(t, "inline_mitigations_already_exist: input is sanitized", *suppressions[0].Justification)
+	require.Equal(t, "doc-2", suppressions[0].Properties[suppressionDocumentProperty])
+}
+
+func TestApplyLatestStatement(t *testing.T) {
+	impl := defaultVexCtlImplementation{}
+	older := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(24 * time.Hour)
+	newStatement := func(status vex.Status, ts *time.Time) vex.Statement {
+		return vex.Statement{
+			Vulnerability: vex.Vulnerability{Name: "CVE-2023-12345"},
+			Products:      []vex.Product{{Component: vex.Component{ID: "pkg:oci/test"}}},
+			Status:        status,
+			Timestamp:     ts,
+		}
+	}
+
+	for _, tc := range []struct {
+		name           string
+		statements     []vex.Statement
+		expectedLength int
+	}{
+		{"older affected, newer fixed", []vex.Statement{newStatement(vex.StatusAffected, &older), newStatement(vex.StatusFixed, &newer)}, 0},
+		{"newer fixed listed first", []vex.Statement{newStatement(vex.StatusFixed, &newer), newStatement(vex.StatusAffected, &older)}, 0},
+		{"older fixed, newer affected", []vex.Statement{newStatement(vex.StatusFixed, &older), newStatement(vex.StatusAffected, &newer)}, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			doc := newTestDocument(tc.statements...)
+			report := newTestReport(newTestResult("CVE-2023-12345", "test finding"))
+			newReport, err := impl.ApplySingleVEX(Options{}, report, doc)
+			require.NoError(t, err)
+			require.Len(t, newReport.Runs[0].Results, tc.expectedLength)
+		})
+	}
+}
+
+func TestApplyAliases(t *testing.T) {
+	impl := defaultVexCtlImplementation{}
+	for _, tc := range []struct {
+		name           string
+		vuln           vex.Vulnerability
+		ruleID         string
+		expectedLength int
+	}{
+		{"scanner CVE, statement GHSA", vex.Vulnerability{Name: "GHSA-abcd-efgh-ijkl", Aliases: []vex.VulnerabilityID{"CVE-2023-1234"}}, "CVE-2023-1234", 0},
+		{"scanner GHSA, statement CVE", vex.Vulnerability{Name: "CVE-2023-1234", Aliases: []vex.VulnerabilityID{"GHSA-abcd-efgh-ijkl"}}, "GHSA-abcd-efgh-ijkl", 0},
+		{"scanner OSV, statement CVE", vex.Vulnerability{Name: "CVE-2023-1234", Aliases: []vex.VulnerabilityID{"OSV-2023-1234"}}, "OSV-2023-1234", 0},
+		{"unrelated alias", vex.Vulnerability{Name: "CVE-2023-1234", Aliases: []vex.VulnerabilityID{"GHSA-abcd-efgh-ijkl"}}, "GHSA-mnop-qrst-uvwx", 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			doc := newTestDocument(vex.Statement{
+				Vulnerability: tc.vuln,
+				Products:      []vex.Product{{Component: vex.Component{ID: "pkg:oci/test"}}},
+				Status:        vex.StatusNotAffected,
+				Justification: vex.VulnerableCodeNotPresent,
+			})
+			report := newTestReport(newTestResult(tc.ruleID, "test finding"))
+			newReport, err := impl.ApplySingleVEX(Options{}, report, doc)
+			require.NoError(t, err)
+			require.Len(t, newReport.Runs[0].Results, tc.expectedLength)
+		})
+	}
+}
+
+func TestApplyMultipleVEX(t *testing.T) {
+	impl := defaultVexCtlImplementation{}
+	older := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(24 * time.Hour)
+	newDoc := func(id string, ts time.Time, status vex.Status) *vex.VEX {
+		doc := newTestDocument(vex.Statement{
+			Vulnerability: vex.Vulnerability{Name: "CVE-2023-12345"},
+			Products:      []vex.Product{{Component: vex.Component{ID: "pkg:oci/test"}}},
+			Status:        status,
+		})
+		doc.ID = id
+		doc.Timestamp = &ts
+		return doc
+	}
+
+	for _, tc := range []struct {
+		name           string
+		docs           []*vex.VEX
+		expectedLength int
+	}{
+		{
+			"newer document reopens",
+			[]*vex.VEX{newDoc("old", older, vex.StatusNotAffected), newDoc("new", newer, vex.StatusAffected)},
+			1,
+		},
+		{
+			"newer document reopens, unsorted input",
+			[]*vex.VEX{newDoc("new", newer, vex.StatusAffected), newDoc("old", older, vex.StatusNotAffected)},
+			1,
+		},
+		{
+			"newer document fixes",
+			[]*vex.VEX{newDoc("new", newer, vex.StatusFixed), newDoc("old", older, vex.StatusAffected)},
+			0,
+		},
+		{
+			"unrelated newer document",
+			[]*vex.VEX{newDoc("old", older, vex.StatusNotAffected), newTestDocument()},
+			0,
+		},
+		{"no documents", []*vex.VEX{}, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			report := newTestReport(newTestResult("CVE-2023-12345", "test finding"))
+			newReport, err := impl.ApplyMultipleVEX(Options{}, report, tc.docs)
+			require.NoError(t, err)
+			require.Len(t, newReport.Runs[0].Results, tc.expectedLength)
+
+			// The original report is untouched and applying again gives
+			// the same results
+			require.Len(t, report.Runs[0].Results, 1)
+			again, err := impl.ApplyMultipleVEX(Options{}, report, tc.docs)
+			require.NoError(t, err)
+			require.Equal(t, newReport, again)
+		})
+	}
+}
+
+func TestApplyVEXWithStats(t *testing.T) {
+	impl := defaultVexCtlImplementation{}
+	doc := newTestDocument(
+		vex.Statement{
+			Vulnerability: vex.Vulnerability{Name: "CVE-2023-0001"},
+			Products:      []vex.Product{{Component: vex.Component{ID: "pkg:oci/test"}}},
+			Status:        vex.StatusNotAffected,
+			Justification: vex.VulnerableCodeNotPresent,
+		},
+		vex.Statement{
+			Vulnerability: vex.Vulnerability{Name: "CVE-2023-0002"},
+			Products:      []vex.Product{{Component: vex.Component{ID: "pkg:oci/test"}}},
+			Status:        vex.StatusFixed,
+		},
+		vex.Statement{
+			Vulnerability: vex.Vulnerability{Name: "CVE-2023-0003"},
+			Products:      []vex.Product{{Component: vex.Component{ID: "pkg:oci/test"}}},
+			Status:        vex.StatusAffected,
+		},
+	)
+
+	newReportWithRuns := func() *sarif.Report {
+		report := newTestReport(
+			newTestResult("CVE-2023-0001", "finding 1"),
+			newTestResult("CVE-2023-0001", "finding 1 again"),
+			newTestResult("CVE-2023-0003", "finding 3"),
+			newTestResult("CVE-2023-0004", "finding 4"),
+		)
+		report.Runs = append(report.Runs, newTestReport(
+			newTestResult("CVE-2023-0002", "finding 2"),
+		).Runs[0])
+		return report
+	}
+
+	for _, mode := range []SuppressionMode{SuppressionModeRemove, SuppressionModeMark} {
+		t.Run(string(mode), func(t *testing.T) {
+			_, stats, err := impl.ApplyVEXWithStats(Options{SuppressionMode: mode}, newReportWithRuns(), []*vex.VEX{doc})
+			require.NoError(t, err)
+			require.Equal(t, []RunStats{
+				{Suppressed: 2, Retained: 2, Vulnerabilities: []string{"CVE-2023-0001"}, Untriaged: []string{"CVE-2023-0004"}},
+				{Suppressed: 1, Retained: 0, Vulnerabilities: []string{"CVE-2023-0002"}, Untriaged: []string{}},
+			}, stats.Runs)
+			require.Equal(t, 3, stats.Suppressed())
+			require.Equal(t, 5, stats.Total())
+			require.Equal(t, "suppressed 3 of 5 findings", stats.String())
+		})
+	}
+}
+
+func TestApplyUntriaged(t *testing.T) {
+	impl := defaultVexCtlImplementation{}
+	doc := newTestDocument(
+		vex.Statement{
+			Vulnerability: vex.Vulnerability{Name: "CVE-2023-0001"},
+			Products:      []vex.Product{{Component: vex.Component{ID: "pkg:oci/test"}}},
+			Status:        vex.StatusNotAffected,
+			Justification: vex.VulnerableCodeNotPresent,
+		},
+		vex.Statement{
+			Vulnerability: vex.Vulnerability{Name: "CVE-2023-0002"},
+			Products:      []vex.Product{{Component: vex.Component{ID: "pkg:oci/test"}}},
+			Status:        vex.StatusUnderInvestigation,
+		},
+	)
+	report := newTestReport(
+		newTestResult("CVE-2023-0001", "suppressed"),
+		newTestResult("CVE-2023-0002", "under investigation, a decision is pending"),
+		newTestResult("CVE-2023-0004", "no statement"),
+		newTestResult("CVE-2023-0003", "no statement"),
+		newTestResult("CVE-2023-0004", "no statement again"),
+		newTestResult("lint-rule", "not a vulnerability"),
+	)
+	report.Runs = append(report.Runs, newTestReport(newTestResult("GHSA-7rjr-3q55-vv33", "no statement")).Runs[0])
+
+	_, stats, err := impl.ApplyVEXWithStats(Options{}, report, []*vex.VEX{doc})
+	require.NoError(t, err)
+	require.Equal(t, []string{"CVE-2023-0003", "CVE-2023-0004", "GHSA-7rjr-3q55-vv33"}, stats.Untriaged())
+
+	newReport, err := impl.ApplySingleVEX(Options{FailOnUntriaged: true}, report, doc)
+	var untriaged *UntriagedError
+	require.ErrorAs(t, err, &untriaged)
+	require.Equal(t, []string{"CVE-2023-0003", "CVE-2023-0004", "GHSA-7rjr-3q55-vv33"}, untriaged.Vulnerabilities)
+	require.EqualError(t, err, "3 vulnerabilities have no VEX statement: CVE-2023-0003, CVE-2023-0004, GHSA-7rjr-3q55-vv33")
+	require.Len(t, newReport.Runs[0].Results, 5, "the filtered report is still returned")
+
+	// Triaging every finding makes it pass
+	for _, id := range untriaged.Vulnerabilities {
+		doc.Statements = append(doc.Statements, vex.Statement{
+			Vulnerability: vex.Vulnerability{Name: vex.VulnerabilityID(id)},
+			Products:      []vex.Product{{Component: vex.Component{ID: "pkg:oci/test"}}},
+			Status:        vex.StatusAffected,
+		})
+	}
+	_, err = impl.ApplySingleVEX(Options{FailOnUntriaged: true}, report, doc)
+	require.NoError(t, err)
+}
+
+func TestApplyCWE(t *testing.T) {
+	impl := defaultVexCtlImplementation{}
+	vexDoc, err := vex.Open("testdata/sarif/sample-cwe.openvex.json")
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name           string
+		opts           Options
+		expectedLength int
+	}{
+		{"not enabled", Options{}, 3},
+		{"enabled", Options{MatchCWE: true}, 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			report, err := sarif.Open("testdata/sarif/sast-cwe.sarif.json")
+			require.NoError(t, err)
+			newReport, err := impl.ApplySingleVEX(tc.opts, report, vexDoc)
+			require.NoError(t, err)
+			require.Len(t, newReport.Runs[0].Results, tc.expectedLength)
+			for _, res := range newReport.Runs[0].Results {
+				if tc.opts.MatchCWE {
+					// CWE-798 must not match the CWE-79 statement
+					require.NotEqual(t, "CWE-79", *res.RuleID)
+				}
+			}
+		})
+	}
+}
+
+func TestCanonicalRuleID(t *testing.T) {
+	custom := Options{RuleIDPatterns: map[string]*regexp.Regexp{
+		"MAL":  regexp.MustCompile(`^MAL-\d{4}-\d+`),
+		"GHSA": regexp.MustCompile(`^GHSA-[a-z]{4}`),
+	}}
+	for _, tc := range []struct {
+		ruleID     string
+		opts       Options
+		expectedID string
+		recognized bool
+	}{
+		{"CVE-2023-1234", Options{}, "CVE-2023-1234", true},
+		{"CVE-2023-1234-openssl", Options{}, "CVE-2023-1234", true},
+		{"CVE-2023-1234/", Options{}, "CVE-2023-1234", true},
+		{"CVE-junk", Options{}, "", false},
+		{"GHSA-xxxx-yyyy-zzzz", Options{}, "GHSA-xxxx-yyyy-zzzz", true},
+		{"GHSA-xxxx-yyyy-zzzz/extra", Options{}, "GHSA-xxxx-yyyy-zzzz", true},
+		{"GHSA-xxxx-yyyy-zzzz/", Options{}, "GHSA-xxxx-yyyy-zzzz", true},
+		{"GHSA-XXXX-YYYY-ZZZZ/extra", Options{}, "GHSA-XXXX-YYYY-ZZZZ", true},
+		{"RUSTSEC-2023-0001/tokio", Options{}, "RUSTSEC-2023-0001", true},
+		{"RUSTSEC-2023-0001:vendor", Options{}, "RUSTSEC-2023-0001", true},
+		{"GO-2023-1234_stdlib", Options{}, "GO-2023-1234", true},
+		{"RHSA-2023:1234-01", Options{}, "RHSA-2023:1234", true},
+		{"DSA-5432-1", Options{}, "DSA-5432-1", true},
+		{"SNYK-DEBIAN12-LIBDE265-3361563", Options{}, "SNYK-DEBIAN12-LIBDE265-3361563", true},
+		{"  OSV-2023-1234 ", Options{}, "OSV-2023-1234", true},
+		{"CWE-79", Options{}, "", false},
+		{"CWE-79/xss", Options{MatchCWE: true}, "CWE-79", true},
+		{"MAL-2023-1234/npm", Options{}, "", false},
+		{"MAL-2023-1234/npm", custom, "MAL-2023-1234", true},
+		{"GHSA-abcd-efgh-ijkl", custom, "GHSA-abcd", true},
+		{"UNKNOWN-1234", Options{}, "", false},
+		{"", Options{}, "", false},
+	} {
+		t.Run(tc.ruleID, func(t *testing.T) {
+			id, ok := canonicalRuleID(tc.opts, tc.ruleID)
+			require.Equal(t, tc.recognized, ok)
+			require.Equal(t, tc.expectedID, id)
+		})
+	}
+}
+
+func TestOptionsLogger(t *testing.T) {
+	global := logtest.NewGlobal()
+	defer logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks))
+
+	target, err := filepath.Abs("testdata/v020-1.vex.json")
+	require.NoError(t, err)
+	dir := t.TempDir()
+	link := filepath.Join(dir, "link.vex.json")
+	require.NoError(t, os.Symlink(target, link))
+	broken := filepath.Join(dir, "broken.vex.json")
+	require.NoError(t, os.WriteFile(broken, []byte(`{"@context": "https://openvex.dev/ns/v0.2.0",`), os.FileMode(0o644)))
+
+	logger, hook := logtest.NewNullLogger()
+	vexctl := New()
+	vexctl.Options.Logger = logger
+	vexctl.Options.ContinueOnLoadError = true
+
+	_, err = vexctl.MergeFiles(context.Background(), &MergeOptions{}, []string{target, link, broken})
+	require.NoError(t, err)
+
+	// Entries logged by the implementation and by VexCtl are captured
+	messages := []string{}
+	for _, entry := range hook.AllEntries() {
+		messages = append(messages, entry.Message)
+	}
+	require.Contains(t, messages, "Skipping "+link+", it has the same contents as "+target)
+	require.Contains(t, strings.Join(messages, "\n"), "Merging the documents that loaded")
+	require.Empty(t, global.AllEntries())
+}
@@ -0,0 +1,234 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	purl "github.com/package-url/packageurl-go"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// cdxBOM is a CycloneDX 1.5 BOM carrying VEX data
+//
+// https://cyclonedx.org/docs/1.5/json/
+type cdxBOM struct {
+	BOMFormat       string            `json:"bomFormat"`
+	SpecVersion     string            `json:"specVersion"`
+	Version         int               `json:"version"`
+	Metadata        cdxMetadata       `json:"metadata"`
+	Components      []cdxBOMComponent `json:"components"`
+	Vulnerabilities []cdxVEXStatement `json:"vulnerabilities"`
+}
+
+type cdxMetadata struct {
+	Timestamp string `json:"timestamp,omitempty"`
+}
+
+type cdxBOMComponent struct {
+	BOMRef string `json:"bom-ref"`
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	PURL   string `json:"purl,omitempty"`
+	CPE    string `json:"cpe,omitempty"`
+}
+
+type cdxVEXStatement struct {
+	ID          string      `json:"id"`
+	Description string      `json:"description,omitempty"`
+	Analysis    cdxAnalysis `json:"analysis"`
+	Affects     []cdxAffect `json:"affects"`
+}
+
+type cdxAnalysis struct {
+	State         string   `json:"state"`
+	Justification string   `json:"justification,omitempty"`
+	Response      []string `json:"response,omitempty"`
+	Detail        string   `json:"detail,omitempty"`
+	FirstIssued   string   `json:"firstIssued,omitempty"`
+	LastUpdated   string   `json:"lastUpdated,omitempty"`
+}
+
+type cdxAffect struct {
+	Ref string `json:"ref"`
+}
+
+// cdxStates maps the VEX statuses to CycloneDX analysis states
+var cdxStates = map[vex.Status]string{
+	vex.StatusNotAffected:        "not_affected",
+	vex.StatusAffected:           "exploitable",
+	vex.StatusFixed:              "resolved",
+	vex.StatusUnderInvestigation: "in_triage",
+}
+
+// cdxJustificationsFromVEX maps the VEX justifications to the closest
+// CycloneDX analysis justification.
+var cdxJustificationsFromVEX = map[vex.Justification]string{
+	vex.ComponentNotPresent:                         "code_not_present",
+	vex.VulnerableCodeNotPresent:                    "code_not_present",
+	vex.VulnerableCodeNotInExecutePath:              "code_not_reachable",
+	vex.VulnerableCodeCannotBeControlledByAdversary: "requires_environment",
+	vex.InlineMitigationsAlreadyExist:               "protected_by_mitigating_control",
+}
+
+// ToCycloneDX renders a VEX document as a CycloneDX 1.5 BOM with the VEX data
+// in its vulnerabilities. Products are listed as components with their
+// identifier as bom-ref and referenced in the affects of the vulnerabilities.
+// The latest statement about each product becomes the analysis of the
+// vulnerability: impact statements, action statements and status notes go
+// in its detail and the statement timestamps in firstIssued and lastUpdated.
+// Products with different statements about a vulnerability are listed in
+// separate vulnerability entries.
+func ToCycloneDX(doc *vex.VEX) ([]byte, error) {
+	if doc == nil {
+		return nil, errors.New("cannot render CycloneDX, vex document is nil")
+	}
+
+	docTime := time.Now().UTC()
+	if doc.Timestamp != nil {
+		docTime = doc.Timestamp.UTC()
+	}
+	version := doc.Version
+	if version < 1 {
+		version = 1
+	}
+
+	bom := cdxBOM{
+		BOMFormat:       "CycloneDX",
+		SpecVersion:     "1.5",
+		Version:         version,
+		Metadata:        cdxMetadata{Timestamp: docTime.Format(time.RFC3339)},
+		Components:      []cdxBOMComponent{},
+		Vulnerabilities: []cdxVEXStatement{},
+	}
+
+	latest, components, err := latestProductStatements(doc, docTime)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range sortedKeys(components) {
+		bom.Components = append(bom.Components, cdxComponentFromVEX(id, components[id]))
+	}
+
+	for _, name := range sortedKeys(latest) {
+		// Products sharing a statement are listed in the same entry
+		entries := map[*vex.Statement]*cdxVEXStatement{}
+		order := []*vex.Statement{}
+		for _, id := range sortedKeys(latest[name]) {
+			s := latest[name][id]
+			if _, ok := entries[s]; !ok {
+				entries[s] = cdxVulnerabilityFromStatement(s)
+				order = append(order, s)
+			}
+			entries[s].Affects = append(entries[s].Affects, cdxAffect{Ref: id})
+		}
+		for _, s := range order {
+			bom.Vulnerabilities = append(bom.Vulnerabilities, *entries[s])
+		}
+	}
+
+	data, err := json.MarshalIndent(bom, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshaling CycloneDX document: %w", err)
+	}
+	return data, nil
+}
+
+// cdxVulnerabilityFromStatement returns the CycloneDX vulnerability entry
+// for a statement, without the products it affects.
+func cdxVulnerabilityFromStatement(s *vex.Statement) *cdxVEXStatement {
+	v := &cdxVEXStatement{
+		ID:          string(s.Vulnerability.Name),
+		Description: s.Vulnerability.Description,
+		Analysis:    cdxAnalysis{State: cdxStates[s.Status]},
+		Affects:     []cdxAffect{},
+	}
+	details := []string{}
+	switch s.Status {
+	case vex.StatusNotAffected:
+		v.Analysis.Justification = cdxJustificationsFromVEX[s.Justification]
+		details = append(details, s.ImpactStatement)
+	case vex.StatusAffected:
+		details = append(details, s.ActionStatement)
+	case vex.StatusFixed:
+		v.Analysis.Response = []string{"update"}
+	}
+	details = append(details, s.StatusNotes)
+	v.Analysis.Detail = strings.TrimSpace(strings.Join(details, "\n"))
+
+	if s.Timestamp != nil {
+		v.Analysis.FirstIssued = s.Timestamp.UTC().Format(time.RFC3339)
+		v.Analysis.LastUpdated = v.Analysis.FirstIssued
+	}
+	if s.LastUpdated != nil {
+		v.Analysis.LastUpdated = s.LastUpdated.UTC().Format(time.RFC3339)
+	}
+	return v
+}
+
+// cdxComponentFromVEX returns the CycloneDX component for a VEX product.
+// The component type and name are taken from its purl when it has one.
+func cdxComponentFromVEX(id string, c *vex.Component) cdxBOMComponent {
+	comp := cdxBOMComponent{BOMRef: id, Type: "library", Name: id}
+	for t, ident := range c.Identifiers {
+		switch t {
+		case vex.PURL:
+			comp.PURL = ident
+		case vex.CPE22, vex.CPE23:
+			comp.CPE = ident
+		}
+	}
+	if comp.PURL == "" && strings.HasPrefix(id, "pkg:") {
+		comp.PURL = id
+	}
+	if comp.CPE == "" && strings.HasPrefix(id, "cpe:") {
+		comp.CPE = id
+	}
+	if p, err := purl.FromString(comp.PURL); err == nil && comp.PURL != "" {
+		comp.Name = p.Name
+		if p.Type == purl.TypeOCI {
+			comp.Type = "container"
+		}
+	}
+	return comp
+}
+
+// FromCycloneDX reads a CycloneDX VEX or BOM and returns its vulnerability
+// analysis as an OpenVEX document. The affects refs are resolved back to
+// the purls of the components, refs with no purl are used as the product
+// ID. Vulnerabilities without analysis are findings, not VEX data, and are
+// skipped. The serial number becomes the document ID when set.
+func FromCycloneDX(data []byte) (*vex.VEX, error) {
+	bom := sbomDocument{}
+	if err := json.Unmarshal(data, &bom); err != nil {
+		return nil, fmt.Errorf("parsing CycloneDX json: %w", err)
+	}
+	if bom.BOMFormat != "CycloneDX" {
+		return nil, errors.New("document is not a CycloneDX BOM")
+	}
+
+	doc := vex.New()
+	doc.Statements = bom.cdxStatements()
+	if bom.Version > 0 {
+		doc.Version = bom.Version
+	}
+	if bom.Metadata != nil {
+		if t := parseSBOMTime(bom.Metadata.Timestamp); t != nil {
+			doc.Timestamp = t
+		}
+	}
+	if bom.SerialNumber != "" {
+		doc.ID = bom.SerialNumber
+	} else if _, err := doc.GenerateCanonicalID(); err != nil {
+		return nil, fmt.Errorf("generating document ID: %w", err)
+	}
+	return &doc, nil
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+func TestToCycloneDX(t *testing.T) {
+	doc, err := vex.Open("testdata/export.openvex.json")
+	require.NoError(t, err)
+
+	data, err := ToCycloneDX(doc)
+	require.NoError(t, err)
+	golden, err := os.ReadFile("testdata/cyclonedx/export.cdx.json")
+	require.NoError(t, err)
+	require.JSONEq(t, string(golden), string(data))
+	requireValidJSON(t, data, "http://cyclonedx.org/schema/bom-1.5.schema.json", map[string]string{
+		"http://cyclonedx.org/schema/bom-1.5.schema.json":  "testdata/cyclonedx/schema/bom-1.5.schema.json",
+		"http://cyclonedx.org/schema/spdx.schema.json":     "testdata/cyclonedx/schema/spdx.schema.json",
+		"http://cyclonedx.org/schema/jsf-0.82.schema.json": "testdata/cyclonedx/schema/jsf-0.82.schema.json",
+	})
+
+	// Reading the VEX data back gets the latest status of each product
+	path := filepath.Join(t.TempDir(), "export.cdx.json")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	docs, err := LoadFromSBOM(path)
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+
+	statuses := []string{}
+	for _, s := range docs[0].Statements {
+		for _, p := range s.Products {
+			statuses = append(statuses, string(s.Vulnerability.Name)+" "+p.ID+" "+string(s.Status))
+		}
+	}
+	sort.Strings(statuses)
+	require.Equal(t, []string{
+		"CVE-2023-1234 pkg:apk/wolfi/bash@1.0.0 not_affected",
+		"CVE-2023-1234 pkg:oci/test@sha256%3A74634d9736a45ca9f6e1187e783492199e020f4a5c19d0b1abc2b604f894ac99 not_affected",
+		"CVE-2023-5678 glibc affected",
+		"CVE-2023-5678 pkg:apk/wolfi/bash@1.0.0 fixed",
+		"GHSA-xxxx-yyyy-zzzz pkg:apk/wolfi/bash@1.0.0 under_investigation",
+	}, statuses)
+
+	_, err = ToCycloneDX(nil)
+	require.Error(t, err)
+}
+
+func TestFromCycloneDX(t *testing.T) {
+	data, err := os.ReadFile("testdata/cyclonedx/scanner.vex.cdx.json")
+	require.NoError(t, err)
+
+	doc, err := FromCycloneDX(data)
+	require.NoError(t, err)
+	require.Equal(t, "urn:uuid:3e671687-395b-41f5-a30f-a58921a69b79", doc.ID)
+	require.Equal(t, 2, doc.Version)
+	require.Equal(t, time.Date(2024, 3, 12, 9, 41, 27, 0, time.UTC), *doc.Timestamp)
+
+	// The finding without analysis is skipped
+	require.Len(t, doc.Statements, 2)
+
+	s := doc.Statements[0]
+	require.Equal(t, vex.VulnerabilityID("CVE-2022-42003"), s.Vulnerability.Name)
+	require.Equal(t, []vex.VulnerabilityID{"GHSA-jjjh-jjxp-wpff"}, s.Vulnerability.Aliases)
+	require.Equal(t, vex.StatusNotAffected, s.Status)
+	require.Equal(t, vex.VulnerableCodeNotInExecutePath, s.Justification)
+	require.Equal(t, "UNWRAP_SINGLE_VALUE_ARRAYS is not enabled in the object mapper.", s.ImpactStatement)
+	require.Equal(t, time.Date(2024, 3, 11, 16, 2, 44, 0, time.UTC), *s.Timestamp)
+	require.Len(t, s.Products, 1)
+	require.Equal(t, "pkg:maven/com.fasterxml.jackson.core/jackson-databind@2.13.4.1?type=jar", s.Products[0].ID)
+
+	// Components without a purl keep their bom-ref as ID
+	s = doc.Statements[1]
+	require.Equal(t, vex.StatusUnderInvestigation, s.Status)
+	require.Len(t, s.Products, 2)
+	require.Equal(t, "pkg:apk/alpine/openssl@3.0.7-r0?arch=x86_64&distro=3.17.1", s.Products[0].ID)
+	require.Equal(t, "5b7c2d91-0e4f-4a8b-b6a3-98d1c7e2f0aa", s.Products[1].ID)
+	require.NoError(t, doc.Statements[1].Validate())
+
+	_, err = FromCycloneDX([]byte(`{"spdxVersion": "SPDX-2.3"}`))
+	require.Error(t, err)
+	_, err = FromCycloneDX([]byte(`not json`))
+	require.Error(t, err)
+}
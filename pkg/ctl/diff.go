@@ -0,0 +1,182 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// VexDiff lists the changes between the statements of two VEX documents. The
+// changes are keyed by vulnerability and product, comparing the latest
+// statement about each pair in both documents.
+type VexDiff struct {
+	Added     []StatementChange `json:"added"`     // Pairs only in the new document
+	Removed   []StatementChange `json:"removed"`   // Pairs only in the old document
+	Changed   []StatementChange `json:"changed"`   // Pairs with a substantive change
+	Timestamp []StatementChange `json:"timestamp"` // Pairs where only the timestamps changed
+}
+
+// StatementChange is the change to the statement about a vulnerability and
+// product. Before is nil for added statements and After for removed ones.
+type StatementChange struct {
+	Vulnerability string         `json:"vulnerability"`
+	Product       string         `json:"product"`
+	Fields        []string       `json:"fields,omitempty"` // Names of the fields that changed
+	Before        *vex.Statement `json:"before,omitempty"`
+	After         *vex.Statement `json:"after,omitempty"`
+}
+
+// Empty returns true when the documents have the same statements
+func (d *VexDiff) Empty() bool {
+	return len(d.Added)+len(d.Removed)+len(d.Changed)+len(d.Timestamp) == 0
+}
+
+// String returns a human-readable summary of the changes, one per line
+func (d *VexDiff) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(
+		&sb, "%d added, %d removed, %d changed, %d timestamp only\n",
+		len(d.Added), len(d.Removed), len(d.Changed), len(d.Timestamp),
+	)
+	for _, c := range d.Added {
+		fmt.Fprintf(&sb, "+ %s %s: %s\n", c.Vulnerability, c.Product, c.After.Status)
+	}
+	for _, c := range d.Removed {
+		fmt.Fprintf(&sb, "- %s %s: %s\n", c.Vulnerability, c.Product, c.Before.Status)
+	}
+	for _, c := range d.Changed {
+		fmt.Fprintf(&sb, "~ %s %s: %s", c.Vulnerability, c.Product, strings.Join(c.Fields, ", "))
+		if c.Before.Status != c.After.Status {
+			fmt.Fprintf(&sb, " (%s -> %s)", c.Before.Status, c.After.Status)
+		}
+		sb.WriteString("\n")
+	}
+	for _, c := range d.Timestamp {
+		fmt.Fprintf(&sb, "= %s %s: %s\n", c.Vulnerability, c.Product, strings.Join(c.Fields, ", "))
+	}
+	return sb.String()
+}
+
+// Diff compares the latest statement about each vulnerability and product in
+// document a with those in document b. Statements without a timestamp take
+// the one from their document. Changes that only touch the timestamps are
+// listed apart from the substantive ones.
+func Diff(a, b *vex.VEX) (*VexDiff, error) {
+	if a == nil || b == nil {
+		return nil, errors.New("cannot diff, vex document is nil")
+	}
+
+	before, _, err := latestProductStatements(a, documentTime(a))
+	if err != nil {
+		return nil, fmt.Errorf("reading old document: %w", err)
+	}
+	after, _, err := latestProductStatements(b, documentTime(b))
+	if err != nil {
+		return nil, fmt.Errorf("reading new document: %w", err)
+	}
+
+	diff := &VexDiff{
+		Added:     []StatementChange{},
+		Removed:   []StatementChange{},
+		Changed:   []StatementChange{},
+		Timestamp: []StatementChange{},
+	}
+	for _, vuln := range sortedKeys(before) {
+		for _, id := range sortedKeys(before[vuln]) {
+			if _, ok := after[vuln][id]; !ok {
+				diff.Removed = append(diff.Removed, StatementChange{
+					Vulnerability: vuln, Product: id, Before: before[vuln][id],
+				})
+			}
+		}
+	}
+	for _, vuln := range sortedKeys(after) {
+		for _, id := range sortedKeys(after[vuln]) {
+			change := StatementChange{Vulnerability: vuln, Product: id, Before: before[vuln][id], After: after[vuln][id]}
+			if change.Before == nil {
+				diff.Added = append(diff.Added, change)
+				continue
+			}
+			if change.Fields = changedFields(change.Before, change.After); len(change.Fields) > 0 {
+				diff.Changed = append(diff.Changed, change)
+				continue
+			}
+			change.Fields = changedTimestamps(change.Before, documentTime(a), change.After, documentTime(b))
+			if len(change.Fields) > 0 {
+				diff.Timestamp = append(diff.Timestamp, change)
+			}
+		}
+	}
+	return diff, nil
+}
+
+// documentTime returns the document timestamp or the zero time when unset
+func documentTime(doc *vex.VEX) time.Time {
+	if doc.Timestamp != nil {
+		return *doc.Timestamp
+	}
+	return time.Time{}
+}
+
+// changedFields returns the names of the substantive fields that differ
+// between two statements.
+func changedFields(a, b *vex.Statement) []string {
+	fields := []string{}
+	for _, f := range []struct {
+		name    string
+		changed bool
+	}{
+		{"status", a.Status != b.Status},
+		{"justification", a.Justification != b.Justification},
+		{"impact_statement", a.ImpactStatement != b.ImpactStatement},
+		{"action_statement", a.ActionStatement != b.ActionStatement},
+		{"status_notes", a.StatusNotes != b.StatusNotes},
+		{"products", !slices.Equal(statementProductIDs(a), statementProductIDs(b))},
+	} {
+		if f.changed {
+			fields = append(fields, f.name)
+		}
+	}
+	return fields
+}
+
+// changedTimestamps returns the names of the timestamp fields that differ
+// between two statements, after cascading the document timestamps.
+func changedTimestamps(a *vex.Statement, aTime time.Time, b *vex.Statement, bTime time.Time) []string {
+	fields := []string{}
+	if a.Timestamp != nil {
+		aTime = *a.Timestamp
+	}
+	if b.Timestamp != nil {
+		bTime = *b.Timestamp
+	}
+	if !aTime.Equal(bTime) {
+		fields = append(fields, "timestamp")
+	}
+	if (a.LastUpdated == nil) != (b.LastUpdated == nil) ||
+		(a.LastUpdated != nil && !a.LastUpdated.Equal(*b.LastUpdated)) {
+		fields = append(fields, "last_updated")
+	}
+	return fields
+}
+
+// statementProductIDs returns the sorted identifiers of the statement products
+func statementProductIDs(s *vex.Statement) []string {
+	ids := []string{}
+	for i := range s.Products {
+		if id := productIdentifier(&s.Products[i].Component); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
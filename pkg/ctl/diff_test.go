@@ -0,0 +1,141 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+func TestDiff(t *testing.T) {
+	t1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(24 * time.Hour)
+	newStatement := func(vuln string, status vex.Status, ts *time.Time, products ...string) vex.Statement {
+		s := vex.Statement{Vulnerability: vex.Vulnerability{Name: vex.VulnerabilityID(vuln)}, Status: status, Timestamp: ts}
+		for _, p := range products {
+			s.Products = append(s.Products, vex.Product{Component: vex.Component{ID: p}})
+		}
+		return s
+	}
+	newDoc := func(ts *time.Time, statements ...vex.Statement) *vex.VEX {
+		return &vex.VEX{Metadata: vex.Metadata{Timestamp: ts}, Statements: statements}
+	}
+
+	for _, tc := range []struct {
+		name     string
+		a, b     *vex.VEX
+		expected []string // kind, vulnerability, product and fields of each change
+	}{
+		{
+			"same document",
+			newDoc(&t1, newStatement("CVE-1", vex.StatusAffected, nil, "pkg:a")),
+			newDoc(&t1, newStatement("CVE-1", vex.StatusAffected, nil, "pkg:a")),
+			[]string{},
+		},
+		{
+			"added and removed",
+			newDoc(&t1, newStatement("CVE-1", vex.StatusAffected, nil, "pkg:a")),
+			newDoc(&t1, newStatement("CVE-2", vex.StatusAffected, nil, "pkg:a")),
+			[]string{"added CVE-2 pkg:a", "removed CVE-1 pkg:a"},
+		},
+		{
+			"status change",
+			newDoc(&t1, newStatement("CVE-1", vex.StatusUnderInvestigation, nil, "pkg:a")),
+			newDoc(&t2, newStatement("CVE-1", vex.StatusFixed, nil, "pkg:a")),
+			[]string{"changed CVE-1 pkg:a status"},
+		},
+		{
+			"justification change",
+			newDoc(&t1, func() vex.Statement {
+				s := newStatement("CVE-1", vex.StatusNotAffected, nil, "pkg:a")
+				s.Justification = vex.ComponentNotPresent
+				return s
+			}()),
+			newDoc(&t1, func() vex.Statement {
+				s := newStatement("CVE-1", vex.StatusNotAffected, nil, "pkg:a")
+				s.Justification = vex.VulnerableCodeNotPresent
+				return s
+			}()),
+			[]string{"changed CVE-1 pkg:a justification"},
+		},
+		{
+			"products change",
+			newDoc(&t1, newStatement("CVE-1", vex.StatusAffected, nil, "pkg:a", "pkg:b")),
+			newDoc(&t1, newStatement("CVE-1", vex.StatusAffected, nil, "pkg:a")),
+			[]string{"changed CVE-1 pkg:a products", "removed CVE-1 pkg:b"},
+		},
+		{
+			"timestamp only",
+			newDoc(&t1, newStatement("CVE-1", vex.StatusAffected, nil, "pkg:a")),
+			newDoc(&t2, newStatement("CVE-1", vex.StatusAffected, nil, "pkg:a")),
+			[]string{"timestamp CVE-1 pkg:a timestamp"},
+		},
+		{
+			"cascaded timestamp is not a change",
+			newDoc(&t1, newStatement("CVE-1", vex.StatusAffected, nil, "pkg:a")),
+			newDoc(&t2, newStatement("CVE-1", vex.StatusAffected, &t1, "pkg:a")),
+			[]string{},
+		},
+		{
+			"latest statement is compared",
+			newDoc(&t1,
+				newStatement("CVE-1", vex.StatusUnderInvestigation, &t1, "pkg:a"),
+				newStatement("CVE-1", vex.StatusFixed, &t2, "pkg:a"),
+			),
+			newDoc(&t2, newStatement("CVE-1", vex.StatusFixed, &t2, "pkg:a")),
+			[]string{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			diff, err := Diff(tc.a, tc.b)
+			require.NoError(t, err)
+			changes := []string{}
+			for kind, list := range map[string][]StatementChange{
+				"added": diff.Added, "removed": diff.Removed, "changed": diff.Changed, "timestamp": diff.Timestamp,
+			} {
+				for _, c := range list {
+					s := kind + " " + c.Vulnerability + " " + c.Product
+					for _, f := range c.Fields {
+						s += " " + f
+					}
+					changes = append(changes, s)
+				}
+			}
+			require.ElementsMatch(t, tc.expected, changes)
+			require.Equal(t, len(tc.expected) == 0, diff.Empty())
+		})
+	}
+
+	a := newDoc(&t1,
+		newStatement("CVE-1", vex.StatusUnderInvestigation, nil, "pkg:a"),
+		newStatement("CVE-2", vex.StatusAffected, nil, "pkg:a"),
+	)
+	b := newDoc(&t2,
+		newStatement("CVE-1", vex.StatusFixed, nil, "pkg:a"),
+		newStatement("CVE-3", vex.StatusAffected, nil, "pkg:a"),
+	)
+	diff, err := Diff(a, b)
+	require.NoError(t, err)
+	require.Equal(t, "1 added, 1 removed, 1 changed, 0 timestamp only\n"+
+		"+ CVE-3 pkg:a: affected\n"+
+		"- CVE-2 pkg:a: affected\n"+
+		"~ CVE-1 pkg:a: status (under_investigation -> fixed)\n", diff.String())
+
+	data, err := json.Marshal(diff)
+	require.NoError(t, err)
+	decoded := VexDiff{}
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Len(t, decoded.Changed, 1)
+	require.Equal(t, vex.StatusFixed, decoded.Changed[0].After.Status)
+
+	_, err = Diff(nil, b)
+	require.Error(t, err)
+}
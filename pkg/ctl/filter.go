@@ -0,0 +1,104 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"errors"
+	"time"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// FilterSpec selects the statements of a document. Empty fields match all
+// statements, a statement has to match all the fields set to be selected.
+type FilterSpec struct {
+	Products        []string     // Product IDs or identifiers, any of them has to match
+	Vulnerabilities []string     // Vulnerability names or aliases, any of them has to match
+	Statuses        []vex.Status // Statuses of the statements to keep
+	Since           time.Time    // Keep statements issued at or after this time
+	Until           time.Time    // Keep statements issued at or before this time
+
+	ProductMatchMode ProductMatchMode // How Products are compared to the statement products (default exact)
+}
+
+// Filter returns a new document with the metadata of doc and only the
+// statements matching the filter spec. Statements without a timestamp are
+// dated with the document timestamp when filtering by time. The statements
+// are copied, the original document is not modified.
+func Filter(doc *vex.VEX, f FilterSpec) (*vex.VEX, error) {
+	if doc == nil {
+		return nil, errors.New("cannot filter, vex document is nil")
+	}
+
+	filtered := &vex.VEX{Metadata: doc.Metadata, Statements: []vex.Statement{}}
+	for i := range doc.Statements {
+		if f.matches(&doc.Statements[i], doc.Timestamp) {
+			filtered.Statements = append(filtered.Statements, doc.Statements[i])
+		}
+	}
+	return filtered, nil
+}
+
+// matches returns true if the statement is selected by the filter. docTime
+// is used for statements without a timestamp, it may be nil.
+func (f *FilterSpec) matches(s *vex.Statement, docTime *time.Time) bool {
+	if len(f.Products) > 0 {
+		found := false
+		for _, id := range f.Products {
+			if statementMatchesProduct(s, id, f.ProductMatchMode) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(f.Vulnerabilities) > 0 {
+		found := false
+		for _, id := range f.Vulnerabilities {
+			if vulnerabilityMatchesID(&s.Vulnerability, id) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(f.Statuses) > 0 {
+		found := false
+		for _, status := range f.Statuses {
+			if s.Status == status {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if f.Since.IsZero() && f.Until.IsZero() {
+		return true
+	}
+	ts := s.Timestamp
+	if ts == nil {
+		ts = docTime
+	}
+	if ts == nil {
+		return false
+	}
+	if !f.Since.IsZero() && ts.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && ts.After(f.Until) {
+		return false
+	}
+	return true
+}
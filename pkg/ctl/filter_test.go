@@ -0,0 +1,80 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+func TestFilter(t *testing.T) {
+	t1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(24 * time.Hour)
+	t3 := t2.Add(24 * time.Hour)
+	newStatement := func(id, vuln, product string, status vex.Status, ts *time.Time) vex.Statement {
+		return vex.Statement{
+			ID:            id,
+			Vulnerability: vex.Vulnerability{Name: vex.VulnerabilityID(vuln), Aliases: []vex.VulnerabilityID{"GHSA-" + vex.VulnerabilityID(id)}},
+			Products:      []vex.Product{{Component: vex.Component{ID: product}}},
+			Status:        status,
+			Timestamp:     ts,
+		}
+	}
+	doc := &vex.VEX{
+		Metadata: vex.Metadata{ID: "https://openvex.dev/docs/test", Timestamp: &t3},
+		Statements: []vex.Statement{
+			newStatement("a", "CVE-2023-1234", "pkg:apk/wolfi/bash@1.0.0", vex.StatusAffected, &t1),
+			newStatement("b", "CVE-2023-1234", "pkg:apk/wolfi/git@2.41.0", vex.StatusFixed, &t2),
+			newStatement("c", "CVE-2023-5678", "pkg:apk/wolfi/bash@1.0.0", vex.StatusUnderInvestigation, nil),
+		},
+	}
+
+	for _, tc := range []struct {
+		name     string
+		spec     FilterSpec
+		expected []string
+	}{
+		{"empty spec", FilterSpec{}, []string{"a", "b", "c"}},
+		{"product", FilterSpec{Products: []string{"pkg:apk/wolfi/bash@1.0.0"}}, []string{"a", "c"}},
+		{"any product", FilterSpec{Products: []string{"pkg:apk/wolfi/git@2.41.0", "pkg:apk/wolfi/curl@8.1.0"}}, []string{"b"}},
+		{"vulnerability", FilterSpec{Vulnerabilities: []string{"CVE-2023-1234"}}, []string{"a", "b"}},
+		{"vulnerability alias", FilterSpec{Vulnerabilities: []string{"GHSA-c"}}, []string{"c"}},
+		{"status", FilterSpec{Statuses: []vex.Status{vex.StatusAffected, vex.StatusUnderInvestigation}}, []string{"a", "c"}},
+		{"since", FilterSpec{Since: t2}, []string{"b", "c"}},
+		{"until", FilterSpec{Until: t2}, []string{"a", "b"}},
+		{"time range", FilterSpec{Since: t2, Until: t2}, []string{"b"}},
+		{
+			"all dimensions",
+			FilterSpec{
+				Products:        []string{"pkg:apk/wolfi/bash@1.0.0"},
+				Vulnerabilities: []string{"CVE-2023-1234"},
+				Statuses:        []vex.Status{vex.StatusAffected},
+				Until:           t1,
+			},
+			[]string{"a"},
+		},
+		{"no match", FilterSpec{Statuses: []vex.Status{vex.StatusNotAffected}}, []string{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			filtered, err := Filter(doc, tc.spec)
+			require.NoError(t, err)
+			require.Equal(t, doc.Metadata, filtered.Metadata)
+			ids := []string{}
+			for _, s := range filtered.Statements {
+				ids = append(ids, s.ID)
+			}
+			require.Equal(t, tc.expected, ids)
+		})
+	}
+	require.Len(t, doc.Statements, 3, "the original document is not modified")
+
+	_, err := Filter(nil, FilterSpec{})
+	require.Error(t, err)
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+const (
+	// FormatOpenVEX is the format reported by DetectFormat for OpenVEX documents
+	FormatOpenVEX = "openvex"
+
+	// FormatCSAF is the format reported by DetectFormat for CSAF documents
+	FormatCSAF = "csaf"
+
+	// openVEXLegacyVersion is the version of OpenVEX documents whose
+	// context does not carry a version
+	openVEXLegacyVersion = "0.0.1"
+)
+
+// formatProbe captures the fields used to tell VEX formats apart.
+type formatProbe struct {
+	Context  json.RawMessage `json:"@context"`
+	ID       string          `json:"@id"`
+	Document *struct {
+		CSAFVersion string `json:"csaf_version"`
+	} `json:"document"`
+}
+
+// DetectFormat inspects the document at path and returns its format and
+// version without loading it. OpenVEX versions are read from the @context
+// field: the unversioned context is reported as 0.0.1.
+func DetectFormat(path string) (format, version string, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", fmt.Errorf("reading document: %w", err)
+	}
+
+	probe := formatProbe{}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return "", "", fmt.Errorf("parsing %s as json: %w", path, err)
+	}
+
+	if probe.Document != nil && probe.Document.CSAFVersion != "" {
+		return FormatCSAF, probe.Document.CSAFVersion, nil
+	}
+
+	if len(probe.Context) == 0 {
+		return "", "", fmt.Errorf("%s is not a VEX document: no @context or csaf_version found", path)
+	}
+
+	var context string
+	if err := json.Unmarshal(probe.Context, &context); err != nil {
+		return "", "", fmt.Errorf("%s is not a VEX document: @context is not a string", path)
+	}
+
+	version, ok := openVEXVersion(context)
+	if !ok {
+		return "", "", fmt.Errorf("%s is not a VEX document: unknown @context %q", path, context)
+	}
+	if probe.ID == "" {
+		return "", "", fmt.Errorf("%s is not a valid OpenVEX document: missing @id", path)
+	}
+	return FormatOpenVEX, version, nil
+}
+
+// openVEXVersion returns the OpenVEX version encoded in a document context.
+func openVEXVersion(context string) (string, bool) {
+	if !strings.HasPrefix(context, vex.Context) {
+		return "", false
+	}
+	suffix := strings.TrimPrefix(context, vex.Context)
+	if suffix == "" || suffix == "/" {
+		return openVEXLegacyVersion, true
+	}
+	if !strings.HasPrefix(suffix, "/v") {
+		return "", false
+	}
+	version := strings.TrimPrefix(suffix, "/v")
+	if version == "" {
+		return "", false
+	}
+	return version, true
+}
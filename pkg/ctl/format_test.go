@@ -0,0 +1,38 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectFormat(t *testing.T) {
+	for name, tc := range map[string]struct {
+		path    string
+		format  string
+		version string
+		errMsg  string
+	}{
+		"openvex v0.0.1": {"testdata/v001-1.vex.json", FormatOpenVEX, "0.0.1", ""},
+		"openvex v0.2.0": {"testdata/v020-1.vex.json", FormatOpenVEX, "0.2.0", ""},
+		"csaf":           {"testdata/csaf/advisory.csaf.json", FormatCSAF, "2.0", ""},
+		"not vex":        {"testdata/format/package.json", "", "", "is not a VEX document"},
+		"missing file":   {"testdata/format/missing.json", "", "", "reading document"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			format, version, err := DetectFormat(tc.path)
+			if tc.errMsg != "" {
+				require.ErrorContains(t, err, tc.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.format, format)
+			require.Equal(t, tc.version, version)
+		})
+	}
+}
@@ -11,26 +11,42 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/google/go-containerregistry/pkg/crane"
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	gosarif "github.com/owenrumney/go-sarif/sarif"
 	purl "github.com/package-url/packageurl-go"
 	ssldsse "github.com/secure-systems-lab/go-securesystemslib/dsse"
+	"github.com/sigstore/cosign/v2/cmd/cosign/cli/fulcio"
 	"github.com/sigstore/cosign/v2/cmd/cosign/cli/options"
+	"github.com/sigstore/cosign/v2/cmd/cosign/cli/rekor"
 	"github.com/sigstore/cosign/v2/pkg/cosign"
 	cbundle "github.com/sigstore/cosign/v2/pkg/cosign/bundle"
+	"github.com/sigstore/cosign/v2/pkg/oci"
 	"github.com/sigstore/cosign/v2/pkg/oci/mutate"
 	ociremote "github.com/sigstore/cosign/v2/pkg/oci/remote"
 	"github.com/sigstore/cosign/v2/pkg/oci/static"
+	sigs "github.com/sigstore/cosign/v2/pkg/signature"
 	"github.com/sigstore/cosign/v2/pkg/types"
+	"github.com/sigstore/sigstore/pkg/signature"
+	"github.com/sigstore/sigstore/pkg/signature/dsse"
+	"github.com/sigstore/sigstore/pkg/tuf"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
 	"sigs.k8s.io/release-utils/util"
 
 	"github.com/openvex/go-vex/pkg/sarif"
@@ -41,6 +57,18 @@ import (
 const (
 	IntotoPayloadType = "application/vnd.in-toto+json"
 
+	// StdinPath is the path that makes OpenVexData and LoadFiles read the
+	// VEX document from stdin.
+	StdinPath = "-"
+
+	// DefaultConcurrency is the number of image references attestations are
+	// attached to or read from at the same time when not set in the options.
+	DefaultConcurrency = 4
+
+	// SBOMAttestationAnnotation is the manifest annotation that links an
+	// attached VEX attestation to the digest of a related SBOM attestation.
+	SBOMAttestationAnnotation = "dev.openvex.sbom-attestation"
+
 	initReadmeMarkdown = "# OpenVEX Templates Directory\n\n" +
 		"This directory contains the OpenVEX data for this repository.\n" +
 		"The files stored in this directory are used as templates by\n" +
@@ -65,413 +93,2384 @@ const (
 )
 
 type Implementation interface {
-	ApplySingleVEX(*sarif.Report, *vex.VEX) (*sarif.Report, error)
+	ApplySingleVEX(Options, *sarif.Report, *vex.VEX) (*sarif.Report, error)
+	ApplyMultipleVEX(Options, *sarif.Report, []*vex.VEX) (*sarif.Report, error)
+	ApplyVEXWithStats(Options, *sarif.Report, []*vex.VEX) (*sarif.Report, *ApplyStats, error)
 	SortDocuments([]*vex.VEX) []*vex.VEX
 	OpenVexData(Options, []string) ([]*vex.VEX, error)
 	Sort(docs []*vex.VEX) []*vex.VEX
 	AttestationBytes(*attestation.Attestation) ([]byte, error)
-	Attach(context.Context, *attestation.Attestation, ...string) error
+	WriteAttestationFile(*attestation.Attestation, string) error
+	VerifyAttestationFile(context.Context, string, string) (*vex.VEX, error)
+	SignAttestation(context.Context, *attestation.Attestation, string) ([]byte, error)
+	SignAttestationWithOptions(context.Context, *attestation.Attestation, string, attestation.SigningOptions) ([]byte, error)
+	UploadToTlog(context.Context, *attestation.Attestation, string) error
+	Attach(context.Context, Options, *attestation.Attestation, ...string) (AttachResult, error)
 	SourceType(uri string) (string, error)
+	FetchVexData(context.Context, Options, string) (*vex.VEX, error)
 	ReadImageAttestations(context.Context, Options, string) ([]*vex.VEX, error)
+	ReadImageAttestationsByDigest(context.Context, Options, string) ([]*vex.VEX, error)
+	ReadImageAttestationsMulti(context.Context, Options, []string) (map[string][]*vex.VEX, error)
 	Merge(context.Context, *MergeOptions, []*vex.VEX) (*vex.VEX, error)
-	LoadFiles(context.Context, []string) ([]*vex.VEX, error)
+	LoadFiles(context.Context, Options, []string) ([]*vex.VEX, error)
+	LoadDirectory(context.Context, string, bool, bool) ([]*vex.VEX, error)
 	ListDocumentProducts(doc *vex.VEX) ([]productRef, error)
+	StreamDocumentProducts(path string) ([]productRef, error)
+	ListDocumentVulnerabilities(doc *vex.VEX) ([]vex.VulnerabilityID, error)
 	NormalizeProducts([]productRef) ([]productRef, []productRef, []productRef, error)
+	ExpandImageIndexes(context.Context, Options, []productRef) ([]productRef, error)
+	ResolveImageMediaTypes(context.Context, Options, []productRef) []productRef
 	VerifyImageSubjects(*attestation.Attestation, *vex.VEX) error
+	VerifySubjectDigests(context.Context, *attestation.Attestation, RegistryOptions) error
+	PinProductDigests(context.Context, *vex.VEX, RegistryOptions) (*vex.VEX, error)
 	ReadTemplateData(*GenerateOpts, []*vex.Product) (*vex.VEX, error)
 	InitTemplatesDir(string) error
 }
 
-type defaultVexCtlImplementation struct{}
+type defaultVexCtlImplementation struct {
+	// logger receives the implementation's log output. When nil, the
+	// Logger of options is used.
+	logger logrus.FieldLogger
+
+	// options points to the Options of the VexCtl the implementation
+	// belongs to.
+	options *Options
+
+	// stdin is where documents are read from when the path is StdinPath.
+	// When nil, os.Stdin is used.
+	stdin io.Reader
+}
+
+// log returns the logger the implementation writes to
+func (impl *defaultVexCtlImplementation) log() logrus.FieldLogger {
+	if impl.logger != nil {
+		return impl.logger
+	}
+	if impl.options != nil {
+		return impl.options.log()
+	}
+	return logrus.StandardLogger()
+}
+
+// input returns the reader documents passed as StdinPath are read from
+func (impl *defaultVexCtlImplementation) input() io.Reader {
+	if impl.stdin == nil {
+		return os.Stdin
+	}
+	return impl.stdin
+}
+
+// DigestAlgorithms maps the algorithm prefixes of the digests in OCI purl
+// versions (eg sha256:abc...) to the VEX hash algorithms. Digests with
+// other prefixes are kept using the prefix as the algorithm name.
+var DigestAlgorithms = map[string]vex.Algorithm{
+	"md5":         vex.MD5,
+	"sha1":        vex.SHA1,
+	"sha256":      vex.SHA256,
+	"sha384":      vex.SHA384,
+	"sha512":      vex.SHA512,
+	"sha3-224":    vex.SHA3224,
+	"sha3-256":    vex.SHA3256,
+	"sha3-384":    vex.SHA3384,
+	"sha3-512":    vex.SHA3512,
+	"blake2s-256": vex.BLAKE2S256,
+	"blake2b-256": vex.BLAKE2B256,
+	"blake2b-512": vex.BLAKE2B512,
+	"blake3":      vex.BLAKE3,
+}
 
-var cveRegexp regexp.Regexp
+// DefaultRuleIDPrefixes are the prefixes of the SARIF rule IDs, other than
+// CVE, that are recognized as vulnerability identifiers.
+var DefaultRuleIDPrefixes = []string{
+	"ALAS", "DSA", "ELSA", "GHSA", "GO", "OSV", "PRISMA", "RHSA", "RUSTSEC", "SNYK",
+}
 
-func init() {
-	cveRegexp = *regexp.MustCompile(`^(CVE-\d+-\d+)`)
+// cweRegexp captures the CWE identifier at the start of a rule ID
+var cweRegexp = regexp.MustCompile(`^CWE-\d+`)
+
+// DefaultRuleIDPatterns map rule ID prefixes to the expression that extracts
+// the canonical vulnerability identifier from the rule IDs. Scanners append
+// data to the IDs (eg Grype adds junk to CVEs, others add /suffixes) that
+// would not match clean statement IDs.
+var DefaultRuleIDPatterns = map[string]*regexp.Regexp{
+	"CVE":     regexp.MustCompile(`^CVE-\d+-\d+`),
+	"CWE":     cweRegexp,
+	"DSA":     regexp.MustCompile(`^DSA-\d+(-\d+)?`),
+	"GHSA":    regexp.MustCompile(`(?i)^GHSA(-[0-9a-z]{4}){3}`),
+	"GO":      regexp.MustCompile(`^GO-\d{4}-\d+`),
+	"RHSA":    regexp.MustCompile(`^RHSA-\d{4}:\d+`),
+	"RUSTSEC": regexp.MustCompile(`^RUSTSEC-\d{4}-\d+`),
 }
 
+// messageVulnRegexp matches the CVE and GHSA identifiers that may be
+// mentioned in the free text of a SARIF result message.
+var messageVulnRegexp = regexp.MustCompile(`\b(CVE-\d{4}-\d{4,}|GHSA(?i:-[23456789cfghjmpqrvwx]{4}){3})\b`)
+
 func (impl *defaultVexCtlImplementation) SortDocuments(docs []*vex.VEX) []*vex.VEX {
 	return vex.SortDocuments(docs)
 }
 
-func (impl *defaultVexCtlImplementation) ApplySingleVEX(report *sarif.Report, vexDoc *vex.VEX) (*sarif.Report, error) {
-	newReport := *report
-	logrus.Infof("VEX document contains %d statements", len(vexDoc.Statements))
+func (impl *defaultVexCtlImplementation) ApplySingleVEX(opts Options, report *sarif.Report, vexDoc *vex.VEX) (*sarif.Report, error) {
+	newReport, _, err := impl.ApplyVEXWithStats(opts, report, []*vex.VEX{vexDoc})
+	return newReport, err
+}
+
+// ApplyMultipleVEX applies a set of VEX documents to a report. Documents are
+// sorted by date and statements in later documents override the earlier ones,
+// so a newer document can reopen a vulnerability. The original report is not
+// modified.
+func (impl *defaultVexCtlImplementation) ApplyMultipleVEX(opts Options, report *sarif.Report, vexDocs []*vex.VEX) (*sarif.Report, error) {
+	newReport, _, err := impl.ApplyVEXWithStats(opts, report, vexDocs)
+	return newReport, err
+}
+
+// ApplyVEXWithStats is like ApplyMultipleVEX but also returns the number of
+// results suppressed and retained in each run of the report.
+func (impl *defaultVexCtlImplementation) ApplyVEXWithStats(
+	opts Options, report *sarif.Report, vexDocs []*vex.VEX,
+) (*sarif.Report, *ApplyStats, error) {
+	if err := opts.ProductMatchMode.validate(); err != nil {
+		return nil, nil, err
+	}
+	docs := []*vex.VEX{}
+	statements := 0
+	for _, doc := range vexDocs {
+		if doc != nil {
+			docs = append(docs, doc)
+			statements += len(doc.Statements)
+		}
+	}
+	docs = impl.SortDocuments(docs)
+	impl.log().Debugf("Applying %d VEX documents containing %d statements", len(docs), statements)
 
-	sortedStatements := vexDoc.Statements
-	vex.SortStatements(sortedStatements, *vexDoc.Timestamp)
+	newReport := *report
+	newReport.Runs = make([]*gosarif.Run, len(report.Runs))
+	stats := &ApplyStats{Runs: make([]RunStats, len(report.Runs))}
+	matcher := NewMatcher()
+	matcher.ProductMatchMode = opts.ProductMatchMode
 
 	// Search for negative VEX statements, that is those that cancel a CVE
 	for i := range report.Runs {
+		run := *report.Runs[i]
 		newResults := []*gosarif.Result{}
-		logrus.Infof("Inspecting SARIF run #%d containing %d results", i, len(report.Runs[i].Results))
-		for _, res := range report.Runs[i].Results {
-			id := ""
-			parts := strings.SplitN(strings.TrimSpace(*res.RuleID), "-", 2)
-			switch parts[0] {
-			case "CVE":
-				// Trim rule ID to CVE as Grype adds junk to the CVE ID
-				m := cveRegexp.FindStringSubmatch(*res.RuleID)
-				if len(m) == 2 {
-					id = m[1]
-				} else {
-					logrus.Errorf(
-						"Invalid rulename in sarif report, expected CVE identifier, got %s",
-						*res.RuleID,
-					)
-					newResults = append(newResults, res)
-					continue
-				}
-			case "GHSA", "PRISMA", "RHSA", "RUSTSEC", "SNYK":
-				id = strings.TrimSpace(*res.RuleID)
-			default:
+		suppressedIDs := map[string]struct{}{}
+		untriagedIDs := map[string]struct{}{}
+		impl.log().Debugf("Inspecting SARIF run #%d containing %d results", i, len(run.Results))
+		for _, res := range run.Results {
+			id := resultVulnerabilityID(opts, &run, res)
+			if id == "" {
 				newResults = append(newResults, res)
 				continue
 			}
 
-			statements := vexDoc.StatementsByVulnerability(id)
+			var statement *vex.Statement
+			var doc *vex.VEX
+			var ok bool
+			artifacts := resultArtifacts(res)
+			if opts.StrictProductMatching {
+				// Only statements about the scanned artifact apply
+				for _, artifact := range artifacts {
+					if statement, doc, ok = matcher.MatchComponents(id, artifact, artifacts, docs); ok {
+						break
+					}
+				}
+			} else {
+				// Results scoped to packages only match the statements
+				// about them, any statement applies to unscoped results
+				products := resultProducts(res)
+				for _, product := range products {
+					if statement, doc, ok = matcher.MatchComponents(id, product, artifacts, docs); ok {
+						break
+					}
+				}
+				if len(products) == 0 {
+					statement, doc, ok = matcher.MatchComponents(id, "", artifacts, docs)
+				}
+			}
 
-			// OpenVEX doc has no data for this vulnerability ID
-			if len(statements) == 0 {
+			// OpenVEX docs have no data for this vulnerability ID
+			if !ok {
+				untriagedIDs[id] = struct{}{}
 				newResults = append(newResults, res)
 				continue
 			}
 
-			switch statements[0].Status {
-			case vex.StatusNotAffected, vex.StatusFixed:
-				logrus.Debugf(
+			switch opts.statementAction(statement) {
+			case FilterActionSuppress:
+				impl.log().Debugf(
 					" >> found VEX statement for %s with status %q",
-					statements[0].Vulnerability, statements[0].Status,
+					statement.Vulnerability, statement.Status,
 				)
+				stats.Runs[i].Suppressed++
+				suppressedIDs[id] = struct{}{}
+				if opts.SuppressionMode == SuppressionModeMark {
+					marked := *res
+					markSuppressed(&marked, doc, statement)
+					newResults = append(newResults, &marked)
+				}
 			default:
 				newResults = append(newResults, res)
 			}
 		}
-		newReport.Runs[i].Results = newResults
+		if opts.SuppressionMode != SuppressionModeMark {
+			pruneRules(&run, newResults)
+		}
+		run.Results = newResults
+		newReport.Runs[i] = &run
+
+		stats.Runs[i].Retained = len(run.Results)
+		if opts.SuppressionMode == SuppressionModeMark {
+			stats.Runs[i].Retained -= stats.Runs[i].Suppressed
+		}
+		stats.Runs[i].Vulnerabilities = []string{}
+		for id := range suppressedIDs {
+			stats.Runs[i].Vulnerabilities = append(stats.Runs[i].Vulnerabilities, id)
+		}
+		sort.Strings(stats.Runs[i].Vulnerabilities)
+		stats.Runs[i].Untriaged = sortedKeys(untriagedIDs)
 	}
-	return &newReport, nil
+
+	if untriaged := stats.Untriaged(); opts.FailOnUntriaged && len(untriaged) > 0 {
+		return &newReport, stats, &UntriagedError{Vulnerabilities: untriaged}
+	}
+	return &newReport, stats, nil
 }
 
-// OpenVexData returns a set of vex documents from the paths received
-func (impl *defaultVexCtlImplementation) OpenVexData(_ Options, paths []string) ([]*vex.VEX, error) {
-	vexes := []*vex.VEX{}
-	for _, path := range paths {
-		doc, err := vex.Open(path)
-		if err != nil {
-			return nil, fmt.Errorf("opening VEX document: %w", err)
+// UntriagedError is returned when applying VEX data with
+// Options.FailOnUntriaged to a report with findings no statement covers.
+type UntriagedError struct {
+	Vulnerabilities []string // IDs of the vulnerabilities without statements
+}
+
+func (e *UntriagedError) Error() string {
+	return fmt.Sprintf(
+		"%d vulnerabilities have no VEX statement: %s",
+		len(e.Vulnerabilities), strings.Join(e.Vulnerabilities, ", "),
+	)
+}
+
+// ApplyStats reports what applying VEX data did to a report
+type ApplyStats struct {
+	Runs []RunStats // Stats of each run, in the same order as the report
+}
+
+// RunStats counts the results suppressed and retained in a SARIF run
+type RunStats struct {
+	Suppressed      int      // Results suppressed by VEX statements (removed or marked)
+	Retained        int      // Results not suppressed
+	Vulnerabilities []string // IDs of the vulnerabilities that triggered suppression
+	Untriaged       []string // IDs of the vulnerabilities found without a matching statement
+}
+
+// Untriaged returns the sorted IDs of the vulnerabilities in all runs that
+// no VEX statement makes a decision about
+func (as *ApplyStats) Untriaged() []string {
+	ids := map[string]struct{}{}
+	for _, r := range as.Runs {
+		for _, id := range r.Untriaged {
+			ids[id] = struct{}{}
 		}
-		vexes = append(vexes, doc)
 	}
-	return vexes, nil
+	return sortedKeys(ids)
 }
 
-// Sort sorts a list of documents
-func (impl *defaultVexCtlImplementation) Sort(docs []*vex.VEX) []*vex.VEX {
-	return vex.SortDocuments(docs)
+// Suppressed returns the number of results suppressed in all runs
+func (as *ApplyStats) Suppressed() int {
+	n := 0
+	for _, r := range as.Runs {
+		n += r.Suppressed
+	}
+	return n
 }
 
-func (impl *defaultVexCtlImplementation) AttestationBytes(att *attestation.Attestation) ([]byte, error) {
-	var b bytes.Buffer
-	if err := att.ToJSON(&b); err != nil {
-		return nil, fmt.Errorf("serializing attestation to json: %w", err)
+// Total returns the number of results in all runs before applying VEX
+func (as *ApplyStats) Total() int {
+	n := 0
+	for _, r := range as.Runs {
+		n += r.Suppressed + r.Retained
 	}
-	return b.Bytes(), nil
+	return n
 }
 
-// Attach attaches an attestation to a container image in the registry using
-// the sigstore libraries. If No references are provided, vexctl will try to
-// attach it to all the attestation subjects that parse as image references.
-func (impl *defaultVexCtlImplementation) Attach(ctx context.Context, att *attestation.Attestation, refs ...string) error {
-	env := ssldsse.Envelope{}
+// String returns a summary line of the stats
+func (as *ApplyStats) String() string {
+	return fmt.Sprintf("suppressed %d of %d findings", as.Suppressed(), as.Total())
+}
 
-	var b bytes.Buffer
-	if err := att.ToJSON(&b); err != nil {
-		return fmt.Errorf("getting attestation JSON")
+// suppressionDocumentProperty is the property of SARIF suppressions that
+// records the VEX document that suppressed the result.
+const suppressionDocumentProperty = "openvex-document"
+
+// markSuppressed records in the result suppressions that it was suppressed
+// by a VEX statement. Suppressions added by earlier documents are replaced.
+func markSuppressed(res *gosarif.Result, doc *vex.VEX, statement *vex.Statement) {
+	justification := string(statement.Justification)
+	if statement.ImpactStatement != "" {
+		if justification != "" {
+			justification += ": "
+		}
+		justification += statement.ImpactStatement
 	}
-	decoder := json.NewDecoder(&b)
-	for decoder.More() {
-		if err := decoder.Decode(&env); err != nil {
-			return err
+	if justification == "" {
+		justification = fmt.Sprintf("VEX status: %s", statement.Status)
+	}
+
+	suppression := gosarif.NewSuppression("external").
+		WithStatus("accepted").
+		WithJustifcation(justification)
+	suppression.PropertyBag = *gosarif.NewPropertyBag()
+	suppression.Add(suppressionDocumentProperty, doc.ID)
+	suppression.Add("openvex-status", string(statement.Status))
+
+	suppressions := []*gosarif.Suppression{}
+	for _, s := range res.Suppressions {
+		if s != nil {
+			if _, ok := s.Properties[suppressionDocumentProperty]; ok {
+				continue
+			}
 		}
+		suppressions = append(suppressions, s)
+	}
+	res.Suppressions = append(suppressions, suppression)
+}
 
-		payload, err := json.Marshal(env)
-		if err != nil {
-			return err
+// resultVulnerabilityID returns the vulnerability identifier of a SARIF
+// result or an empty string if it cannot be determined.
+func resultVulnerabilityID(opts Options, run *gosarif.Run, res *gosarif.Result) string {
+	ruleID := ""
+	if res.RuleID != nil {
+		ruleID = *res.RuleID
+	} else if rule := resultRule(run, res); rule != nil {
+		// Some scanners (eg Trivy) only reference the rule by its index
+		ruleID = rule.ID
+	}
+
+	if alias, ok := opts.RuleIDAliases[strings.TrimSpace(ruleID)]; ok && alias != "" {
+		return CanonicalizeVulnID(alias)
+	}
+
+	if id, ok := canonicalRuleID(opts, ruleID); ok {
+		return CanonicalizeVulnID(id)
+	}
+
+	// As a last resort, look for an identifier in the result message. This
+	// is opt-in as messages may mention unrelated vulnerabilities.
+	if opts.VulnIDFromMessage && res.Message.Text != nil {
+		if id := messageVulnRegexp.FindString(*res.Message.Text); id != "" {
+			opts.log().Debugf("Using vulnerability %s found in the result message", id)
+			return CanonicalizeVulnID(id)
 		}
+	}
+	return ""
+}
+
+// canonicalRuleID returns the vulnerability identifier in a SARIF rule ID
+// if its prefix is recognized. Rule IDs are trimmed to the canonical form
+// using the pattern registered for the prefix.
+func canonicalRuleID(opts Options, ruleID string) (string, bool) {
+	ruleID = strings.TrimSpace(ruleID)
+	prefix := strings.SplitN(ruleID, "-", 2)[0]
+	if prefix == "" {
+		return "", false
+	}
+
+	pattern, hasPattern := opts.RuleIDPatterns[prefix]
+	if !hasPattern {
+		pattern, hasPattern = DefaultRuleIDPatterns[prefix]
+	}
 
-		if env.PayloadType != IntotoPayloadType {
-			return fmt.Errorf("invalid payloadType %s on envelope, expected %s", env.PayloadType, types.IntotoPayloadType)
+	switch {
+	case prefix == "CWE" && !opts.MatchCWE:
+		// CWE matching is coarse, only use them when enabled
+		return "", false
+	case hasPattern:
+		if id := pattern.FindString(ruleID); id != "" {
+			return id, true
 		}
+		opts.log().Errorf(
+			"Invalid rulename in sarif report, expected %s identifier, got %s",
+			prefix, ruleID,
+		)
+		return "", false
+	case slices.Contains(DefaultRuleIDPrefixes, prefix), slices.Contains(opts.RuleIDPrefixes, prefix):
+		return ruleID, true
+	default:
+		return "", false
+	}
+}
 
-		if len(refs) == 0 {
-			for _, s := range att.Subject {
-				if _, err := name.ParseReference(s.Name); err != nil {
-					logrus.Infof("Skipping attaching to %s. It is not an image reference", s.Name)
-					continue
+// resultArtifacts returns the identifiers of the artifact where a SARIF
+// result was found: the purl in the result properties, if any, followed
+// by the URIs and the logical location names of its locations.
+func resultArtifacts(res *gosarif.Result) []string {
+	artifacts := []string{}
+	if p, ok := res.Properties["purl"].(string); ok && p != "" {
+		artifacts = append(artifacts, p)
+	}
+	for _, l := range res.Locations {
+		if l == nil {
+			continue
+		}
+		if l.PhysicalLocation != nil && l.PhysicalLocation.ArtifactLocation != nil {
+			if uri := l.PhysicalLocation.ArtifactLocation.URI; uri != nil && *uri != "" {
+				artifacts = append(artifacts, *uri)
+			}
+		}
+		for _, ll := range l.LogicalLocations {
+			if ll == nil {
+				continue
+			}
+			for _, n := range []*string{ll.FullyQualifiedName, ll.Name} {
+				if n != nil && *n != "" {
+					artifacts = append(artifacts, *n)
+					break
 				}
-				refs = append(refs, s.Name)
 			}
 		}
+	}
+	return artifacts
+}
 
-		for _, ref := range refs {
-			if err := attachAttestation(ctx, att, payload, ref); err != nil {
-				return fmt.Errorf("attaching attestation to %s: %w", ref, err)
-			}
+// resultProducts returns the artifacts of a SARIF result that identify a
+// package (purls), used to pick among the statements about several
+// products when matching is not strict.
+func resultProducts(res *gosarif.Result) []string {
+	products := []string{}
+	for _, a := range resultArtifacts(res) {
+		if strings.HasPrefix(a, "pkg:") {
+			products = append(products, a)
 		}
 	}
+	return products
+}
 
+// resultRule returns the rule descriptor of a result from the run's driver
+func resultRule(run *gosarif.Run, res *gosarif.Result) *gosarif.ReportingDescriptor {
+	if run.Tool.Driver == nil {
+		return nil
+	}
+	rules := run.Tool.Driver.Rules
+	if res.RuleIndex != nil && int(*res.RuleIndex) < len(rules) {
+		return rules[*res.RuleIndex]
+	}
+	if res.RuleID == nil {
+		return nil
+	}
+	for _, r := range rules {
+		if r != nil && r.ID == *res.RuleID {
+			return r
+		}
+	}
 	return nil
 }
 
-// attachAttestation is a utility function to do the actual attachment of
-// the signed attestation
-func attachAttestation(ctx context.Context, original *attestation.Attestation, payload []byte, imageRef string) error {
-	regOpts := options.RegistryOptions{}
-	remoteOpts, err := regOpts.ClientOpts(ctx)
-	if err != nil {
-		return fmt.Errorf("getting OCI remote options: %w", err)
+// ruleIndex returns the index of the rule of a SARIF result in the driver
+// rules, or -1 if the result does not reference one of them.
+func ruleIndex(rules []*gosarif.ReportingDescriptor, res *gosarif.Result) int {
+	if res.RuleIndex != nil && int(*res.RuleIndex) < len(rules) {
+		return int(*res.RuleIndex)
+	}
+	if res.Rule != nil && res.Rule.ToolComponent == nil && res.Rule.Index != nil && int(*res.Rule.Index) < len(rules) {
+		return int(*res.Rule.Index)
+	}
+	if res.RuleID == nil {
+		return -1
 	}
+	for i, r := range rules {
+		if r != nil && r.ID == *res.RuleID {
+			return i
+		}
+	}
+	return -1
+}
 
-	ref, err := name.ParseReference(imageRef)
-	if err != nil {
-		return err
+// pruneRules drops from the run driver the rules that are only referenced
+// by results removed from the run, results holds the results that remain.
+// The rule indexes of the remaining results are updated to point to the
+// pruned rules. The driver and the updated results are copies, the
+// original report is not modified.
+func pruneRules(run *gosarif.Run, results []*gosarif.Result) {
+	if run.Tool.Driver == nil || len(run.Tool.Driver.Rules) == 0 {
+		return
 	}
+	rules := run.Tool.Driver.Rules
 
-	digest, err := ociremote.ResolveDigest(ref, remoteOpts...)
-	if err != nil {
-		return fmt.Errorf("resolving entity: %w", err)
+	referenced := map[int]struct{}{}
+	for _, res := range run.Results {
+		referenced[ruleIndex(rules, res)] = struct{}{}
+	}
+	retained := map[int]struct{}{}
+	for _, res := range results {
+		retained[ruleIndex(rules, res)] = struct{}{}
+	}
+
+	newIndex := make([]int, len(rules))
+	pruned := []*gosarif.ReportingDescriptor{}
+	for i, r := range rules {
+		_, isReferenced := referenced[i]
+		_, isRetained := retained[i]
+		if isReferenced && !isRetained {
+			newIndex[i] = -1
+			continue
+		}
+		newIndex[i] = len(pruned)
+		pruned = append(pruned, r)
+	}
+	if len(pruned) == len(rules) {
+		return
 	}
 
-	ref = digest //nolint:ineffassign
+	driver := *run.Tool.Driver
+	driver.Rules = pruned
+	run.Tool.Driver = &driver
 
-	opts := []static.Option{static.WithLayerMediaType(types.DssePayloadType)}
+	for i, res := range results {
+		idx := ruleIndex(rules, res)
+		if idx == -1 || newIndex[idx] == idx {
+			continue
+		}
+		updated := *res
+		n := uint(newIndex[idx])
+		if updated.RuleIndex != nil {
+			updated.RuleIndex = &n
+		}
+		if updated.Rule != nil && updated.Rule.ToolComponent == nil && updated.Rule.Index != nil {
+			ref := *updated.Rule
+			ref.Index = &n
+			updated.Rule = &ref
+		}
+		results[i] = &updated
+	}
+}
 
-	// Add the attestation certificate:
-	opts = append(opts, static.WithCertChain(original.SignatureData.CertData, original.SignatureData.Chain))
+// OpenVexData returns a set of vex documents from the paths received. The
+// StdinPath path reads a document from stdin.
+func (impl *defaultVexCtlImplementation) OpenVexData(opts Options, paths []string) ([]*vex.VEX, error) {
+	vexes := []*vex.VEX{}
+	for _, path := range paths {
+		doc, err := impl.openVexPath(opts, path)
+		if err != nil {
+			return nil, fmt.Errorf("opening VEX document: %w", err)
+		}
+		vexes = append(vexes, doc)
+	}
+	return vexes, nil
+}
 
-	// Add the tlog entry to the annotations
-	if original.SignatureData.Entry != nil {
-		opts = append(opts, static.WithBundle(
-			cbundle.EntryToBundle(original.SignatureData.Entry),
-		))
+// openVexPath opens the VEX document at path or, when the path is
+// StdinPath, reads it from stdin up to opts.MaxDocumentSize bytes.
+func (impl *defaultVexCtlImplementation) openVexPath(opts Options, path string) (*vex.VEX, error) {
+	if path != StdinPath {
+		return vex.Open(path)
+	}
+	data, err := readLimited(impl.input(), opts.MaxDocumentSize)
+	if err != nil {
+		return nil, fmt.Errorf("reading stdin: %w", err)
 	}
+	return parseVexData(data)
+}
 
-	// Add predicateType as manifest annotation
-	opts = append(opts, static.WithAnnotations(map[string]string{
-		"predicateType": vex.Context,
-	}))
+// Sort sorts a list of documents
+func (impl *defaultVexCtlImplementation) Sort(docs []*vex.VEX) []*vex.VEX {
+	return vex.SortDocuments(docs)
+}
 
-	att, err := static.NewAttestation(payload, opts...)
+// AttestationBytes returns the canonical JSON of an attestation, see
+// CanonicalAttestationBytes.
+func (impl *defaultVexCtlImplementation) AttestationBytes(att *attestation.Attestation) ([]byte, error) {
+	return CanonicalAttestationBytes(att)
+}
+
+// WriteAttestationFile writes the DSSE envelope of a signed attestation to
+// path as JSON lines (.intoto.jsonl). This keeps the attestations about
+// subjects that are not container images, which cannot be attached.
+func (impl *defaultVexCtlImplementation) WriteAttestationFile(att *attestation.Attestation, path string) error {
+	if att == nil || !att.Signed {
+		return errors.New("only signed attestations can be written to an attestation file")
+	}
+	data, err := impl.AttestationBytes(att)
 	if err != nil {
 		return err
 	}
 
-	se, err := ociremote.SignedEntity(digest, remoteOpts...)
-	if err != nil {
-		return fmt.Errorf("creating signed entity from image: %w", err)
+	var b bytes.Buffer
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for decoder.More() {
+		envelope := json.RawMessage{}
+		if err := decoder.Decode(&envelope); err != nil {
+			return fmt.Errorf("decoding attestation envelope: %w", err)
+		}
+		if err := json.Compact(&b, envelope); err != nil {
+			return fmt.Errorf("compacting attestation envelope: %w", err)
+		}
+		b.WriteByte('\n')
 	}
 
-	newSE, err := mutate.AttachAttestationToEntity(se, att)
+	if err := os.WriteFile(path, b.Bytes(), os.FileMode(0o644)); err != nil {
+		return fmt.Errorf("writing attestation file: %w", err)
+	}
+	return nil
+}
+
+// VerifyAttestationFile checks the signatures of the DSSE envelopes in an
+// .intoto.jsonl file with the public key in keyRef and returns the document
+// in the first OpenVEX attestation. It does not talk to any registry or
+// transparency log so it can be used offline.
+func (impl *defaultVexCtlImplementation) VerifyAttestationFile(
+	ctx context.Context, path, keyRef string,
+) (*vex.VEX, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading attestation file: %w", err)
+	}
+	verifier, err := sigs.PublicKeyFromKeyRef(ctx, keyRef)
 	if err != nil {
-		return fmt.Errorf("attaching attestation: %w", err)
+		return nil, fmt.Errorf("loading verification key: %w", err)
 	}
 
-	// Publish the signatures
-	if err := ociremote.WriteAttestations(digest.Repository, newSE, remoteOpts...); err != nil {
-		return fmt.Errorf("writing attestations to registry: %w", err)
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if err := dsse.WrapVerifier(verifier).VerifySignature(bytes.NewReader(line), nil); err != nil {
+			return nil, fmt.Errorf("verifying envelope #%d: %w", i, err)
+		}
+		envelope := cosign.AttestationPayload{}
+		if err := json.Unmarshal(line, &envelope); err != nil {
+			return nil, fmt.Errorf("parsing envelope #%d: %w", i, err)
+		}
+		doc, err := impl.ReadSignedVEX(envelope)
+		if err != nil {
+			return nil, fmt.Errorf("reading envelope #%d: %w", i, err)
+		}
+		if doc != nil {
+			return doc, nil
+		}
 	}
-	return nil
+	return nil, errors.New("attestation file has no OpenVEX attestations")
 }
 
-// SourceType returns a string indicating what kind of vex
-// source a URI points to
-func (impl *defaultVexCtlImplementation) SourceType(uri string) (string, error) {
-	if util.Exists(uri) {
-		return "file", nil
+// SignAttestation signs the attestation with the key in keyRef, or using the
+// keyless flow when keyRef is empty, and returns the resulting DSSE envelope.
+func (impl *defaultVexCtlImplementation) SignAttestation(
+	ctx context.Context, att *attestation.Attestation, keyRef string,
+) ([]byte, error) {
+	return impl.SignAttestationWithOptions(ctx, att, keyRef, attestation.SigningOptions{})
+}
+
+// SignAttestationWithOptions is like SignAttestation but signs keyless
+// using the sigstore instance in opts.
+func (impl *defaultVexCtlImplementation) SignAttestationWithOptions(
+	ctx context.Context, att *attestation.Attestation, keyRef string, opts attestation.SigningOptions,
+) ([]byte, error) {
+	if err := att.SignWithOptions(ctx, keyRef, opts); err != nil {
+		return nil, fmt.Errorf("signing attestation: %w", err)
 	}
+	return impl.AttestationBytes(att)
+}
 
-	_, err := name.ParseReference(uri)
-	if err == nil {
-		return "image", nil
+// UploadToTlog records a signed attestation in the Rekor instance at
+// rekorURL, the public instance when empty.
+func (impl *defaultVexCtlImplementation) UploadToTlog(
+	ctx context.Context, att *attestation.Attestation, rekorURL string,
+) error {
+	if err := att.UploadToTlog(ctx, rekorURL); err != nil {
+		return fmt.Errorf("uploading attestation to rekor: %w", err)
 	}
+	return nil
+}
 
-	return "", errors.New("unable to resolve the vex source location")
+// AttachResult counts the images an attestation was attached to
+type AttachResult struct {
+	Written int // Images the attestation was pushed to
+	Skipped int // Images that already had the attestation (see Options.SkipExisting)
+
+	Planned []AttachTarget // Images the attestation would be pushed to (see Options.DryRun)
 }
 
-// DownloadAttestation
-func (impl *defaultVexCtlImplementation) ReadImageAttestations(
-	ctx context.Context, _ Options, refString string,
-) (vexes []*vex.VEX, err error) {
-	// Parsae the image reference
-	ref, err := name.ParseReference(refString)
+// AttachTarget is an image reference and the digest it resolved to
+type AttachTarget struct {
+	Ref    string
+	Digest string
+}
+
+// Attach attaches an attestation to a container image in the registry using
+// the sigstore libraries. If No references are provided, vexctl will try to
+// attach it to all the attestation subjects that parse as image references.
+// With opts.DryRun nothing is written, the images are listed in the Planned
+// field of the result instead and the attestation does not need to be signed.
+func (impl *defaultVexCtlImplementation) Attach(
+	ctx context.Context, opts Options, att *attestation.Attestation, refs ...string,
+) (result AttachResult, err error) {
+	annotations, err := attestationAnnotations(opts)
 	if err != nil {
-		return nil, fmt.Errorf("parsing image reference: %w", err)
+		return result, fmt.Errorf("building attestation annotations: %w", err)
 	}
-	regOpts := &options.RegistryOptions{}
-	remoteOpts, err := regOpts.ClientOpts(ctx)
+
+	payloadType, err := envelopePayloadType(opts)
 	if err != nil {
-		return nil, fmt.Errorf("getting OCI remote options: %w", err)
+		return result, err
 	}
-	payloads, err := cosign.FetchAttestationsForReference(ctx, ref, "", remoteOpts...)
-	if err != nil {
-		return nil, fmt.Errorf("fetching attached attestation: %w", err)
+
+	// Dry runs only resolve the images. The attestation is not read as it
+	// is left unsigned to keep it out of the transparency log.
+	if opts.DryRun {
+		if err := impl.VerifyImageSubjects(att, &att.Predicate); err != nil {
+			return result, fmt.Errorf("checking subjects: %w", err)
+		}
+		if len(refs) == 0 {
+			refs = imageSubjectRefs(opts, att)
+		}
+		result.Planned, err = planAttach(ctx, opts, refs, newDigestCache())
+		return result, err
 	}
-	vexes = []*vex.VEX{}
-	for _, dssePayload := range payloads {
-		vexData, err := impl.ReadSignedVEX(dssePayload)
+
+	env := ssldsse.Envelope{}
+
+	// Each image tag is resolved once per call, even when attaching several
+	// envelopes or when a reference is listed more than once
+	digests := newDigestCache()
+
+	var b bytes.Buffer
+	if err := att.ToJSON(&b); err != nil {
+		return result, fmt.Errorf("getting attestation JSON")
+	}
+	decoder := json.NewDecoder(&b)
+	for decoder.More() {
+		if err := decoder.Decode(&env); err != nil {
+			return result, err
+		}
+
+		payload, err := json.Marshal(env)
 		if err != nil {
-			return nil, fmt.Errorf("opening dsse payload: %w", err)
+			return result, err
+		}
+
+		if env.PayloadType != payloadType {
+			return result, fmt.Errorf("invalid payloadType %s on envelope, expected %s", env.PayloadType, payloadType)
+		}
+
+		if len(refs) == 0 {
+			refs = imageSubjectRefs(opts, att)
+		}
+
+		res, err := attachToRefs(ctx, opts, att, payload, refs, annotations, digests)
+		result.Written += res.Written
+		result.Skipped += res.Skipped
+		if err != nil {
+			return result, err
 		}
-		vexes = append(vexes, vexData)
 	}
-	return vexes, nil
+
+	return result, nil
 }
 
-// ReadSignedVEX returns the vex data inside a signed envelope
-func (impl *defaultVexCtlImplementation) ReadSignedVEX(dssePayload cosign.AttestationPayload) (*vex.VEX, error) {
-	if dssePayload.PayloadType != IntotoPayloadType {
-		logrus.Info("Signed envelope does not contain an in-toto attestation")
-		return nil, nil
+// imageSubjectRefs returns the attestation subjects that are image
+// references. The rest, like hashed purls, are attested but cannot be
+// pushed to a registry.
+func imageSubjectRefs(opts Options, att *attestation.Attestation) []string {
+	refs := []string{}
+	for _, s := range att.Subject {
+		if _, err := parseImageName(s.Name); err != nil {
+			opts.log().Infof("Skipping attaching to %s. It is not an image reference", s.Name)
+			continue
+		}
+		refs = append(refs, s.Name)
 	}
+	return refs
+}
 
-	data, err := base64.StdEncoding.DecodeString(dssePayload.PayLoad)
-	if err != nil {
-		return nil, fmt.Errorf("decoding signed attestation: %w", err)
+// childImageRefs replaces the image indexes in refs with the references of
+// their platform images.
+func childImageRefs(ctx context.Context, opts Options, refs []string) ([]string, error) {
+	remoteOpts := registryOptions(opts).GetRegistryClientOpts(ctx)
+	expanded := []string{}
+	for _, r := range refs {
+		ref, err := parseImageReference(opts, r)
+		if err != nil {
+			return nil, fmt.Errorf("parsing reference: %w", err)
+		}
+		_, children, err := imageIndexChildren(ctx, ref, remoteOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("expanding image index: %w", err)
+		}
+		if children == nil {
+			expanded = append(expanded, r)
+			continue
+		}
+		for _, child := range children {
+			expanded = append(expanded, ref.Context().Digest(child.Digest.String()).String())
+		}
 	}
-	fmt.Printf("%s\n", string(data))
+	return expanded, nil
+}
 
-	// Unmarshall the attestation
-	att := &attestation.Attestation{}
-	if err := json.Unmarshal(data, att); err != nil {
-		return nil, fmt.Errorf("unmarshalling attestation JSON: %w", err)
+// planAttach resolves the image references the attestation would be attached
+// to and logs them without writing to the registry.
+func planAttach(ctx context.Context, opts Options, refs []string, digests *digestCache) ([]AttachTarget, error) {
+	if opts.AttachToChildren {
+		var err error
+		refs, err = childImageRefs(ctx, opts, refs)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	if att.PredicateType != vex.TypeURI {
-		return nil, nil
+	planned := []AttachTarget{}
+	for _, r := range refs {
+		ref, err := parseImageReference(opts, r)
+		if err != nil {
+			return planned, err
+		}
+		digest, err := digests.resolve(ctx, opts, ref)
+		if err != nil {
+			return planned, fmt.Errorf("resolving %s: %w", r, err)
+		}
+		opts.log().Infof("Dry run: would attach attestation to %s (%s)", r, digest.DigestStr())
+		planned = append(planned, AttachTarget{Ref: r, Digest: digest.DigestStr()})
+	}
+	return planned, nil
+}
+
+// attachToRefs attaches the attestation payload to the image references
+// using up to opts.Concurrency workers. Unless opts.FailFast is set, a failed
+// reference does not stop the others and the returned error joins the
+// errors of all the references that failed.
+func attachToRefs(
+	ctx context.Context, opts Options, att *attestation.Attestation, payload []byte, refs []string,
+	annotations map[string]string, digests *digestCache,
+) (AttachResult, error) {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	if opts.AttachToChildren {
+		var err error
+		refs, err = childImageRefs(ctx, opts, refs)
+		if err != nil {
+			return AttachResult{}, err
+		}
+	}
+
+	var mu sync.Mutex
+	result := AttachResult{}
+	count := func(written bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if written {
+			result.Written++
+		} else {
+			result.Skipped++
+		}
+	}
+	errs := []error{}
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(concurrency)
+	for _, ref := range refs {
+		g.Go(func() error {
+			// After a failure in fail fast mode, skip the pending refs
+			if err := gctx.Err(); err != nil {
+				return err
+			}
+			if opts.UseReferrers {
+				written, err := attachReferrerToRef(gctx, opts, payload, ref, annotations, digests)
+				if err == nil {
+					count(written)
+					return nil
+				}
+				opts.log().Warnf("Attaching to %s as a referrer failed, falling back to the tag scheme: %v", ref, err)
+			}
+			written, err := attachAttestation(gctx, opts, att, payload, ref, annotations, digests)
+			if err == nil {
+				count(written)
+				return nil
+			}
+			err = fmt.Errorf("attaching attestation to %s: %w", ref, err)
+			if opts.FailFast {
+				return err
+			}
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return result, err
+	}
+	return result, errors.Join(errs...)
+}
+
+// attachAttestation is a utility function to do the actual attachment of
+// the signed attestation. It returns false when the attestation was already
+// attached to the image and vexOpts.SkipExisting is set.
+func attachAttestation(
+	ctx context.Context, vexOpts Options, original *attestation.Attestation, payload []byte, imageRef string,
+	annotations map[string]string, digests *digestCache,
+) (written bool, err error) {
+	remoteOpts, err := attestationClientOpts(ctx, vexOpts)
+	if err != nil {
+		return false, err
+	}
+
+	ref, err := parseImageReference(vexOpts, imageRef)
+	if err != nil {
+		return false, err
+	}
+
+	digest, err := digests.resolve(ctx, vexOpts, ref)
+	if err != nil {
+		return false, fmt.Errorf("resolving entity: %w", err)
+	}
+
+	opts := []static.Option{static.WithLayerMediaType(types.DssePayloadType)}
+
+	// Unsigned attestations have no certificate or tlog entry to attach
+	if original.SignatureData != nil {
+		// Add the attestation certificate:
+		opts = append(opts, static.WithCertChain(original.SignatureData.CertData, original.SignatureData.Chain))
+
+		// Add the tlog entry to the annotations
+		if original.SignatureData.Entry != nil {
+			opts = append(opts, static.WithBundle(
+				cbundle.EntryToBundle(original.SignatureData.Entry),
+			))
+		}
+	}
+
+	// Add predicateType and any links as manifest annotations
+	opts = append(opts, static.WithAnnotations(annotations))
+
+	att, err := static.NewAttestation(payload, opts...)
+	if err != nil {
+		return false, err
+	}
+
+	// Writing the attestation is idempotent, so the whole read-modify-write
+	// is retried on transient registry errors.
+	err = withRetry(ctx, vexOpts, func() error {
+		se, err := ociremote.SignedEntity(digest, remoteOpts...)
+		if err != nil {
+			return fmt.Errorf("creating signed entity from image: %w", err)
+		}
+
+		if vexOpts.SkipExisting {
+			exists, err := hasAttestation(se, payload)
+			if err != nil {
+				return fmt.Errorf("listing existing attestations: %w", err)
+			}
+			if exists {
+				vexOpts.log().Infof("Not attaching to %s, the attestation is already attached", digest)
+				written = false
+				return nil
+			}
+		}
+
+		newSE, err := mutate.AttachAttestationToEntity(se, att)
+		if err != nil {
+			return fmt.Errorf("attaching attestation: %w", err)
+		}
+
+		// Publish the signatures
+		if err := ociremote.WriteAttestations(digest.Repository, newSE, remoteOpts...); err != nil {
+			return fmt.Errorf("writing attestations to registry: %w", err)
+		}
+		written = true
+		return nil
+	})
+	return written, err
+}
+
+// hasAttestation checks if an attestation with the same payload is already
+// attached to the signed entity. The layers of cosign attestations hold the
+// DSSE envelope as-is, so it compares their digest to the payload digest.
+func hasAttestation(se oci.SignedEntity, payload []byte) (bool, error) {
+	want, _, err := v1.SHA256(bytes.NewReader(payload))
+	if err != nil {
+		return false, fmt.Errorf("hashing attestation payload: %w", err)
+	}
+	atts, err := se.Attestations()
+	if err != nil {
+		return false, err
+	}
+	existing, err := atts.Get()
+	if err != nil {
+		return false, err
+	}
+	for _, a := range existing {
+		d, err := a.Digest()
+		if err != nil {
+			return false, err
+		}
+		if d == want {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// attestationAnnotations returns the annotations to add to the manifest of
+// an attached attestation. Besides the predicate type, when a related SBOM
+// attestation digest is set in the options, it is recorded to link the VEX
+// data to the SBOM enumerating its subcomponents.
+func attestationAnnotations(opts Options) (map[string]string, error) {
+	annotations := map[string]string{
+		"predicateType": vex.Context,
+	}
+
+	if opts.SBOMAttestationDigest != "" {
+		if _, err := v1.NewHash(opts.SBOMAttestationDigest); err != nil {
+			return nil, fmt.Errorf("invalid SBOM attestation digest: %w", err)
+		}
+		annotations[SBOMAttestationAnnotation] = opts.SBOMAttestationDigest
+	}
+	return annotations, nil
+}
+
+// SourceType returns a string indicating what kind of vex
+// source a URI points to
+func (impl *defaultVexCtlImplementation) SourceType(uri string) (string, error) {
+	if uri == StdinPath || util.Exists(uri) {
+		return "file", nil
+	}
+
+	if isURL(uri) {
+		return "url", nil
+	}
+
+	_, err := name.ParseReference(uri)
+	if err == nil {
+		return "image", nil
+	}
+
+	return "", errors.New("unable to resolve the vex source location")
+}
+
+// ReadImageAttestations returns the VEX documents in the attestations attached
+// to an image. Attestations are verified with the key in opts.VerifyKey or,
+// keyless, against opts.CertIdentity and opts.CertOIDCIssuer. Attestations
+// that fail verification are dropped. Verification is only skipped when
+// opts.SkipVerify is set.
+func (impl *defaultVexCtlImplementation) ReadImageAttestations(
+	ctx context.Context, opts Options, refString string,
+) ([]*vex.VEX, error) {
+	// Parsae the image reference
+	ref, err := parseImageReference(opts, refString)
+	if err != nil {
+		return nil, fmt.Errorf("parsing image reference: %w", err)
+	}
+	return impl.readImageAttestations(ctx, opts, ref)
+}
+
+// ReadImageAttestationsByDigest is like ReadImageAttestations but only takes
+// digest references (repo@sha256:...) so that the attestations are read from
+// exactly that image, no tags are resolved.
+func (impl *defaultVexCtlImplementation) ReadImageAttestationsByDigest(
+	ctx context.Context, opts Options, digest string,
+) ([]*vex.VEX, error) {
+	nameOpts := []name.Option{}
+	if opts.PlainHTTP || opts.AllowInsecure {
+		nameOpts = append(nameOpts, name.Insecure)
+	}
+	ref, err := name.NewDigest(digest, nameOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("parsing digest reference: %w", err)
+	}
+	return impl.readImageAttestations(ctx, opts, ref)
+}
+
+// readImageAttestations reads the VEX attestations of the image ref points to
+func (impl *defaultVexCtlImplementation) readImageAttestations(
+	ctx context.Context, opts Options, ref name.Reference,
+) (vexes []*vex.VEX, err error) {
+	payloadType, err := envelopePayloadType(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	regOpts := registryOptions(opts)
+	remoteOpts, err := attestationClientOpts(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var payloads []cosign.AttestationPayload
+	if opts.UseReferrers {
+		payloads, err = impl.readReferrerPayloads(ctx, opts, ref, regOpts, remoteOpts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case len(payloads) > 0:
+		// Attestations found as referrers, the tag scheme is a fallback
+	case opts.SkipVerify:
+		impl.log().Warnf("Signature verification disabled, reading unverified attestations from %s", ref)
+		err = withRetry(ctx, opts, func() (err error) {
+			payloads, err = attachedAttestationPayloads(ref, opts.PredicateType, remoteOpts)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("fetching attached attestation: %w", registryError(ref, err))
+		}
+	default:
+		checkOpts, err := attestationCheckOpts(ctx, opts, remoteOpts)
+		if err != nil {
+			return nil, err
+		}
+		err = withRetry(ctx, opts, func() (err error) {
+			payloads, err = verifiedAttestationPayloads(ctx, opts, ref, checkOpts)
+			return err
+		})
+		var noMatch *cosign.ErrNoMatchingAttestations
+		if errors.As(err, &noMatch) {
+			impl.log().Warnf("No attestation in %s passed verification: %v", ref, err)
+		} else if err != nil {
+			return nil, fmt.Errorf("verifying attestations: %w", registryError(ref, err))
+		}
+	}
+
+	vexes = []*vex.VEX{}
+	for _, dssePayload := range payloads {
+		vexData, err := impl.readSignedVEX(dssePayload, payloadType)
+		if err != nil {
+			return nil, fmt.Errorf("opening dsse payload: %w", err)
+		}
+		// Attestations of other predicate types are skipped
+		if vexData == nil {
+			continue
+		}
+		vexes = append(vexes, vexData)
+	}
+	return filterByTime(opts, vexes), nil
+}
+
+// filterByTime drops the documents issued before opts.Since and, when
+// opts.Latest is set, keeps only the most recent one.
+func filterByTime(opts Options, docs []*vex.VEX) []*vex.VEX {
+	filtered := []*vex.VEX{}
+	for _, doc := range docs {
+		if documentTime(doc).Before(opts.Since) {
+			continue
+		}
+		if opts.Latest && len(filtered) > 0 {
+			if documentTime(doc).After(documentTime(filtered[0])) {
+				filtered[0] = doc
+			}
+			continue
+		}
+		filtered = append(filtered, doc)
+	}
+	return filtered
+}
+
+// RefErrors maps the image references that failed to the error reading them
+type RefErrors map[string]error
+
+// Error lists the failed references in order
+func (re RefErrors) Error() string {
+	msgs := []string{}
+	for _, ref := range sortedKeys(re) {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", ref, re[ref]))
+	}
+	return fmt.Sprintf("reading attestations from %d images failed: %s", len(re), strings.Join(msgs, "; "))
+}
+
+// ReadImageAttestationsMulti reads the VEX attestations of several images
+// concurrently, using up to opts.Concurrency workers. The documents are
+// returned by image reference. An image that cannot be read does not stop
+// the rest, the failures are returned as RefErrors.
+func (impl *defaultVexCtlImplementation) ReadImageAttestationsMulti(
+	ctx context.Context, opts Options, refs []string,
+) (map[string][]*vex.VEX, error) {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	var mu sync.Mutex
+	results := map[string][]*vex.VEX{}
+	errs := RefErrors{}
+	g := errgroup.Group{}
+	g.SetLimit(concurrency)
+	for _, ref := range refs {
+		g.Go(func() error {
+			docs, err := impl.ReadImageAttestations(ctx, opts, ref)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs[ref] = err
+			} else {
+				results[ref] = docs
+			}
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	if len(errs) > 0 {
+		return results, errs
+	}
+	return results, nil
+}
+
+// readReferrerPayloads reads the attestations attached to the image as OCI
+// 1.1 referrers. Unless opts.SkipVerify is set, their signatures are checked
+// with opts.VerifyKey and the ones that fail are dropped.
+func (impl *defaultVexCtlImplementation) readReferrerPayloads(
+	ctx context.Context, opts Options, ref name.Reference, regOpts *options.RegistryOptions, remoteOpts []ociremote.Option,
+) ([]cosign.AttestationPayload, error) {
+	// Digest references are used as-is, without a registry round trip
+	digest, ok := ref.(name.Digest)
+	if !ok {
+		var err error
+		digest, err = ociremote.ResolveDigest(ref, remoteOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("resolving image digest: %w", registryError(ref, err))
+		}
+	}
+	envelopes, err := referrerAttestations(ctx, digest, regOpts.GetRegistryClientOpts(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("reading referrer attestations: %w", err)
+	}
+
+	var verifier signature.Verifier
+	if !opts.SkipVerify && len(envelopes) > 0 {
+		if opts.VerifyKey == "" {
+			return nil, errors.New("verifying attestations read from referrers requires a public key")
+		}
+		verifier, err = sigs.PublicKeyFromKeyRef(ctx, opts.VerifyKey)
+		if err != nil {
+			return nil, fmt.Errorf("loading verification key: %w", err)
+		}
+	}
+
+	payloads := []cosign.AttestationPayload{}
+	for _, envelope := range envelopes {
+		if verifier != nil {
+			if err := verifyReferrerEnvelope(envelope, verifier, digest); err != nil {
+				impl.log().Warnf("Dropping referrer attestation of %s: %v", digest, err)
+				continue
+			}
+		}
+		p := cosign.AttestationPayload{}
+		if err := json.Unmarshal(envelope, &p); err != nil {
+			return nil, fmt.Errorf("unmarshalling attestation envelope: %w", err)
+		}
+		payloads = append(payloads, p)
+	}
+	return payloads, nil
+}
+
+// attestationCheckOpts builds the cosign options to verify attestations
+// signed with opts.VerifyKey or, when no key is set, keyless by the
+// identity in opts.CertIdentity.
+func attestationCheckOpts(ctx context.Context, opts Options, remoteOpts []ociremote.Option) (*cosign.CheckOpts, error) {
+	checkOpts := &cosign.CheckOpts{
+		RegistryClientOpts: remoteOpts,
+		ClaimVerifier:      cosign.IntotoSubjectClaimVerifier,
+		IgnoreTlog:         opts.IgnoreTlog,
+	}
+
+	var err error
+	switch {
+	case opts.VerifyKey != "":
+		checkOpts.SigVerifier, err = sigs.PublicKeyFromKeyRef(ctx, opts.VerifyKey)
+		if err != nil {
+			return nil, fmt.Errorf("loading verification key: %w", err)
+		}
+	case opts.CertIdentity != "":
+		checkOpts.Identities = []cosign.Identity{{
+			Issuer: opts.CertOIDCIssuer, Subject: opts.CertIdentity,
+		}}
+		checkOpts.RootCerts, err = fulcio.GetRoots()
+		if err != nil {
+			return nil, fmt.Errorf("getting Fulcio root certificates: %w", err)
+		}
+		checkOpts.IntermediateCerts, err = fulcio.GetIntermediates()
+		if err != nil {
+			return nil, fmt.Errorf("getting Fulcio intermediate certificates: %w", err)
+		}
+		checkOpts.CTLogPubKeys, err = cosign.GetCTLogPubs(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("getting CT log public keys: %w", err)
+		}
+	default:
+		return nil, errors.New("a public key or a certificate identity is required to verify attestations")
+	}
+
+	if opts.IgnoreTlog {
+		return checkOpts, nil
+	}
+
+	if opts.RekorPublicKeyPath != "" {
+		checkOpts.RekorPubKeys, err = loadRekorPublicKeys(opts.RekorPublicKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("loading rekor public keys: %w", err)
+		}
+		checkOpts.Offline = true
+	} else {
+		checkOpts.RekorPubKeys, err = cosign.GetRekorPubs(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("getting rekor public keys: %w", err)
+		}
+	}
+
+	// Without a client, cosign only checks the bundles stored along the
+	// attestations. With one, it also verifies the inclusion proofs.
+	if opts.VerifyTlogInclusion && !checkOpts.Offline {
+		rekorURL := opts.Sigstore.RekorURL
+		if rekorURL == "" {
+			rekorURL = options.DefaultRekorURL
+		}
+		checkOpts.RekorClient, err = rekor.NewClient(rekorURL)
+		if err != nil {
+			return nil, fmt.Errorf("creating rekor client: %w", err)
+		}
+	}
+	return checkOpts, nil
+}
+
+// verifiedAttestationPayloads returns the payloads of the attestations
+// attached to the image that pass verification.
+func verifiedAttestationPayloads(
+	ctx context.Context, opts Options, ref name.Reference, checkOpts *cosign.CheckOpts,
+) ([]cosign.AttestationPayload, error) {
+	var payloads []cosign.AttestationPayload
+	err := runWithTimeout(ctx, opts.VerifyTimeout, func(ctx context.Context) error {
+		// The registry requests have to be bound to the timeout context
+		remoteOpts, err := attestationClientOpts(ctx, opts)
+		if err != nil {
+			return err
+		}
+		co := *checkOpts
+		co.RegistryClientOpts = remoteOpts
+		verified, _, err := cosign.VerifyImageAttestations(ctx, ref, &co)
+		if err != nil {
+			return err
+		}
+		payloads, err = attestationPayloads(verified, opts.PredicateType)
+		return err
+	})
+	return payloads, err
+}
+
+// attachedAttestationPayloads returns the payloads of the attestations
+// attached to the image, without verifying them.
+func attachedAttestationPayloads(
+	ref name.Reference, predicateType string, remoteOpts []ociremote.Option,
+) ([]cosign.AttestationPayload, error) {
+	se, err := ociremote.SignedEntity(ref, remoteOpts...)
+	if err != nil {
+		return nil, err
+	}
+	atts, err := se.Attestations()
+	if err != nil {
+		return nil, fmt.Errorf("reading attestations: %w", err)
+	}
+	l, err := atts.Get()
+	if err != nil {
+		return nil, fmt.Errorf("reading attestations: %w", err)
+	}
+	return attestationPayloads(l, predicateType)
+}
+
+// attestationPayloads unmarshals the DSSE envelopes of the attestations.
+// When predicateType is set, the attestations annotated with a different
+// predicate type are skipped without reading them. Attestations without
+// the annotation are kept, their predicate type is checked when decoding.
+func attestationPayloads(atts []oci.Signature, predicateType string) ([]cosign.AttestationPayload, error) {
+	payloads := []cosign.AttestationPayload{}
+	for _, att := range atts {
+		if predicateType != "" {
+			annotations, err := att.Annotations()
+			if err != nil {
+				return nil, fmt.Errorf("reading attestation annotations: %w", err)
+			}
+			if pt, ok := annotations["predicateType"]; ok && pt != predicateType {
+				continue
+			}
+		}
+		data, err := att.Payload()
+		if err != nil {
+			return nil, fmt.Errorf("reading attestation payload: %w", err)
+		}
+		p := cosign.AttestationPayload{}
+		if err := json.Unmarshal(data, &p); err != nil {
+			return nil, fmt.Errorf("unmarshalling attestation envelope: %w", err)
+		}
+		payloads = append(payloads, p)
+	}
+	return payloads, nil
+}
+
+// loadRekorPublicKeys reads a file containing one or more PEM encoded Rekor
+// public keys and returns them as a trusted key set for offline verification.
+func loadRekorPublicKeys(path string) (*cosign.TrustedTransparencyLogPubKeys, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading key file: %w", err)
+	}
+
+	keys := cosign.NewTrustedTransparencyLogPubKeys()
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if err := keys.AddTransparencyLogPubKey(pem.EncodeToMemory(block), tuf.Active); err != nil {
+			return nil, fmt.Errorf("adding rekor public key: %w", err)
+		}
+	}
+
+	if len(keys.Keys) == 0 {
+		return nil, fmt.Errorf("no PEM encoded keys found in %s", path)
+	}
+	return &keys, nil
+}
+
+// envelopePayloadType returns the payload type expected in attestation
+// envelopes, opts.PayloadType or IntotoPayloadType when not set.
+func envelopePayloadType(opts Options) (string, error) {
+	if opts.PayloadType == "" {
+		return IntotoPayloadType, nil
+	}
+	if strings.TrimSpace(opts.PayloadType) == "" {
+		return "", errors.New("payload type cannot be blank")
+	}
+	return opts.PayloadType, nil
+}
+
+// runWithTimeout calls fn with a context that expires after the timeout and
+// returns its error. fn must pass the context to the operations it runs so
+// they are aborted when it expires. A zero timeout only honors ctx.
+func runWithTimeout(ctx context.Context, timeout time.Duration, fn func(context.Context) error) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	err := fn(ctx)
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("operation aborted: %w", ctx.Err())
+	}
+	return err
+}
+
+// ReadSignedVEX returns the vex data inside a signed envelope, or nil when
+// the envelope does not hold an OpenVEX attestation
+func (impl *defaultVexCtlImplementation) ReadSignedVEX(dssePayload cosign.AttestationPayload) (*vex.VEX, error) {
+	return impl.readSignedVEX(dssePayload, IntotoPayloadType)
+}
+
+// readSignedVEX reads the OpenVEX attestation in an envelope of the
+// expected payload type.
+func (impl *defaultVexCtlImplementation) readSignedVEX(
+	dssePayload cosign.AttestationPayload, payloadType string,
+) (*vex.VEX, error) {
+	if dssePayload.PayloadType != payloadType {
+		impl.log().Info("Signed envelope does not contain an in-toto attestation")
+		return nil, nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(dssePayload.PayLoad)
+	if err != nil {
+		return nil, fmt.Errorf("decoding signed attestation: %w", err)
+	}
+	impl.log().Debugf("Decoded attestation: %s", data)
+
+	// Unmarshall the attestation
+	att := &attestation.Attestation{}
+	if err := json.Unmarshal(data, att); err != nil {
+		return nil, fmt.Errorf("unmarshalling attestation JSON: %w", err)
+	}
+
+	if att.PredicateType != vex.TypeURI {
+		return nil, nil
+	}
+
+	return &att.Predicate, nil
+}
+
+type MergeOptions struct {
+	DocumentID      string       // ID to use in the new document
+	Author          string       // Author to use in the new document
+	AuthorRole      string       // Role of the document author
+	Products        []string     // Product IDs to consider
+	Vulnerabilities []string     // IDs of vulnerabilities to merge
+	Statuses        []vex.Status // Statuses of the statements to merge
+	InternProducts  bool         // Share the storage of repeated product strings
+	TrustedAuthors  []string     // When set, only statements from docs by these authors are merged
+	KeepDuplicates  bool         // Keep repeated statements instead of collapsing them into the most recent
+	UseCurrentTime  bool         // Timestamp the merged doc with the current time instead of the newest source doc
+	AnnotateSource  bool         // Record the source document of each statement in its status notes
+
+	// RequireJustification makes Merge fail when a not_affected statement
+	// has no justification or impact statement. Otherwise they are merged
+	// with a warning.
+	RequireJustification bool
+
+	// OnConflict controls what happens when documents have statements with
+	// different statuses for the same vulnerability, product and time.
+	// Defaults to ConflictKeepBoth.
+	OnConflict ConflictPolicy
+
+	// Strategy controls whether the merged document keeps every statement
+	// or only the newest one about each vulnerability and product.
+	// Defaults to MergeAccumulate.
+	Strategy MergeStrategy
+
+	// ChangelogWriter, when set, receives a JSON changelog listing every
+	// statement superseded by a newer one in the source documents, even
+	// those the merged document does not keep.
+	ChangelogWriter io.Writer
+
+	// PreserveSourceOrder groups the merged statements by source document,
+	// in the order the documents are passed, instead of sorting them all
+	// together. Statements are only sorted within each group.
+	PreserveSourceOrder bool
+
+	// ProductMatchMode controls how Products are compared to the products
+	// of the statements. Defaults to ProductMatchExact.
+	ProductMatchMode ProductMatchMode
+}
+
+// ConflictPolicy defines how Merge handles conflicting statements
+type ConflictPolicy string
+
+const (
+	// ConflictError makes Merge fail, listing the conflicts
+	ConflictError ConflictPolicy = "error"
+
+	// ConflictKeepLatest keeps the statement from the most recent document
+	ConflictKeepLatest ConflictPolicy = "keepLatest"
+
+	// ConflictKeepBoth keeps all the conflicting statements
+	ConflictKeepBoth ConflictPolicy = "keepBoth"
+)
+
+// MergeStrategy defines which statements Merge keeps
+type MergeStrategy string
+
+const (
+	// MergeAccumulate keeps the statements from all the documents
+	MergeAccumulate MergeStrategy = "accumulate"
+
+	// MergeSupersede keeps only the newest statement about each
+	// vulnerability and product, dropping the older ones
+	MergeSupersede MergeStrategy = "supersede"
+)
+
+// MergeConflict describes statements with different statuses about the
+// same vulnerability and product at the same time.
+type MergeConflict struct {
+	Vulnerability string
+	Product       string
+	Timestamp     time.Time
+	Statuses      []vex.Status
+}
+
+// String returns a description of the conflict
+func (mc MergeConflict) String() string {
+	statuses := []string{}
+	for _, s := range mc.Statuses {
+		statuses = append(statuses, string(s))
+	}
+	return fmt.Sprintf(
+		"%s in %s at %s is %s", mc.Vulnerability, mc.Product,
+		mc.Timestamp.Format(time.RFC3339), strings.Join(statuses, " and "),
+	)
+}
+
+// ChangelogEntry records a statement that was superseded by a newer
+// statement about the same vulnerability and product.
+type ChangelogEntry struct {
+	Vulnerability string       `json:"vulnerability"`
+	Product       string       `json:"product"`
+	Superseded    StatementRef `json:"superseded"`
+	SupersededBy  StatementRef `json:"superseded_by"`
+}
+
+// StatementRef captures the data identifying a statement in a changelog
+type StatementRef struct {
+	ID        string     `json:"id,omitempty"`
+	Status    vex.Status `json:"status"`
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+}
+
+// documentContentID returns a placeholder ID for a document without one,
+// derived from the hash of its JSON encoding.
+func documentContentID(doc *vex.VEX) (string, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return "", fmt.Errorf("hashing document contents: %w", err)
+	}
+	return fmt.Sprintf("VEX-DOC-%x", sha256.Sum256(data)), nil
+}
+
+// Merge combines the statements from a number of documents into
+// a new one, preserving time context from each of them.
+func (impl *defaultVexCtlImplementation) Merge(
+	_ context.Context, mergeOpts *MergeOptions, docs []*vex.VEX,
+) (*vex.VEX, error) {
+	if len(docs) == 0 {
+		return nil, fmt.Errorf("at least one vex document is required to merge")
+	}
+	if err := mergeOpts.ProductMatchMode.validate(); err != nil {
+		return nil, err
+	}
+
+	docID := mergeOpts.DocumentID
+	// If no document id is specified we compute a
+	// deterministic ID using the merged docs
+	if docID == "" {
+		ids := []string{}
+		for _, d := range docs {
+			if d.ID != "" {
+				ids = append(ids, d.ID)
+				continue
+			}
+			// Documents without an ID are identified by their contents
+			// so that the merged ID does not depend on their order.
+			id, err := documentContentID(d)
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+		}
+
+		sort.Strings(ids)
+		h := sha256.New()
+		h.Write([]byte(strings.Join(ids, ":")))
+		// Hash the sorted IDs list
+		docID = fmt.Sprintf("merged-vex-%x", h.Sum(nil))
+	}
+
+	newDoc := vex.New()
+
+	newDoc.ID = docID
+	if author := mergeOpts.Author; author != "" {
+		newDoc.Author = author
+	}
+	if authorRole := mergeOpts.AuthorRole; authorRole != "" {
+		newDoc.AuthorRole = authorRole
+	}
+
+	ss := []vex.Statement{}
+
+	filter := FilterSpec{
+		Products:        mergeOpts.Products,
+		Vulnerabilities: mergeOpts.Vulnerabilities,
+		Statuses:        mergeOpts.Statuses,
+
+		ProductMatchMode: mergeOpts.ProductMatchMode,
+	}
+
+	var interner stringInterner
+	if mergeOpts.InternProducts {
+		interner = stringInterner{}
+	}
+
+	// Statements take the author of the document they come from
+	trustedAuthors := map[string]struct{}{}
+	for _, author := range mergeOpts.TrustedAuthors {
+		trustedAuthors[strings.TrimSpace(author)] = struct{}{}
+	}
+	untrusted := 0
+
+	// Rank the documents by date to resolve conflicts
+	sortedDocs := vex.SortDocuments(slices.Clone(docs))
+	docRank := map[*vex.VEX]int{}
+	for i, doc := range sortedDocs {
+		docRank[doc] = i
+	}
+	origins := []statementOrigin{}
+	unjustified := []string{}
+
+	for docIndex, doc := range docs {
+		if len(trustedAuthors) > 0 {
+			if _, ok := trustedAuthors[strings.TrimSpace(doc.Author)]; !ok {
+				untrusted += len(doc.Statements)
+				continue
+			}
+		}
+		for _, s := range doc.Statements { //nolint:gocritic // this IS supposed to copy
+			if !filter.matches(&s, doc.Timestamp) {
+				continue
+			}
+
+			if err := checkJustification(&s); err != nil {
+				unjustified = append(unjustified, fmt.Sprintf("%s in document %q", s.Vulnerability.Name, doc.ID))
+			}
+
+			// If statement does not have a timestamp, cascade
+			// the timestamp down from the document.
+			// See https://github.com/chainguard-dev/vex/issues/49
+			if s.Timestamp == nil {
+				if doc.Timestamp == nil {
+					return nil, errTimelessStatement
+				}
+				s.Timestamp = doc.Timestamp
+			}
+
+			// When interning, the products are copied so that the
+			// source documents are not modified.
+			if interner != nil {
+				s.Products = interner.internProducts(s.Products)
+			}
+
+			if mergeOpts.AnnotateSource {
+				s.StatusNotes = annotateSource(s.StatusNotes, doc)
+			}
+
+			ss = append(ss, s)
+			origins = append(origins, statementOrigin{rank: docRank[doc], source: docIndex})
+		}
+	}
+
+	if len(unjustified) > 0 {
+		msg := fmt.Sprintf(
+			"%d not_affected statements have no justification or impact statement: %s",
+			len(unjustified), strings.Join(unjustified, "; "),
+		)
+		if mergeOpts.RequireJustification {
+			return nil, errors.New(msg)
+		}
+		impl.log().Warn(msg)
+	}
+
+	// The changelog is computed before the conflict policy, the strategy
+	// and deduplication drop statements, so it lists all of them.
+	var changelog []ChangelogEntry
+	if mergeOpts.ChangelogWriter != nil {
+		history := slices.Clone(ss)
+		vex.SortStatements(history, *newDoc.Metadata.Timestamp)
+		changelog = supersededStatements(history)
+	}
+
+	switch mergeOpts.OnConflict {
+	case "", ConflictKeepBoth:
+	case ConflictError, ConflictKeepLatest:
+		var conflicts []MergeConflict
+		ss, origins, conflicts = resolveConflicts(ss, origins)
+		if len(conflicts) > 0 {
+			descs := []string{}
+			for _, c := range conflicts {
+				descs = append(descs, c.String())
+			}
+			if mergeOpts.OnConflict == ConflictError {
+				return nil, fmt.Errorf("found %d conflicting statements: %s", len(conflicts), strings.Join(descs, "; "))
+			}
+			impl.log().Warnf("Resolved %d conflicts keeping the latest statements: %s", len(conflicts), strings.Join(descs, "; "))
+		}
+	default:
+		return nil, fmt.Errorf("unknown conflict policy %q", mergeOpts.OnConflict)
+	}
+
+	switch mergeOpts.Strategy {
+	case "", MergeAccumulate:
+	case MergeSupersede:
+		n := len(ss)
+		ss, origins = supersedeStatements(ss, origins)
+		impl.log().Debugf("Dropped %d superseded statements", n-len(ss))
+	default:
+		return nil, fmt.Errorf("unknown merge strategy %q", mergeOpts.Strategy)
+	}
+
+	if untrusted > 0 {
+		impl.log().Infof("Dropped %d statements from untrusted authors", untrusted)
+	}
+
+	if !mergeOpts.KeepDuplicates {
+		n := len(ss)
+		ss, origins = deduplicateStatements(ss, origins)
+		impl.log().Debugf("Removed %d duplicate statements", n-len(ss))
+	}
+
+	// The merged document keeps the time of the newest source document
+	// so that it reflects when the decisions were made, not when they
+	// were merged.
+	if !mergeOpts.UseCurrentTime {
+		if ts := newestDocumentTimestamp(docs); ts != nil {
+			newDoc.Timestamp = ts
+		}
+	}
+	newDoc.LastUpdated = newestStatementTimestamp(ss)
+
+	sorted := slices.Clone(ss)
+	vex.SortStatements(sorted, *newDoc.Metadata.Timestamp)
+	if mergeOpts.PreserveSourceOrder {
+		newDoc.Statements = sortBySource(ss, origins, len(docs), *newDoc.Metadata.Timestamp)
+	} else {
+		newDoc.Statements = sorted
+	}
+
+	if mergeOpts.ChangelogWriter != nil {
+		enc := json.NewEncoder(mergeOpts.ChangelogWriter)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(changelog); err != nil {
+			return nil, fmt.Errorf("writing merge changelog: %w", err)
+		}
+	}
+
+	return &newDoc, nil
+}
+
+// annotateSource appends the provenance of a statement to its notes.
+// OpenVEX statements have no field to record where they came from, so the
+// ID of the source document, along with its tooling and supplier, is
+// written in the notes where readers of the merged document can see it.
+func annotateSource(notes string, doc *vex.VEX) string {
+	source := []string{"source: " + doc.ID}
+	if doc.Tooling != "" {
+		source = append(source, "tooling: "+doc.Tooling)
+	}
+	if doc.Supplier != "" {
+		source = append(source, "supplier: "+doc.Supplier)
+	}
+	annotation := "[" + strings.Join(source, "; ") + "]"
+	if notes == "" {
+		return annotation
+	}
+	return notes + " " + annotation
+}
+
+// newestDocumentTimestamp returns the most recent document timestamp
+func newestDocumentTimestamp(docs []*vex.VEX) *time.Time {
+	var newest *time.Time
+	for _, doc := range docs {
+		if doc.Timestamp != nil && (newest == nil || doc.Timestamp.After(*newest)) {
+			ts := *doc.Timestamp
+			newest = &ts
+		}
+	}
+	return newest
+}
+
+// errTimelessStatement is returned when a statement has no timestamp and
+// its document has none to inherit
+var errTimelessStatement = errors.New("unable to cascade timestamp from doc to timeless statement")
+
+// CascadeTimestamps sets the timestamp of the statements without one to
+// the document timestamp and updates the document LastUpdated to the newest
+// statement time. If a statement has no timestamp and the document has none
+// to inherit, it returns an error and the document is left untouched.
+func CascadeTimestamps(doc *vex.VEX) error {
+	if doc == nil {
+		return errors.New("cannot cascade timestamps, vex document is nil")
+	}
+	if doc.Timestamp == nil {
+		for i := range doc.Statements {
+			if doc.Statements[i].Timestamp == nil {
+				return fmt.Errorf("statement #%d: %w", i, errTimelessStatement)
+			}
+		}
+	}
+
+	for i := range doc.Statements {
+		if doc.Statements[i].Timestamp == nil {
+			ts := *doc.Timestamp
+			doc.Statements[i].Timestamp = &ts
+		}
+	}
+	if newest := newestStatementTimestamp(doc.Statements); newest != nil &&
+		(doc.LastUpdated == nil || newest.After(*doc.LastUpdated)) {
+		doc.LastUpdated = newest
+	}
+	return nil
+}
+
+// newestStatementTimestamp returns the most recent time a statement was
+// issued or updated.
+func newestStatementTimestamp(stmts []vex.Statement) *time.Time {
+	var newest *time.Time
+	for i := range stmts {
+		for _, ts := range []*time.Time{stmts[i].Timestamp, stmts[i].LastUpdated} {
+			if ts != nil && (newest == nil || ts.After(*newest)) {
+				t := *ts
+				newest = &t
+			}
+		}
+	}
+	return newest
+}
+
+// statementOrigin records where a statement being merged comes from
+type statementOrigin struct {
+	rank   int // Position of the source document when sorted by date
+	source int // Position of the source document in the Merge input
+}
+
+// productScopeKey returns a key identifying a statement product along with
+// its subcomponents, so that statements about different subcomponents of the
+// same product are not taken to be about the same thing.
+func productScopeKey(p *vex.Product) string {
+	key := productIdentifier(&p.Component)
+	if len(p.Subcomponents) == 0 {
+		return key
+	}
+	subs := make([]string, 0, len(p.Subcomponents))
+	for i := range p.Subcomponents {
+		subs = append(subs, productIdentifier(&p.Subcomponents[i].Component))
+	}
+	sort.Strings(subs)
+	return key + "[" + strings.Join(subs, ",") + "]"
+}
+
+// resolveConflicts finds statements with different statuses about the same
+// vulnerability and product at the same time. It returns the statements
+// with the products of the conflicting statements from the older documents
+// removed (as ranked in origins), the origins of the statements kept and the
+// list of conflicts found.
+func resolveConflicts(
+	stmts []vex.Statement, origins []statementOrigin,
+) ([]vex.Statement, []statementOrigin, []MergeConflict) {
+	type entry struct {
+		statement int
+		product   int
+	}
+	groups := map[string][]entry{}
+	keys := []string{}
+	for i := range stmts {
+		for j := range stmts[i].Products {
+			key := fmt.Sprintf(
+				"%s|%s|%d", CanonicalizeVulnID(string(stmts[i].Vulnerability.Name)),
+				productScopeKey(&stmts[i].Products[j]), stmts[i].Timestamp.UnixNano(),
+			)
+			if _, ok := groups[key]; !ok {
+				keys = append(keys, key)
+			}
+			groups[key] = append(groups[key], entry{i, j})
+		}
+	}
+
+	conflicts := []MergeConflict{}
+	removed := map[entry]struct{}{}
+	for _, key := range keys {
+		group := groups[key]
+		statuses := []vex.Status{}
+		winner := group[0]
+		for _, e := range group {
+			if !slices.Contains(statuses, stmts[e.statement].Status) {
+				statuses = append(statuses, stmts[e.statement].Status)
+			}
+			if origins[e.statement].rank >= origins[winner.statement].rank {
+				winner = e
+			}
+		}
+		if len(statuses) < 2 {
+			continue
+		}
+
+		first := &stmts[group[0].statement]
+		conflicts = append(conflicts, MergeConflict{
+			Vulnerability: string(first.Vulnerability.Name),
+			Product:       productIdentifier(&first.Products[group[0].product].Component),
+			Timestamp:     *first.Timestamp,
+			Statuses:      statuses,
+		})
+		for _, e := range group {
+			if stmts[e.statement].Status != stmts[winner.statement].Status {
+				removed[e] = struct{}{}
+			}
+		}
 	}
 
-	return &att.Predicate, nil
-}
+	if len(removed) == 0 {
+		return stmts, origins, conflicts
+	}
 
-type MergeOptions struct {
-	DocumentID      string   // ID to use in the new document
-	Author          string   // Author to use in the new document
-	AuthorRole      string   // Role of the document author
-	Products        []string // Product IDs to consider
-	Vulnerabilities []string // IDs of vulnerabilities to merge
+	ret := []vex.Statement{}
+	retOrigins := []statementOrigin{}
+	for i := range stmts {
+		products := []vex.Product{}
+		for j := range stmts[i].Products {
+			if _, ok := removed[entry{i, j}]; !ok {
+				products = append(products, stmts[i].Products[j])
+			}
+		}
+		if len(products) == 0 {
+			continue
+		}
+		s := stmts[i]
+		s.Products = products
+		ret = append(ret, s)
+		retOrigins = append(retOrigins, origins[i])
+	}
+	return ret, retOrigins, conflicts
 }
 
-// Merge combines the statements from a number of documents into
-// a new one, preserving time context from each of them.
-func (impl *defaultVexCtlImplementation) Merge(
-	_ context.Context, mergeOpts *MergeOptions, docs []*vex.VEX,
-) (*vex.VEX, error) {
-	if len(docs) == 0 {
-		return nil, fmt.Errorf("at least one vex document is required to merge")
+// supersedeStatements keeps only the newest statement about each
+// vulnerability and product. Statements about several products are kept
+// with the products they are the newest statement about. Timestamps must be
+// cascaded, ties go to the statement from the latest document (as ranked in
+// origins) and then to the last one.
+func supersedeStatements(
+	stmts []vex.Statement, origins []statementOrigin,
+) ([]vex.Statement, []statementOrigin) {
+	newest := map[string]int{}
+	newer := func(i, j int) bool {
+		if !stmts[i].Timestamp.Equal(*stmts[j].Timestamp) {
+			return stmts[i].Timestamp.After(*stmts[j].Timestamp)
+		}
+		return origins[i].rank >= origins[j].rank
 	}
-
-	docID := mergeOpts.DocumentID
-	// If no document id is specified we compute a
-	// deterministic ID using the merged docs
-	if docID == "" {
-		ids := []string{}
-		for i, d := range docs {
-			if d.ID == "" {
-				ids = append(ids, fmt.Sprintf("VEX-DOC-%d", i))
-			} else {
-				ids = append(ids, d.ID)
+	productKey := func(i, j int) string {
+		return CanonicalizeVulnID(string(stmts[i].Vulnerability.Name)) + "|" + productScopeKey(&stmts[i].Products[j])
+	}
+	for i := range stmts {
+		for j := range stmts[i].Products {
+			key := productKey(i, j)
+			if k, ok := newest[key]; !ok || newer(i, k) {
+				newest[key] = i
 			}
 		}
+	}
 
-		sort.Strings(ids)
-		h := sha256.New()
-		h.Write([]byte(strings.Join(ids, ":")))
-		// Hash the sorted IDs list
-		docID = fmt.Sprintf("merged-vex-%x", h.Sum(nil))
+	ret := []vex.Statement{}
+	retOrigins := []statementOrigin{}
+	for i := range stmts {
+		products := []vex.Product{}
+		for j := range stmts[i].Products {
+			if newest[productKey(i, j)] == i {
+				products = append(products, stmts[i].Products[j])
+			}
+		}
+		if len(products) == 0 && len(stmts[i].Products) > 0 {
+			continue
+		}
+		s := stmts[i]
+		s.Products = products
+		ret = append(ret, s)
+		retOrigins = append(retOrigins, origins[i])
 	}
+	return ret, retOrigins
+}
 
-	newDoc := vex.New()
+// deduplicateStatements collapses statements with the same vulnerability,
+// products, status and justification into the most recent one. It returns
+// the statements kept and their origins.
+func deduplicateStatements(
+	stmts []vex.Statement, origins []statementOrigin,
+) ([]vex.Statement, []statementOrigin) {
+	ret := []vex.Statement{}
+	retOrigins := []statementOrigin{}
+	index := map[string]int{}
+	for i := range stmts {
+		products := []string{}
+		for j := range stmts[i].Products {
+			products = append(products, productScopeKey(&stmts[i].Products[j]))
+		}
+		sort.Strings(products)
+		key := strings.Join([]string{
+			CanonicalizeVulnID(string(stmts[i].Vulnerability.Name)),
+			strings.Join(products, ","),
+			string(stmts[i].Status),
+			string(stmts[i].Justification),
+		}, "|")
+
+		j, ok := index[key]
+		if !ok {
+			index[key] = len(ret)
+			ret = append(ret, stmts[i])
+			retOrigins = append(retOrigins, origins[i])
+			continue
+		}
+		// Statements have their timestamps cascaded at this point
+		if ret[j].Timestamp != nil && stmts[i].Timestamp != nil && stmts[i].Timestamp.After(*ret[j].Timestamp) {
+			ret[j] = stmts[i]
+			retOrigins[j] = origins[i]
+		}
+	}
+	return ret, retOrigins
+}
 
-	newDoc.ID = docID
-	if author := mergeOpts.Author; author != "" {
-		newDoc.Author = author
+// sortBySource groups the statements by the document they come from, in the
+// order the documents were passed to Merge, and sorts each group.
+func sortBySource(
+	stmts []vex.Statement, origins []statementOrigin, numDocs int, docTime time.Time,
+) []vex.Statement {
+	groups := make([][]vex.Statement, numDocs)
+	for i := range stmts {
+		groups[origins[i].source] = append(groups[origins[i].source], stmts[i])
 	}
-	if authorRole := mergeOpts.AuthorRole; authorRole != "" {
-		newDoc.AuthorRole = authorRole
+	ret := make([]vex.Statement, 0, len(stmts))
+	for _, group := range groups {
+		vex.SortStatements(group, docTime)
+		ret = append(ret, group...)
 	}
+	return ret
+}
 
-	ss := []vex.Statement{}
+// supersededStatements takes a list of statements sorted by vulnerability
+// and time and returns a changelog entry for each statement that is superseded
+// by a later one about the same vulnerability and product.
+func supersededStatements(stmts []vex.Statement) []ChangelogEntry {
+	entries := []ChangelogEntry{}
+	latest := map[string]map[string]*vex.Statement{}
+	for i := range stmts {
+		vuln := CanonicalizeVulnID(string(stmts[i].Vulnerability.Name))
+		if _, ok := latest[vuln]; !ok {
+			latest[vuln] = map[string]*vex.Statement{}
+		}
+		for j := range stmts[i].Products {
+			key := productScopeKey(&stmts[i].Products[j])
+			if prev, ok := latest[vuln][key]; ok {
+				entries = append(entries, ChangelogEntry{
+					Vulnerability: vuln,
+					Product:       productIdentifier(&stmts[i].Products[j].Component),
+					Superseded:    StatementRef{ID: prev.ID, Status: prev.Status, Timestamp: prev.Timestamp},
+					SupersededBy:  StatementRef{ID: stmts[i].ID, Status: stmts[i].Status, Timestamp: stmts[i].Timestamp},
+				})
+			}
+			latest[vuln][key] = &stmts[i]
+		}
+	}
+	return entries
+}
 
-	// Create an inverse dict of products and vulnerabilities to filter
-	// these will only be used if ids to filter on are defined in the options.
-	iProds := map[string]struct{}{}
-	iVulns := map[string]struct{}{}
-	for _, id := range mergeOpts.Products {
-		iProds[id] = struct{}{}
+// LoadFiles loads multiple vex files from disk. Paths containing glob
+// metacharacters are expanded with filepath.Glob, files matched more than
+// once are only loaded the first time. Documents with the same contents as
+// one loaded earlier, eg through a symlink, are skipped. The StdinPath path
+// reads a document from stdin.
+//
+// If opts.ContinueOnLoadError is set, files that fail to load are skipped:
+// the documents that loaded are returned along with an error joining all
+// the failures.
+func (impl *defaultVexCtlImplementation) LoadFiles(
+	_ context.Context, opts Options, filePaths []string,
+) ([]*vex.VEX, error) {
+	paths, err := expandGlobs(filePaths)
+	if err != nil {
+		return nil, err
 	}
-	for _, id := range mergeOpts.Vulnerabilities {
-		iVulns[id] = struct{}{}
+
+	vexes := make([]*vex.VEX, 0, len(paths))
+	loaded := map[string]string{}
+	errs := []error{}
+	for _, path := range paths {
+		doc, err := impl.openVexPath(opts, path)
+		if err != nil {
+			if !opts.ContinueOnLoadError {
+				return nil, fmt.Errorf("error loading file: %w", err)
+			}
+			errs = append(errs, fmt.Errorf("loading %s: %w", path, err))
+			continue
+		}
+		hash, err := documentContentID(doc)
+		if err != nil {
+			return nil, fmt.Errorf("error loading file: %w", err)
+		}
+		if first, ok := loaded[hash]; ok {
+			impl.log().Infof("Skipping %s, it has the same contents as %s", path, first)
+			continue
+		}
+		loaded[hash] = path
+		vexes = append(vexes, doc)
 	}
 
-	for _, doc := range docs {
-		for _, s := range doc.Statements { //nolint:gocritic // this IS supposed to copy
-			matchesProduct := false
-			for id := range iProds {
-				if s.MatchesProduct(id, "") {
-					matchesProduct = true
-					break
-				}
+	return vexes, errors.Join(errs...)
+}
+
+// expandGlobs replaces the glob patterns in paths with the files they
+// match, sorted by name. Duplicate paths are dropped.
+func expandGlobs(paths []string) ([]string, error) {
+	expanded := []string{}
+	seen := map[string]struct{}{}
+	for _, p := range paths {
+		matches := []string{p}
+		if strings.ContainsAny(p, `*?[`) {
+			var err error
+			matches, err = filepath.Glob(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", p, err)
 			}
-			if len(iProds) > 0 && !matchesProduct {
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("pattern %q did not match any files", p)
+			}
+			sort.Strings(matches)
+		}
+		for _, m := range matches {
+			if _, ok := seen[filepath.Clean(m)]; ok {
 				continue
 			}
+			seen[filepath.Clean(m)] = struct{}{}
+			expanded = append(expanded, m)
+		}
+	}
+	return expanded, nil
+}
 
-			matchesVuln := false
-			for id := range iVulns {
-				if s.Vulnerability.Matches(id) {
-					matchesVuln = true
-					break
-				}
+// vexFileSuffixes are the extensions of the files picked up by LoadDirectory
+var vexFileSuffixes = []string{".vex.json", ".openvex.json"}
+
+// LoadDirectory loads the VEX documents found in a directory. Only files
+// named *.vex.json or *.openvex.json are considered and JSON files that are
+// not OpenVEX documents or attestations are skipped. When recursive is true,
+// subdirectories are walked too.
+//
+// If continueOnError is set, files that fail to load do not stop the walk:
+// the documents that loaded are returned along with an error joining all
+// the failures.
+func (impl *defaultVexCtlImplementation) LoadDirectory(
+	_ context.Context, root string, recursive, continueOnError bool,
+) ([]*vex.VEX, error) {
+	vexes := []*vex.VEX{}
+	errs := []error{}
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if !continueOnError || path == root {
+				return err
 			}
-			if len(iVulns) > 0 && !matchesVuln {
-				continue
+			errs = append(errs, err)
+			return nil
+		}
+		if d.IsDir() {
+			if path != root && !recursive {
+				return filepath.SkipDir
 			}
+			return nil
+		}
+		if !slices.ContainsFunc(vexFileSuffixes, func(suffix string) bool {
+			return strings.HasSuffix(strings.ToLower(d.Name()), suffix)
+		}) {
+			return nil
+		}
 
-			// If statement does not have a timestamp, cascade
-			// the timestamp down from the document.
-			// See https://github.com/chainguard-dev/vex/issues/49
-			if s.Timestamp == nil {
-				if doc.Timestamp == nil {
-					return nil, errors.New("unable to cascade timestamp from doc to timeless statement")
-				}
-				s.Timestamp = doc.Timestamp
+		doc, err := loadVEXFile(path)
+		if err != nil {
+			err = fmt.Errorf("loading %s: %w", path, err)
+			if !continueOnError {
+				return err
 			}
-
-			ss = append(ss, s)
+			errs = append(errs, err)
+			return nil
 		}
+		if doc == nil {
+			impl.log().Debugf("skipping %s, not an OpenVEX document", path)
+			return nil
+		}
+		vexes = append(vexes, doc)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walking %s: %w", root, err)
 	}
 
-	vex.SortStatements(ss, *newDoc.Metadata.Timestamp)
+	return vexes, errors.Join(errs...)
+}
 
-	newDoc.Statements = ss
+// loadVEXFile reads an OpenVEX document or an attestation wrapping one.
+// Files that are JSON but not VEX return a nil document and no error.
+func loadVEXFile(path string) (*vex.VEX, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading file: %w", err)
+	}
 
-	return &newDoc, nil
-}
+	header := struct {
+		Context       any             `json:"@context"`
+		PredicateType string          `json:"predicateType"`
+		Predicate     json.RawMessage `json:"predicate"`
+	}{}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, fmt.Errorf("parsing JSON: %w", err)
+	}
 
-// LoadFiles loads multiple vex files from disk
-func (impl *defaultVexCtlImplementation) LoadFiles(
-	_ context.Context, filePaths []string,
-) ([]*vex.VEX, error) {
-	vexes := make([]*vex.VEX, len(filePaths))
-	for i, path := range filePaths {
+	switch {
+	case strings.HasPrefix(header.PredicateType, vex.TypeURI):
+		doc, err := vex.Parse(header.Predicate)
+		if err != nil {
+			return nil, fmt.Errorf("parsing attestation predicate: %w", err)
+		}
+		return doc, nil
+	case isOpenVEXContext(header.Context):
 		doc, err := vex.Open(path)
 		if err != nil {
-			return nil, fmt.Errorf("error loading file: %w", err)
+			return nil, fmt.Errorf("opening document: %w", err)
 		}
-		vexes[i] = doc
+		return doc, nil
+	default:
+		return nil, nil
 	}
+}
 
-	return vexes, nil
+// isOpenVEXContext checks if a JSON-LD @context, a string or a list of
+// strings, points to the OpenVEX context.
+func isOpenVEXContext(ctx any) bool {
+	switch v := ctx.(type) {
+	case string:
+		return strings.HasPrefix(v, vex.Context)
+	case []any:
+		for _, c := range v {
+			if s, ok := c.(string); ok && strings.HasPrefix(s, vex.Context) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// stringInterner deduplicates strings so that equal values share the
+// same backing storage.
+type stringInterner map[string]string
+
+// intern returns the stored copy of str, storing a clone if it's new so
+// that the interned strings don't keep the source documents in memory.
+func (si stringInterner) intern(str string) string {
+	if v, ok := si[str]; ok {
+		return v
+	}
+	str = strings.Clone(str)
+	si[str] = str
+	return str
+}
+
+// internProducts returns a copy of a product list with all its identifier
+// strings interned.
+func (si stringInterner) internProducts(products []vex.Product) []vex.Product {
+	if products == nil {
+		return nil
+	}
+	ret := make([]vex.Product, len(products))
+	for i := range products {
+		ret[i].Component = si.internComponent(&products[i].Component)
+		if products[i].Subcomponents == nil {
+			continue
+		}
+		ret[i].Subcomponents = make([]vex.Subcomponent, len(products[i].Subcomponents))
+		for j := range products[i].Subcomponents {
+			ret[i].Subcomponents[j].Component = si.internComponent(&products[i].Subcomponents[j].Component)
+		}
+	}
+	return ret
+}
+
+// internComponent returns a copy of a component with its strings interned
+func (si stringInterner) internComponent(c *vex.Component) vex.Component {
+	ret := vex.Component{
+		ID:       si.intern(c.ID),
+		Supplier: si.intern(c.Supplier),
+	}
+	if c.Hashes != nil {
+		ret.Hashes = make(map[vex.Algorithm]vex.Hash, len(c.Hashes))
+		for a, h := range c.Hashes {
+			ret.Hashes[vex.Algorithm(si.intern(string(a)))] = vex.Hash(si.intern(string(h)))
+		}
+	}
+	if c.Identifiers != nil {
+		ret.Identifiers = make(map[vex.IdentifierType]string, len(c.Identifiers))
+		for t, id := range c.Identifiers {
+			ret.Identifiers[vex.IdentifierType(si.intern(string(t)))] = si.intern(id)
+		}
+	}
+	return ret
 }
 
 // ListDocumentProducts returns an array of all the prodicts in the document
@@ -479,30 +2478,55 @@ func (impl *defaultVexCtlImplementation) ListDocumentProducts(doc *vex.VEX) ([]p
 	if doc == nil {
 		return nil, errors.New("cannot read subjects, vex document is nil")
 	}
-	inv := map[string]map[vex.Algorithm]vex.Hash{}
-	products := []productRef{}
+	inv := productInventory{}
 	for i := range doc.Statements {
-		for _, p := range doc.Statements[i].Products {
-			switch {
-			case p.ID != "":
-				inv[p.ID] = p.Hashes
-			case len(p.Identifiers) > 0:
-				if i, ok := p.Identifiers[vex.PURL]; ok {
-					inv[i] = p.Hashes
-					continue
-				}
-				for _, id := range p.Identifiers {
-					inv[id] = p.Hashes
-				}
-			case len(p.Hashes) > 0:
-				for _, hash := range p.Hashes {
-					inv[string(hash)] = p.Hashes
-					continue
-				}
+		inv.add(&doc.Statements[i])
+	}
+	return inv.refs(), nil
+}
+
+// StreamDocumentProducts is like ListDocumentProducts but reads the
+// document at path one statement at a time (see StreamStatements), so the
+// products of documents too large to load can be listed.
+func (impl *defaultVexCtlImplementation) StreamDocumentProducts(path string) ([]productRef, error) {
+	inv := productInventory{}
+	if err := StreamStatements(path, func(s vex.Statement) error {
+		inv.add(&s)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("streaming statements: %w", err)
+	}
+	return inv.refs(), nil
+}
+
+// productInventory collects the products of statements and their hashes
+type productInventory map[string]map[vex.Algorithm]vex.Hash
+
+// add records the products of a statement in the inventory
+func (inv productInventory) add(s *vex.Statement) {
+	for _, p := range s.Products {
+		switch {
+		case p.ID != "":
+			addProductHashes(inv, canonicalImageRef(p.ID), p.Hashes)
+		case len(p.Identifiers) > 0:
+			if i, ok := p.Identifiers[vex.PURL]; ok {
+				inv[i] = p.Hashes
+				continue
+			}
+			for _, id := range p.Identifiers {
+				addProductHashes(inv, canonicalImageRef(id), p.Hashes)
+			}
+		case len(p.Hashes) > 0:
+			for _, hash := range p.Hashes {
+				inv[string(hash)] = p.Hashes
+				continue
 			}
 		}
 	}
+}
 
+// refs returns the products in the inventory sorted by name
+func (inv productInventory) refs() []productRef {
 	// Sort the identifier list to make the return value deterministic
 	ids := []string{}
 	for id := range inv {
@@ -511,6 +2535,7 @@ func (impl *defaultVexCtlImplementation) ListDocumentProducts(doc *vex.VEX) ([]p
 
 	sort.Strings(ids)
 
+	products := []productRef{}
 	for _, id := range ids {
 		h := inv[id]
 		if h == nil {
@@ -521,7 +2546,43 @@ func (impl *defaultVexCtlImplementation) ListDocumentProducts(doc *vex.VEX) ([]p
 			Hashes: h,
 		})
 	}
-	return products, nil
+	return products
+}
+
+// addProductHashes records the hashes of a product in the inventory, merging
+// them with those of entries already listed under the same name.
+func addProductHashes(inv map[string]map[vex.Algorithm]vex.Hash, id string, hashes map[vex.Algorithm]vex.Hash) {
+	if _, ok := inv[id]; !ok {
+		inv[id] = map[vex.Algorithm]vex.Hash{}
+	}
+	for algo, h := range hashes {
+		inv[id][algo] = h
+	}
+}
+
+// ListDocumentVulnerabilities returns the sorted list of the vulnerability
+// names and aliases referenced in the document statements, in their
+// canonical form (see CanonicalizeVulnID).
+func (impl *defaultVexCtlImplementation) ListDocumentVulnerabilities(doc *vex.VEX) ([]vex.VulnerabilityID, error) {
+	if doc == nil {
+		return nil, errors.New("cannot read vulnerabilities, vex document is nil")
+	}
+	inv := map[vex.VulnerabilityID]struct{}{}
+	for i := range doc.Statements {
+		v := &doc.Statements[i].Vulnerability
+		for _, id := range append([]vex.VulnerabilityID{v.Name}, v.Aliases...) {
+			if id := CanonicalizeVulnID(string(id)); id != "" {
+				inv[vex.VulnerabilityID(id)] = struct{}{}
+			}
+		}
+	}
+
+	ids := make([]vex.VulnerabilityID, 0, len(inv))
+	for id := range inv {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids, nil
 }
 
 // NormalizeImageRefs returns a list of image references from a list of
@@ -547,14 +2608,8 @@ func (impl *defaultVexCtlImplementation) NormalizeProducts(subjects []productRef
 				return nil, nil, nil, fmt.Errorf("parsing OCI purl subject: %s", err)
 			}
 
-			ref := ""
+			ref := ociPurlRepository(p)
 			qs := p.Qualifiers.Map()
-			if r, ok := qs["repository_url"]; ok {
-				ref = fmt.Sprintf("%s/%s", strings.TrimSuffix(r, "/"), p.Name)
-			} else {
-				// digest or image
-				ref = p.Name
-			}
 			var hash vex.Hash
 			var algo vex.Algorithm
 			if p.Version != "" {
@@ -562,11 +2617,10 @@ func (impl *defaultVexCtlImplementation) NormalizeProducts(subjects []productRef
 				parts := strings.Split(p.Version, ":")
 				if len(parts) > 1 {
 					hash = vex.Hash(parts[1])
-					switch parts[0] {
-					case "sha256":
-						algo = vex.SHA256
-					case "sha512":
-						algo = vex.SHA3512
+					var ok bool
+					if algo, ok = DigestAlgorithms[parts[0]]; !ok {
+						impl.log().Warnf("Unknown digest algorithm %q in %s, keeping the hash as-is", parts[0], pref.Name)
+						algo = vex.Algorithm(parts[0])
 					}
 				}
 			} else if tag, ok := qs["tag"]; ok {
@@ -575,9 +2629,9 @@ func (impl *defaultVexCtlImplementation) NormalizeProducts(subjects []productRef
 			if algo != "" {
 				pref.Hashes[algo] = hash
 			}
-			pref.Name = ref
-			logrus.Debugf("%s is a purl for %s", pref.Name, ref)
-			imageRefs = append(imageRefs, pref)
+			impl.log().Debugf("%s is a purl for %s", pref.Name, ref)
+			pref.Name = canonicalImageRef(ref)
+			imageRefs = appendImageRef(imageRefs, pref)
 		case strings.HasPrefix(pref.Name, "pkg:"):
 			// When there are other purls, we only attest them as subjects if
 			// the product reference has hashes
@@ -590,16 +2644,92 @@ func (impl *defaultVexCtlImplementation) NormalizeProducts(subjects []productRef
 			// If not,try to parse the string as an image reference. If they can
 			// be parsed as image references but they cannot be looked up, attestting
 			// will fail trying to fetch their digests.
-			if _, err := name.ParseReference(pref.Name); err == nil {
-				imageRefs = append(imageRefs, pref)
-			} else {
+			switch _, err := parseImageName(pref.Name); {
+			case err == nil:
+				pref.Name = canonicalImageRef(pref.Name)
+				imageRefs = appendImageRef(imageRefs, pref)
+			case len(pref.Hashes) > 0:
 				otherRefs = append(otherRefs, pref)
+			default:
+				unattestableRefs = append(unattestableRefs, pref)
 			}
 		}
 	}
 	return imageRefs, otherRefs, unattestableRefs, nil
 }
 
+// ExpandImageIndexes adds the platform images of any image index in refs
+// after the index reference. The platform images are referenced by digest
+// and carry their sha256 hash so they can be attested as subjects.
+func (impl *defaultVexCtlImplementation) ExpandImageIndexes(ctx context.Context, opts Options, refs []productRef) ([]productRef, error) {
+	remoteOpts := registryOptions(opts).GetRegistryClientOpts(ctx)
+	expanded := []productRef{}
+	for _, pref := range refs {
+		expanded = append(expanded, pref)
+		ref, err := parseImageReference(opts, pref.Name)
+		if err != nil {
+			continue
+		}
+		mediaType, children, err := imageIndexChildren(ctx, ref, remoteOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("expanding image index: %w", err)
+		}
+		expanded[len(expanded)-1].MediaType = mediaType
+		for _, child := range children {
+			expanded = append(expanded, productRef{
+				Name:      canonicalImageRef(ref.Context().Digest(child.Digest.String()).String()),
+				Hashes:    map[vex.Algorithm]vex.Hash{vex.SHA256: vex.Hash(child.Digest.Hex)},
+				MediaType: child.MediaType,
+			})
+		}
+	}
+	return expanded, nil
+}
+
+// appendImageRef adds an image reference to the list, merging its hashes into
+// an existing entry when the same image is already listed.
+func appendImageRef(refs []productRef, pref productRef) []productRef {
+	for i := range refs {
+		if refs[i].Name == pref.Name {
+			for algo, h := range pref.Hashes {
+				refs[i].Hashes[algo] = h
+			}
+			return refs
+		}
+	}
+	return append(refs, pref)
+}
+
+// canonicalImageRef returns the fully qualified form of an image reference so
+// the different ways of writing the same image compare equal. Docker Hub short
+// names are expanded to docker.io/library and the latest tag is added when the
+// reference has no tag or digest. Purls, URLs and strings that are not image
+// references are returned unchanged.
+func canonicalImageRef(s string) string {
+	ref, err := parseImageName(s)
+	if err != nil {
+		return s
+	}
+	registry := ref.Context().RegistryStr()
+	if registry == name.DefaultRegistry {
+		registry = "docker.io"
+	}
+	repo := registry + "/" + ref.Context().RepositoryStr()
+	if d, ok := ref.(name.Digest); ok {
+		return repo + "@" + d.DigestStr()
+	}
+	return repo + ":" + ref.Identifier()
+}
+
+// ociPurlRepository returns the image repository an OCI purl points to
+func ociPurlRepository(p purl.PackageURL) string {
+	if r, ok := p.Qualifiers.Map()["repository_url"]; ok {
+		return fmt.Sprintf("%s/%s", strings.TrimSuffix(r, "/"), p.Name)
+	}
+	// digest or image
+	return p.Name
+}
+
 // VerifySubjectsPresent takes a list of references and ensures they are present
 // in the document that is being attested
 func (impl *defaultVexCtlImplementation) VerifyImageSubjects(
@@ -615,22 +2745,175 @@ func (impl *defaultVexCtlImplementation) VerifyImageSubjects(
 		return fmt.Errorf("normalizing references: %s", err)
 	}
 
-	found := false
+	subjects := make([]string, 0, len(att.Subject))
+	for _, sb := range att.Subject {
+		subjects = append(subjects, sb.Name)
+	}
+
 	for _, r := range imageRefs {
+		found := false
 		for _, sb := range att.Subject {
-			found = false
-			if sb.Name == r.Name {
+			if canonicalImageRef(sb.Name) == r.Name {
+				if err := checkSubjectDigests(sb.Digest, r.Hashes); err != nil {
+					return fmt.Errorf("subject %s: %w", sb.Name, err)
+				}
 				found = true
 				break
 			}
 		}
 		if !found {
-			return fmt.Errorf("entry for %s not found in subjects %v", r, imageRefs)
+			return fmt.Errorf("entry for %s not found in subjects %v", r.Name, subjects)
+		}
+	}
+	return nil
+}
+
+// checkSubjectDigests returns an error if the subject digest set is missing
+// any of the product hashes or records a different value for them.
+func checkSubjectDigests(digests map[string]string, hashes map[vex.Algorithm]vex.Hash) error {
+	for algo, hash := range hashes {
+		alg, ok := intotoDigestNames[algo]
+		if !ok {
+			alg = string(algo)
+		}
+		digest, ok := digests[alg]
+		if !ok {
+			return fmt.Errorf("no %s digest, the document has %s", alg, hash)
+		}
+		if digest != string(hash) {
+			return fmt.Errorf("%s digest %s does not match %s in the document", alg, digest, hash)
+		}
+	}
+	return nil
+}
+
+// VerifySubjectDigests checks the digests recorded in the attestation subjects
+// against the registry. Each subject that is an image reference is resolved
+// and its current digest must match the sha256 digest in the subject. This
+// catches tags that were repointed after the attestation was generated.
+// Subjects without a sha256 digest cannot be checked and are skipped.
+func (impl *defaultVexCtlImplementation) VerifySubjectDigests(
+	ctx context.Context, att *attestation.Attestation, regOpts RegistryOptions,
+) error {
+	craneOpts := append([]crane.Option{crane.WithContext(ctx)}, regOpts.CraneOptions...)
+	for _, sb := range att.Subject {
+		if _, err := parseImageName(sb.Name); err != nil {
+			continue
+		}
+
+		recorded, ok := sb.Digest["sha256"]
+		if !ok || recorded == "" {
+			impl.log().Debugf("Not checking %s in the registry, subject has no sha256 digest", sb.Name)
+			continue
+		}
+
+		current, err := crane.Digest(sb.Name, craneOpts...)
+		if err != nil {
+			return fmt.Errorf("resolving %s digest from registry: %w", sb.Name, err)
+		}
+
+		if strings.TrimPrefix(current, "sha256:") != recorded {
+			return fmt.Errorf(
+				"registry digest of %s (%s) does not match the attestation subject digest (sha256:%s)",
+				sb.Name, current, recorded,
+			)
 		}
 	}
 	return nil
 }
 
+// RegistryOptions control how product references are resolved in registries
+type RegistryOptions struct {
+	AllowUnresolved bool           // Leave products that cannot be resolved as-is instead of failing
+	CraneOptions    []crane.Option // Additional options (auth, transport) passed to crane
+}
+
+// PinProductDigests returns a copy of the document where the OCI purls of
+// the statement products that point to a tag are rewritten to point to the
+// digest the tag currently resolves to in the registry.
+func (impl *defaultVexCtlImplementation) PinProductDigests(
+	ctx context.Context, doc *vex.VEX, regOpts RegistryOptions,
+) (*vex.VEX, error) {
+	newDoc := *doc
+	newDoc.Statements = make([]vex.Statement, len(doc.Statements))
+	craneOpts := append([]crane.Option{crane.WithContext(ctx)}, regOpts.CraneOptions...)
+
+	// Cache the resolved digests, products repeat across statements
+	digests := map[string]string{}
+
+	for i := range doc.Statements {
+		newDoc.Statements[i] = doc.Statements[i]
+		newDoc.Statements[i].Products = make([]vex.Product, len(doc.Statements[i].Products))
+		for j := range doc.Statements[i].Products {
+			product := doc.Statements[i].Products[j]
+			product.Identifiers = maps.Clone(product.Identifiers)
+			product.Hashes = maps.Clone(product.Hashes)
+
+			pin := func(id string) (string, error) {
+				if !strings.HasPrefix(id, "pkg:oci/") {
+					return id, nil
+				}
+				pinned, digest, err := pinOCIPurl(id, digests, craneOpts)
+				if err != nil {
+					if regOpts.AllowUnresolved {
+						impl.log().Warnf("Leaving %s unpinned: %v", id, err)
+						return id, nil
+					}
+					return "", fmt.Errorf("pinning %s: %w", id, err)
+				}
+				if digest != "" {
+					if product.Hashes == nil {
+						product.Hashes = map[vex.Algorithm]vex.Hash{}
+					}
+					product.Hashes[vex.SHA256] = vex.Hash(strings.TrimPrefix(digest, "sha256:"))
+				}
+				return pinned, nil
+			}
+
+			var err error
+			if product.ID, err = pin(product.ID); err != nil {
+				return nil, err
+			}
+			if p, ok := product.Identifiers[vex.PURL]; ok {
+				if product.Identifiers[vex.PURL], err = pin(p); err != nil {
+					return nil, err
+				}
+			}
+			newDoc.Statements[i].Products[j] = product
+		}
+	}
+	return &newDoc, nil
+}
+
+// pinOCIPurl rewrites an OCI purl to point to the digest of its tag. Purls
+// that already have a digest version are returned unchanged.
+func pinOCIPurl(purlString string, cache map[string]string, craneOpts []crane.Option) (pinned, digest string, err error) {
+	p, err := purl.FromString(purlString)
+	if err != nil {
+		return "", "", fmt.Errorf("parsing purl: %w", err)
+	}
+	if p.Version != "" {
+		return purlString, "", nil
+	}
+
+	ref := ociPurlRepository(p)
+	if tag, ok := p.Qualifiers.Map()["tag"]; ok {
+		ref += ":" + tag
+	}
+
+	digest, ok := cache[ref]
+	if !ok {
+		digest, err = crane.Digest(ref, craneOpts...)
+		if err != nil {
+			return "", "", fmt.Errorf("resolving %s digest: %w", ref, err)
+		}
+		cache[ref] = digest
+	}
+
+	p.Version = digest
+	return p.ToString(), digest, nil
+}
+
 // ReadTemplateData reads a set of golden documents with data used to generate
 // VEX information for a given artifact.
 func (impl *defaultVexCtlImplementation) ReadTemplateData(opts *GenerateOpts, products []*vex.Product) (*vex.VEX, error) {
@@ -6,12 +6,44 @@ SPDX-License-Identifier: Apache-2.0
 package ctl
 
 import (
+	"bytes"
 	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+	"unsafe"
 
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
 	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	purl "github.com/package-url/packageurl-go"
+	"github.com/sigstore/cosign/v2/pkg/cosign"
+	"github.com/sigstore/rekor/pkg/generated/models"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/sigstore/sigstore/pkg/signature"
+	"github.com/sigstore/sigstore/pkg/signature/dsse"
+	logtest "github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/require"
 
 	"github.com/openvex/go-vex/pkg/vex"
@@ -31,7 +63,7 @@ func TestNormalizeProducts(t *testing.T) {
 		{
 			name:                 "docker hub reference",
 			products:             []productRef{{Name: "nginx"}},
-			expectedImage:        []productRef{{Name: "nginx", Hashes: make(map[vex.Algorithm]vex.Hash)}},
+			expectedImage:        []productRef{{Name: "docker.io/library/nginx:latest", Hashes: make(map[vex.Algorithm]vex.Hash)}},
 			expectedOther:        []productRef{},
 			expectedUnattestable: []productRef{},
 			shouldFail:           false,
@@ -39,7 +71,7 @@ func TestNormalizeProducts(t *testing.T) {
 		{
 			name:                 "custom registry",
 			products:             []productRef{{Name: "registry.k8s.io/kube-apiserver"}},
-			expectedImage:        []productRef{{Name: "registry.k8s.io/kube-apiserver", Hashes: make(map[vex.Algorithm]vex.Hash)}},
+			expectedImage:        []productRef{{Name: "registry.k8s.io/kube-apiserver:latest", Hashes: make(map[vex.Algorithm]vex.Hash)}},
 			expectedOther:        []productRef{},
 			expectedUnattestable: []productRef{},
 			shouldFail:           false,
@@ -63,7 +95,7 @@ func TestNormalizeProducts(t *testing.T) {
 		{
 			name:                 "purl, dockerhub",
 			products:             []productRef{{Name: "pkg:oci/nginx"}},
-			expectedImage:        []productRef{{Name: "nginx", Hashes: make(map[vex.Algorithm]vex.Hash)}},
+			expectedImage:        []productRef{{Name: "docker.io/library/nginx:latest", Hashes: make(map[vex.Algorithm]vex.Hash)}},
 			expectedOther:        []productRef{},
 			expectedUnattestable: []productRef{},
 			shouldFail:           false,
@@ -72,7 +104,7 @@ func TestNormalizeProducts(t *testing.T) {
 			name:     "purl, with digest",
 			products: []productRef{{Name: "pkg:oci/alpine@sha256%3Af271e74b17ced29b915d351685fd4644785c6d1559dd1f2d4189a5e851ef753a"}},
 			expectedImage: []productRef{{
-				Name: "alpine@sha256:f271e74b17ced29b915d351685fd4644785c6d1559dd1f2d4189a5e851ef753a",
+				Name: "docker.io/library/alpine@sha256:f271e74b17ced29b915d351685fd4644785c6d1559dd1f2d4189a5e851ef753a",
 				Hashes: map[vex.Algorithm]vex.Hash{
 					vex.SHA256: vex.Hash("f271e74b17ced29b915d351685fd4644785c6d1559dd1f2d4189a5e851ef753a"),
 				},
@@ -81,6 +113,55 @@ func TestNormalizeProducts(t *testing.T) {
 			expectedUnattestable: []productRef{},
 			shouldFail:           false,
 		},
+		{
+			name:     "purl, with sha512 digest",
+			products: []productRef{{Name: "pkg:oci/alpine@sha512%3Ab7a5ca5bba7b4fd9b4bb1d8f1e5e2e0ab7a5ca5bba7b4fd9b4bb1d8f1e5e2e0ab7a5ca5bba7b4fd9b4bb1d8f1e5e2e0ab7a5ca5bba7b4fd9b4bb1d8f1e5e2e0a"}},
+			expectedImage: []productRef{{
+				Name: "alpine@sha512:b7a5ca5bba7b4fd9b4bb1d8f1e5e2e0ab7a5ca5bba7b4fd9b4bb1d8f1e5e2e0ab7a5ca5bba7b4fd9b4bb1d8f1e5e2e0ab7a5ca5bba7b4fd9b4bb1d8f1e5e2e0a",
+				Hashes: map[vex.Algorithm]vex.Hash{
+					vex.SHA512: vex.Hash("b7a5ca5bba7b4fd9b4bb1d8f1e5e2e0ab7a5ca5bba7b4fd9b4bb1d8f1e5e2e0ab7a5ca5bba7b4fd9b4bb1d8f1e5e2e0ab7a5ca5bba7b4fd9b4bb1d8f1e5e2e0a"),
+				},
+			}},
+			expectedOther:        []productRef{},
+			expectedUnattestable: []productRef{},
+			shouldFail:           false,
+		},
+		{
+			name:     "purl, with sha3-512 digest",
+			products: []productRef{{Name: "pkg:oci/alpine@sha3-512%3Ab7a5ca5bba7b4fd9b4bb1d8f1e5e2e0ab7a5ca5bba7b4fd9b4bb1d8f1e5e2e0ab7a5ca5bba7b4fd9b4bb1d8f1e5e2e0ab7a5ca5bba7b4fd9b4bb1d8f1e5e2e0a"}},
+			expectedImage: []productRef{{
+				Name: "alpine@sha3-512:b7a5ca5bba7b4fd9b4bb1d8f1e5e2e0ab7a5ca5bba7b4fd9b4bb1d8f1e5e2e0ab7a5ca5bba7b4fd9b4bb1d8f1e5e2e0ab7a5ca5bba7b4fd9b4bb1d8f1e5e2e0a",
+				Hashes: map[vex.Algorithm]vex.Hash{
+					vex.SHA3512: vex.Hash("b7a5ca5bba7b4fd9b4bb1d8f1e5e2e0ab7a5ca5bba7b4fd9b4bb1d8f1e5e2e0ab7a5ca5bba7b4fd9b4bb1d8f1e5e2e0ab7a5ca5bba7b4fd9b4bb1d8f1e5e2e0a"),
+				},
+			}},
+			expectedOther:        []productRef{},
+			expectedUnattestable: []productRef{},
+			shouldFail:           false,
+		},
+		{
+			name: "docker hub short, library and fully qualified names",
+			products: []productRef{
+				{Name: "nginx"},
+				{Name: "library/nginx"},
+				{Name: "docker.io/library/nginx", Hashes: map[vex.Algorithm]vex.Hash{vex.SHA256: "74634d9736a45ca9f6e1187e783492199e020f4a5c19d0b1abc2b604f894ac99"}},
+				{Name: "index.docker.io/library/nginx:latest"},
+				{Name: "pkg:oci/nginx?repository_url=docker.io/library"},
+			},
+			expectedImage: []productRef{{
+				Name:   "docker.io/library/nginx:latest",
+				Hashes: map[vex.Algorithm]vex.Hash{vex.SHA256: "74634d9736a45ca9f6e1187e783492199e020f4a5c19d0b1abc2b604f894ac99"},
+			}},
+			expectedOther:        []productRef{},
+			expectedUnattestable: []productRef{},
+		},
+		{
+			name:                 "tags and digests are kept apart",
+			products:             []productRef{{Name: "nginx:1.25"}, {Name: "nginx"}},
+			expectedImage:        []productRef{{Name: "docker.io/library/nginx:1.25", Hashes: make(map[vex.Algorithm]vex.Hash)}, {Name: "docker.io/library/nginx:latest", Hashes: make(map[vex.Algorithm]vex.Hash)}},
+			expectedOther:        []productRef{},
+			expectedUnattestable: []productRef{},
+		},
 		{
 			name:                 "other purl",
 			products:             []productRef{{Name: "pkg:apk/wolfi/bash@1.0.0"}},
@@ -111,10 +192,20 @@ func TestNormalizeProducts(t *testing.T) {
 			expectedUnattestable: []productRef{},
 			shouldFail:           false,
 		},
+		{
+			name: "non-image identifiers",
+			products: []productRef{
+				{Name: "https://example.com/bash.tar.gz"},
+				{Name: "https://example.com/git.tar.gz", Hashes: map[vex.Algorithm]vex.Hash{vex.SHA256: "805f9e876d84aa72b0c10a810d4e16bf84b16c5399ddab86fb973e561e86de37"}},
+			},
+			expectedImage:        []productRef{},
+			expectedOther:        []productRef{{Name: "https://example.com/git.tar.gz", Hashes: map[vex.Algorithm]vex.Hash{vex.SHA256: "805f9e876d84aa72b0c10a810d4e16bf84b16c5399ddab86fb973e561e86de37"}}},
+			expectedUnattestable: []productRef{{Name: "https://example.com/bash.tar.gz", Hashes: make(map[vex.Algorithm]vex.Hash)}},
+		},
 		{
 			name:                 "mixed image ref and non-oci purl",
 			products:             []productRef{{Name: "pkg:apk/wolfi/bash@1.0.0"}, {Name: "nginx"}},
-			expectedImage:        []productRef{{Name: "nginx", Hashes: make(map[vex.Algorithm]vex.Hash)}},
+			expectedImage:        []productRef{{Name: "docker.io/library/nginx:latest", Hashes: make(map[vex.Algorithm]vex.Hash)}},
 			expectedOther:        []productRef{},
 			expectedUnattestable: []productRef{{Name: "pkg:apk/wolfi/bash@1.0.0", Hashes: make(map[vex.Algorithm]vex.Hash)}},
 			shouldFail:           false,
@@ -133,6 +224,35 @@ func TestNormalizeProducts(t *testing.T) {
 	}
 }
 
+func TestNormalizeProductsDigestAlgorithms(t *testing.T) {
+	impl := defaultVexCtlImplementation{}
+	hash := "74634d9736a45ca9f6e1187e783492199e020f4a5c19d0b1abc2b604f894ac99"
+	for prefix, algo := range map[string]vex.Algorithm{
+		"md5":         vex.MD5,
+		"sha1":        vex.SHA1,
+		"sha256":      vex.SHA256,
+		"sha384":      vex.SHA384,
+		"sha512":      vex.SHA512,
+		"sha3-224":    vex.SHA3224,
+		"sha3-256":    vex.SHA3256,
+		"sha3-384":    vex.SHA3384,
+		"sha3-512":    vex.SHA3512,
+		"blake2s-256": vex.BLAKE2S256,
+		"blake2b-256": vex.BLAKE2B256,
+		"blake2b-512": vex.BLAKE2B512,
+		"blake3":      vex.BLAKE3,
+		"blake2b":     vex.Algorithm("blake2b"), // Unknown, kept as-is
+	} {
+		image, _, _, err := impl.NormalizeProducts([]productRef{
+			{Name: fmt.Sprintf("pkg:oci/alpine@%s%%3A%s", prefix, hash)},
+		})
+		require.NoError(t, err, prefix)
+		require.Len(t, image, 1, prefix)
+		require.Equal(t, canonicalImageRef(fmt.Sprintf("alpine@%s:%s", prefix, hash)), image[0].Name, prefix)
+		require.Equal(t, map[vex.Algorithm]vex.Hash{algo: vex.Hash(hash)}, image[0].Hashes, prefix)
+	}
+}
+
 func TestListDocumentProducts(t *testing.T) {
 	impl := defaultVexCtlImplementation{}
 	for _, tc := range []struct {
@@ -144,12 +264,17 @@ func TestListDocumentProducts(t *testing.T) {
 			"image identifiers",
 			"testdata/images.vex.json",
 			[]productRef{
-				{Name: "nginx", Hashes: make(map[vex.Algorithm]vex.Hash)},
+				{Name: "docker.io/library/nginx:latest", Hashes: make(map[vex.Algorithm]vex.Hash)},
 				{Name: "pkg:oci/alpine@sha256%3Af271e74b17ced29b915d351685fd4644785c6d1559dd1f2d4189a5e851ef753a", Hashes: make(map[vex.Algorithm]vex.Hash)},
 				{Name: "pkg:oci/kube-apiserver?repository_url=registry.k8s.io&tag=v1.26.0", Hashes: make(map[vex.Algorithm]vex.Hash)},
 				{Name: "registry.k8s.io/kube-apiserver:v1.26.0", Hashes: make(map[vex.Algorithm]vex.Hash)},
 			},
 		},
+		{
+			"docker hub names",
+			"testdata/dockerhub.vex.json",
+			[]productRef{{Name: "docker.io/library/nginx:latest", Hashes: make(map[vex.Algorithm]vex.Hash)}},
+		},
 		{
 			"openvex-v0.0.1",
 			"testdata/v001-1.vex.json",
@@ -171,6 +296,28 @@ func TestListDocumentProducts(t *testing.T) {
 	}
 }
 
+func TestListDocumentVulnerabilities(t *testing.T) {
+	impl := defaultVexCtlImplementation{}
+	doc := &vex.VEX{Statements: []vex.Statement{
+		{Vulnerability: vex.Vulnerability{Name: "CVE-2023-5678", Aliases: []vex.VulnerabilityID{"GHSA-xxxx-yyyy-zzzz"}}},
+		{Vulnerability: vex.Vulnerability{Name: "CVE-2023-1234"}},
+		{Vulnerability: vex.Vulnerability{Name: "CVE-2023-5678", Aliases: []vex.VulnerabilityID{"GO-2023-0001"}}},
+		{Vulnerability: vex.Vulnerability{Name: "GHSA-xxxx-yyyy-zzzz"}},
+	}}
+	ids, err := impl.ListDocumentVulnerabilities(doc)
+	require.NoError(t, err)
+	require.Equal(t, []vex.VulnerabilityID{
+		"CVE-2023-1234", "CVE-2023-5678", "GHSA-xxxx-yyyy-zzzz", "GO-2023-0001",
+	}, ids)
+
+	ids, err = impl.ListDocumentVulnerabilities(&vex.VEX{})
+	require.NoError(t, err)
+	require.Empty(t, ids)
+
+	_, err = impl.ListDocumentVulnerabilities(nil)
+	require.Error(t, err)
+}
+
 func TestVerifyImageSubjects(t *testing.T) {
 	impl := defaultVexCtlImplementation{}
 	att := attestation.New()
@@ -197,12 +344,62 @@ func TestVerifyImageSubjects(t *testing.T) {
 		},
 		{
 			// purls need to be translated
+			[]intoto.Subject{
+				{
+					Name:   "ghcr.io/test/image@sha256:74634d9736a45ca9f6e1187e783492199e020f4a5c19d0b1abc2b604f894ac99",
+					Digest: map[string]string{"sha256": "74634d9736a45ca9f6e1187e783492199e020f4a5c19d0b1abc2b604f894ac99"},
+				},
+			},
+			[]string{"pkg:oci/image@sha256:74634d9736a45ca9f6e1187e783492199e020f4a5c19d0b1abc2b604f894ac99?repository_url=ghcr.io/test"},
+			false,
+		},
+		{
+			// The subject digest must match the product digest
+			[]intoto.Subject{
+				{
+					Name:   "ghcr.io/test/image@sha256:74634d9736a45ca9f6e1187e783492199e020f4a5c19d0b1abc2b604f894ac99",
+					Digest: map[string]string{"sha256": "0000000000000000000000000000000000000000000000000000000000000000"},
+				},
+			},
+			[]string{"pkg:oci/image@sha256:74634d9736a45ca9f6e1187e783492199e020f4a5c19d0b1abc2b604f894ac99?repository_url=ghcr.io/test"},
+			true,
+		},
+		{
+			// A subject without the product digest fails
 			[]intoto.Subject{
 				{Name: "ghcr.io/test/image@sha256:74634d9736a45ca9f6e1187e783492199e020f4a5c19d0b1abc2b604f894ac99"},
 			},
 			[]string{"pkg:oci/image@sha256:74634d9736a45ca9f6e1187e783492199e020f4a5c19d0b1abc2b604f894ac99?repository_url=ghcr.io/test"},
+			true,
+		},
+		{
+			// The matching subject is not the last one
+			[]intoto.Subject{
+				{Name: "ghcr.io/test/image:canary"},
+				{Name: "ghcr.io/test/other:latest"},
+				{Name: "ghcr.io/test/another:latest"},
+			},
+			[]string{"ghcr.io/test/image:canary"},
+			false,
+		},
+		{
+			// Every product must be in the subjects
+			[]intoto.Subject{
+				{Name: "ghcr.io/test/other:latest"},
+				{Name: "ghcr.io/test/image:canary"},
+			},
+			[]string{"ghcr.io/test/image:canary", "ghcr.io/test/other:latest"},
 			false,
 		},
+		{
+			// A product missing from several subjects
+			[]intoto.Subject{
+				{Name: "ghcr.io/test/image:canary"},
+				{Name: "ghcr.io/test/other:latest"},
+			},
+			[]string{"ghcr.io/test/other:latest", "ghcr.io/test/missing:latest"},
+			true,
+		},
 	} {
 		att.Subject = tc.subjects
 		doc := vex.New()
@@ -413,3 +610,1897 @@ func TestInitTemplatesDir(t *testing.T) {
 		})
 	}
 }
+
+func TestRunWithTimeout(t *testing.T) {
+	ctx := context.Background()
+
+	// A function that finishes in time returns its own error
+	err := runWithTimeout(ctx, time.Second, func(context.Context) error {
+		return errors.New("boom")
+	})
+	require.EqualError(t, err, "boom")
+
+	// A hanging verification is aborted when the timeout expires, fn
+	// returns before runWithTimeout does
+	returned := false
+	start := time.Now()
+	err = runWithTimeout(ctx, 50*time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done()
+		returned = true
+		return ctx.Err()
+	})
+	require.Error(t, err)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.True(t, returned)
+	require.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestReadImageAttestationsVerifyTimeout(t *testing.T) {
+	// The registry never answers until the client gives up
+	var pending atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		pending.Add(1)
+		defer pending.Add(-1)
+		<-r.Context().Done()
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	pub, err := cryptoutils.MarshalPublicKeyToPEM(&priv.PublicKey)
+	require.NoError(t, err)
+	keyPath := filepath.Join(t.TempDir(), "cosign.pub")
+	require.NoError(t, os.WriteFile(keyPath, pub, os.FileMode(0o644)))
+
+	impl := defaultVexCtlImplementation{}
+	opts := Options{VerifyKey: keyPath, IgnoreTlog: true, VerifyTimeout: 100 * time.Millisecond}
+	start := time.Now()
+	_, err = impl.ReadImageAttestations(context.Background(), opts, u.Host+"/test/image:latest")
+	require.Error(t, err)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), 5*time.Second)
+
+	// The requests were canceled, not left running
+	require.Eventually(t, func() bool { return pending.Load() == 0 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestMergeProductMatchMode(t *testing.T) {
+	doc := newTestDocument(
+		vex.Statement{
+			Vulnerability: vex.Vulnerability{Name: "CVE-2023-1234"},
+			Products:      []vex.Product{{Component: vex.Component{ID: "pkg:golang/github.com/foo/bar@v1.0.0"}}},
+			Status:        vex.StatusNotAffected,
+			Justification: vex.VulnerableCodeNotPresent,
+		},
+		vex.Statement{
+			Vulnerability: vex.Vulnerability{Name: "CVE-2023-1234"},
+			Products:      []vex.Product{{Component: vex.Component{ID: "pkg:golang/github.com/foo/baz@v1.0.0"}}},
+			Status:        vex.StatusAffected,
+		},
+	)
+
+	impl := defaultVexCtlImplementation{}
+	for _, tc := range []struct {
+		name        string
+		mode        ProductMatchMode
+		product     string
+		expectedLen int
+		shouldErr   bool
+	}{
+		{"exact with version", ProductMatchExact, "pkg:golang/github.com/foo/bar@v1.0.0", 1, false},
+		{"exact without version", ProductMatchExact, "pkg:golang/github.com/foo/bar", 0, false},
+		{"prefix without version", ProductMatchPurlPrefix, "pkg:golang/github.com/foo/bar", 1, false},
+		{"prefix with other version", ProductMatchPurlPrefix, "pkg:golang/github.com/foo/bar@v2.0.0", 1, false},
+		{"unknown mode", ProductMatchMode("fuzzy"), "pkg:golang/github.com/foo/bar", 0, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			merged, err := impl.Merge(context.Background(), &MergeOptions{
+				Products: []string{tc.product}, ProductMatchMode: tc.mode,
+			}, []*vex.VEX{doc})
+			if tc.shouldErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, merged.Statements, tc.expectedLen)
+			for _, s := range merged.Statements {
+				require.Equal(t, "pkg:golang/github.com/foo/bar@v1.0.0", s.Products[0].ID)
+			}
+		})
+	}
+}
+
+func TestMergeInternProducts(t *testing.T) {
+	ctx := context.Background()
+	impl := defaultVexCtlImplementation{}
+	docs := []*vex.VEX{}
+	for i := 0; i < 2; i++ {
+		doc, err := vex.Parse(repeatedProductsDocument(10, 3))
+		require.NoError(t, err)
+		docs = append(docs, doc)
+	}
+
+	plain, err := impl.Merge(ctx, &MergeOptions{}, docs)
+	require.NoError(t, err)
+	interned, err := impl.Merge(ctx, &MergeOptions{InternProducts: true}, docs)
+	require.NoError(t, err)
+
+	// Interning must not change the merged data...
+	require.Equal(t, plain.Statements, interned.Statements)
+
+	// ... but equal strings share their backing storage. The pointers are
+	// compared as unsafe.Pointer, require compares *uint8 by their values.
+	storage := func(s string) unsafe.Pointer { return unsafe.Pointer(unsafe.StringData(s)) }
+	first := interned.Statements[0].Products[0].ID
+	last := interned.Statements[len(interned.Statements)-1].Products[0].ID
+	require.Equal(t, first, last)
+	require.Equal(t, storage(first), storage(last))
+
+	// The interned strings are not the ones of the source documents
+	require.NotEqual(t, storage(docs[0].Statements[0].Products[0].ID), storage(first))
+	require.NotEqual(t, storage(plain.Statements[0].Products[0].ID), storage(first))
+}
+
+// repeatedProductsDocument returns the JSON of a document with numStatements
+// statements, all of them listing the same numProducts products.
+func repeatedProductsDocument(numStatements, numProducts int) []byte {
+	statements := []string{}
+	for i := 0; i < numStatements; i++ {
+		products := []string{}
+		for j := 0; j < numProducts; j++ {
+			products = append(products, fmt.Sprintf(
+				`{"@id": "pkg:oci/image-%d@sha256%%3A74634d9736a45ca9f6e1187e783492199e020f4a5c19d0b1abc2b604f894ac99?repository_url=ghcr.io/test"}`, j,
+			))
+		}
+		statements = append(statements, fmt.Sprintf(
+			`{"vulnerability": {"name": "CVE-2023-%d"}, "products": [%s], "status": "under_investigation"}`,
+			i, strings.Join(products, ","),
+		))
+	}
+	return []byte(fmt.Sprintf(
+		`{"@context": "https://openvex.dev/ns/v0.2.0", "@id": "https://openvex.dev/docs/test", `+
+			`"author": "test", "timestamp": "2023-01-01T00:00:00Z", "version": 1, "statements": [%s]}`,
+		strings.Join(statements, ","),
+	))
+}
+
+func BenchmarkMergeInternProducts(b *testing.B) {
+	data := repeatedProductsDocument(500, 20)
+	for _, intern := range []bool{false, true} {
+		b.Run(fmt.Sprintf("intern=%v", intern), func(b *testing.B) {
+			impl := defaultVexCtlImplementation{}
+			var retained int64
+			for i := 0; i < b.N; i++ {
+				var base, m runtime.MemStats
+				runtime.GC()
+				runtime.ReadMemStats(&base)
+
+				docs := []*vex.VEX{}
+				for j := 0; j < 5; j++ {
+					doc, err := vex.Parse(data)
+					require.NoError(b, err)
+					docs = append(docs, doc)
+				}
+				merged, err := impl.Merge(context.Background(), &MergeOptions{InternProducts: intern}, docs)
+				require.NoError(b, err)
+
+				// The sources are not referenced anymore, measure
+				// what remains allocated by the merged document.
+				runtime.GC()
+				runtime.ReadMemStats(&m)
+				retained += int64(m.HeapAlloc) - int64(base.HeapAlloc)
+				runtime.KeepAlive(merged)
+			}
+			b.ReportMetric(float64(retained)/float64(b.N), "retained-B/op")
+		})
+	}
+}
+
+func TestVerifySubjectDigests(t *testing.T) {
+	ctx := context.Background()
+	reg := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "pass" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	ref := fmt.Sprintf("%s/test/image:latest", u.Host)
+	auth := crane.WithAuth(&authn.Basic{Username: "user", Password: "pass"})
+	require.NoError(t, crane.Push(img, ref, auth))
+	d, err := img.Digest()
+	require.NoError(t, err)
+
+	// The credentials come from the options, as when attesting
+	regOpts := RegistryOptions{
+		CraneOptions: craneOptions(ctx, Options{RegistryUsername: "user", RegistryPassword: "pass"}),
+	}
+
+	impl := defaultVexCtlImplementation{}
+	for _, tc := range []struct {
+		name    string
+		subject intoto.Subject
+		regOpts RegistryOptions
+		mustErr bool
+	}{
+		{"digest matches", intoto.Subject{Name: ref, Digest: map[string]string{"sha256": d.Hex}}, regOpts, false},
+		{"tag repointed", intoto.Subject{Name: ref, Digest: map[string]string{"sha256": strings.Repeat("a", 64)}}, regOpts, true},
+		{"no digest to check", intoto.Subject{Name: ref, Digest: map[string]string{}}, regOpts, false},
+		{"not an image", intoto.Subject{Name: "pkg:apk/wolfi/bash@1.0.0", Digest: map[string]string{"sha256": d.Hex}}, regOpts, false},
+		{"no credentials", intoto.Subject{Name: ref, Digest: map[string]string{"sha256": d.Hex}}, RegistryOptions{}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			att := attestation.New()
+			att.Subject = []intoto.Subject{tc.subject}
+			err := impl.VerifySubjectDigests(ctx, att, tc.regOpts)
+			if tc.mustErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestPinProductDigests(t *testing.T) {
+	ctx := context.Background()
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	require.NoError(t, crane.Push(img, fmt.Sprintf("%s/test/image:latest", u.Host)))
+	d, err := img.Digest()
+	require.NoError(t, err)
+
+	repoURL := url.QueryEscape(u.Host + "/test")
+	taggedPurl := fmt.Sprintf("pkg:oci/image?repository_url=%s&tag=latest", repoURL)
+	missingPurl := fmt.Sprintf("pkg:oci/image?repository_url=%s&tag=missing", repoURL)
+	pinnedPurl := fmt.Sprintf("pkg:oci/image@%s?repository_url=%s", "sha256%3A"+strings.Repeat("b", 64), repoURL)
+
+	newDoc := func(products ...vex.Product) *vex.VEX {
+		doc := vex.New()
+		doc.Statements = []vex.Statement{{
+			Vulnerability: vex.Vulnerability{Name: "CVE-2023-1234"},
+			Products:      products,
+			Status:        vex.StatusNotAffected,
+		}}
+		return &doc
+	}
+
+	impl := defaultVexCtlImplementation{}
+	for _, tc := range []struct {
+		name     string
+		product  vex.Product
+		regOpts  RegistryOptions
+		expected string
+		hashed   bool
+		mustErr  bool
+	}{
+		{"tag in id", vex.Product{Component: vex.Component{ID: taggedPurl}}, RegistryOptions{}, d.String(), true, false},
+		{
+			"tag in identifiers",
+			vex.Product{Component: vex.Component{ID: "my-image", Identifiers: map[vex.IdentifierType]string{vex.PURL: taggedPurl}}},
+			RegistryOptions{}, d.String(), true, false,
+		},
+		{"already pinned", vex.Product{Component: vex.Component{ID: pinnedPurl}}, RegistryOptions{}, "sha256:" + strings.Repeat("b", 64), false, false},
+		{"not an image", vex.Product{Component: vex.Component{ID: "pkg:apk/wolfi/bash@1.0.0"}}, RegistryOptions{}, "1.0.0", false, false},
+		{"unresolvable", vex.Product{Component: vex.Component{ID: missingPurl}}, RegistryOptions{}, "", false, true},
+		{"unresolvable, allowed", vex.Product{Component: vex.Component{ID: missingPurl}}, RegistryOptions{AllowUnresolved: true}, "", false, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			doc := newDoc(tc.product)
+			pinned, err := impl.PinProductDigests(ctx, doc, tc.regOpts)
+			if tc.mustErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			// The original document must not be modified
+			require.Equal(t, tc.product, doc.Statements[0].Products[0])
+
+			product := pinned.Statements[0].Products[0]
+			id := product.ID
+			if p, ok := product.Identifiers[vex.PURL]; ok {
+				id = p
+			}
+			p, err := purl.FromString(id)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, p.Version)
+			if tc.hashed {
+				require.Equal(t, vex.Hash(d.Hex), product.Hashes[vex.SHA256])
+			} else {
+				// Products that are not pinned are left as they were
+				require.Empty(t, product.Hashes)
+				require.Equal(t, tc.product, product)
+			}
+		})
+	}
+}
+
+func TestMergeChangelog(t *testing.T) {
+	t1 := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(24 * time.Hour)
+	t3 := t2.Add(24 * time.Hour)
+	newStatement := func(id, product string, status vex.Status, ts *time.Time) vex.Statement {
+		return vex.Statement{
+			ID:            id,
+			Vulnerability: vex.Vulnerability{Name: "CVE-2023-1234"},
+			Products:      []vex.Product{{Component: vex.Component{ID: product}}},
+			Status:        status,
+			Timestamp:     ts,
+		}
+	}
+	docs := []*vex.VEX{
+		{Metadata: vex.Metadata{ID: "doc1", Timestamp: &t1}, Statements: []vex.Statement{
+			newStatement("stmt-1", "pkg:oci/image1", vex.StatusUnderInvestigation, &t1),
+		}},
+		{Metadata: vex.Metadata{ID: "doc2", Timestamp: &t2}, Statements: []vex.Statement{
+			newStatement("stmt-2", "pkg:oci/image1", vex.StatusAffected, &t2),
+			newStatement("stmt-3", "pkg:oci/image2", vex.StatusUnderInvestigation, &t2),
+		}},
+		{Metadata: vex.Metadata{ID: "doc3", Timestamp: &t3}, Statements: []vex.Statement{
+			newStatement("stmt-4", "pkg:oci/image1", vex.StatusFixed, &t3),
+		}},
+	}
+
+	impl := defaultVexCtlImplementation{}
+	for _, tc := range []struct {
+		strategy   MergeStrategy
+		statements int
+	}{
+		{MergeAccumulate, 4},
+		// Superseded statements are dropped but still in the changelog
+		{MergeSupersede, 2},
+	} {
+		t.Run(string(tc.strategy), func(t *testing.T) {
+			var b bytes.Buffer
+			doc, err := impl.Merge(context.Background(), &MergeOptions{ChangelogWriter: &b, Strategy: tc.strategy}, docs)
+			require.NoError(t, err)
+			require.Len(t, doc.Statements, tc.statements)
+
+			changelog := []ChangelogEntry{}
+			require.NoError(t, json.Unmarshal(b.Bytes(), &changelog))
+			require.Len(t, changelog, 2)
+			for i, ids := range [][]string{{"stmt-1", "stmt-2"}, {"stmt-2", "stmt-4"}} {
+				require.Equal(t, "CVE-2023-1234", changelog[i].Vulnerability)
+				require.Equal(t, "pkg:oci/image1", changelog[i].Product)
+				require.Equal(t, ids[0], changelog[i].Superseded.ID)
+				require.Equal(t, ids[1], changelog[i].SupersededBy.ID)
+			}
+			require.Equal(t, vex.StatusFixed, changelog[1].SupersededBy.Status)
+			require.True(t, changelog[1].SupersededBy.Timestamp.Equal(t3))
+		})
+	}
+}
+
+func TestCascadeTimestamps(t *testing.T) {
+	t1 := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(24 * time.Hour)
+	newDoc := func(docTime *time.Time) *vex.VEX {
+		return &vex.VEX{
+			Metadata: vex.Metadata{Timestamp: docTime},
+			Statements: []vex.Statement{
+				{Vulnerability: vex.Vulnerability{Name: "CVE-2023-1234"}, Timestamp: &t2},
+				{Vulnerability: vex.Vulnerability{Name: "CVE-2023-5678"}},
+			},
+		}
+	}
+
+	t.Run("document timestamp", func(t *testing.T) {
+		doc := newDoc(&t1)
+		require.NoError(t, CascadeTimestamps(doc))
+		require.Equal(t, t2, *doc.Statements[0].Timestamp)
+		require.Equal(t, t1, *doc.Statements[1].Timestamp)
+		require.Equal(t, t2, *doc.LastUpdated)
+	})
+
+	t.Run("no document timestamp", func(t *testing.T) {
+		doc := newDoc(nil)
+		require.Error(t, CascadeTimestamps(doc))
+		require.Nil(t, doc.Statements[1].Timestamp)
+		require.Nil(t, doc.LastUpdated)
+
+		doc.Statements = doc.Statements[:1]
+		require.NoError(t, CascadeTimestamps(doc))
+		require.Equal(t, t2, *doc.LastUpdated)
+	})
+
+	require.Error(t, CascadeTimestamps(nil))
+}
+
+func TestMergeDeduplicate(t *testing.T) {
+	t1 := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(24 * time.Hour)
+	newStatement := func(id string, products []string, status vex.Status, ts *time.Time) vex.Statement {
+		s := vex.Statement{
+			ID:            id,
+			Vulnerability: vex.Vulnerability{Name: "CVE-2023-1234"},
+			Status:        status,
+			Timestamp:     ts,
+		}
+		if status == vex.StatusNotAffected {
+			s.Justification = vex.ComponentNotPresent
+		}
+		for _, p := range products {
+			s.Products = append(s.Products, vex.Product{Component: vex.Component{ID: p}})
+		}
+		return s
+	}
+	doc1 := &vex.VEX{Metadata: vex.Metadata{ID: "doc1", Timestamp: &t1}, Statements: []vex.Statement{
+		newStatement("a", []string{"pkg:oci/image1", "pkg:oci/image2"}, vex.StatusNotAffected, &t1),
+		newStatement("b", []string{"pkg:oci/image3"}, vex.StatusUnderInvestigation, &t1),
+	}}
+	doc2 := &vex.VEX{Metadata: vex.Metadata{ID: "doc2", Timestamp: &t2}, Statements: []vex.Statement{
+		// Same as "a" with products in another order and a later timestamp
+		newStatement("c", []string{"pkg:oci/image2", "pkg:oci/image1"}, vex.StatusNotAffected, &t2),
+		newStatement("d", []string{"pkg:oci/image3"}, vex.StatusAffected, &t2),
+	}}
+
+	impl := defaultVexCtlImplementation{}
+	for _, tc := range []struct {
+		name        string
+		docs        []*vex.VEX
+		dedup       bool
+		expectedIDs []string
+	}{
+		{"document with itself", []*vex.VEX{doc1, doc1}, true, []string{"a", "b"}},
+		{"document with itself, no dedup", []*vex.VEX{doc1, doc1}, false, []string{"a", "a", "b", "b"}},
+		{"overlapping documents keep the latest", []*vex.VEX{doc1, doc2}, true, []string{"b", "c", "d"}},
+		{"overlapping documents, reversed", []*vex.VEX{doc2, doc1}, true, []string{"b", "c", "d"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := impl.Merge(context.Background(), &MergeOptions{KeepDuplicates: !tc.dedup}, tc.docs)
+			require.NoError(t, err)
+			ids := []string{}
+			for _, s := range doc.Statements {
+				ids = append(ids, s.ID)
+			}
+			sort.Strings(ids)
+			require.Equal(t, tc.expectedIDs, ids)
+		})
+	}
+}
+
+func TestMergeRequireJustification(t *testing.T) {
+	ts := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	newDoc := func(s vex.Statement) *vex.VEX {
+		s.Vulnerability = vex.Vulnerability{Name: "CVE-2023-1234"}
+		s.Products = []vex.Product{{Component: vex.Component{ID: "pkg:oci/image1"}}}
+		s.Status = vex.StatusNotAffected
+		return &vex.VEX{Metadata: vex.Metadata{ID: "doc", Timestamp: &ts}, Statements: []vex.Statement{s}}
+	}
+
+	impl := defaultVexCtlImplementation{}
+	for _, tc := range []struct {
+		name    string
+		doc     *vex.VEX
+		require bool
+		mustErr bool
+	}{
+		{"justification", newDoc(vex.Statement{Justification: vex.ComponentNotPresent}), true, false},
+		{"impact statement", newDoc(vex.Statement{ImpactStatement: "not loaded"}), true, false},
+		{"unjustified", newDoc(vex.Statement{}), true, true},
+		{"unjustified, not required", newDoc(vex.Statement{}), false, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := impl.Merge(
+				context.Background(), &MergeOptions{RequireJustification: tc.require}, []*vex.VEX{tc.doc},
+			)
+			if tc.mustErr {
+				require.ErrorContains(t, err, `CVE-2023-1234 in document "doc"`)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, doc.Statements, 1)
+		})
+	}
+}
+
+func TestMergeConflicts(t *testing.T) {
+	ts := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	later := ts.Add(time.Hour)
+	newStatement := func(id string, products []string, status vex.Status) vex.Statement {
+		s := vex.Statement{
+			ID:            id,
+			Vulnerability: vex.Vulnerability{Name: "CVE-2023-1234"},
+			Status:        status,
+			Timestamp:     &ts,
+		}
+		for _, p := range products {
+			s.Products = append(s.Products, vex.Product{Component: vex.Component{ID: p}})
+		}
+		return s
+	}
+	docs := []*vex.VEX{
+		{Metadata: vex.Metadata{ID: "newer", Timestamp: &later}, Statements: []vex.Statement{
+			newStatement("newer-1", []string{"pkg:oci/image1"}, vex.StatusNotAffected),
+		}},
+		{Metadata: vex.Metadata{ID: "older", Timestamp: &ts}, Statements: []vex.Statement{
+			newStatement("older-1", []string{"pkg:oci/image1", "pkg:oci/image2"}, vex.StatusAffected),
+		}},
+	}
+
+	impl := defaultVexCtlImplementation{}
+	for _, tc := range []struct {
+		name     string
+		policy   ConflictPolicy
+		expected map[string][]string
+		mustErr  bool
+	}{
+		{
+			"default keeps both", "",
+			map[string][]string{"newer-1": {"pkg:oci/image1"}, "older-1": {"pkg:oci/image1", "pkg:oci/image2"}}, false,
+		},
+		{
+			"keep both", ConflictKeepBoth,
+			map[string][]string{"newer-1": {"pkg:oci/image1"}, "older-1": {"pkg:oci/image1", "pkg:oci/image2"}}, false,
+		},
+		{
+			"keep latest", ConflictKeepLatest,
+			map[string][]string{"newer-1": {"pkg:oci/image1"}, "older-1": {"pkg:oci/image2"}}, false,
+		},
+		{"error", ConflictError, nil, true},
+		{"invalid", ConflictPolicy("random"), nil, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := impl.Merge(context.Background(), &MergeOptions{OnConflict: tc.policy}, docs)
+			if tc.mustErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			res := map[string][]string{}
+			for _, s := range doc.Statements {
+				for _, p := range s.Products {
+					res[s.ID] = append(res[s.ID], p.ID)
+				}
+			}
+			require.Equal(t, tc.expected, res)
+		})
+	}
+
+	// Same status at the same time is not a conflict
+	docs[0].Statements[0].Status = vex.StatusAffected
+	_, err := impl.Merge(context.Background(), &MergeOptions{OnConflict: ConflictError}, docs)
+	require.NoError(t, err)
+}
+
+func TestMergeTrustedAuthors(t *testing.T) {
+	ts := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	newDoc := func(author string, ids ...string) *vex.VEX {
+		doc := &vex.VEX{Metadata: vex.Metadata{ID: "doc-" + author, Author: author, Timestamp: &ts}}
+		for _, id := range ids {
+			doc.Statements = append(doc.Statements, vex.Statement{
+				ID:            id,
+				Vulnerability: vex.Vulnerability{Name: "CVE-2023-1234"},
+				Products:      []vex.Product{{Component: vex.Component{ID: "pkg:oci/image1"}}},
+				Status:        vex.StatusNotAffected,
+				Justification: vex.ComponentNotPresent,
+			})
+		}
+		return doc
+	}
+	docs := []*vex.VEX{
+		newDoc("Vendor Inc", "stmt-1", "stmt-2"),
+		newDoc("Random Person", "stmt-3"),
+		newDoc("Distro Security Team", "stmt-4"),
+		newDoc("", "stmt-5"),
+	}
+
+	for _, tc := range []struct {
+		name        string
+		trusted     []string
+		expectedIDs []string
+		dropped     int
+	}{
+		{"no allowlist", nil, []string{"stmt-1", "stmt-2", "stmt-3", "stmt-4", "stmt-5"}, 0},
+		{"one trusted author", []string{"Vendor Inc"}, []string{"stmt-1", "stmt-2"}, 3},
+		{"two trusted authors", []string{"Vendor Inc", " Distro Security Team "}, []string{"stmt-1", "stmt-2", "stmt-4"}, 2},
+		{"no trusted documents", []string{"Someone Else"}, []string{}, 5},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			logger, hook := logtest.NewNullLogger()
+			impl := defaultVexCtlImplementation{logger: logger}
+			doc, err := impl.Merge(context.Background(), &MergeOptions{TrustedAuthors: tc.trusted, KeepDuplicates: true}, docs)
+			require.NoError(t, err)
+
+			ids := []string{}
+			for _, s := range doc.Statements {
+				ids = append(ids, s.ID)
+			}
+			sort.Strings(ids)
+			require.Equal(t, tc.expectedIDs, ids)
+
+			if tc.dropped == 0 {
+				require.Empty(t, hook.AllEntries())
+				return
+			}
+			require.NotNil(t, hook.LastEntry())
+			require.Equal(t, fmt.Sprintf("Dropped %d statements from untrusted authors", tc.dropped), hook.LastEntry().Message)
+		})
+	}
+}
+
+func TestAttestationAnnotations(t *testing.T) {
+	sbomDigest := "sha256:74634d9736a45ca9f6e1187e783492199e020f4a5c19d0b1abc2b604f894ac99"
+	for _, tc := range []struct {
+		name     string
+		opts     Options
+		expected map[string]string
+		mustErr  bool
+	}{
+		{
+			name:     "no sbom link",
+			opts:     Options{},
+			expected: map[string]string{"predicateType": vex.Context},
+		},
+		{
+			name: "sbom link",
+			opts: Options{SBOMAttestationDigest: sbomDigest},
+			expected: map[string]string{
+				"predicateType":           vex.Context,
+				SBOMAttestationAnnotation: sbomDigest,
+			},
+		},
+		{
+			name:    "invalid digest",
+			opts:    Options{SBOMAttestationDigest: "sbom.spdx.json"},
+			mustErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			annotations, err := attestationAnnotations(tc.opts)
+			if tc.mustErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, annotations)
+		})
+	}
+}
+
+func TestLoadDirectory(t *testing.T) {
+	doc, err := os.ReadFile("testdata/v020-1.vex.json")
+	require.NoError(t, err)
+	att, err := json.Marshal(map[string]any{
+		"_type":         intoto.StatementInTotoV01,
+		"predicateType": vex.TypeURI,
+		"predicate":     json.RawMessage(doc),
+	})
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	for path, data := range map[string][]byte{
+		"a.vex.json":             doc,
+		"b.openvex.json":         att,
+		"notes.json":             doc,
+		"sbom.vex.json":          []byte(`{"bomFormat": "CycloneDX"}`),
+		"sub/c.vex.json":         doc,
+		"sub/deeper/d.vex.json":  doc,
+		"broken/broken.vex.json": []byte(`{"@context": `),
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(path)), os.FileMode(0o755)))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, path), data, os.FileMode(0o644)))
+	}
+
+	for _, tc := range []struct {
+		name            string
+		recursive       bool
+		continueOnError bool
+		expectedDocs    int
+		shouldErr       bool
+	}{
+		{"flat", false, false, 2, false},
+		{"recursive aborts on errors", true, false, 0, true},
+		{"recursive collects errors", true, true, 4, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			impl := defaultVexCtlImplementation{}
+			docs, err := impl.LoadDirectory(context.Background(), dir, tc.recursive, tc.continueOnError)
+			if tc.shouldErr {
+				require.Error(t, err)
+				if tc.continueOnError {
+					require.Contains(t, err.Error(), "broken.vex.json")
+				}
+			} else {
+				require.NoError(t, err)
+			}
+			require.Len(t, docs, tc.expectedDocs)
+			for _, d := range docs {
+				require.Len(t, d.Statements, 1)
+			}
+		})
+	}
+
+	_, err = (&defaultVexCtlImplementation{}).LoadDirectory(context.Background(), filepath.Join(dir, "missing"), true, true)
+	require.Error(t, err)
+}
+
+func TestLoadFilesDuplicateContents(t *testing.T) {
+	target, err := filepath.Abs("testdata/v020-1.vex.json")
+	require.NoError(t, err)
+	link := filepath.Join(t.TempDir(), "link.vex.json")
+	require.NoError(t, os.Symlink(target, link))
+
+	docs, err := (&defaultVexCtlImplementation{}).LoadFiles(
+		context.Background(), Options{}, []string{target, link, "testdata/v020-2.vex.json"},
+	)
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+	require.Equal(t, "https://openvex.dev/docs/public/vex-3f59b4dffdeae0183e5e6a9d7a2461fdf86a03c079f4129050bb462eca366beb", docs[0].ID)
+}
+
+func TestLoadFilesContinueOnError(t *testing.T) {
+	broken := filepath.Join(t.TempDir(), "broken.vex.json")
+	require.NoError(t, os.WriteFile(broken, []byte(`{"@context": "https://openvex.dev/ns/v0.2.0",`), os.FileMode(0o644)))
+	paths := []string{"testdata/v020-1.vex.json", broken, "testdata/v020-2.vex.json"}
+
+	impl := defaultVexCtlImplementation{}
+	docs, err := impl.LoadFiles(context.Background(), Options{}, paths)
+	require.Error(t, err)
+	require.Nil(t, docs)
+
+	docs, err = impl.LoadFiles(context.Background(), Options{ContinueOnLoadError: true}, paths)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), broken)
+	require.Len(t, docs, 2)
+}
+
+func TestLoadFilesGlob(t *testing.T) {
+	impl := defaultVexCtlImplementation{}
+	for _, tc := range []struct {
+		name      string
+		paths     []string
+		expected  []string
+		shouldErr bool
+	}{
+		{
+			name:     "no patterns",
+			paths:    []string{"testdata/v020-2.vex.json", "testdata/v020-1.vex.json"},
+			expected: []string{"testdata/v020-2.vex.json", "testdata/v020-1.vex.json"},
+		},
+		{
+			name:     "pattern matching multiple files",
+			paths:    []string{"testdata/v020-?.vex.json"},
+			expected: []string{"testdata/v020-1.vex.json", "testdata/v020-2.vex.json"},
+		},
+		{
+			name:     "duplicates are loaded once",
+			paths:    []string{"testdata/v020-2.vex.json", "testdata/v020-*.vex.json"},
+			expected: []string{"testdata/v020-2.vex.json", "testdata/v020-1.vex.json"},
+		},
+		{
+			name:      "pattern matching nothing",
+			paths:     []string{"testdata/v020-1.vex.json", "testdata/*.nothing"},
+			shouldErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			docs, err := impl.LoadFiles(context.Background(), Options{}, tc.paths)
+			if tc.shouldErr {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "testdata/*.nothing")
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, docs, len(tc.expected))
+			for i, path := range tc.expected {
+				expected, err := vex.Open(path)
+				require.NoError(t, err)
+				require.Equal(t, expected.ID, docs[i].ID)
+			}
+		})
+	}
+}
+
+func TestOpenVexDataStdin(t *testing.T) {
+	data, err := os.ReadFile("testdata/v020-1.vex.json")
+	require.NoError(t, err)
+	fromFile, err := vex.Open("testdata/v020-1.vex.json")
+	require.NoError(t, err)
+
+	impl := defaultVexCtlImplementation{stdin: bytes.NewReader(data)}
+	docs, err := impl.OpenVexData(Options{}, []string{StdinPath})
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	require.Equal(t, fromFile, docs[0])
+
+	impl = defaultVexCtlImplementation{stdin: bytes.NewReader(data)}
+	docs, err = impl.LoadFiles(context.Background(), Options{}, []string{"testdata/v020-2.vex.json", StdinPath})
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+	require.Equal(t, fromFile, docs[1])
+
+	impl = defaultVexCtlImplementation{stdin: bytes.NewReader(data)}
+	_, err = impl.OpenVexData(Options{MaxDocumentSize: int64(len(data) - 1)}, []string{StdinPath})
+	require.ErrorContains(t, err, "larger than")
+}
+
+func TestMergeTimestamps(t *testing.T) {
+	t1 := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(24 * time.Hour)
+	t3 := t2.Add(24 * time.Hour)
+	newStatement := func(ts, updated *time.Time) vex.Statement {
+		return vex.Statement{
+			Vulnerability: vex.Vulnerability{Name: "CVE-2023-1234"},
+			Products:      []vex.Product{{Component: vex.Component{ID: "pkg:oci/image"}}},
+			Status:        vex.StatusAffected,
+			Timestamp:     ts,
+			LastUpdated:   updated,
+		}
+	}
+	doc1 := &vex.VEX{Metadata: vex.Metadata{ID: "doc1", Timestamp: &t2}, Statements: []vex.Statement{
+		newStatement(&t1, &t3),
+	}}
+	doc2 := &vex.VEX{Metadata: vex.Metadata{ID: "doc2", Timestamp: &t1}, Statements: []vex.Statement{
+		newStatement(nil, nil),
+	}}
+
+	impl := defaultVexCtlImplementation{}
+	doc, err := impl.Merge(context.Background(), &MergeOptions{}, []*vex.VEX{doc1, doc2})
+	require.NoError(t, err)
+	require.NotNil(t, doc.Timestamp)
+	require.True(t, doc.Timestamp.Equal(t2))
+	require.NotNil(t, doc.LastUpdated)
+	require.True(t, doc.LastUpdated.Equal(t3))
+
+	before := time.Now()
+	doc, err = impl.Merge(context.Background(), &MergeOptions{UseCurrentTime: true}, []*vex.VEX{doc1, doc2})
+	require.NoError(t, err)
+	require.False(t, doc.Timestamp.Before(before.Truncate(time.Second)))
+}
+
+func TestMergeIDOrderIndependent(t *testing.T) {
+	ts := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	newDoc := func(id, vuln string) *vex.VEX {
+		return &vex.VEX{Metadata: vex.Metadata{ID: id, Timestamp: &ts}, Statements: []vex.Statement{{
+			Vulnerability: vex.Vulnerability{Name: vex.VulnerabilityID(vuln)},
+			Products:      []vex.Product{{Component: vex.Component{ID: "pkg:oci/image"}}},
+			Status:        vex.StatusAffected,
+		}}}
+	}
+	docs := []*vex.VEX{newDoc("", "CVE-2023-1234"), newDoc("", "CVE-2023-5678"), newDoc("doc3", "CVE-2023-9999")}
+
+	impl := defaultVexCtlImplementation{}
+	doc1, err := impl.Merge(context.Background(), &MergeOptions{}, docs)
+	require.NoError(t, err)
+	doc2, err := impl.Merge(context.Background(), &MergeOptions{}, []*vex.VEX{docs[2], docs[1], docs[0]})
+	require.NoError(t, err)
+	require.Equal(t, doc1.ID, doc2.ID)
+
+	// Documents without an ID but different contents get different IDs
+	doc3, err := impl.Merge(context.Background(), &MergeOptions{}, []*vex.VEX{docs[0], docs[0], docs[2]})
+	require.NoError(t, err)
+	require.NotEqual(t, doc1.ID, doc3.ID)
+}
+
+func TestMergeSupersede(t *testing.T) {
+	t1 := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.AddDate(0, 1, 0)
+	newStatement := func(status vex.Status, ts *time.Time, products ...string) vex.Statement {
+		s := vex.Statement{Vulnerability: vex.Vulnerability{Name: "CVE-2023-1234"}, Status: status, Timestamp: ts}
+		for _, p := range products {
+			s.Products = append(s.Products, vex.Product{Component: vex.Component{ID: p}})
+		}
+		return s
+	}
+	// January snapshot: both images affected
+	jan := &vex.VEX{Metadata: vex.Metadata{ID: "jan", Timestamp: &t1}, Statements: []vex.Statement{
+		newStatement(vex.StatusAffected, nil, "pkg:oci/a", "pkg:oci/b"),
+	}}
+	// February snapshot: a is fixed, the statement takes the document time
+	feb := &vex.VEX{Metadata: vex.Metadata{ID: "feb", Timestamp: &t2}, Statements: []vex.Statement{
+		newStatement(vex.StatusFixed, nil, "pkg:oci/a"),
+	}}
+
+	impl := defaultVexCtlImplementation{}
+	for _, tc := range []struct {
+		name     string
+		strategy MergeStrategy
+		docs     []*vex.VEX
+		expected []string
+	}{
+		{"accumulate", MergeAccumulate, []*vex.VEX{jan, feb}, []string{"affected pkg:oci/a pkg:oci/b", "fixed pkg:oci/a"}},
+		{"supersede", MergeSupersede, []*vex.VEX{jan, feb}, []string{"affected pkg:oci/b", "fixed pkg:oci/a"}},
+		{"supersede any order", MergeSupersede, []*vex.VEX{feb, jan}, []string{"affected pkg:oci/b", "fixed pkg:oci/a"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := impl.Merge(context.Background(), &MergeOptions{Strategy: tc.strategy}, tc.docs)
+			require.NoError(t, err)
+			got := []string{}
+			for _, s := range doc.Statements {
+				desc := string(s.Status)
+				for _, p := range s.Products {
+					desc += " " + p.ID
+				}
+				got = append(got, desc)
+			}
+			require.ElementsMatch(t, tc.expected, got)
+		})
+	}
+
+	// The source documents are not modified
+	require.Len(t, jan.Statements[0].Products, 2)
+
+	_, err := impl.Merge(context.Background(), &MergeOptions{Strategy: "newest"}, []*vex.VEX{jan})
+	require.Error(t, err)
+}
+
+func TestMergeSubcomponents(t *testing.T) {
+	t1 := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(24 * time.Hour)
+	newStatement := func(id string, status vex.Status, ts *time.Time, subcomponents ...string) vex.Statement {
+		p := vex.Product{Component: vex.Component{ID: "pkg:oci/image1"}}
+		for _, sc := range subcomponents {
+			p.Subcomponents = append(p.Subcomponents, vex.Subcomponent{Component: vex.Component{ID: sc}})
+		}
+		s := vex.Statement{
+			ID:            id,
+			Vulnerability: vex.Vulnerability{Name: "CVE-2023-1234"},
+			Products:      []vex.Product{p},
+			Status:        status,
+			Timestamp:     ts,
+		}
+		if status == vex.StatusNotAffected {
+			s.Justification = vex.VulnerableCodeNotPresent
+		}
+		return s
+	}
+	docs := []*vex.VEX{
+		{Metadata: vex.Metadata{ID: "doc1", Timestamp: &t1}, Statements: []vex.Statement{
+			newStatement("a", vex.StatusNotAffected, &t1, "pkg:apk/wolfi/bash", "pkg:apk/wolfi/curl"),
+			newStatement("b", vex.StatusAffected, &t1, "pkg:apk/wolfi/glibc"),
+		}},
+		{Metadata: vex.Metadata{ID: "doc2", Timestamp: &t2}, Statements: []vex.Statement{
+			// Same subcomponents as "a" in another order
+			newStatement("c", vex.StatusNotAffected, &t2, "pkg:apk/wolfi/curl", "pkg:apk/wolfi/bash"),
+		}},
+	}
+
+	impl := defaultVexCtlImplementation{}
+	for _, tc := range []struct {
+		name        string
+		opts        MergeOptions
+		expectedIDs []string
+	}{
+		{"deduplicate", MergeOptions{}, []string{"b", "c"}},
+		{"supersede", MergeOptions{Strategy: MergeSupersede}, []string{"b", "c"}},
+		{"conflicts", MergeOptions{OnConflict: ConflictError, KeepDuplicates: true}, []string{"a", "b", "c"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := impl.Merge(context.Background(), &tc.opts, docs)
+			require.NoError(t, err)
+			ids := []string{}
+			for _, s := range doc.Statements {
+				ids = append(ids, s.ID)
+			}
+			sort.Strings(ids)
+			require.Equal(t, tc.expectedIDs, ids)
+		})
+	}
+
+	var b bytes.Buffer
+	_, err := impl.Merge(context.Background(), &MergeOptions{ChangelogWriter: &b}, docs)
+	require.NoError(t, err)
+	changelog := []ChangelogEntry{}
+	require.NoError(t, json.Unmarshal(b.Bytes(), &changelog))
+	require.Len(t, changelog, 1)
+	require.Equal(t, "a", changelog[0].Superseded.ID)
+	require.Equal(t, "c", changelog[0].SupersededBy.ID)
+}
+
+func TestMergePreserveSourceOrder(t *testing.T) {
+	t1 := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.AddDate(0, 1, 0)
+	newStatement := func(vuln string) vex.Statement {
+		return vex.Statement{
+			Vulnerability: vex.Vulnerability{Name: vex.VulnerabilityID(vuln)},
+			Products:      []vex.Product{{Component: vex.Component{ID: "pkg:oci/image"}}},
+			Status:        vex.StatusAffected,
+		}
+	}
+	older := &vex.VEX{Metadata: vex.Metadata{ID: "older", Timestamp: &t1}, Statements: []vex.Statement{
+		newStatement("CVE-2023-0004"), newStatement("CVE-2023-0002"),
+	}}
+	newer := &vex.VEX{Metadata: vex.Metadata{ID: "newer", Timestamp: &t2}, Statements: []vex.Statement{
+		newStatement("CVE-2023-0003"), newStatement("CVE-2023-0001"),
+	}}
+
+	impl := defaultVexCtlImplementation{}
+	for _, tc := range []struct {
+		name     string
+		opts     MergeOptions
+		docs     []*vex.VEX
+		expected []string
+	}{
+		{
+			"sorted globally", MergeOptions{}, []*vex.VEX{newer, older},
+			[]string{"CVE-2023-0001", "CVE-2023-0002", "CVE-2023-0003", "CVE-2023-0004"},
+		},
+		{
+			"grouped by document", MergeOptions{PreserveSourceOrder: true}, []*vex.VEX{newer, older},
+			[]string{"CVE-2023-0001", "CVE-2023-0003", "CVE-2023-0002", "CVE-2023-0004"},
+		},
+		{
+			"groups follow the input order", MergeOptions{PreserveSourceOrder: true}, []*vex.VEX{older, newer},
+			[]string{"CVE-2023-0002", "CVE-2023-0004", "CVE-2023-0001", "CVE-2023-0003"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := impl.Merge(context.Background(), &tc.opts, tc.docs)
+			require.NoError(t, err)
+			vulns := []string{}
+			for _, s := range doc.Statements {
+				vulns = append(vulns, string(s.Vulnerability.Name))
+			}
+			require.Equal(t, tc.expected, vulns)
+		})
+	}
+}
+
+func TestMergeStatuses(t *testing.T) {
+	ts := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	doc := &vex.VEX{Metadata: vex.Metadata{ID: "doc", Timestamp: &ts}}
+	for _, status := range []vex.Status{
+		vex.StatusNotAffected, vex.StatusAffected, vex.StatusFixed, vex.StatusUnderInvestigation,
+	} {
+		doc.Statements = append(doc.Statements, vex.Statement{
+			Vulnerability: vex.Vulnerability{Name: vex.VulnerabilityID("CVE-2023-" + string(status))},
+			Products:      []vex.Product{{Component: vex.Component{ID: "pkg:oci/image"}}},
+			Status:        status,
+		})
+	}
+
+	impl := defaultVexCtlImplementation{}
+	for _, tc := range []struct {
+		name     string
+		statuses []vex.Status
+		expected []vex.Status
+	}{
+		{"no filter", nil, []vex.Status{vex.StatusAffected, vex.StatusFixed, vex.StatusNotAffected, vex.StatusUnderInvestigation}},
+		{"exploitable", []vex.Status{vex.StatusAffected, vex.StatusUnderInvestigation}, []vex.Status{vex.StatusAffected, vex.StatusUnderInvestigation}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			merged, err := impl.Merge(context.Background(), &MergeOptions{Statuses: tc.statuses}, []*vex.VEX{doc})
+			require.NoError(t, err)
+			statuses := []vex.Status{}
+			for _, s := range merged.Statements {
+				statuses = append(statuses, s.Status)
+			}
+			sort.Slice(statuses, func(i, j int) bool { return statuses[i] < statuses[j] })
+			require.Equal(t, tc.expected, statuses)
+		})
+	}
+}
+
+func TestMergeAnnotateSource(t *testing.T) {
+	ts := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	statement := vex.Statement{
+		Vulnerability:            vex.Vulnerability{Name: "CVE-2023-1234"},
+		Products:                 []vex.Product{{Component: vex.Component{ID: "pkg:oci/image"}}},
+		Status:                   vex.StatusAffected,
+		StatusNotes:              "being fixed",
+		ActionStatement:          "update the image",
+		ActionStatementTimestamp: &ts,
+	}
+	doc1 := &vex.VEX{
+		Metadata:   vex.Metadata{ID: "doc1", Timestamp: &ts, Tooling: "vexctl", Supplier: "ACME"},
+		Statements: []vex.Statement{statement},
+	}
+	statement.StatusNotes = ""
+	doc2 := &vex.VEX{
+		Metadata:   vex.Metadata{ID: "doc2", Timestamp: &ts},
+		Statements: []vex.Statement{statement},
+	}
+
+	impl := defaultVexCtlImplementation{}
+	for _, tc := range []struct {
+		name     string
+		annotate bool
+		expected []string
+	}{
+		{"no annotations", false, []string{"", "being fixed"}},
+		{"annotate source", true, []string{"[source: doc2]", "being fixed [source: doc1; tooling: vexctl; supplier: ACME]"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			merged, err := impl.Merge(context.Background(), &MergeOptions{AnnotateSource: tc.annotate, KeepDuplicates: true}, []*vex.VEX{doc1, doc2})
+			require.NoError(t, err)
+			notes := []string{}
+			for _, s := range merged.Statements {
+				notes = append(notes, s.StatusNotes)
+				require.Equal(t, "update the image", s.ActionStatement)
+				require.Equal(t, &ts, s.ActionStatementTimestamp)
+			}
+			sort.Strings(notes)
+			require.Equal(t, tc.expected, notes)
+			require.Equal(t, "being fixed", doc1.Statements[0].StatusNotes)
+		})
+	}
+}
+
+func TestSignAttestationInvalidKey(t *testing.T) {
+	impl := defaultVexCtlImplementation{}
+	att := attestation.New()
+	_, err := impl.SignAttestation(context.Background(), att, filepath.Join(t.TempDir(), "missing.key"))
+	require.Error(t, err)
+	require.False(t, att.Signed)
+	require.Nil(t, att.SignatureData)
+}
+
+func TestUploadToTlog(t *testing.T) {
+	ctx := context.Background()
+	impl := defaultVexCtlImplementation{}
+
+	// Signing without uploading does not talk to rekor
+	keys, err := cosign.GenerateKeyPair(func(bool) ([]byte, error) { return []byte{}, nil })
+	require.NoError(t, err)
+	keyPath := filepath.Join(t.TempDir(), "cosign.key")
+	require.NoError(t, os.WriteFile(keyPath, keys.PrivateBytes, os.FileMode(0o600)))
+	t.Setenv("COSIGN_PASSWORD", "")
+
+	att := attestation.New()
+	_, err = impl.SignAttestationWithOptions(ctx, att, keyPath, attestation.SigningOptions{SkipTlogUpload: true})
+	require.NoError(t, err)
+	require.True(t, att.Signed)
+	require.NotNil(t, att.SignatureData)
+	require.Nil(t, att.SignatureData.Entry)
+
+	// Unsigned attestations cannot be uploaded
+	require.Error(t, impl.UploadToTlog(ctx, attestation.New(), ""))
+
+	// Attestations already in the log are not uploaded again
+	index := int64(42)
+	att.SignatureData.Entry = &models.LogEntryAnon{LogIndex: &index}
+	require.NoError(t, impl.UploadToTlog(ctx, att, "http://rekor.invalid"))
+	require.Equal(t, &index, att.SignatureData.Entry.LogIndex)
+}
+
+func TestWriteAttestationFile(t *testing.T) {
+	ctx := context.Background()
+	impl := defaultVexCtlImplementation{}
+	keys, err := cosign.GenerateKeyPair(func(bool) ([]byte, error) { return []byte{}, nil })
+	require.NoError(t, err)
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "cosign.key")
+	require.NoError(t, os.WriteFile(keyPath, keys.PrivateBytes, os.FileMode(0o600)))
+	t.Setenv("COSIGN_PASSWORD", "")
+
+	att := attestation.New()
+	att.Predicate = vex.New()
+	att.Predicate.ID = "https://openvex.dev/docs/test"
+	require.NoError(t, att.AddSubjects([]intoto.Subject{
+		{Name: "pkg:apk/wolfi/bash@1.0.0", Digest: map[string]string{"sha256": strings.Repeat("a", 64)}},
+	}))
+
+	path := filepath.Join(dir, "vex.intoto.jsonl")
+	require.Error(t, impl.WriteAttestationFile(att, path), "unsigned attestations are not written")
+	require.NoFileExists(t, path)
+
+	_, err = impl.SignAttestationWithOptions(ctx, att, keyPath, attestation.SigningOptions{SkipTlogUpload: true})
+	require.NoError(t, err)
+	require.NoError(t, impl.WriteAttestationFile(att, path))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	require.Len(t, lines, 1)
+
+	envelope := cosign.AttestationPayload{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &envelope))
+	require.Equal(t, IntotoPayloadType, envelope.PayloadType)
+	require.Len(t, envelope.Signatures, 1)
+	payload, err := base64.StdEncoding.DecodeString(envelope.PayLoad)
+	require.NoError(t, err)
+	read := attestation.New()
+	require.NoError(t, json.Unmarshal(payload, read))
+	require.Equal(t, "https://openvex.dev/docs/test", read.Predicate.ID)
+	require.Equal(t, "pkg:apk/wolfi/bash@1.0.0", read.Subject[0].Name)
+}
+
+func TestVerifyAttestationFile(t *testing.T) {
+	ctx := context.Background()
+	impl := defaultVexCtlImplementation{}
+	dir := t.TempDir()
+	t.Setenv("COSIGN_PASSWORD", "")
+	writeKeys := func(name string) (privPath, pubPath string) {
+		keys, err := cosign.GenerateKeyPair(func(bool) ([]byte, error) { return []byte{}, nil })
+		require.NoError(t, err)
+		privPath = filepath.Join(dir, name+".key")
+		pubPath = filepath.Join(dir, name+".pub")
+		require.NoError(t, os.WriteFile(privPath, keys.PrivateBytes, os.FileMode(0o600)))
+		require.NoError(t, os.WriteFile(pubPath, keys.PublicBytes, os.FileMode(0o600)))
+		return privPath, pubPath
+	}
+	keyPath, pubPath := writeKeys("cosign")
+	_, otherPubPath := writeKeys("other")
+
+	att := attestation.New()
+	att.Predicate = vex.New()
+	att.Predicate.ID = "https://openvex.dev/docs/test"
+	_, err := impl.SignAttestationWithOptions(ctx, att, keyPath, attestation.SigningOptions{SkipTlogUpload: true})
+	require.NoError(t, err)
+	path := filepath.Join(dir, "vex.intoto.jsonl")
+	require.NoError(t, impl.WriteAttestationFile(att, path))
+
+	// Replace the payload keeping the signature of the original one
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	envelope := map[string]any{}
+	require.NoError(t, json.Unmarshal(data, &envelope))
+	tampered := attestation.New()
+	tampered.Predicate = vex.New()
+	tampered.Predicate.ID = "https://openvex.dev/docs/tampered"
+	var b bytes.Buffer
+	require.NoError(t, tampered.ToJSON(&b))
+	envelope["payload"] = base64.StdEncoding.EncodeToString(b.Bytes())
+	data, err = json.Marshal(envelope)
+	require.NoError(t, err)
+	tamperedPath := filepath.Join(dir, "tampered.intoto.jsonl")
+	require.NoError(t, os.WriteFile(tamperedPath, data, os.FileMode(0o600)))
+
+	for _, tc := range []struct {
+		name    string
+		path    string
+		key     string
+		mustErr bool
+	}{
+		{"valid", path, pubPath, false},
+		{"wrong key", path, otherPubPath, true},
+		{"tampered payload", tamperedPath, pubPath, true},
+		{"missing file", filepath.Join(dir, "missing.intoto.jsonl"), pubPath, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := impl.VerifyAttestationFile(ctx, tc.path, tc.key)
+			if tc.mustErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "https://openvex.dev/docs/test", doc.ID)
+		})
+	}
+}
+
+func TestReadSignedVEXStdout(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, envelope := signedTestAttestation(t, priv, "doc", "example.com/image:latest", v1.Hash{
+		Algorithm: "sha256", Hex: strings.Repeat("a", 64),
+	})
+	payload := cosign.AttestationPayload{}
+	require.NoError(t, json.Unmarshal(envelope, &payload))
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	impl := defaultVexCtlImplementation{}
+	doc, err := impl.ReadSignedVEX(payload)
+	os.Stdout = stdout
+	require.NoError(t, w.Close())
+	require.NoError(t, err)
+	require.Equal(t, "doc", doc.ID)
+
+	out, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Empty(t, out)
+}
+
+func TestReadImageAttestations(t *testing.T) {
+	ctx := context.Background()
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	ref := fmt.Sprintf("%s/test/image:latest", u.Host)
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	require.NoError(t, crane.Push(img, ref))
+	d, err := img.Digest()
+	require.NoError(t, err)
+
+	newKey := func() (*ecdsa.PrivateKey, string) {
+		priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		pub, err := cryptoutils.MarshalPublicKeyToPEM(&priv.PublicKey)
+		require.NoError(t, err)
+		path := filepath.Join(t.TempDir(), "cosign.pub")
+		require.NoError(t, os.WriteFile(path, pub, os.FileMode(0o644)))
+		return priv, path
+	}
+
+	// attachSigned attaches an attestation of a document signed with priv
+	attachSigned := func(priv *ecdsa.PrivateKey, docID string) {
+		att, envelope := signedTestAttestation(t, priv, docID, ref, d)
+		_, err := attachAttestation(ctx, Options{}, att, envelope, ref, nil, nil)
+		require.NoError(t, err)
+	}
+
+	trustedKey, trustedKeyPath := newKey()
+	untrustedKey, _ := newKey()
+	_, unknownKeyPath := newKey()
+	attachSigned(trustedKey, "valid")
+	attachSigned(untrustedKey, "invalid")
+
+	impl := defaultVexCtlImplementation{}
+	for _, tc := range []struct {
+		name        string
+		opts        Options
+		expectedIDs []string
+		mustErr     bool
+	}{
+		{"invalid signature is dropped", Options{VerifyKey: trustedKeyPath, IgnoreTlog: true}, []string{"valid"}, false},
+		{"no valid signatures", Options{VerifyKey: unknownKeyPath, IgnoreTlog: true}, []string{}, false},
+		{"skip verification", Options{SkipVerify: true}, []string{"invalid", "valid"}, false},
+		{"no key or identity", Options{}, nil, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			docs, err := impl.ReadImageAttestations(ctx, tc.opts, ref)
+			if tc.mustErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			ids := []string{}
+			for _, doc := range docs {
+				ids = append(ids, doc.ID)
+			}
+			sort.Strings(ids)
+			require.Equal(t, tc.expectedIDs, ids)
+		})
+	}
+
+	// VexFromURI verifies image sources through ReadImageAttestations
+	vexctl := &VexCtl{impl: &impl, Options: Options{VerifyKey: trustedKeyPath, IgnoreTlog: true}}
+	doc, err := vexctl.VexFromURI(ctx, ref)
+	require.NoError(t, err)
+	require.Equal(t, "valid", doc.ID)
+
+	vexctl.Options.VerifyKey = unknownKeyPath
+	_, err = vexctl.VexFromURI(ctx, ref)
+	require.ErrorContains(t, err, "no attestations found")
+}
+
+func TestReadImageAttestationsByDigest(t *testing.T) {
+	ctx := context.Background()
+	var tagLookups atomic.Int32
+	reg := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/test/image/manifests/latest" {
+			tagLookups.Add(1)
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	ref := fmt.Sprintf("%s/test/image:latest", u.Host)
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	require.NoError(t, crane.Push(img, ref))
+	d, err := img.Digest()
+	require.NoError(t, err)
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	att, envelope := signedTestAttestation(t, priv, "pinned", ref, d)
+	_, err = attachAttestation(ctx, Options{}, att, envelope, ref, nil, nil)
+	require.NoError(t, err)
+
+	// Move the tag so that resolving it would read from another image
+	img2, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	require.NoError(t, crane.Push(img2, ref))
+
+	impl := defaultVexCtlImplementation{}
+	digestRef := fmt.Sprintf("%s/test/image@%s", u.Host, d)
+	for _, opts := range []Options{{SkipVerify: true}, {SkipVerify: true, UseReferrers: true}} {
+		tagLookups.Store(0)
+		docs, err := impl.ReadImageAttestationsByDigest(ctx, opts, digestRef)
+		require.NoError(t, err)
+		require.Len(t, docs, 1)
+		require.Equal(t, "pinned", docs[0].ID)
+		require.Equal(t, int32(0), tagLookups.Load(), "no tags are resolved")
+	}
+
+	docs, err := impl.ReadImageAttestations(ctx, Options{SkipVerify: true}, ref)
+	require.NoError(t, err)
+	require.Empty(t, docs)
+
+	_, err = impl.ReadImageAttestationsByDigest(ctx, Options{SkipVerify: true}, ref)
+	require.Error(t, err, "tag references are rejected")
+}
+
+func TestReadImageAttestationsByTime(t *testing.T) {
+	ctx := context.Background()
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	ref := fmt.Sprintf("%s/test/image:latest", u.Host)
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	require.NoError(t, crane.Push(img, ref))
+	d, err := img.Digest()
+	require.NoError(t, err)
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	sv, err := signature.LoadECDSASignerVerifier(priv, crypto.SHA256)
+	require.NoError(t, err)
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, id := range []string{"january", "march", "february"} {
+		att := attestation.New()
+		att.Predicate = vex.New()
+		att.Predicate.ID = id
+		ts := base.AddDate(0, []int{0, 2, 1}[i], 0)
+		att.Predicate.Timestamp = &ts
+		require.NoError(t, att.AddSubjects([]intoto.Subject{
+			{Name: ref, Digest: map[string]string{"sha256": d.Hex}},
+		}))
+		var b bytes.Buffer
+		require.NoError(t, att.ToJSON(&b))
+		envelope, err := dsse.WrapSigner(sv, IntotoPayloadType).SignMessage(bytes.NewReader(b.Bytes()))
+		require.NoError(t, err)
+		att.SignatureData = &attestation.SignatureData{}
+		_, err = attachAttestation(ctx, Options{}, att, envelope, ref, nil, nil)
+		require.NoError(t, err)
+	}
+
+	impl := defaultVexCtlImplementation{}
+	for _, tc := range []struct {
+		name        string
+		opts        Options
+		expectedIDs []string
+	}{
+		{"no filter", Options{SkipVerify: true}, []string{"february", "january", "march"}},
+		{"since", Options{SkipVerify: true, Since: base.AddDate(0, 1, 0)}, []string{"february", "march"}},
+		{"latest", Options{SkipVerify: true, Latest: true}, []string{"march"}},
+		{"latest since", Options{SkipVerify: true, Latest: true, Since: base.AddDate(0, 1, 0)}, []string{"march"}},
+		{"since after all", Options{SkipVerify: true, Latest: true, Since: base.AddDate(1, 0, 0)}, []string{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			docs, err := impl.ReadImageAttestations(ctx, tc.opts, ref)
+			require.NoError(t, err)
+			ids := []string{}
+			for _, doc := range docs {
+				ids = append(ids, doc.ID)
+			}
+			sort.Strings(ids)
+			require.Equal(t, tc.expectedIDs, ids)
+		})
+	}
+}
+
+func TestReadImageAttestationsPayloadType(t *testing.T) {
+	ctx := context.Background()
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	ref := fmt.Sprintf("%s/test/image:latest", u.Host)
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	require.NoError(t, crane.Push(img, ref))
+	d, err := img.Digest()
+	require.NoError(t, err)
+
+	// Sign an attestation with the payload type set by older tooling
+	customType := "application/vnd.in-toto.v0.1+json"
+	att := attestation.New()
+	att.Predicate = vex.New()
+	att.Predicate.ID = "custom"
+	require.NoError(t, att.AddSubjects([]intoto.Subject{
+		{Name: ref, Digest: map[string]string{"sha256": d.Hex}},
+	}))
+	att.SignatureData = &attestation.SignatureData{}
+	var b bytes.Buffer
+	require.NoError(t, att.ToJSON(&b))
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	sv, err := signature.LoadECDSASignerVerifier(priv, crypto.SHA256)
+	require.NoError(t, err)
+	envelope, err := dsse.WrapSigner(sv, customType).SignMessage(bytes.NewReader(b.Bytes()))
+	require.NoError(t, err)
+	_, err = attachAttestation(ctx, Options{}, att, envelope, ref, nil, nil)
+	require.NoError(t, err)
+
+	impl := defaultVexCtlImplementation{}
+	for _, tc := range []struct {
+		name        string
+		payloadType string
+		expectedIDs []string
+		mustErr     bool
+	}{
+		{"default payload type", "", []string{}, false},
+		{"custom payload type", customType, []string{"custom"}, false},
+		{"blank payload type", "  ", nil, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			docs, err := impl.ReadImageAttestations(ctx, Options{SkipVerify: true, PayloadType: tc.payloadType}, ref)
+			if tc.mustErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			ids := []string{}
+			for _, doc := range docs {
+				ids = append(ids, doc.ID)
+			}
+			require.Equal(t, tc.expectedIDs, ids)
+		})
+	}
+}
+
+// signedTestAttestation returns an attestation of an empty document about
+// an image and its DSSE envelope signed with priv.
+func signedTestAttestation(
+	t *testing.T, priv *ecdsa.PrivateKey, docID, ref string, digest v1.Hash,
+) (att *attestation.Attestation, envelope []byte) {
+	att = attestation.New()
+	att.Predicate = vex.New()
+	att.Predicate.ID = docID
+	require.NoError(t, att.AddSubjects([]intoto.Subject{
+		{Name: ref, Digest: map[string]string{"sha256": digest.Hex}},
+	}))
+	var b bytes.Buffer
+	require.NoError(t, att.ToJSON(&b))
+
+	sv, err := signature.LoadECDSASignerVerifier(priv, crypto.SHA256)
+	require.NoError(t, err)
+	envelope, err = dsse.WrapSigner(sv, IntotoPayloadType).SignMessage(bytes.NewReader(b.Bytes()))
+	require.NoError(t, err)
+
+	att.SignatureData = &attestation.SignatureData{}
+	return att, envelope
+}
+
+func TestAttachToRefs(t *testing.T) {
+	ctx := context.Background()
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	// pushImages pushes n images and returns their references, prefixed by
+	// a reference to an image that does not exist.
+	pushImages := func(name string, n int) []string {
+		refs := []string{fmt.Sprintf("%s/%s/missing:latest", u.Host, name)}
+		for i := 0; i < n; i++ {
+			ref := fmt.Sprintf("%s/%s/image%d:latest", u.Host, name, i)
+			img, err := random.Image(1024, 1)
+			require.NoError(t, err)
+			require.NoError(t, crane.Push(img, ref))
+			refs = append(refs, ref)
+		}
+		return refs
+	}
+
+	for _, tc := range []struct {
+		name     string
+		opts     Options
+		attached int
+	}{
+		{"failures do not stop other refs", Options{}, 5},
+		{"fail fast", Options{FailFast: true, Concurrency: 1}, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			refs := pushImages(strings.ReplaceAll(tc.name, " ", "-"), 5)
+
+			// All the refs share the attestation, the subject does not
+			// matter as the signatures are not verified here.
+			d, err := crane.Digest(refs[1])
+			require.NoError(t, err)
+			h, err := v1.NewHash(d)
+			require.NoError(t, err)
+			att, envelope := signedTestAttestation(t, priv, "doc", refs[1], h)
+
+			_, err = attachToRefs(ctx, tc.opts, att, envelope, refs, nil, nil)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), refs[0])
+
+			attached := 0
+			for _, ref := range refs[1:] {
+				r, err := name.ParseReference(ref)
+				require.NoError(t, err)
+				payloads, err := cosign.FetchAttestationsForReference(ctx, r, "")
+				if err == nil && len(payloads) > 0 {
+					attached++
+				}
+			}
+			require.Equal(t, tc.attached, attached)
+		})
+	}
+}
+
+func TestAttachDryRun(t *testing.T) {
+	ctx := context.Background()
+	impl := defaultVexCtlImplementation{}
+	var writes atomic.Int32
+	reg := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			writes.Add(1)
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	ref := fmt.Sprintf("%s/test/image:latest", u.Host)
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	require.NoError(t, crane.Push(img, ref))
+	d, err := img.Digest()
+	require.NoError(t, err)
+
+	keys, err := cosign.GenerateKeyPair(func(bool) ([]byte, error) { return []byte{}, nil })
+	require.NoError(t, err)
+	keyPath := filepath.Join(t.TempDir(), "cosign.key")
+	require.NoError(t, os.WriteFile(keyPath, keys.PrivateBytes, os.FileMode(0o600)))
+	t.Setenv("COSIGN_PASSWORD", "")
+
+	att := attestation.New()
+	att.Predicate = vex.New()
+	att.Predicate.Statements = []vex.Statement{
+		{Products: []vex.Product{{Component: vex.Component{ID: ref}}}},
+	}
+	require.NoError(t, att.AddSubjects([]intoto.Subject{
+		{Name: ref, Digest: map[string]string{"sha256": d.Hex}},
+	}))
+	_, err = impl.SignAttestationWithOptions(ctx, att, keyPath, attestation.SigningOptions{SkipTlogUpload: true})
+	require.NoError(t, err)
+
+	writes.Store(0)
+	res, err := impl.Attach(ctx, Options{DryRun: true}, att)
+	require.NoError(t, err)
+	require.Equal(t, []AttachTarget{{Ref: ref, Digest: d.String()}}, res.Planned)
+	require.Zero(t, res.Written)
+	require.Equal(t, int32(0), writes.Load())
+
+	// Subjects are still checked against the document
+	att.Predicate.Statements[0].Products[0].ID = fmt.Sprintf("%s/test/missing:latest", u.Host)
+	_, err = impl.Attach(ctx, Options{DryRun: true}, att)
+	require.ErrorContains(t, err, "checking subjects")
+}
+
+func TestAttachCachesDigests(t *testing.T) {
+	ctx := context.Background()
+	var resolved atomic.Int32
+	reg := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/test/image/manifests/latest" {
+			resolved.Add(1)
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	ref := fmt.Sprintf("%s/test/image:latest", u.Host)
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	require.NoError(t, crane.Push(img, ref))
+	d, err := img.Digest()
+	require.NoError(t, err)
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	att, envelope := signedTestAttestation(t, priv, "doc", ref, d)
+	opts := Options{SkipExisting: true, Concurrency: 1}
+
+	// The tag is resolved once no matter how many times it is listed
+	resolved.Store(0)
+	digests := newDigestCache()
+	res, err := attachToRefs(ctx, opts, att, envelope, []string{ref, ref, ref}, nil, digests)
+	require.NoError(t, err)
+	require.Equal(t, AttachResult{Written: 1, Skipped: 2}, res)
+	require.Equal(t, int32(1), resolved.Load())
+
+	// A new invocation does not reuse the digests of the previous one
+	res, err = attachToRefs(ctx, opts, att, envelope, []string{ref}, nil, newDigestCache())
+	require.NoError(t, err)
+	require.Equal(t, AttachResult{Skipped: 1}, res)
+	require.Equal(t, int32(2), resolved.Load())
+}
+
+func TestAttachSkipExisting(t *testing.T) {
+	ctx := context.Background()
+	s := httptest.NewServer(registry.New(registry.WithReferrersSupport(true)))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name string
+		opts Options
+	}{
+		{"tag scheme", Options{SkipExisting: true}},
+		{"referrers", Options{SkipExisting: true, UseReferrers: true}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ref := fmt.Sprintf("%s/%s/image:latest", u.Host, strings.ReplaceAll(tc.name, " ", "-"))
+			img, err := random.Image(1024, 1)
+			require.NoError(t, err)
+			require.NoError(t, crane.Push(img, ref))
+			d, err := img.Digest()
+			require.NoError(t, err)
+			att, envelope := signedTestAttestation(t, priv, "doc", ref, d)
+
+			res, err := attachToRefs(ctx, tc.opts, att, envelope, []string{ref}, nil, nil)
+			require.NoError(t, err)
+			require.Equal(t, AttachResult{Written: 1}, res)
+
+			res, err = attachToRefs(ctx, tc.opts, att, envelope, []string{ref}, nil, nil)
+			require.NoError(t, err)
+			require.Equal(t, AttachResult{Skipped: 1}, res)
+
+			// A different attestation is still written
+			att, envelope = signedTestAttestation(t, priv, "other", ref, d)
+			res, err = attachToRefs(ctx, tc.opts, att, envelope, []string{ref}, nil, nil)
+			require.NoError(t, err)
+			require.Equal(t, AttachResult{Written: 1}, res)
+
+			if !tc.opts.UseReferrers {
+				r, err := name.ParseReference(ref)
+				require.NoError(t, err)
+				payloads, err := cosign.FetchAttestationsForReference(ctx, r, "")
+				require.NoError(t, err)
+				require.Len(t, payloads, 2)
+			}
+		})
+	}
+}
+
+func TestReadImageAttestationsMulti(t *testing.T) {
+	ctx := context.Background()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	// Each image lives in its own registry with an attestation of docID
+	refs := []string{}
+	for _, docID := range []string{"doc-1", "doc-2"} {
+		s := httptest.NewServer(registry.New())
+		t.Cleanup(s.Close)
+		u, err := url.Parse(s.URL)
+		require.NoError(t, err)
+
+		ref := fmt.Sprintf("%s/test/image:latest", u.Host)
+		img, err := random.Image(1024, 1)
+		require.NoError(t, err)
+		require.NoError(t, crane.Push(img, ref))
+		d, err := img.Digest()
+		require.NoError(t, err)
+		att, envelope := signedTestAttestation(t, priv, docID, ref, d)
+		_, err = attachAttestation(ctx, Options{}, att, envelope, ref, nil, nil)
+		require.NoError(t, err)
+		refs = append(refs, ref)
+	}
+
+	down := httptest.NewServer(registry.New())
+	u, err := url.Parse(down.URL)
+	require.NoError(t, err)
+	down.Close()
+	unreachable := fmt.Sprintf("%s/test/image:latest", u.Host)
+
+	impl := defaultVexCtlImplementation{}
+	opts := Options{SkipVerify: true, RetryAttempts: 1, Concurrency: 2}
+	results, err := impl.ReadImageAttestationsMulti(ctx, opts, append([]string{refs[0], unreachable}, refs[1]))
+	require.Error(t, err)
+	var refErrs RefErrors
+	require.ErrorAs(t, err, &refErrs)
+	require.Len(t, refErrs, 1)
+	require.Contains(t, refErrs, unreachable)
+
+	require.Len(t, results, 2)
+	for i, ref := range refs {
+		require.Len(t, results[ref], 1)
+		require.Equal(t, fmt.Sprintf("doc-%d", i+1), results[ref][0].ID)
+	}
+
+	results, err = impl.ReadImageAttestationsMulti(ctx, opts, refs)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+}
+
+func TestReadImageAttestationsPredicateTypes(t *testing.T) {
+	ctx := context.Background()
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	ref := fmt.Sprintf("%s/test/image:latest", u.Host)
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	require.NoError(t, crane.Push(img, ref))
+	d, err := img.Digest()
+	require.NoError(t, err)
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	sv, err := signature.LoadECDSASignerVerifier(priv, crypto.SHA256)
+	require.NoError(t, err)
+
+	// attach attaches an in-toto envelope annotated with annotations
+	attach := func(envelope []byte, annotations map[string]string) {
+		_, err := attachAttestation(ctx, Options{}, attestation.New(), envelope, ref, annotations, nil)
+		require.NoError(t, err)
+	}
+
+	// statement returns the signed envelope of a statement about the image
+	statement := func(predicateType string) []byte {
+		data, err := json.Marshal(intoto.Statement{
+			StatementHeader: intoto.StatementHeader{
+				Type:          intoto.StatementInTotoV01,
+				PredicateType: predicateType,
+				Subject:       []intoto.Subject{{Name: ref, Digest: map[string]string{"sha256": d.Hex}}},
+			},
+			Predicate: map[string]string{},
+		})
+		require.NoError(t, err)
+		envelope, err := dsse.WrapSigner(sv, IntotoPayloadType).SignMessage(bytes.NewReader(data))
+		require.NoError(t, err)
+		return envelope
+	}
+
+	_, vexEnvelope := signedTestAttestation(t, priv, "vex", ref, d)
+	attach(vexEnvelope, map[string]string{"predicateType": vex.TypeURI})
+	attach(statement("https://slsa.dev/provenance/v1"), map[string]string{"predicateType": "https://slsa.dev/provenance/v1"})
+	attach(statement("https://spdx.dev/Document"), nil)
+
+	impl := defaultVexCtlImplementation{}
+	read := func(opts Options) ([]*vex.VEX, error) {
+		opts.SkipVerify = true
+		return impl.ReadImageAttestations(ctx, opts, ref)
+	}
+
+	// Non VEX attestations are not returned, filtered or not
+	for _, opts := range []Options{{}, {PredicateType: vex.TypeURI}} {
+		docs, err := read(opts)
+		require.NoError(t, err)
+		require.Len(t, docs, 1)
+		require.Equal(t, "vex", docs[0].ID)
+	}
+
+	// Attestations of other predicate types are not decoded when filtering
+	attach(
+		[]byte(`{"payloadType":"application/vnd.in-toto+json","payload":"not base64!","signatures":[]}`),
+		map[string]string{"predicateType": "https://slsa.dev/provenance/v1"},
+	)
+	_, err = read(Options{})
+	require.Error(t, err)
+	docs, err := read(Options{PredicateType: vex.TypeURI})
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	ggcrtypes "github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// imageIndexChildren returns the media type of ref and, when it points to an
+// image index, the descriptors of its platform images. If ref does not point
+// to an index, the children are nil. Manifests that are not for a platform,
+// like the attestation manifests added by buildkit, are skipped.
+func imageIndexChildren(
+	ctx context.Context, ref name.Reference, opts ...remote.Option,
+) (ggcrtypes.MediaType, []v1.Descriptor, error) {
+	desc, err := remote.Get(ref, append(opts, remote.WithContext(ctx))...)
+	if err != nil {
+		return "", nil, fmt.Errorf("fetching %s: %w", ref, registryError(ref, err))
+	}
+	if !desc.MediaType.IsIndex() {
+		return desc.MediaType, nil, nil
+	}
+
+	idx, err := desc.ImageIndex()
+	if err != nil {
+		return "", nil, fmt.Errorf("reading image index %s: %w", ref, err)
+	}
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return "", nil, fmt.Errorf("reading image index manifest %s: %w", ref, err)
+	}
+
+	children := []v1.Descriptor{}
+	for _, m := range manifest.Manifests {
+		if !m.MediaType.IsImage() || isUnknownPlatform(m.Platform) {
+			continue
+		}
+		children = append(children, m)
+	}
+	return desc.MediaType, children, nil
+}
+
+// ResolveImageMediaTypes looks up the media type of the image references in
+// the registry so callers can tell image indexes apart and decide to fan out
+// to their platform images. References that cannot be looked up are returned
+// without a media type.
+func (impl *defaultVexCtlImplementation) ResolveImageMediaTypes(
+	ctx context.Context, opts Options, refs []productRef,
+) []productRef {
+	remoteOpts := append(registryOptions(opts).GetRegistryClientOpts(ctx), remote.WithContext(ctx))
+	resolved := make([]productRef, 0, len(refs))
+	for _, pref := range refs {
+		if ref, err := parseImageReference(opts, pref.Name); err == nil {
+			desc, err := remote.Head(ref, remoteOpts...)
+			if err == nil {
+				pref.MediaType = desc.MediaType
+			} else {
+				impl.log().Debugf("Could not look up the media type of %s: %v", pref.Name, err)
+			}
+		}
+		resolved = append(resolved, pref)
+	}
+	return resolved
+}
+
+// isUnknownPlatform returns true for the unknown/unknown platform that
+// buildkit sets on the attestation manifests it adds to indexes.
+func isUnknownPlatform(p *v1.Platform) bool {
+	return p != nil && p.OS == "unknown" && p.Architecture == "unknown"
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sigstore/cosign/v2/pkg/cosign"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+func TestImageIndexes(t *testing.T) {
+	ctx := context.Background()
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	indexRef := fmt.Sprintf("%s/test/index:latest", u.Host)
+	idx, err := random.Index(1024, 1, 3)
+	require.NoError(t, err)
+	ref, err := name.ParseReference(indexRef)
+	require.NoError(t, err)
+	require.NoError(t, remote.WriteIndex(ref, idx))
+	manifest, err := idx.IndexManifest()
+	require.NoError(t, err)
+
+	imageRef := fmt.Sprintf("%s/test/image:latest", u.Host)
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	require.NoError(t, crane.Push(img, imageRef))
+
+	childRefs := []string{}
+	for _, m := range manifest.Manifests {
+		childRefs = append(childRefs, fmt.Sprintf("%s/test/index@%s", u.Host, m.Digest))
+	}
+
+	t.Run("expand subjects", func(t *testing.T) {
+		impl := defaultVexCtlImplementation{}
+		refs, err := impl.ExpandImageIndexes(ctx, Options{}, []productRef{{Name: indexRef}, {Name: imageRef}})
+		require.NoError(t, err)
+		names := []string{}
+		for _, r := range refs {
+			names = append(names, r.Name)
+		}
+		require.Equal(t, append(append([]string{indexRef}, childRefs...), imageRef), names)
+		for i, m := range manifest.Manifests {
+			require.Equal(t, vex.Hash(m.Digest.Hex), refs[i+1].Hashes[vex.SHA256])
+			require.Equal(t, m.MediaType, refs[i+1].MediaType)
+		}
+		require.True(t, refs[0].isIndex())
+		require.False(t, refs[len(refs)-1].isIndex())
+	})
+
+	t.Run("index digest purls", func(t *testing.T) {
+		d, err := idx.Digest()
+		require.NoError(t, err)
+		imgDigest, err := img.Digest()
+		require.NoError(t, err)
+
+		impl := defaultVexCtlImplementation{}
+		refs, _, _, err := impl.NormalizeProducts([]productRef{
+			{Name: fmt.Sprintf("pkg:oci/index@sha256%%3A%s?repository_url=%s/test", d.Hex, u.Host)},
+			{Name: fmt.Sprintf("pkg:oci/image@sha256%%3A%s?repository_url=%s/test", imgDigest.Hex, u.Host)},
+			{Name: fmt.Sprintf("%s/test/missing:latest", u.Host)},
+		})
+		require.NoError(t, err)
+		require.Len(t, refs, 3)
+		require.Equal(t, fmt.Sprintf("%s/test/index@%s", u.Host, d), refs[0].Name)
+
+		refs = impl.ResolveImageMediaTypes(ctx, Options{}, refs)
+		require.True(t, refs[0].isIndex())
+		require.False(t, refs[1].isIndex())
+		require.True(t, refs[1].MediaType.IsImage())
+		require.Empty(t, refs[2].MediaType, "missing images are not an error")
+	})
+
+	t.Run("attach to children", func(t *testing.T) {
+		priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		d, err := idx.Digest()
+		require.NoError(t, err)
+		att, envelope := signedTestAttestation(t, priv, "doc", indexRef, d)
+
+		opts := Options{AttachToChildren: true}
+		_, err = attachToRefs(ctx, opts, att, envelope, []string{indexRef, imageRef}, nil, nil)
+		require.NoError(t, err)
+
+		for _, r := range append(childRefs, imageRef) {
+			ref, err := name.ParseReference(r)
+			require.NoError(t, err)
+			payloads, err := cosign.FetchAttestationsForReference(ctx, ref, "")
+			require.NoError(t, err)
+			require.Len(t, payloads, 1, r)
+		}
+		_, err = cosign.FetchAttestationsForReference(ctx, ref, "")
+		require.Error(t, err, "the index should not have attestations")
+	})
+}
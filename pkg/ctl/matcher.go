@@ -0,0 +1,237 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// Matcher looks up the VEX statement that applies to a vulnerability found
+// in a product. It centralizes the matching rules so that all the filter
+// entrypoints resolve statements in the same way. The first lookup in a
+// document indexes its statements by vulnerability, the documents must not
+// be modified while the matcher is in use.
+type Matcher struct {
+	// ProductMatchMode controls how products are compared to the
+	// products of the statements. Defaults to ProductMatchExact.
+	ProductMatchMode ProductMatchMode
+
+	indexes map[*vex.VEX]VulnIndex
+}
+
+// NewMatcher returns a new Matcher
+func NewMatcher() *Matcher {
+	return &Matcher{indexes: map[*vex.VEX]VulnIndex{}}
+}
+
+// VulnIndex maps the vulnerability names, IRIs and aliases of the
+// statements in a document to the statements about them.
+type VulnIndex map[string][]*vex.Statement
+
+// BuildVulnIndex indexes the statements of the document by vulnerability so
+// they can be looked up without going over the whole document. The index
+// points to the document statements and keeps their order.
+func BuildVulnIndex(doc *vex.VEX) VulnIndex {
+	idx := VulnIndex{}
+	if doc == nil {
+		return idx
+	}
+	for i := range doc.Statements {
+		s := &doc.Statements[i]
+		seen := map[string]struct{}{}
+		ids := []string{s.Vulnerability.ID, string(s.Vulnerability.Name)}
+		for _, alias := range s.Vulnerability.Aliases {
+			ids = append(ids, string(alias))
+		}
+		for _, id := range ids {
+			key := vulnIndexKey(id)
+			if _, ok := seen[key]; ok || key == "" {
+				continue
+			}
+			seen[key] = struct{}{}
+			idx[key] = append(idx[key], s)
+		}
+	}
+	return idx
+}
+
+// Lookup returns the statements about the vulnerability id, in the order
+// they appear in the document.
+func (idx VulnIndex) Lookup(id string) []*vex.Statement {
+	return idx[vulnIndexKey(id)]
+}
+
+// vulnIndexKey normalizes a vulnerability identifier to index it
+func vulnIndexKey(id string) string {
+	return strings.ToLower(CanonicalizeVulnID(id))
+}
+
+// candidates returns the statements of the document that may be about
+// vulnID. CWE identifiers can match the statement descriptions so they are
+// checked against all the statements.
+func (m *Matcher) candidates(vulnID string, doc *vex.VEX) []*vex.Statement {
+	if cweRegexp.MatchString(strings.ToUpper(strings.TrimSpace(vulnID))) {
+		all := make([]*vex.Statement, 0, len(doc.Statements))
+		for i := range doc.Statements {
+			all = append(all, &doc.Statements[i])
+		}
+		return all
+	}
+	if m.indexes == nil {
+		m.indexes = map[*vex.VEX]VulnIndex{}
+	}
+	idx, ok := m.indexes[doc]
+	if !ok {
+		idx = BuildVulnIndex(doc)
+		m.indexes[doc] = idx
+	}
+	return idx.Lookup(vulnID)
+}
+
+// Match returns the statement from docs that applies to vulnID in product.
+// Statements match the vulnerability as defined by matchVulnerability.
+// If product is empty, statements are not scoped to a product, otherwise it
+// has to match one of the statement products or their subcomponents.
+// Within a document, the statement with the most recent timestamp wins.
+// Documents are expected to be sorted by date: statements in later documents
+// take precedence over those in earlier ones.
+func (m *Matcher) Match(vulnID, product string, docs []*vex.VEX) (*vex.Statement, bool) {
+	s, _, ok := m.MatchDocument(vulnID, product, docs)
+	return s, ok
+}
+
+// MatchDocument is like Match but also returns the document where the
+// matching statement was found.
+func (m *Matcher) MatchDocument(vulnID, product string, docs []*vex.VEX) (*vex.Statement, *vex.VEX, bool) {
+	return m.match(vulnID, product, nil, false, docs)
+}
+
+// MatchComponents is like MatchDocument but honors the subcomponents of the
+// statements: a statement scoped to subcomponents only matches when one of
+// the components where the vulnerability was found is among them.
+func (m *Matcher) MatchComponents(
+	vulnID, product string, components []string, docs []*vex.VEX,
+) (*vex.Statement, *vex.VEX, bool) {
+	return m.match(vulnID, product, components, true, docs)
+}
+
+// match looks up the statement about vulnID in docs, see MatchComponents
+func (m *Matcher) match(
+	vulnID, product string, components []string, checkSubcomponents bool, docs []*vex.VEX,
+) (*vex.Statement, *vex.VEX, bool) {
+	var match *vex.Statement
+	var matchDoc *vex.VEX
+	for _, doc := range docs {
+		if doc == nil {
+			continue
+		}
+		var latest *vex.Statement
+		var latestTime time.Time
+		for _, s := range m.candidates(vulnID, doc) {
+			if !matchVulnerability(s, vulnID) {
+				continue
+			}
+			if product != "" && !statementAppliesTo(s, product, m.ProductMatchMode) {
+				continue
+			}
+			if checkSubcomponents && !subcomponentsMatch(s, components, m.ProductMatchMode) {
+				continue
+			}
+			ts := effectiveTimestamp(s, doc)
+			if latest == nil || !ts.Before(latestTime) {
+				// Return a copy so callers cannot modify the document
+				c := *s
+				latest = &c
+				latestTime = ts
+			}
+		}
+		if latest != nil {
+			match = latest
+			matchDoc = doc
+		}
+	}
+	return match, matchDoc, match != nil
+}
+
+// effectiveTimestamp returns the statement timestamp, falling back to
+// the timestamp of its document.
+func effectiveTimestamp(s *vex.Statement, doc *vex.VEX) time.Time {
+	if s.Timestamp != nil {
+		return *s.Timestamp
+	}
+	if doc.Timestamp != nil {
+		return *doc.Timestamp
+	}
+	return time.Time{}
+}
+
+// matchVulnerability returns true if id identifies the statement
+// vulnerability. The id is compared to the vulnerability name, its IRI and
+// its aliases so that a scanner reporting any of the identifiers of a
+// vulnerability (eg CVE, GHSA or OSV) matches a statement keyed on another
+// one. Comparisons ignore case and surrounding spaces. CWE identifiers
+// also match statements that mention the CWE in the vulnerability
+// description.
+func matchVulnerability(s *vex.Statement, id string) bool {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return false
+	}
+	if cweRegexp.MatchString(strings.ToUpper(id)) && mentionsCWE(s.Vulnerability.Description, id) {
+		return true
+	}
+	return vulnerabilityMatchesID(&s.Vulnerability, id)
+}
+
+// cweMentionRegexp finds the CWE identifiers mentioned in a text
+var cweMentionRegexp = regexp.MustCompile(`(?i)\bCWE-\d+\b`)
+
+// mentionsCWE returns true if the text contains the CWE identifier
+func mentionsCWE(text, cwe string) bool {
+	for _, m := range cweMentionRegexp.FindAllString(text, -1) {
+		if strings.EqualFold(m, cwe) {
+			return true
+		}
+	}
+	return false
+}
+
+// statementAppliesTo returns true if the identifier matches one of the
+// statement products or any of their subcomponents.
+func statementAppliesTo(s *vex.Statement, identifier string, mode ProductMatchMode) bool {
+	if statementMatchesProduct(s, identifier, mode) {
+		return true
+	}
+	for _, p := range s.Products {
+		for i := range p.Subcomponents {
+			if componentMatches(&p.Subcomponents[i].Component, identifier, mode) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// subcomponentsMatch returns true if the statement has no subcomponents or
+// one of its subcomponents matches one of the components.
+func subcomponentsMatch(s *vex.Statement, components []string, mode ProductMatchMode) bool {
+	scoped := false
+	for _, p := range s.Products {
+		for i := range p.Subcomponents {
+			scoped = true
+			for _, c := range components {
+				if componentMatches(&p.Subcomponents[i].Component, c, mode) {
+					return true
+				}
+			}
+		}
+	}
+	return !scoped
+}
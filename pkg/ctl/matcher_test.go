@@ -0,0 +1,311 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	gosarif "github.com/owenrumney/go-sarif/sarif"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+func TestMatcherMatch(t *testing.T) {
+	ts := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	doc1 := &vex.VEX{
+		Metadata: vex.Metadata{ID: "doc1", Timestamp: &ts},
+		Statements: []vex.Statement{
+			{
+				ID: "stmt-1",
+				Vulnerability: vex.Vulnerability{
+					Name:    "CVE-2023-1234",
+					Aliases: []vex.VulnerabilityID{"GHSA-xxxx-yyyy-zzzz"},
+				},
+				Products: []vex.Product{{Component: vex.Component{ID: "pkg:oci/image1"}}},
+				Status:   vex.StatusUnderInvestigation,
+			},
+			{
+				ID:            "stmt-2",
+				Vulnerability: vex.Vulnerability{Name: "CVE-2023-5678"},
+				Products:      []vex.Product{{Component: vex.Component{ID: "pkg:oci/image2"}}},
+				Status:        vex.StatusNotAffected,
+			},
+		},
+	}
+	laterTs := ts.Add(time.Hour)
+	doc2 := &vex.VEX{
+		Metadata: vex.Metadata{ID: "doc2", Timestamp: &laterTs},
+		Statements: []vex.Statement{
+			{
+				ID:            "stmt-3",
+				Vulnerability: vex.Vulnerability{Name: "CVE-2023-1234"},
+				Products:      []vex.Product{{Component: vex.Component{ID: "pkg:oci/image1"}}},
+				Status:        vex.StatusFixed,
+			},
+		},
+	}
+
+	olderTs := ts.Add(-time.Hour)
+	doc3 := &vex.VEX{
+		Metadata: vex.Metadata{ID: "doc3", Timestamp: &ts},
+		Statements: []vex.Statement{
+			{
+				ID:            "stmt-4",
+				Vulnerability: vex.Vulnerability{Name: "CVE-2023-9999"},
+				Status:        vex.StatusNotAffected,
+				Timestamp:     &laterTs,
+			},
+			{
+				ID:            "stmt-5",
+				Vulnerability: vex.Vulnerability{Name: "CVE-2023-9999"},
+				Status:        vex.StatusAffected,
+				Timestamp:     &olderTs,
+			},
+			{
+				ID:            "stmt-6",
+				Vulnerability: vex.Vulnerability{Name: "CVE-2023-9999"},
+				Status:        vex.StatusUnderInvestigation,
+			},
+		},
+	}
+
+	for _, tc := range []struct {
+		name       string
+		vulnID     string
+		product    string
+		docs       []*vex.VEX
+		expectedID string
+	}{
+		{"match by name", "CVE-2023-5678", "", []*vex.VEX{doc1}, "stmt-2"},
+		{"match by alias", "GHSA-xxxx-yyyy-zzzz", "", []*vex.VEX{doc1}, "stmt-1"},
+		{"scoped to product", "CVE-2023-5678", "pkg:oci/image2", []*vex.VEX{doc1}, "stmt-2"},
+		{"product does not match", "CVE-2023-5678", "pkg:oci/image1", []*vex.VEX{doc1}, ""},
+		{"unknown vulnerability", "CVE-2020-0001", "", []*vex.VEX{doc1, doc2}, ""},
+		{"later document wins", "CVE-2023-1234", "", []*vex.VEX{doc1, doc2}, "stmt-3"},
+		{"earlier document kept if later has no data", "CVE-2023-5678", "", []*vex.VEX{doc1, doc2}, "stmt-2"},
+		{"latest statement in a document wins", "CVE-2023-9999", "", []*vex.VEX{doc3}, "stmt-4"},
+		{"no documents", "CVE-2023-1234", "", []*vex.VEX{}, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, ok := NewMatcher().Match(tc.vulnID, tc.product, tc.docs)
+			if tc.expectedID == "" {
+				require.False(t, ok)
+				require.Nil(t, s)
+				return
+			}
+			require.True(t, ok)
+			require.Equal(t, tc.expectedID, s.ID)
+		})
+	}
+}
+
+func TestMatcherMatchComponents(t *testing.T) {
+	ts := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	laterTs := ts.Add(time.Hour)
+	doc := &vex.VEX{
+		Metadata: vex.Metadata{ID: "doc", Timestamp: &ts},
+		Statements: []vex.Statement{
+			{
+				ID:            "unscoped",
+				Vulnerability: vex.Vulnerability{Name: "CVE-2023-1234"},
+				Products:      []vex.Product{{Component: vex.Component{ID: "pkg:oci/image1"}}},
+				Status:        vex.StatusAffected,
+			},
+			{
+				ID:            "scoped",
+				Vulnerability: vex.Vulnerability{Name: "CVE-2023-1234"},
+				Products: []vex.Product{{
+					Component:     vex.Component{ID: "pkg:oci/image1"},
+					Subcomponents: []vex.Subcomponent{{Component: vex.Component{ID: "pkg:golang/example.com/lib@v1.0.0"}}},
+				}},
+				Status:    vex.StatusNotAffected,
+				Timestamp: &laterTs,
+			},
+		},
+	}
+
+	for _, tc := range []struct {
+		name       string
+		components []string
+		expectedID string
+	}{
+		{"subcomponent found", []string{"pkg:golang/example.com/lib@v1.0.0"}, "scoped"},
+		{"other component", []string{"pkg:golang/example.com/other@v1.0.0"}, "unscoped"},
+		{"no components", nil, "unscoped"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, _, ok := NewMatcher().MatchComponents("CVE-2023-1234", "pkg:oci/image1", tc.components, []*vex.VEX{doc})
+			require.True(t, ok)
+			require.Equal(t, tc.expectedID, s.ID)
+		})
+	}
+
+	// Without components, subcomponents are ignored and the latest wins
+	s, ok := NewMatcher().Match("CVE-2023-1234", "pkg:oci/image1", []*vex.VEX{doc})
+	require.True(t, ok)
+	require.Equal(t, "scoped", s.ID)
+}
+
+func TestMatcherProductMatchMode(t *testing.T) {
+	doc := &vex.VEX{
+		Metadata: vex.Metadata{ID: "doc"},
+		Statements: []vex.Statement{
+			{
+				ID:            "bar",
+				Vulnerability: vex.Vulnerability{Name: "CVE-2023-1234"},
+				Products:      []vex.Product{{Component: vex.Component{ID: "pkg:golang/github.com/foo/bar@v1.0.0"}}},
+				Status:        vex.StatusNotAffected,
+			},
+		},
+	}
+
+	for _, tc := range []struct {
+		name     string
+		mode     ProductMatchMode
+		product  string
+		expected bool
+	}{
+		{"exact same version", ProductMatchExact, "pkg:golang/github.com/foo/bar@v1.0.0", true},
+		{"exact other version", ProductMatchExact, "pkg:golang/github.com/foo/bar@v1.1.0", false},
+		{"exact no version", ProductMatchExact, "pkg:golang/github.com/foo/bar", false},
+		{"default no version", "", "pkg:golang/github.com/foo/bar", false},
+		{"prefix same version", ProductMatchPurlPrefix, "pkg:golang/github.com/foo/bar@v1.0.0", true},
+		{"prefix other version", ProductMatchPurlPrefix, "pkg:golang/github.com/foo/bar@v1.1.0?goos=linux", true},
+		{"prefix no version", ProductMatchPurlPrefix, "pkg:golang/github.com/foo/bar", true},
+		{"prefix other name", ProductMatchPurlPrefix, "pkg:golang/github.com/foo/baz@v1.0.0", false},
+		{"prefix other namespace", ProductMatchPurlPrefix, "pkg:golang/github.com/bar/bar@v1.0.0", false},
+		{"prefix other type", ProductMatchPurlPrefix, "pkg:npm/bar@v1.0.0", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m := NewMatcher()
+			m.ProductMatchMode = tc.mode
+			_, ok := m.Match("CVE-2023-1234", tc.product, []*vex.VEX{doc})
+			require.Equal(t, tc.expected, ok)
+		})
+	}
+}
+
+func TestMatchVulnerability(t *testing.T) {
+	s := &vex.Statement{
+		Vulnerability: vex.Vulnerability{
+			ID:      "https://nvd.nist.gov/vuln/detail/CVE-2023-1234",
+			Name:    "CVE-2023-1234",
+			Aliases: []vex.VulnerabilityID{"GHSA-abcd-efgh-ijkl", "GO-2023-0001"},
+		},
+	}
+	for _, tc := range []struct {
+		id       string
+		expected bool
+	}{
+		{"CVE-2023-1234", true},
+		{"https://nvd.nist.gov/vuln/detail/CVE-2023-1234", true},
+		{"GHSA-abcd-efgh-ijkl", true},
+		{"ghsa-abcd-efgh-ijkl", true},
+		{"GO-2023-0001", true},
+		{" cve-2023-1234 ", true},
+		{"CVE-2023-12345", false},
+		{"GHSA-abcd-efgh-xxxx", false},
+		{"", false},
+	} {
+		t.Run(tc.id, func(t *testing.T) {
+			require.Equal(t, tc.expected, matchVulnerability(s, tc.id))
+		})
+	}
+
+	// CWEs match the vulnerability description
+	cwe := &vex.Statement{Vulnerability: vex.Vulnerability{
+		Name: "XSS-1", Description: "Cross-site scripting (CWE-79) in templates",
+	}}
+	require.True(t, matchVulnerability(cwe, "CWE-79"))
+	require.True(t, matchVulnerability(cwe, "cwe-79"))
+	require.False(t, matchVulnerability(cwe, "CWE-7"))
+	require.False(t, matchVulnerability(cwe, "CWE-798"))
+
+	// A statement keyed on the alias matches the scanner ID in its aliases
+	aliased := &vex.Statement{Vulnerability: vex.Vulnerability{
+		Name: "GHSA-abcd-efgh-ijkl", Aliases: []vex.VulnerabilityID{"CVE-2023-1234"},
+	}}
+	require.True(t, matchVulnerability(aliased, "CVE-2023-1234"))
+	require.True(t, matchVulnerability(aliased, "GHSA-abcd-efgh-ijkl"))
+}
+
+func TestBuildVulnIndex(t *testing.T) {
+	doc := &vex.VEX{Statements: []vex.Statement{
+		{ID: "stmt-1", Vulnerability: vex.Vulnerability{Name: "CVE-2023-1234", Aliases: []vex.VulnerabilityID{"GHSA-xxxx-yyyy-zzzz"}}},
+		{ID: "stmt-2", Vulnerability: vex.Vulnerability{Name: "CVE-2023-5678", Aliases: []vex.VulnerabilityID{"cve-2023-5678"}}},
+		{ID: "stmt-3", Vulnerability: vex.Vulnerability{ID: "https://osv.dev/GHSA-xxxx-yyyy-zzzz", Name: "GHSA-xxxx-yyyy-zzzz"}},
+	}}
+	idx := BuildVulnIndex(doc)
+
+	for _, tc := range []struct {
+		id       string
+		expected []string
+	}{
+		{"CVE-2023-1234", []string{"stmt-1"}},
+		{" ghsa-XXXX-yyyy-zzzz ", []string{"stmt-1", "stmt-3"}},
+		{"CVE-2023-5678", []string{"stmt-2"}},
+		{"https://osv.dev/GHSA-xxxx-yyyy-zzzz", []string{"stmt-3"}},
+		{"CVE-2023-9999", []string{}},
+	} {
+		t.Run(tc.id, func(t *testing.T) {
+			ids := []string{}
+			for _, s := range idx.Lookup(tc.id) {
+				ids = append(ids, s.ID)
+			}
+			require.Equal(t, tc.expected, ids)
+		})
+	}
+	require.Same(t, &doc.Statements[0], idx.Lookup("CVE-2023-1234")[0])
+	require.Empty(t, BuildVulnIndex(nil))
+}
+
+// BenchmarkApplyLargeReport applies a large document to a large report
+// matching the results with the statement index and, as a baseline, going
+// over all the statements for each result.
+func BenchmarkApplyLargeReport(b *testing.B) {
+	statements := []vex.Statement{}
+	for i := 0; i < 5000; i++ {
+		statements = append(statements, vex.Statement{
+			Vulnerability: vex.Vulnerability{Name: vex.VulnerabilityID(fmt.Sprintf("CVE-2023-%d", i))},
+			Products:      []vex.Product{{Component: vex.Component{ID: "pkg:oci/test"}}},
+			Status:        vex.StatusNotAffected,
+			Justification: vex.ComponentNotPresent,
+		})
+	}
+	doc := newTestDocument(statements...)
+	results := []*gosarif.Result{}
+	for i := 0; i < 2000; i++ {
+		results = append(results, newTestResult(fmt.Sprintf("CVE-2023-%d", i*5), "finding"))
+	}
+	report := newTestReport(results...)
+
+	b.Run("index", func(b *testing.B) {
+		impl := defaultVexCtlImplementation{}
+		for i := 0; i < b.N; i++ {
+			_, stats, err := impl.ApplyVEXWithStats(Options{}, report, []*vex.VEX{doc})
+			require.NoError(b, err)
+			require.Equal(b, 1000, stats.Suppressed())
+		}
+	})
+
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			suppressed := 0
+			for _, res := range report.Runs[0].Results {
+				for j := range doc.Statements {
+					if matchVulnerability(&doc.Statements[j], *res.RuleID) {
+						suppressed++
+						break
+					}
+				}
+			}
+			require.Equal(b, 1000, suppressed)
+		}
+	})
+}
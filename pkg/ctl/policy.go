@@ -0,0 +1,312 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	gosarif "github.com/owenrumney/go-sarif/sarif"
+	"sigs.k8s.io/yaml"
+
+	"github.com/openvex/go-vex/pkg/sarif"
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// Severity of a scanner finding, ordered from lowest to highest
+type Severity int
+
+const (
+	SeverityNone Severity = iota
+	SeverityLow
+	SeverityMedium
+	SeverityHigh
+	SeverityCritical
+)
+
+var severityNames = map[string]Severity{
+	"none":     SeverityNone,
+	"low":      SeverityLow,
+	"medium":   SeverityMedium,
+	"high":     SeverityHigh,
+	"critical": SeverityCritical,
+}
+
+// String returns the name of the severity
+func (s Severity) String() string {
+	for name, sev := range severityNames {
+		if sev == s {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+// Policy maps conditions found in a filtered report and its VEX data to
+// exit codes. Rules are evaluated in order and the first non-zero exit code
+// of the rules that fire is returned. Rules with exit code 0 only warn.
+type Policy struct {
+	Rules []PolicyRule `json:"rules"`
+}
+
+// PolicyRule is a single condition of a policy. Each rule must define
+// exactly one of the conditions.
+type PolicyRule struct {
+	Name     string `json:"name"`
+	ExitCode int    `json:"exitCode"`
+
+	// MinSeverity fires the rule when any finding surviving the VEX filter
+	// has this severity or higher (low, medium, high or critical).
+	MinSeverity string `json:"minSeverity,omitempty"`
+
+	// RequiredStatements lists vulnerabilities that must have a VEX
+	// statement. The rule fires when any of them is missing.
+	RequiredStatements []string `json:"requiredStatements,omitempty"`
+
+	// MaxStatementAge fires the rule when a statement is older than the
+	// duration (eg "720h").
+	MaxStatementAge *PolicyDuration `json:"maxStatementAge,omitempty"`
+}
+
+// PolicyDuration is a time.Duration read from a duration string
+type PolicyDuration struct {
+	time.Duration
+}
+
+// UnmarshalJSON parses the duration from its string form
+func (d *PolicyDuration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("durations must be strings: %w", err)
+	}
+	dur, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("parsing duration: %w", err)
+	}
+	d.Duration = dur
+	return nil
+}
+
+// MarshalJSON renders the duration as a string
+func (d PolicyDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.Duration.String())
+}
+
+// PolicyResult is the outcome of evaluating a policy
+type PolicyResult struct {
+	ExitCode int         `json:"exitCode"`
+	Fired    []FiredRule `json:"fired"`
+}
+
+// FiredRule records a policy rule that fired and why
+type FiredRule struct {
+	Rule     string   `json:"rule"`
+	ExitCode int      `json:"exitCode"`
+	Reasons  []string `json:"reasons"`
+}
+
+// LoadPolicy reads a policy from a JSON or YAML file
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading policy file: %w", err)
+	}
+
+	policy := &Policy{}
+	if err := yaml.UnmarshalStrict(data, policy); err != nil {
+		return nil, fmt.Errorf("parsing policy: %w", err)
+	}
+
+	if err := policy.Validate(); err != nil {
+		return nil, fmt.Errorf("validating policy: %w", err)
+	}
+	return policy, nil
+}
+
+// Validate checks that the policy rules are well formed
+func (p *Policy) Validate() error {
+	errs := []error{}
+	for i, r := range p.Rules {
+		conditions := 0
+		if r.MinSeverity != "" {
+			conditions++
+			if _, ok := severityNames[strings.ToLower(r.MinSeverity)]; !ok {
+				errs = append(errs, fmt.Errorf("rule #%d: invalid severity %q", i, r.MinSeverity))
+			}
+		}
+		if len(r.RequiredStatements) > 0 {
+			conditions++
+		}
+		if r.MaxStatementAge != nil {
+			conditions++
+		}
+		if conditions != 1 {
+			errs = append(errs, fmt.Errorf("rule #%d must define exactly one condition", i))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Evaluate runs the policy rules against a filtered report and the VEX
+// documents used to filter it.
+func (p *Policy) Evaluate(report *sarif.Report, docs []*vex.VEX, now time.Time) (*PolicyResult, error) {
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("validating policy: %w", err)
+	}
+
+	result := &PolicyResult{Fired: []FiredRule{}}
+	for i, r := range p.Rules {
+		var reasons []string
+		switch {
+		case r.MinSeverity != "":
+			reasons = severityReasons(report, severityNames[strings.ToLower(r.MinSeverity)])
+		case len(r.RequiredStatements) > 0:
+			reasons = missingStatementReasons(docs, r.RequiredStatements)
+		case r.MaxStatementAge != nil:
+			reasons = staleStatementReasons(docs, now.Add(-r.MaxStatementAge.Duration))
+		}
+
+		if len(reasons) == 0 {
+			continue
+		}
+
+		name := r.Name
+		if name == "" {
+			name = fmt.Sprintf("rule #%d", i)
+		}
+		if result.ExitCode == 0 {
+			result.ExitCode = r.ExitCode
+		}
+		result.Fired = append(result.Fired, FiredRule{
+			Rule: name, ExitCode: r.ExitCode, Reasons: reasons,
+		})
+	}
+	return result, nil
+}
+
+// severityReasons lists the report findings at or above a severity
+func severityReasons(report *sarif.Report, minSeverity Severity) []string {
+	reasons := []string{}
+	if report == nil {
+		return reasons
+	}
+	for _, run := range report.Runs {
+		for _, res := range run.Results {
+			sev := resultSeverity(run, res)
+			if sev < minSeverity {
+				continue
+			}
+			id := "(unknown rule)"
+			if res.RuleID != nil {
+				id = *res.RuleID
+			} else if rule := resultRule(run, res); rule != nil {
+				id = rule.ID
+			}
+			reasons = append(reasons, fmt.Sprintf("%s has severity %s", id, sev))
+		}
+	}
+	return reasons
+}
+
+// resultSeverity returns the severity of a SARIF result. The security-severity
+// score of the result's rule is preferred, falling back to the result level.
+func resultSeverity(run *gosarif.Run, res *gosarif.Result) Severity {
+	if rule := resultRule(run, res); rule != nil {
+		if score, ok := securitySeverityScore(rule.Properties); ok {
+			switch {
+			case score >= 9.0:
+				return SeverityCritical
+			case score >= 7.0:
+				return SeverityHigh
+			case score >= 4.0:
+				return SeverityMedium
+			case score > 0:
+				return SeverityLow
+			default:
+				return SeverityNone
+			}
+		}
+	}
+
+	level := "warning" // The SARIF default
+	if res.Level != nil {
+		level = *res.Level
+	}
+	switch level {
+	case "error":
+		return SeverityHigh
+	case "warning":
+		return SeverityMedium
+	case "note":
+		return SeverityLow
+	default:
+		return SeverityNone
+	}
+}
+
+// securitySeverityScore reads the security-severity property of a rule
+// which scanners write either as a string or as a number.
+func securitySeverityScore(props gosarif.Properties) (float64, bool) {
+	switch v := props["security-severity"].(type) {
+	case string:
+		score, err := strconv.ParseFloat(v, 64)
+		return score, err == nil
+	case float64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
+
+// missingStatementReasons lists the required vulnerabilities that have no
+// statement in any of the documents.
+func missingStatementReasons(docs []*vex.VEX, required []string) []string {
+	reasons := []string{}
+	for _, id := range required {
+		found := false
+		for _, doc := range docs {
+			for i := range doc.Statements {
+				if vulnerabilityMatchesID(&doc.Statements[i].Vulnerability, id) {
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			reasons = append(reasons, fmt.Sprintf("no VEX statement for %s", id))
+		}
+	}
+	return reasons
+}
+
+// staleStatementReasons lists the statements last updated before a date
+func staleStatementReasons(docs []*vex.VEX, cutoff time.Time) []string {
+	reasons := []string{}
+	for _, doc := range docs {
+		for i := range doc.Statements {
+			ts := doc.Statements[i].Timestamp
+			if doc.Statements[i].LastUpdated != nil {
+				ts = doc.Statements[i].LastUpdated
+			}
+			if ts == nil {
+				ts = doc.Timestamp
+			}
+			if ts == nil || !ts.Before(cutoff) {
+				continue
+			}
+			reasons = append(reasons, fmt.Sprintf(
+				"statement for %s in %s was last updated %s",
+				doc.Statements[i].Vulnerability.Name, doc.ID, ts.Format(time.RFC3339),
+			))
+		}
+	}
+	return reasons
+}
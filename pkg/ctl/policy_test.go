@@ -0,0 +1,147 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"testing"
+	"time"
+
+	gosarif "github.com/owenrumney/go-sarif/sarif"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+func TestLoadPolicy(t *testing.T) {
+	policy, err := LoadPolicy("testdata/policy/gate.yaml")
+	require.NoError(t, err)
+	require.Len(t, policy.Rules, 3)
+	require.Equal(t, "critical", policy.Rules[0].MinSeverity)
+	require.Equal(t, []string{"CVE-2023-1234"}, policy.Rules[1].RequiredStatements)
+	require.Equal(t, 720*time.Hour, policy.Rules[2].MaxStatementAge.Duration)
+
+	_, err = LoadPolicy("testdata/policy/invalid.json")
+	require.Error(t, err)
+}
+
+func TestResultSeverity(t *testing.T) {
+	level := func(l string) *string { return &l }
+	run := &gosarif.Run{Tool: gosarif.Tool{Driver: &gosarif.ToolComponent{
+		Rules: []*gosarif.ReportingDescriptor{
+			{ID: "CVE-2023-0001", Properties: gosarif.Properties{"security-severity": "9.8"}},
+			{ID: "CVE-2023-0002", Properties: gosarif.Properties{"security-severity": 5.3}},
+		},
+	}}}
+	for _, tc := range []struct {
+		name     string
+		result   *gosarif.Result
+		expected Severity
+	}{
+		{"string score", newTestResult("CVE-2023-0001", ""), SeverityCritical},
+		{"numeric score", newTestResult("CVE-2023-0002", ""), SeverityMedium},
+		{"level error", &gosarif.Result{Level: level("error")}, SeverityHigh},
+		{"level note", &gosarif.Result{Level: level("note")}, SeverityLow},
+		{"default level", newTestResult("CVE-2023-0003", ""), SeverityMedium},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, resultSeverity(run, tc.result))
+		})
+	}
+}
+
+func TestPolicyEvaluate(t *testing.T) {
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	recent := now.Add(-24 * time.Hour)
+	old := now.Add(-90 * 24 * time.Hour)
+
+	criticalReport := newTestReport(newTestResult("CVE-2023-0001", "critical finding"))
+	criticalReport.Runs[0].Tool.Driver.Rules = []*gosarif.ReportingDescriptor{
+		{ID: "CVE-2023-0001", Properties: gosarif.Properties{"security-severity": "9.8"}},
+	}
+	cleanReport := newTestReport()
+
+	newDoc := func(ts time.Time, vulns ...string) *vex.VEX {
+		doc := newTestDocument()
+		doc.ID = "doc"
+		doc.Timestamp = &ts
+		for _, v := range vulns {
+			doc.Statements = append(doc.Statements, vex.Statement{
+				Vulnerability: vex.Vulnerability{Name: vex.VulnerabilityID(v)},
+				Products:      []vex.Product{{Component: vex.Component{ID: "pkg:oci/test"}}},
+				Status:        vex.StatusNotAffected,
+			})
+		}
+		return doc
+	}
+
+	policy, err := LoadPolicy("testdata/policy/gate.yaml")
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name         string
+		critical     bool
+		docs         []*vex.VEX
+		expectedCode int
+		expected     []string
+	}{
+		{"nothing fires", false, []*vex.VEX{newDoc(recent, "CVE-2023-1234")}, 0, []string{}},
+		{"critical finding", true, []*vex.VEX{newDoc(recent, "CVE-2023-1234")}, 3, []string{"critical findings"}},
+		{"missing assessment", false, []*vex.VEX{newDoc(recent, "CVE-2023-9999")}, 4, []string{"required assessments"}},
+		{"stale statement", false, []*vex.VEX{newDoc(old, "CVE-2023-1234")}, 5, []string{"stale statements"}},
+		{"first failing rule wins", true, []*vex.VEX{newDoc(old, "CVE-2023-9999")}, 3, []string{"critical findings", "required assessments", "stale statements"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			report := cleanReport
+			if tc.critical {
+				report = criticalReport
+			}
+			res, err := policy.Evaluate(report, tc.docs, now)
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedCode, res.ExitCode)
+			fired := []string{}
+			for _, f := range res.Fired {
+				require.NotEmpty(t, f.Reasons)
+				fired = append(fired, f.Rule)
+			}
+			require.Equal(t, tc.expected, fired)
+		})
+	}
+}
+
+func TestPolicyEvaluateWarningRules(t *testing.T) {
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	doc := newTestDocument()
+	doc.Timestamp = &now
+
+	// A rule that only warns does not mask the failing rules after it
+	policy := &Policy{Rules: []PolicyRule{
+		{Name: "warning", ExitCode: 0, RequiredStatements: []string{"CVE-2023-0001"}},
+		{Name: "failure", ExitCode: 4, RequiredStatements: []string{"CVE-2023-0002"}},
+		{Name: "second failure", ExitCode: 5, RequiredStatements: []string{"CVE-2023-0003"}},
+	}}
+	res, err := policy.Evaluate(newTestReport(), []*vex.VEX{doc}, now)
+	require.NoError(t, err)
+	require.Len(t, res.Fired, 3)
+	require.Equal(t, 4, res.ExitCode)
+}
+
+func TestSeverityReasons(t *testing.T) {
+	index := uint(1)
+	report := newTestReport(
+		newTestResult("CVE-2023-0001", "by rule id"),
+		&gosarif.Result{RuleIndex: &index},
+	)
+	report.Runs[0].Tool.Driver.Rules = []*gosarif.ReportingDescriptor{
+		{ID: "CVE-2023-0001", Properties: gosarif.Properties{"security-severity": "9.8"}},
+		{ID: "CVE-2023-0002", Properties: gosarif.Properties{"security-severity": "7.5"}},
+	}
+
+	// Results that only reference their rule by index are named after it
+	require.Equal(t, []string{
+		"CVE-2023-0001 has severity critical",
+		"CVE-2023-0002 has severity high",
+	}, severityReasons(report, SeverityHigh))
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"fmt"
+	"strings"
+
+	purl "github.com/package-url/packageurl-go"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// ProductMatchMode controls how product identifiers are compared to the
+// products of VEX statements.
+type ProductMatchMode string
+
+const (
+	// ProductMatchExact matches products as defined by OpenVEX: purls
+	// only match when their versions and qualifiers are compatible.
+	ProductMatchExact ProductMatchMode = "exact"
+
+	// ProductMatchPurlPrefix also matches purls with the same type,
+	// namespace and name, ignoring their version, qualifiers and subpath.
+	ProductMatchPurlPrefix ProductMatchMode = "purlPrefix"
+)
+
+// validate returns an error if the mode is not known. Empty means exact.
+func (m ProductMatchMode) validate() error {
+	switch m {
+	case "", ProductMatchExact, ProductMatchPurlPrefix:
+		return nil
+	default:
+		return fmt.Errorf(
+			"unknown product match mode %q, must be %s or %s", m, ProductMatchExact, ProductMatchPurlPrefix,
+		)
+	}
+}
+
+// statementMatchesProduct returns true if the identifier matches one of
+// the statement products.
+func statementMatchesProduct(s *vex.Statement, identifier string, mode ProductMatchMode) bool {
+	for i := range s.Products {
+		if componentMatches(&s.Products[i].Component, identifier, mode) {
+			return true
+		}
+	}
+	return false
+}
+
+// componentMatches returns true if the identifier matches the component.
+// In purlPrefix mode, its purls are also compared by name.
+func componentMatches(c *vex.Component, identifier string, mode ProductMatchMode) bool {
+	if c.Matches(identifier) {
+		return true
+	}
+	if mode != ProductMatchPurlPrefix {
+		return false
+	}
+	if purlNameMatches(c.ID, identifier) {
+		return true
+	}
+	return purlNameMatches(c.Identifiers[vex.PURL], identifier)
+}
+
+// purlNameMatches returns true if both strings are purls of the same
+// package, that is, they have the same type, namespace and name.
+func purlNameMatches(purl1, purl2 string) bool {
+	if !strings.HasPrefix(purl1, "pkg:") || !strings.HasPrefix(purl2, "pkg:") {
+		return false
+	}
+	p1, err := purl.FromString(purl1)
+	if err != nil {
+		return false
+	}
+	p2, err := purl.FromString(purl2)
+	if err != nil {
+		return false
+	}
+	return p1.Type == p2.Type && p1.Namespace == p2.Namespace && p1.Name == p2.Name
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	ggcrtypes "github.com/google/go-containerregistry/pkg/v1/types"
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/sigstore/cosign/v2/pkg/cosign"
+	"github.com/sigstore/cosign/v2/pkg/types"
+	"github.com/sigstore/sigstore/pkg/signature"
+	"github.com/sigstore/sigstore/pkg/signature/dsse"
+)
+
+// ReferrerArtifactType is the artifact type of the OCI 1.1 referrer manifests
+// written when attaching attestations with Options.UseReferrers. It is set as
+// the manifest config media type and the manifest has a single layer of type
+// application/vnd.dsse.envelope.v1+json holding the DSSE envelope.
+const ReferrerArtifactType = "application/vnd.dev.openvex.attestation.v1+json"
+
+// attachReferrerToRef resolves the image reference and attaches the
+// attestation envelope to it as an OCI 1.1 referrer.
+func attachReferrerToRef(
+	ctx context.Context, opts Options, payload []byte, imageRef string, annotations map[string]string, digests *digestCache,
+) (bool, error) {
+	ref, err := parseImageReference(opts, imageRef)
+	if err != nil {
+		return false, err
+	}
+	digest, err := digests.resolve(ctx, opts, ref)
+	if err != nil {
+		return false, fmt.Errorf("resolving entity: %w", err)
+	}
+	return attachReferrer(
+		ctx, opts, payload, digest, annotations, registryOptions(opts).GetRegistryClientOpts(ctx),
+	)
+}
+
+// attachReferrer pushes the attestation envelope as an OCI 1.1 referrer of
+// the image. Registries that don't implement the referrers API get the
+// referrers tag schema index (sha256-<digest>) updated instead. Referrer
+// manifests are content addressed, with opts.SkipExisting it returns false
+// without writing when the manifest is already in the repository.
+func attachReferrer(
+	ctx context.Context, opts Options, payload []byte, digest name.Digest, annotations map[string]string,
+	remoteOpts []remote.Option,
+) (bool, error) {
+	subject, err := remote.Head(digest, append(remoteOpts, remote.WithContext(ctx))...)
+	if err != nil {
+		return false, fmt.Errorf("reading subject descriptor: %w", err)
+	}
+
+	img := mutate.MediaType(empty.Image, ggcrtypes.OCIManifestSchema1)
+	img = mutate.ConfigMediaType(img, ReferrerArtifactType)
+	img, err = mutate.Append(img, mutate.Addendum{
+		Layer: static.NewLayer(payload, ggcrtypes.MediaType(types.DssePayloadType)),
+	})
+	if err != nil {
+		return false, fmt.Errorf("adding attestation layer: %w", err)
+	}
+	img, ok := mutate.Annotations(img, annotations).(v1.Image)
+	if !ok {
+		return false, fmt.Errorf("annotating referrer manifest")
+	}
+	img, ok = mutate.Subject(img, *subject).(v1.Image)
+	if !ok {
+		return false, fmt.Errorf("setting referrer subject")
+	}
+
+	imgDigest, err := img.Digest()
+	if err != nil {
+		return false, fmt.Errorf("computing referrer digest: %w", err)
+	}
+	referrer := digest.Context().Digest(imgDigest.String())
+	if opts.SkipExisting {
+		if _, err := remote.Head(referrer, append(remoteOpts, remote.WithContext(ctx))...); err == nil {
+			opts.log().Infof("Not attaching to %s, the referrer %s already exists", digest, imgDigest)
+			return false, nil
+		}
+	}
+	if err := remote.Write(referrer, img, append(remoteOpts, remote.WithContext(ctx))...); err != nil {
+		return false, fmt.Errorf("writing referrer manifest: %w", err)
+	}
+	return true, nil
+}
+
+// referrerAttestations reads the DSSE envelopes attached to an image as
+// OCI 1.1 referrers.
+func referrerAttestations(ctx context.Context, digest name.Digest, remoteOpts []remote.Option) ([][]byte, error) {
+	opts := append(remoteOpts, remote.WithContext(ctx), remote.WithFilter("artifactType", ReferrerArtifactType))
+	idx, err := remote.Referrers(digest, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("listing referrers: %w", err)
+	}
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("reading referrers index: %w", err)
+	}
+
+	envelopes := [][]byte{}
+	for _, desc := range manifest.Manifests {
+		img, err := remote.Image(digest.Context().Digest(desc.Digest.String()), opts...)
+		if err != nil {
+			return nil, fmt.Errorf("fetching referrer %s: %w", desc.Digest, err)
+		}
+		layers, err := img.Layers()
+		if err != nil {
+			return nil, fmt.Errorf("reading referrer %s layers: %w", desc.Digest, err)
+		}
+		for _, l := range layers {
+			mt, err := l.MediaType()
+			if err != nil || string(mt) != types.DssePayloadType {
+				continue
+			}
+			rc, err := l.Uncompressed()
+			if err != nil {
+				return nil, fmt.Errorf("reading referrer %s: %w", desc.Digest, err)
+			}
+			data, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return nil, fmt.Errorf("reading referrer %s: %w", desc.Digest, err)
+			}
+			envelopes = append(envelopes, data)
+		}
+	}
+	return envelopes, nil
+}
+
+// verifyReferrerEnvelope checks the DSSE envelope signature with the
+// verifier and that the attestation is about the image.
+func verifyReferrerEnvelope(envelope []byte, verifier signature.Verifier, digest name.Digest) error {
+	if err := dsse.WrapVerifier(verifier).VerifySignature(bytes.NewReader(envelope), nil); err != nil {
+		return fmt.Errorf("verifying signature: %w", err)
+	}
+
+	payload := cosign.AttestationPayload{}
+	if err := json.Unmarshal(envelope, &payload); err != nil {
+		return fmt.Errorf("parsing envelope: %w", err)
+	}
+	data, err := base64.StdEncoding.DecodeString(payload.PayLoad)
+	if err != nil {
+		return fmt.Errorf("decoding envelope payload: %w", err)
+	}
+	statement := intoto.Statement{}
+	if err := json.Unmarshal(data, &statement); err != nil {
+		return fmt.Errorf("parsing in-toto statement: %w", err)
+	}
+
+	hex := strings.TrimPrefix(digest.DigestStr(), "sha256:")
+	for _, s := range statement.Subject {
+		if s.Digest["sha256"] == hex {
+			return nil
+		}
+	}
+	return fmt.Errorf("attestation subjects do not include %s", digest.DigestStr())
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReferrers(t *testing.T) {
+	ctx := context.Background()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	pub, err := cryptoutils.MarshalPublicKeyToPEM(&priv.PublicKey)
+	require.NoError(t, err)
+	keyPath := filepath.Join(t.TempDir(), "cosign.pub")
+	require.NoError(t, os.WriteFile(keyPath, pub, os.FileMode(0o644)))
+
+	for _, tc := range []struct {
+		name      string
+		referrers bool
+	}{
+		{"referrers API", true},
+		{"referrers tag schema", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := httptest.NewServer(registry.New(registry.WithReferrersSupport(tc.referrers)))
+			defer s.Close()
+			u, err := url.Parse(s.URL)
+			require.NoError(t, err)
+
+			ref := fmt.Sprintf("%s/test/image:latest", u.Host)
+			img, err := random.Image(1024, 1)
+			require.NoError(t, err)
+			require.NoError(t, crane.Push(img, ref))
+			d, err := img.Digest()
+			require.NoError(t, err)
+
+			att, envelope := signedTestAttestation(t, priv, "referrer", ref, d)
+			opts := Options{UseReferrers: true, VerifyKey: keyPath}
+			_, err = attachToRefs(ctx, opts, att, envelope, []string{ref}, nil, nil)
+			require.NoError(t, err)
+
+			// Nothing was written using the cosign tag scheme
+			_, err = crane.Digest(fmt.Sprintf("%s/test/image:%s-%s.att", u.Host, d.Algorithm, d.Hex))
+			require.Error(t, err)
+
+			impl := defaultVexCtlImplementation{}
+			docs, err := impl.ReadImageAttestations(ctx, opts, ref)
+			require.NoError(t, err)
+			require.Len(t, docs, 1)
+			require.Equal(t, "referrer", docs[0].ID)
+		})
+	}
+}
@@ -0,0 +1,299 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	ecr "github.com/awslabs/amazon-ecr-credential-helper/ecr-login"
+	"github.com/chrismellard/docker-credential-acr-env/pkg/credhelper"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/google"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/sigstore/cosign/v2/cmd/cosign/cli/options"
+	ociremote "github.com/sigstore/cosign/v2/pkg/oci/remote"
+)
+
+const (
+	// DefaultRetryAttempts is the number of attempts of registry operations
+	// that fail with transient errors when not set in the options.
+	DefaultRetryAttempts = 3
+
+	// DefaultRetryBackoff is the delay before the first retry of a registry
+	// operation when not set in the options.
+	DefaultRetryBackoff = time.Second
+)
+
+// defaultKeychain reads registry credentials from the docker config and
+// the ECR, GCR and ACR credential helpers.
+var defaultKeychain = authn.NewMultiKeychain(
+	authn.DefaultKeychain,
+	google.Keychain,
+	authn.NewKeychainFromHelper(ecr.NewECRHelper(ecr.WithLogger(io.Discard))),
+	authn.NewKeychainFromHelper(credhelper.NewACRCredentialsHelper()),
+)
+
+// registryOptions returns the cosign registry options to talk to registries
+// using the credentials in opts. When none are set, the credentials are
+// looked up in defaultKeychain.
+func registryOptions(opts Options) *options.RegistryOptions {
+	regOpts := &options.RegistryOptions{}
+	switch {
+	case opts.RegistryUsername != "" || opts.RegistryPassword != "":
+		regOpts.AuthConfig = authn.AuthConfig{
+			Username: opts.RegistryUsername,
+			Password: opts.RegistryPassword,
+		}
+	case opts.RegistryToken != "":
+		regOpts.AuthConfig = authn.AuthConfig{RegistryToken: opts.RegistryToken}
+	default:
+		regOpts.Keychain = defaultKeychain
+	}
+	regOpts.AllowInsecure = opts.AllowInsecure
+	regOpts.AllowHTTPRegistry = opts.PlainHTTP
+	return regOpts
+}
+
+// craneOptions returns the crane options to talk to registries with the
+// credentials and transport settings in opts.
+func craneOptions(ctx context.Context, opts Options) []crane.Option {
+	craneOpts := []crane.Option{crane.WithContext(ctx)}
+	regOpts := registryOptions(opts)
+	if regOpts.Keychain != nil {
+		craneOpts = append(craneOpts, crane.WithAuthFromKeychain(regOpts.Keychain))
+	} else {
+		craneOpts = append(craneOpts, crane.WithAuth(authn.FromConfig(regOpts.AuthConfig)))
+	}
+	if opts.PlainHTTP || opts.AllowInsecure {
+		craneOpts = append(craneOpts, crane.Insecure)
+	}
+	return craneOpts
+}
+
+// DefaultAttestationTagSuffix is the suffix cosign gives to the tags that
+// hold the attestations of an image.
+const DefaultAttestationTagSuffix = "att"
+
+var (
+	// tagPrefixRegexp matches the characters that can start a tag
+	tagPrefixRegexp = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+
+	// tagSuffixRegexp matches the characters allowed in the rest of a tag
+	tagSuffixRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+)
+
+// maxTagLength is the length limit of tags in the OCI distribution spec
+const maxTagLength = 128
+
+// AttestationTag returns the tag where the attestations of the image with
+// the digest are stored in the cosign tag scheme, using the tag prefix and
+// suffix in opts. It fails if the tag is not valid in registries.
+func AttestationTag(opts Options, digest string) (string, error) {
+	h, err := v1.NewHash(digest)
+	if err != nil {
+		return "", fmt.Errorf("parsing digest: %w", err)
+	}
+	suffix := opts.AttestationTagSuffix
+	if suffix == "" {
+		suffix = DefaultAttestationTagSuffix
+	}
+	if opts.AttestationTagPrefix != "" && !tagPrefixRegexp.MatchString(opts.AttestationTagPrefix) {
+		return "", fmt.Errorf("invalid attestation tag prefix %q", opts.AttestationTagPrefix)
+	}
+	if !tagSuffixRegexp.MatchString(suffix) {
+		return "", fmt.Errorf("invalid attestation tag suffix %q", suffix)
+	}
+	tag := fmt.Sprintf("%s%s-%s.%s", opts.AttestationTagPrefix, h.Algorithm, h.Hex, suffix)
+	if len(tag) > maxTagLength {
+		return "", fmt.Errorf("attestation tag %s is longer than %d characters", tag, maxTagLength)
+	}
+	return tag, nil
+}
+
+// attestationClientOpts returns the OCI remote options to read and write
+// the attestations of images with the cosign tag scheme, honoring the tag
+// prefix and suffix in opts.
+func attestationClientOpts(ctx context.Context, opts Options) ([]ociremote.Option, error) {
+	// Check the tags are valid with a sha256 digest, the most common
+	if _, err := AttestationTag(opts, "sha256:"+strings.Repeat("0", 64)); err != nil {
+		return nil, err
+	}
+	remoteOpts, err := registryOptions(opts).ClientOpts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting OCI remote options: %w", err)
+	}
+	if opts.AttestationTagPrefix != "" {
+		remoteOpts = append(remoteOpts, ociremote.WithPrefix(opts.AttestationTagPrefix))
+	}
+	if opts.AttestationTagSuffix != "" {
+		remoteOpts = append(remoteOpts, ociremote.WithAttestationSuffix(opts.AttestationTagSuffix))
+	}
+	return remoteOpts, nil
+}
+
+// parseImageName parses a product identifier as an image reference. Purls
+// and URLs (eg https://example.com/file.tar.gz) are rejected even if
+// name.ParseReference would accept them.
+func parseImageName(s string) (name.Reference, error) {
+	if strings.HasPrefix(s, "pkg:") || strings.Contains(s, "://") {
+		return nil, fmt.Errorf("%s is not an image reference", s)
+	}
+	return name.ParseReference(s)
+}
+
+// parseImageReference parses an image reference, allowing it to point to
+// a plain HTTP registry when opts.PlainHTTP or opts.AllowInsecure are set.
+func parseImageReference(opts Options, s string) (name.Reference, error) {
+	nameOpts := []name.Option{}
+	if opts.PlainHTTP || opts.AllowInsecure {
+		nameOpts = append(nameOpts, name.Insecure)
+	}
+	return name.ParseReference(s, nameOpts...)
+}
+
+// resolveImageDigest returns the digest reference of an image
+func resolveImageDigest(ctx context.Context, opts Options, ref name.Reference) (name.Digest, error) {
+	remoteOpts, err := registryOptions(opts).ClientOpts(ctx)
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("getting OCI remote options: %w", err)
+	}
+	var digest name.Digest
+	if err := withRetry(ctx, opts, func() (err error) {
+		digest, err = ociremote.ResolveDigest(ref, remoteOpts...)
+		return err
+	}); err != nil {
+		return name.Digest{}, registryError(ref, err)
+	}
+	return digest, nil
+}
+
+// digestCache remembers the digests image references resolve to so that
+// attaching to the same reference many times only looks it up once. Caches
+// live for a single Attach call, digests are not reused across calls as the
+// tags may be pushed again. A nil cache resolves every time.
+type digestCache struct {
+	mu      sync.Mutex
+	entries map[string]*digestEntry
+}
+
+type digestEntry struct {
+	once   sync.Once
+	digest name.Digest
+	err    error
+}
+
+func newDigestCache() *digestCache {
+	return &digestCache{entries: map[string]*digestEntry{}}
+}
+
+// resolve returns the digest of ref, looking it up in the registry the
+// first time it is seen. Concurrent calls for a reference wait for the
+// same lookup.
+func (c *digestCache) resolve(ctx context.Context, opts Options, ref name.Reference) (name.Digest, error) {
+	if c == nil {
+		return resolveImageDigest(ctx, opts, ref)
+	}
+	c.mu.Lock()
+	entry, ok := c.entries[ref.String()]
+	if !ok {
+		entry = &digestEntry{}
+		c.entries[ref.String()] = entry
+	}
+	c.mu.Unlock()
+
+	entry.once.Do(func() {
+		entry.digest, entry.err = resolveImageDigest(ctx, opts, ref)
+	})
+	return entry.digest, entry.err
+}
+
+// registryError makes the errors returned by registries when the
+// credentials are wrong or an image does not exist explicit.
+func registryError(ref name.Reference, err error) error {
+	var terr *transport.Error
+	if !errors.As(err, &terr) {
+		return err
+	}
+	switch {
+	case terr.StatusCode == http.StatusUnauthorized, terr.StatusCode == http.StatusForbidden,
+		hasDiagnostic(terr, transport.UnauthorizedErrorCode, transport.DeniedErrorCode):
+		return fmt.Errorf("unauthorized to access %s, check the registry credentials: %w", ref, err)
+	case terr.StatusCode == http.StatusNotFound,
+		hasDiagnostic(terr, transport.ManifestUnknownErrorCode, transport.NameUnknownErrorCode):
+		return fmt.Errorf("%s not found: %w", ref, err)
+	default:
+		return err
+	}
+}
+
+// hasDiagnostic checks if the registry error includes any of the codes
+func hasDiagnostic(terr *transport.Error, codes ...transport.ErrorCode) bool {
+	for _, d := range terr.Errors {
+		for _, c := range codes {
+			if d.Code == c {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// withRetry runs a registry operation, retrying it with exponential backoff
+// while it fails with transient errors, up to opts.RetryAttempts times.
+func withRetry(ctx context.Context, opts Options, op func() error) error {
+	attempts := opts.RetryAttempts
+	if attempts <= 0 {
+		attempts = DefaultRetryAttempts
+	}
+	delay := opts.RetryBackoff
+	if delay <= 0 {
+		delay = DefaultRetryBackoff
+	}
+
+	for i := 1; ; i++ {
+		err := op()
+		if err == nil || i == attempts || !isTransientError(err) {
+			return err
+		}
+		opts.log().Warnf("Registry operation failed (attempt %d/%d), retrying in %s: %v", i, attempts, delay, err)
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// isTransientError returns true for the registry errors worth retrying:
+// server errors, rate limiting, timeouts and dropped connections. Errors
+// like unauthorized or not found are final.
+func isTransientError(err error) bool {
+	var terr *transport.Error
+	if errors.As(err, &terr) {
+		return terr.StatusCode >= http.StatusInternalServerError ||
+			terr.StatusCode == http.StatusTooManyRequests ||
+			terr.StatusCode == http.StatusRequestTimeout
+	}
+	var nerr net.Error
+	if errors.As(err, &nerr) && nerr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) || errors.Is(err, io.ErrUnexpectedEOF)
+}
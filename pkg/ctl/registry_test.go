@@ -0,0 +1,296 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryOptions(t *testing.T) {
+	for m, tc := range map[string]struct {
+		opts        Options
+		auth        authn.AuthConfig
+		useKeychain bool
+	}{
+		"default keychain": {
+			opts:        Options{},
+			useKeychain: true,
+		},
+		"username and password": {
+			opts: Options{RegistryUsername: "user", RegistryPassword: "pass"},
+			auth: authn.AuthConfig{Username: "user", Password: "pass"},
+		},
+		"token": {
+			opts: Options{RegistryToken: "token"},
+			auth: authn.AuthConfig{RegistryToken: "token"},
+		},
+	} {
+		regOpts := registryOptions(tc.opts)
+		require.Equal(t, tc.auth, regOpts.AuthConfig, m)
+		require.Equal(t, tc.useKeychain, regOpts.Keychain != nil, m)
+	}
+}
+
+func TestRegistryAuth(t *testing.T) {
+	ctx := context.Background()
+	reg := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "pass" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	imageRef := fmt.Sprintf("%s/test/image:latest", u.Host)
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	require.NoError(t, crane.Push(img, imageRef, crane.WithAuth(&authn.Basic{Username: "user", Password: "pass"})))
+	d, err := img.Digest()
+	require.NoError(t, err)
+
+	for m, tc := range map[string]struct {
+		ref     string
+		opts    Options
+		mustErr string
+	}{
+		"credentials": {
+			ref:  imageRef,
+			opts: Options{RegistryUsername: "user", RegistryPassword: "pass"},
+		},
+		"wrong credentials": {
+			ref:     imageRef,
+			opts:    Options{RegistryUsername: "user", RegistryPassword: "wrong"},
+			mustErr: "unauthorized to access",
+		},
+		"no credentials": {
+			ref:     imageRef,
+			mustErr: "unauthorized to access",
+		},
+		"not found": {
+			ref:     fmt.Sprintf("%s/test/missing:latest", u.Host),
+			opts:    Options{RegistryUsername: "user", RegistryPassword: "pass"},
+			mustErr: "not found",
+		},
+	} {
+		ref, err := name.ParseReference(tc.ref)
+		require.NoError(t, err, m)
+		digest, err := resolveImageDigest(ctx, tc.opts, ref)
+		if tc.mustErr != "" {
+			require.ErrorContains(t, err, tc.mustErr, m)
+			continue
+		}
+		require.NoError(t, err, m)
+		require.Equal(t, d.String(), digest.DigestStr(), m)
+	}
+}
+
+func TestInsecureRegistry(t *testing.T) {
+	ctx := context.Background()
+	s := httptest.NewTLSServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	imageRef := fmt.Sprintf("%s/test/image:latest", u.Host)
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	require.NoError(t, crane.Push(img, imageRef, crane.Insecure))
+	d, err := img.Digest()
+	require.NoError(t, err)
+
+	for m, tc := range map[string]struct {
+		opts    Options
+		mustErr bool
+	}{
+		"verify TLS":   {Options{}, true},
+		"insecure TLS": {Options{AllowInsecure: true}, false},
+	} {
+		ref, err := parseImageReference(tc.opts, imageRef)
+		require.NoError(t, err, m)
+		digest, err := resolveImageDigest(ctx, tc.opts, ref)
+		if tc.mustErr {
+			require.Error(t, err, m)
+			continue
+		}
+		require.NoError(t, err, m)
+		require.Equal(t, d.String(), digest.DigestStr(), m)
+	}
+}
+
+func TestParseImageReference(t *testing.T) {
+	for m, tc := range map[string]struct {
+		opts   Options
+		scheme string
+	}{
+		"default":        {Options{}, "https"},
+		"plain HTTP":     {Options{PlainHTTP: true}, "http"},
+		"allow insecure": {Options{AllowInsecure: true}, "http"},
+	} {
+		ref, err := parseImageReference(tc.opts, "registry.example.com/test/image:latest")
+		require.NoError(t, err, m)
+		require.Equal(t, tc.scheme, ref.Context().Scheme(), m)
+	}
+}
+
+func TestAttestationTag(t *testing.T) {
+	hex := strings.Repeat("ab", 32)
+	digest := "sha256:" + hex
+	for m, tc := range map[string]struct {
+		opts     Options
+		digest   string
+		expected string
+	}{
+		"default":            {Options{}, digest, "sha256-" + hex + ".att"},
+		"suffix":             {Options{AttestationTagSuffix: "vex"}, digest, "sha256-" + hex + ".vex"},
+		"prefix and suffix":  {Options{AttestationTagPrefix: "attestations-", AttestationTagSuffix: "v"}, digest, "attestations-sha256-" + hex + ".v"},
+		"invalid suffix":     {Options{AttestationTagSuffix: "vex/att"}, digest, ""},
+		"invalid prefix":     {Options{AttestationTagPrefix: ".vex"}, digest, ""},
+		"too long":           {Options{AttestationTagSuffix: strings.Repeat("a", 57)}, digest, ""},
+		"longest suffix":     {Options{AttestationTagSuffix: strings.Repeat("a", 56)}, digest, "sha256-" + hex + "." + strings.Repeat("a", 56)},
+		"invalid digest":     {Options{}, "sha256:1234", ""},
+		"sha512 with suffix": {Options{AttestationTagSuffix: "a"}, "sha512:" + hex + hex, ""},
+	} {
+		tag, err := AttestationTag(tc.opts, tc.digest)
+		if tc.expected == "" {
+			require.Error(t, err, m)
+			continue
+		}
+		require.NoError(t, err, m)
+		require.Equal(t, tc.expected, tag, m)
+		_, err = name.NewTag("registry.example.com/test/image:"+tag, name.StrictValidation)
+		require.NoError(t, err, m)
+	}
+}
+
+func TestAttachAttestationTagSuffix(t *testing.T) {
+	ctx := context.Background()
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	ref := fmt.Sprintf("%s/test/image:latest", u.Host)
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	require.NoError(t, crane.Push(img, ref))
+	d, err := img.Digest()
+	require.NoError(t, err)
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	opts := Options{AttestationTagPrefix: "vex-", AttestationTagSuffix: "openvex"}
+	att, envelope := signedTestAttestation(t, priv, "custom-tag", ref, d)
+	_, err = attachAttestation(ctx, opts, att, envelope, ref, nil, nil)
+	require.NoError(t, err)
+
+	expected, err := AttestationTag(opts, d.String())
+	require.NoError(t, err)
+	require.Equal(t, "vex-sha256-"+d.Hex+".openvex", expected)
+	tags, err := crane.ListTags(fmt.Sprintf("%s/test/image", u.Host))
+	require.NoError(t, err)
+	require.Contains(t, tags, expected)
+	require.NotContains(t, tags, "sha256-"+d.Hex+".att")
+
+	// Reading finds the attestation only with the same tag scheme
+	impl := defaultVexCtlImplementation{}
+	opts.SkipVerify = true
+	docs, err := impl.ReadImageAttestations(ctx, opts, ref)
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	require.Equal(t, "custom-tag", docs[0].ID)
+
+	docs, err = impl.ReadImageAttestations(ctx, Options{SkipVerify: true}, ref)
+	require.NoError(t, err)
+	require.Empty(t, docs)
+
+	_, err = attachAttestation(ctx, Options{AttestationTagSuffix: "bad/suffix"}, att, envelope, ref, nil, nil)
+	require.Error(t, err)
+}
+
+// flakyTransport fails the first manifest requests with a status code
+type flakyTransport struct {
+	failures int32
+	status   int
+	requests atomic.Int32
+}
+
+func (ft *flakyTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if !strings.Contains(r.URL.Path, "/manifests/") {
+		return http.DefaultTransport.RoundTrip(r)
+	}
+	if ft.requests.Add(1) <= ft.failures {
+		return &http.Response{
+			StatusCode: ft.status,
+			Body:       io.NopCloser(strings.NewReader("")),
+			Request:    r,
+		}, nil
+	}
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestWithRetry(t *testing.T) {
+	ctx := context.Background()
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	imageRef := fmt.Sprintf("%s/test/image:latest", u.Host)
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	require.NoError(t, crane.Push(img, imageRef))
+	ref, err := name.ParseReference(imageRef)
+	require.NoError(t, err)
+
+	for m, tc := range map[string]struct {
+		transport *flakyTransport
+		attempts  int
+		mustErr   bool
+		requests  int32
+	}{
+		"succeeds on the third try": {&flakyTransport{failures: 2, status: http.StatusTooManyRequests}, 3, false, 3},
+		"out of attempts":           {&flakyTransport{failures: 3, status: http.StatusTooManyRequests}, 3, true, 3},
+		"unauthorized not retried":  {&flakyTransport{failures: 2, status: http.StatusUnauthorized}, 3, true, 1},
+		"not found not retried":     {&flakyTransport{failures: 2, status: http.StatusNotFound}, 3, true, 1},
+	} {
+		opts := Options{RetryAttempts: tc.attempts, RetryBackoff: time.Millisecond}
+		err := withRetry(ctx, opts, func() error {
+			_, err := remote.Head(ref, remote.WithTransport(tc.transport))
+			return err
+		})
+		if tc.mustErr {
+			require.Error(t, err, m)
+		} else {
+			require.NoError(t, err, m)
+		}
+		require.Equal(t, tc.requests, tc.transport.requests.Load(), m)
+	}
+}
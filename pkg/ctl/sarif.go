@@ -0,0 +1,53 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/openvex/go-vex/pkg/sarif"
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// GenerateFromSARIF seeds a VEX document from a scanner report. It has an
+// under_investigation statement about productID for each distinct
+// vulnerability found in the report, identified from the rule IDs the same
+// way they are when applying VEX data to the report. Results without a
+// recognized vulnerability ID are skipped.
+func GenerateFromSARIF(report *sarif.Report, productID string) (*vex.VEX, error) {
+	if report == nil {
+		return nil, errors.New("sarif report is nil")
+	}
+	if productID == "" {
+		return nil, errors.New("a product ID is required to generate statements")
+	}
+
+	vulns := map[string]struct{}{}
+	for _, run := range report.Runs {
+		if run == nil {
+			continue
+		}
+		for _, res := range run.Results {
+			if id := resultVulnerabilityID(Options{}, run, res); id != "" {
+				vulns[id] = struct{}{}
+			}
+		}
+	}
+
+	doc := vex.New()
+	for _, id := range sortedKeys(vulns) {
+		doc.Statements = append(doc.Statements, vex.Statement{
+			Vulnerability: vex.Vulnerability{Name: vex.VulnerabilityID(id)},
+			Products:      []vex.Product{{Component: vex.Component{ID: productID}}},
+			Status:        vex.StatusUnderInvestigation,
+		})
+	}
+	if _, err := doc.GenerateCanonicalID(); err != nil {
+		return nil, fmt.Errorf("generating document ID: %w", err)
+	}
+	return &doc, nil
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/openvex/go-vex/pkg/sarif"
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+func TestGenerateFromSARIF(t *testing.T) {
+	report := newTestReport(
+		newTestResult("CVE-2023-12345", "openssl finding"),
+		newTestResult("CVE-2023-12345-libssl3", "the same vulnerability in another package"),
+		newTestResult("GHSA-7rjr-3q55-vv33", "log4j finding"),
+		newTestResult("CVE-2022-0001", "older finding"),
+		newTestResult("unused-variable", "not a vulnerability"),
+	)
+
+	doc, err := GenerateFromSARIF(report, "pkg:oci/nginx@sha256:74634d9736a45ca9f6e1187e783492199e020f4a5c19d0b1abc2b604f894ac99")
+	require.NoError(t, err)
+	require.NotEmpty(t, doc.ID)
+	require.Empty(t, Validate(doc))
+
+	ids := []string{}
+	for _, s := range doc.Statements {
+		ids = append(ids, string(s.Vulnerability.Name))
+		require.Equal(t, vex.StatusUnderInvestigation, s.Status)
+		require.Len(t, s.Products, 1)
+		require.Equal(t, "pkg:oci/nginx@sha256:74634d9736a45ca9f6e1187e783492199e020f4a5c19d0b1abc2b604f894ac99", s.Products[0].ID)
+	}
+	require.Equal(t, []string{"CVE-2022-0001", "CVE-2023-12345", "GHSA-7rjr-3q55-vv33"}, ids)
+
+	// The generated document suppresses nothing until it is triaged
+	vexctl := New()
+	filtered, err := vexctl.Apply(report, []*vex.VEX{doc})
+	require.NoError(t, err)
+	require.Len(t, filtered.Runs[0].Results, 5)
+
+	_, err = GenerateFromSARIF(nil, "pkg:oci/nginx")
+	require.Error(t, err)
+	_, err = GenerateFromSARIF(sarif.New(), "")
+	require.Error(t, err)
+}
@@ -0,0 +1,406 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// cdxComponent is the subset of a CycloneDX component needed to index it
+type cdxComponent struct {
+	BOMRef     string         `json:"bom-ref"`
+	PURL       string         `json:"purl"`
+	CPE        string         `json:"cpe"`
+	Components []cdxComponent `json:"components"`
+}
+
+// sbomDocument captures the fields of CycloneDX and SPDX JSON documents
+// used to look up components.
+type sbomDocument struct {
+	// CycloneDX
+	BOMFormat    string `json:"bomFormat"`
+	SerialNumber string `json:"serialNumber"`
+	Version      int    `json:"version"`
+	Metadata     *struct {
+		Timestamp string        `json:"timestamp"`
+		Component *cdxComponent `json:"component"`
+	} `json:"metadata"`
+	Components      []cdxComponent     `json:"components"`
+	Vulnerabilities []cdxVulnerability `json:"vulnerabilities"`
+
+	// SPDX
+	SPDXVersion string `json:"spdxVersion"`
+	Packages    []struct {
+		SPDXID       string `json:"SPDXID"`
+		ExternalRefs []struct {
+			ReferenceLocator string `json:"referenceLocator"`
+		} `json:"externalRefs"`
+	} `json:"packages"`
+
+	// SPDX 3 JSON-LD
+	Context json.RawMessage `json:"@context"`
+	Graph   []spdxElement   `json:"@graph"`
+}
+
+// cdxVulnerability is the subset of a CycloneDX vulnerability holding its
+// VEX analysis.
+type cdxVulnerability struct {
+	ID          string `json:"id"`
+	Description string `json:"description"`
+	Published   string `json:"published"`
+	Updated     string `json:"updated"`
+	References  []struct {
+		ID string `json:"id"`
+	} `json:"references"`
+	Analysis *struct {
+		State         string   `json:"state"`
+		Justification string   `json:"justification"`
+		Response      []string `json:"response"`
+		Detail        string   `json:"detail"`
+		LastUpdated   string   `json:"lastUpdated"`
+	} `json:"analysis"`
+	Affects []struct {
+		Ref string `json:"ref"`
+	} `json:"affects"`
+}
+
+// spdxElement is the subset of the SPDX 3 elements describing packages,
+// vulnerabilities and the VEX assessments relating them.
+type spdxElement struct {
+	Type               string `json:"type"`
+	SPDXID             string `json:"spdxId"`
+	PackageURL         string `json:"software_packageUrl"`
+	ExternalIdentifier []struct {
+		Type       string `json:"externalIdentifierType"`
+		Identifier string `json:"identifier"`
+	} `json:"externalIdentifier"`
+	From            string   `json:"from"`
+	To              []string `json:"to"`
+	Justification   string   `json:"security_justificationType"`
+	ImpactStatement string   `json:"security_impactStatement"`
+	ActionStatement string   `json:"security_actionStatement"`
+	StatusNotes     string   `json:"security_statusNotes"`
+	PublishedTime   string   `json:"security_publishedTime"`
+}
+
+// cdxStatuses maps the CycloneDX analysis states to VEX statuses
+var cdxStatuses = map[string]vex.Status{
+	"resolved":               vex.StatusFixed,
+	"resolved_with_pedigree": vex.StatusFixed,
+	"exploitable":            vex.StatusAffected,
+	"in_triage":              vex.StatusUnderInvestigation,
+	"false_positive":         vex.StatusNotAffected,
+	"not_affected":           vex.StatusNotAffected,
+}
+
+// cdxJustifications maps the CycloneDX analysis justifications to the
+// closest VEX justification.
+var cdxJustifications = map[string]vex.Justification{
+	"code_not_present":                vex.VulnerableCodeNotPresent,
+	"code_not_reachable":              vex.VulnerableCodeNotInExecutePath,
+	"requires_configuration":          vex.VulnerableCodeCannotBeControlledByAdversary,
+	"requires_dependency":             vex.ComponentNotPresent,
+	"requires_environment":            vex.VulnerableCodeCannotBeControlledByAdversary,
+	"protected_by_compiler":           vex.InlineMitigationsAlreadyExist,
+	"protected_at_runtime":            vex.InlineMitigationsAlreadyExist,
+	"protected_at_perimeter":          vex.InlineMitigationsAlreadyExist,
+	"protected_by_mitigating_control": vex.InlineMitigationsAlreadyExist,
+}
+
+// spdxStatuses maps the SPDX 3 VEX assessment types to VEX statuses
+var spdxStatuses = map[string]vex.Status{
+	"security_VexAffectedVulnAssessmentRelationship":           vex.StatusAffected,
+	"security_VexFixedVulnAssessmentRelationship":              vex.StatusFixed,
+	"security_VexNotAffectedVulnAssessmentRelationship":        vex.StatusNotAffected,
+	"security_VexUnderInvestigationVulnAssessmentRelationship": vex.StatusUnderInvestigation,
+}
+
+// spdxJustifications maps the SPDX 3 justification types to VEX
+// justifications.
+var spdxJustifications = map[string]vex.Justification{
+	"componentNotPresent":                         vex.ComponentNotPresent,
+	"vulnerableCodeNotPresent":                    vex.VulnerableCodeNotPresent,
+	"vulnerableCodeNotInExecutePath":              vex.VulnerableCodeNotInExecutePath,
+	"vulnerableCodeCannotBeControlledByAdversary": vex.VulnerableCodeCannotBeControlledByAdversary,
+	"inlineMitigationsAlreadyExist":               vex.InlineMitigationsAlreadyExist,
+}
+
+// VerifySubcomponentsInSBOM returns the subcomponents referenced in the
+// document statements that cannot be found in the SBOM at sbomPath.
+// Subcomponents are looked up by their ID and identifiers (purl, cpe)
+// against the CycloneDX bom-refs, purls and cpes or the SPDX IDs and
+// external references. Only JSON SBOMs are supported.
+func VerifySubcomponentsInSBOM(doc *vex.VEX, sbomPath string) ([]string, error) {
+	if doc == nil {
+		return nil, errors.New("cannot verify subcomponents, vex document is nil")
+	}
+
+	data, err := os.ReadFile(sbomPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading SBOM: %w", err)
+	}
+
+	index, err := indexSBOM(data)
+	if err != nil {
+		return nil, fmt.Errorf("indexing SBOM %s: %w", sbomPath, err)
+	}
+
+	missing := map[string]struct{}{}
+	for _, s := range doc.Statements {
+		for _, p := range s.Products {
+			for i := range p.Subcomponents {
+				if !index.contains(&p.Subcomponents[i].Component) {
+					missing[productIdentifier(&p.Subcomponents[i].Component)] = struct{}{}
+				}
+			}
+		}
+	}
+
+	ret := []string{}
+	for id := range missing {
+		ret = append(ret, id)
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// sbomIndex is the set of identifiers found in an SBOM
+type sbomIndex map[string]struct{}
+
+// contains returns true if any of the component identifiers is in the SBOM
+func (idx sbomIndex) contains(c *vex.Component) bool {
+	if _, ok := idx[c.ID]; ok && c.ID != "" {
+		return true
+	}
+	for _, id := range c.Identifiers {
+		if _, ok := idx[id]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// indexSBOM parses a CycloneDX or SPDX JSON document and returns the
+// identifiers of its components.
+func indexSBOM(data []byte) (sbomIndex, error) {
+	doc := sbomDocument{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parsing SBOM json: %w", err)
+	}
+
+	idx := sbomIndex{}
+	add := func(ids ...string) {
+		for _, id := range ids {
+			if id != "" {
+				idx[id] = struct{}{}
+			}
+		}
+	}
+
+	switch {
+	case doc.BOMFormat == "CycloneDX":
+		var walk func([]cdxComponent)
+		walk = func(components []cdxComponent) {
+			for _, c := range components {
+				add(c.BOMRef, c.PURL, c.CPE)
+				walk(c.Components)
+			}
+		}
+		if doc.Metadata != nil && doc.Metadata.Component != nil {
+			walk([]cdxComponent{*doc.Metadata.Component})
+		}
+		walk(doc.Components)
+	case doc.SPDXVersion != "":
+		for _, p := range doc.Packages {
+			add(p.SPDXID)
+			for _, ref := range p.ExternalRefs {
+				add(ref.ReferenceLocator)
+			}
+		}
+	default:
+		return nil, errors.New("unable to recognize SBOM format (CycloneDX or SPDX JSON)")
+	}
+	return idx, nil
+}
+
+// LoadFromSBOM reads the VEX data embedded in the SBOM at path. The
+// analysis of the vulnerabilities in CycloneDX documents and the VEX
+// assessments in SPDX 3 documents are turned into OpenVEX statements about
+// the purls of the affected components. The statements are returned in a
+// single document, SBOMs without VEX data return no documents. SPDX 2
+// documents cannot carry VEX data. Only JSON SBOMs are supported.
+func LoadFromSBOM(path string) ([]*vex.VEX, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading SBOM: %w", err)
+	}
+	sbom := sbomDocument{}
+	if err := json.Unmarshal(data, &sbom); err != nil {
+		return nil, fmt.Errorf("parsing SBOM json: %w", err)
+	}
+
+	var statements []vex.Statement
+	switch {
+	case sbom.BOMFormat == "CycloneDX":
+		statements = sbom.cdxStatements()
+	case bytes.Contains(sbom.Context, []byte("spdx.org/rdf/3")):
+		statements = sbom.spdxStatements()
+	case sbom.SPDXVersion != "":
+		return []*vex.VEX{}, nil
+	default:
+		return nil, errors.New("unable to recognize SBOM format (CycloneDX or SPDX JSON)")
+	}
+
+	if len(statements) == 0 {
+		return []*vex.VEX{}, nil
+	}
+	doc := vex.New()
+	doc.Statements = statements
+	if _, err := doc.GenerateCanonicalID(); err != nil {
+		return nil, fmt.Errorf("generating document ID: %w", err)
+	}
+	return []*vex.VEX{&doc}, nil
+}
+
+// cdxStatements returns the statements from the analysis of the
+// vulnerabilities in a CycloneDX SBOM. Vulnerabilities without analysis
+// are scan findings, not VEX data, and are skipped.
+func (sbom *sbomDocument) cdxStatements() []vex.Statement {
+	purls := map[string]string{}
+	var walk func([]cdxComponent)
+	walk = func(components []cdxComponent) {
+		for _, c := range components {
+			if c.BOMRef != "" && c.PURL != "" {
+				purls[c.BOMRef] = c.PURL
+			}
+			walk(c.Components)
+		}
+	}
+	if sbom.Metadata != nil && sbom.Metadata.Component != nil {
+		walk([]cdxComponent{*sbom.Metadata.Component})
+	}
+	walk(sbom.Components)
+
+	statements := []vex.Statement{}
+	for _, v := range sbom.Vulnerabilities {
+		if v.Analysis == nil || cdxStatuses[v.Analysis.State] == "" || len(v.Affects) == 0 {
+			continue
+		}
+		s := vex.Statement{
+			Vulnerability: vex.Vulnerability{Name: vex.VulnerabilityID(v.ID), Description: v.Description},
+			Status:        cdxStatuses[v.Analysis.State],
+			Timestamp:     parseSBOMTime(v.Analysis.LastUpdated, v.Updated, v.Published),
+		}
+		for _, r := range v.References {
+			if r.ID != "" && r.ID != v.ID {
+				s.Vulnerability.Aliases = append(s.Vulnerability.Aliases, vex.VulnerabilityID(r.ID))
+			}
+		}
+		for _, a := range v.Affects {
+			id := a.Ref
+			// BOM-Links point to a bom-ref after the #
+			if i := strings.LastIndex(id, "#"); i >= 0 && strings.HasPrefix(id, "urn:cdx:") {
+				id = id[i+1:]
+			}
+			if purl, ok := purls[id]; ok {
+				id = purl
+			}
+			s.Products = append(s.Products, vex.Product{Component: vex.Component{ID: id}})
+		}
+		switch s.Status {
+		case vex.StatusNotAffected:
+			s.Justification = cdxJustifications[v.Analysis.Justification]
+			s.ImpactStatement = v.Analysis.Detail
+			if s.Justification == "" && s.ImpactStatement == "" {
+				s.ImpactStatement = fmt.Sprintf("CycloneDX analysis state: %s", v.Analysis.State)
+			}
+		case vex.StatusAffected:
+			s.ActionStatement = v.Analysis.Detail
+			if s.ActionStatement == "" {
+				s.ActionStatement = strings.Join(v.Analysis.Response, ", ")
+			}
+		default:
+			s.StatusNotes = v.Analysis.Detail
+		}
+		statements = append(statements, s)
+	}
+	return statements
+}
+
+// spdxStatements returns the statements from the VEX assessments in an
+// SPDX 3 SBOM.
+func (sbom *sbomDocument) spdxStatements() []vex.Statement {
+	purls := map[string]string{}
+	vulns := map[string]string{}
+	for _, e := range sbom.Graph {
+		if e.PackageURL != "" {
+			purls[e.SPDXID] = e.PackageURL
+		}
+		if e.Type == "security_Vulnerability" {
+			// Prefer the CVE ID, then any external identifier
+			name := e.SPDXID
+			for _, id := range e.ExternalIdentifier {
+				if id.Type == "cve" {
+					name = id.Identifier
+					break
+				}
+				if name == e.SPDXID {
+					name = id.Identifier
+				}
+			}
+			vulns[e.SPDXID] = name
+		}
+	}
+
+	statements := []vex.Statement{}
+	for _, e := range sbom.Graph {
+		status, ok := spdxStatuses[e.Type]
+		if !ok {
+			continue
+		}
+		name := e.From
+		if id, ok := vulns[e.From]; ok {
+			name = id
+		}
+		s := vex.Statement{
+			Vulnerability:   vex.Vulnerability{Name: vex.VulnerabilityID(name)},
+			Status:          status,
+			Timestamp:       parseSBOMTime(e.PublishedTime),
+			Justification:   spdxJustifications[e.Justification],
+			ImpactStatement: e.ImpactStatement,
+			ActionStatement: e.ActionStatement,
+			StatusNotes:     e.StatusNotes,
+		}
+		for _, to := range e.To {
+			id := to
+			if purl, ok := purls[to]; ok {
+				id = purl
+			}
+			s.Products = append(s.Products, vex.Product{Component: vex.Component{ID: id}})
+		}
+		statements = append(statements, s)
+	}
+	return statements
+}
+
+// parseSBOMTime returns the first of the timestamps that can be parsed
+func parseSBOMTime(timestamps ...string) *time.Time {
+	for _, ts := range timestamps {
+		if t, err := time.Parse(time.RFC3339, ts); err == nil {
+			return &t
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+func TestVerifySubcomponentsInSBOM(t *testing.T) {
+	subcomponentsDoc := func(subs ...vex.Component) *vex.VEX {
+		product := vex.Product{Component: vex.Component{ID: "pkg:oci/test"}}
+		for _, c := range subs {
+			product.Subcomponents = append(product.Subcomponents, vex.Subcomponent{Component: c})
+		}
+		return newTestDocument(vex.Statement{
+			Vulnerability: vex.Vulnerability{Name: "CVE-2023-12345"},
+			Products:      []vex.Product{product},
+			Status:        vex.StatusNotAffected,
+		})
+	}
+
+	for _, tc := range []struct {
+		name     string
+		sbom     string
+		doc      *vex.VEX
+		expected []string
+		mustErr  bool
+	}{
+		{
+			name:     "cyclonedx, all present",
+			sbom:     "testdata/sbom/image.cdx.json",
+			doc:      subcomponentsDoc(vex.Component{ID: "pkg:apk/wolfi/openssl@3.1.1"}, vex.Component{ID: "pkg:apk/wolfi/libcrypto3@3.1.1"}),
+			expected: []string{},
+		},
+		{
+			name: "cyclonedx, matched by identifier",
+			sbom: "testdata/sbom/image.cdx.json",
+			doc: subcomponentsDoc(vex.Component{
+				Identifiers: map[vex.IdentifierType]string{vex.CPE23: "cpe:2.3:a:gnu:glibc:2.37:*:*:*:*:*:*:*"},
+			}),
+			expected: []string{},
+		},
+		{
+			name:     "cyclonedx, typo in subcomponent",
+			sbom:     "testdata/sbom/image.cdx.json",
+			doc:      subcomponentsDoc(vex.Component{ID: "pkg:apk/wolfi/openssl@3.1.1"}, vex.Component{ID: "pkg:apk/wolfi/opensll@3.1.1"}),
+			expected: []string{"pkg:apk/wolfi/opensll@3.1.1"},
+		},
+		{
+			name:     "spdx, all present",
+			sbom:     "testdata/sbom/image.spdx.json",
+			doc:      subcomponentsDoc(vex.Component{ID: "pkg:apk/wolfi/openssl@3.1.1"}, vex.Component{ID: "SPDXRef-Package-glibc"}),
+			expected: []string{},
+		},
+		{
+			name:     "spdx, missing subcomponents",
+			sbom:     "testdata/sbom/image.spdx.json",
+			doc:      subcomponentsDoc(vex.Component{ID: "pkg:apk/wolfi/libcrypto3@3.1.1"}, vex.Component{ID: "pkg:apk/wolfi/busybox@1.36"}),
+			expected: []string{"pkg:apk/wolfi/busybox@1.36", "pkg:apk/wolfi/libcrypto3@3.1.1"},
+		},
+		{
+			name:    "not an sbom",
+			sbom:    "testdata/test.vex.json",
+			doc:     subcomponentsDoc(),
+			mustErr: true,
+		},
+		{
+			name:    "sbom does not exist",
+			sbom:    "testdata/sbom/missing.json",
+			doc:     subcomponentsDoc(),
+			mustErr: true,
+		},
+		{
+			name:    "nil document",
+			sbom:    "testdata/sbom/image.cdx.json",
+			mustErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			missing, err := VerifySubcomponentsInSBOM(tc.doc, tc.sbom)
+			if tc.mustErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, missing)
+		})
+	}
+}
+
+func TestLoadFromSBOM(t *testing.T) {
+	ts := time.Date(2023, 12, 1, 10, 0, 0, 0, time.UTC)
+	embedded := []vex.Statement{
+		{
+			Vulnerability:   vex.Vulnerability{Name: "CVE-2023-1234"},
+			Products:        []vex.Product{{Component: vex.Component{ID: "pkg:oci/test"}}},
+			Status:          vex.StatusNotAffected,
+			Timestamp:       &ts,
+			Justification:   vex.VulnerableCodeNotInExecutePath,
+			ImpactStatement: "The vulnerable function is never called",
+		},
+		{
+			Vulnerability:   vex.Vulnerability{Name: "CVE-2023-5678"},
+			Products:        []vex.Product{{Component: vex.Component{ID: "pkg:apk/wolfi/openssl@3.1.1"}}},
+			Status:          vex.StatusAffected,
+			ActionStatement: "update",
+		},
+	}
+
+	for _, tc := range []struct {
+		name     string
+		sbom     string
+		expected []vex.Statement
+		mustErr  bool
+	}{
+		{"cyclonedx", "testdata/sbom/vex.cdx.json", embedded, false},
+		{"spdx 3", "testdata/sbom/vex.spdx.json", embedded, false},
+		{"cyclonedx without vex data", "testdata/sbom/image.cdx.json", nil, false},
+		{"spdx 2", "testdata/sbom/image.spdx.json", nil, false},
+		{"not an sbom", "testdata/test.vex.json", nil, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			docs, err := LoadFromSBOM(tc.sbom)
+			if tc.mustErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			if tc.expected == nil {
+				require.Empty(t, docs)
+				return
+			}
+			require.Len(t, docs, 1)
+			require.NotEmpty(t, docs[0].ID)
+			require.Equal(t, tc.expected, docs[0].Statements)
+		})
+	}
+}
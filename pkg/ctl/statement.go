@@ -0,0 +1,40 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// AddStatement validates the statement and appends it to the document.
+// Statements without a timestamp take the one of the document, or the
+// current time when it has none. The document LastUpdated time is bumped.
+func AddStatement(doc *vex.VEX, s vex.Statement) error {
+	if doc == nil {
+		return errors.New("cannot add statement, vex document is nil")
+	}
+
+	now := time.Now()
+	if s.Timestamp == nil {
+		ts := now
+		if doc.Timestamp != nil {
+			ts = *doc.Timestamp
+		}
+		s.Timestamp = &ts
+	}
+
+	if errs := validateStatement(&s, true); len(errs) > 0 {
+		return fmt.Errorf("invalid statement: %w", errors.Join(errs...))
+	}
+
+	doc.Statements = append(doc.Statements, s)
+	doc.LastUpdated = &now
+	return nil
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+func TestAddStatement(t *testing.T) {
+	docTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	stmtTime := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	product := []vex.Product{{Component: vex.Component{ID: "pkg:apk/wolfi/bash@1.0.0"}}}
+
+	for _, tc := range []struct {
+		name         string
+		docTime      *time.Time
+		statement    vex.Statement
+		expectedTime *time.Time
+		shouldErr    bool
+	}{
+		{
+			name:    "inherits the document timestamp",
+			docTime: &docTime,
+			statement: vex.Statement{
+				Vulnerability: vex.Vulnerability{Name: "CVE-2024-1234"},
+				Products:      product,
+				Status:        vex.StatusNotAffected,
+				Justification: vex.VulnerableCodeNotPresent,
+			},
+			expectedTime: &docTime,
+		},
+		{
+			name:    "keeps its own timestamp",
+			docTime: &docTime,
+			statement: vex.Statement{
+				Vulnerability: vex.Vulnerability{Name: "CVE-2024-1234"},
+				Products:      product,
+				Status:        vex.StatusFixed,
+				Timestamp:     &stmtTime,
+			},
+			expectedTime: &stmtTime,
+		},
+		{
+			name: "document without timestamp",
+			statement: vex.Statement{
+				Vulnerability: vex.Vulnerability{Name: "CVE-2024-1234"},
+				Products:      product,
+				Status:        vex.StatusUnderInvestigation,
+			},
+		},
+		{
+			name:    "missing justification",
+			docTime: &docTime,
+			statement: vex.Statement{
+				Vulnerability: vex.Vulnerability{Name: "CVE-2024-1234"},
+				Products:      product,
+				Status:        vex.StatusNotAffected,
+			},
+			shouldErr: true,
+		},
+		{
+			name:    "missing products",
+			docTime: &docTime,
+			statement: vex.Statement{
+				Vulnerability: vex.Vulnerability{Name: "CVE-2024-1234"},
+				Status:        vex.StatusFixed,
+			},
+			shouldErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			doc := vex.New()
+			doc.Timestamp = tc.docTime
+			start := time.Now()
+
+			err := AddStatement(&doc, tc.statement)
+			if tc.shouldErr {
+				require.Error(t, err)
+				require.Empty(t, doc.Statements)
+				require.Nil(t, doc.LastUpdated)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, doc.Statements, 1)
+			require.NotNil(t, doc.Statements[0].Timestamp)
+			if tc.expectedTime != nil {
+				require.True(t, tc.expectedTime.Equal(*doc.Statements[0].Timestamp))
+			} else {
+				require.False(t, doc.Statements[0].Timestamp.Before(start))
+			}
+			require.NotNil(t, doc.LastUpdated)
+			require.False(t, doc.LastUpdated.Before(start))
+		})
+	}
+
+	require.Error(t, AddStatement(nil, vex.Statement{}))
+}
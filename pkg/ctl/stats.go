@@ -0,0 +1,77 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"time"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// DocStats summarizes the statements in one or more VEX documents
+type DocStats struct {
+	Documents            int                `json:"documents"`
+	Statements           int                `json:"statements"`
+	Statuses             map[vex.Status]int `json:"statuses"`              // Number of statements with each status
+	Vulnerabilities      int                `json:"vulnerabilities"`       // Distinct vulnerabilities
+	Products             int                `json:"products"`              // Distinct products
+	MissingJustification int                `json:"missing_justification"` // not_affected statements without a justification label
+	FirstStatement       *time.Time         `json:"first_statement,omitempty"`
+	LastStatement        *time.Time         `json:"last_statement,omitempty"`
+}
+
+// Stats returns the statistics of the statements in the documents. Statements
+// without a timestamp take the one from their document to compute the time
+// span. Nil documents are ignored.
+func Stats(docs ...*vex.VEX) DocStats {
+	stats := DocStats{Statuses: map[vex.Status]int{}}
+	vulns := map[string]struct{}{}
+	products := map[string]struct{}{}
+	for _, doc := range docs {
+		if doc == nil {
+			continue
+		}
+		stats.Documents++
+		for i := range doc.Statements {
+			s := &doc.Statements[i]
+			stats.Statements++
+			stats.Statuses[s.Status]++
+			if s.Status == vex.StatusNotAffected && s.Justification == "" {
+				stats.MissingJustification++
+			}
+
+			if name := string(s.Vulnerability.Name); name != "" {
+				vulns[name] = struct{}{}
+			} else if s.Vulnerability.ID != "" {
+				vulns[s.Vulnerability.ID] = struct{}{}
+			}
+			for j := range s.Products {
+				if id := productIdentifier(&s.Products[j].Component); id != "" {
+					products[id] = struct{}{}
+				}
+			}
+
+			ts := s.Timestamp
+			if ts == nil {
+				ts = doc.Timestamp
+			}
+			if ts == nil {
+				continue
+			}
+			if stats.FirstStatement == nil || ts.Before(*stats.FirstStatement) {
+				first := *ts
+				stats.FirstStatement = &first
+			}
+			if stats.LastStatement == nil || ts.After(*stats.LastStatement) {
+				last := *ts
+				stats.LastStatement = &last
+			}
+		}
+	}
+	stats.Vulnerabilities = len(vulns)
+	stats.Products = len(products)
+	return stats
+}
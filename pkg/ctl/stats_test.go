@@ -0,0 +1,112 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+func TestStats(t *testing.T) {
+	t1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(24 * time.Hour)
+	t3 := t2.Add(24 * time.Hour)
+	products := func(ids ...string) []vex.Product {
+		ret := []vex.Product{}
+		for _, id := range ids {
+			ret = append(ret, vex.Product{Component: vex.Component{ID: id}})
+		}
+		return ret
+	}
+
+	mixed := &vex.VEX{
+		Metadata: vex.Metadata{Timestamp: &t2},
+		Statements: []vex.Statement{
+			{
+				Vulnerability: vex.Vulnerability{Name: "CVE-2023-1234"},
+				Products:      products("pkg:apk/wolfi/bash@1.0.0", "pkg:apk/wolfi/git@2.41.0"),
+				Status:        vex.StatusNotAffected,
+				Justification: vex.ComponentNotPresent,
+				Timestamp:     &t1,
+			},
+			{
+				Vulnerability:   vex.Vulnerability{Name: "CVE-2023-5678"},
+				Products:        products("pkg:apk/wolfi/bash@1.0.0"),
+				Status:          vex.StatusNotAffected,
+				ImpactStatement: "The vulnerable code is not loaded",
+			},
+			{
+				Vulnerability:   vex.Vulnerability{Name: "CVE-2023-5678"},
+				Products:        products("pkg:apk/wolfi/git@2.41.0"),
+				Status:          vex.StatusAffected,
+				ActionStatement: "Update to 2.41.1",
+			},
+			{
+				Vulnerability: vex.Vulnerability{Name: "CVE-2023-9999"},
+				Products:      products("pkg:apk/wolfi/curl@8.1.0"),
+				Status:        vex.StatusFixed,
+			},
+		},
+	}
+	later := &vex.VEX{
+		Metadata: vex.Metadata{Timestamp: &t3},
+		Statements: []vex.Statement{
+			{
+				Vulnerability: vex.Vulnerability{Name: "CVE-2023-1234"},
+				Products:      products("pkg:apk/wolfi/curl@8.1.0"),
+				Status:        vex.StatusUnderInvestigation,
+			},
+		},
+	}
+
+	for _, tc := range []struct {
+		name     string
+		docs     []*vex.VEX
+		expected DocStats
+	}{
+		{
+			"mixed statuses",
+			[]*vex.VEX{mixed},
+			DocStats{
+				Documents:  1,
+				Statements: 4,
+				Statuses: map[vex.Status]int{
+					vex.StatusNotAffected: 2, vex.StatusAffected: 1, vex.StatusFixed: 1,
+				},
+				Vulnerabilities:      3,
+				Products:             3,
+				MissingJustification: 1,
+				FirstStatement:       &t1,
+				LastStatement:        &t2,
+			},
+		},
+		{
+			"multiple documents",
+			[]*vex.VEX{mixed, later, nil},
+			DocStats{
+				Documents:  2,
+				Statements: 5,
+				Statuses: map[vex.Status]int{
+					vex.StatusNotAffected: 2, vex.StatusAffected: 1, vex.StatusFixed: 1, vex.StatusUnderInvestigation: 1,
+				},
+				Vulnerabilities:      3,
+				Products:             3,
+				MissingJustification: 1,
+				FirstStatement:       &t1,
+				LastStatement:        &t3,
+			},
+		},
+		{"no documents", nil, DocStats{Statuses: map[vex.Status]int{}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, Stats(tc.docs...))
+		})
+	}
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// StreamStatements decodes the statements of the OpenVEX document at path
+// one at a time and calls fn with each of them, so documents too large to
+// hold in memory can be processed. Decoding stops at the first error
+// returned by fn. The document metadata is not read: statements without a
+// timestamp are passed as they are, without cascading the document one.
+// Only documents in the current OpenVEX JSON format are supported. See
+// StreamFilter to select statements while streaming.
+func StreamStatements(path string, fn func(vex.Statement) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening document: %w", err)
+	}
+	defer f.Close()
+	return streamStatements(f, fn)
+}
+
+// StreamFilter calls fn with the statements of the document at path that
+// match the filter spec, decoding them one at a time like StreamStatements
+// instead of loading the document as Filter does. As the document metadata
+// is not read, statements without a timestamp never match a time filter.
+func StreamFilter(path string, f FilterSpec, fn func(vex.Statement) error) error {
+	return StreamStatements(path, func(s vex.Statement) error {
+		if !f.matches(&s, nil) {
+			return nil
+		}
+		return fn(s)
+	})
+}
+
+// streamStatements decodes the statements of the document read from r
+func streamStatements(r io.Reader, fn func(vex.Statement) error) error {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("reading document: %w", err)
+		}
+		if key, ok := tok.(string); !ok || key != "statements" {
+			// Skip the values of the other fields
+			if err := dec.Decode(&json.RawMessage{}); err != nil {
+				return fmt.Errorf("reading document: %w", err)
+			}
+			continue
+		}
+
+		if err := expectDelim(dec, '['); err != nil {
+			return err
+		}
+		for i := 0; dec.More(); i++ {
+			s := vex.Statement{}
+			if err := dec.Decode(&s); err != nil {
+				return fmt.Errorf("decoding statement #%d: %w", i, err)
+			}
+			if err := fn(s); err != nil {
+				return err
+			}
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, '}')
+}
+
+// LoadStream decodes the VEX documents read from r, eg concatenated by a
+// pipeline on stdin, so they can be merged. The stream can hold documents
+// one after the other (newline delimited or not) or a single top level
+// array of documents. Each document is parsed like those read from files.
+func LoadStream(r io.Reader) ([]*vex.VEX, error) {
+	dec := json.NewDecoder(r)
+	docs := []*vex.VEX{}
+	for i := 0; ; i++ {
+		raw := json.RawMessage{}
+		if err := dec.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("decoding document #%d: %w", len(docs), err)
+		}
+
+		values := []json.RawMessage{raw}
+		if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+			if i > 0 || dec.More() {
+				return nil, errors.New("document arrays cannot be mixed with other values in the stream")
+			}
+			if err := json.Unmarshal(raw, &values); err != nil {
+				return nil, fmt.Errorf("decoding document array: %w", err)
+			}
+		}
+
+		for _, v := range values {
+			doc, err := parseVexData(v)
+			if err != nil {
+				return nil, fmt.Errorf("parsing document #%d: %w", len(docs), err)
+			}
+			docs = append(docs, doc)
+		}
+	}
+	if len(docs) == 0 {
+		return nil, errors.New("no VEX documents found in the stream")
+	}
+	return docs, nil
+}
+
+// expectDelim reads the next token and checks it is the delimiter d
+func expectDelim(dec *json.Decoder, d json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("reading document: %w", err)
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != d {
+		return errors.New("document is not a valid OpenVEX JSON document")
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+func TestStreamStatements(t *testing.T) {
+	for _, path := range []string{"testdata/v020-1.vex.json", "testdata/export.openvex.json"} {
+		t.Run(path, func(t *testing.T) {
+			doc, err := vex.Open(path)
+			require.NoError(t, err)
+			statements := []vex.Statement{}
+			require.NoError(t, StreamStatements(path, func(s vex.Statement) error {
+				statements = append(statements, s)
+				return nil
+			}))
+			require.Equal(t, doc.Statements, statements)
+		})
+	}
+
+	t.Run("callback error stops decoding", func(t *testing.T) {
+		stop := errors.New("stop")
+		n := 0
+		err := StreamStatements("testdata/export.openvex.json", func(vex.Statement) error {
+			n++
+			return stop
+		})
+		require.ErrorIs(t, err, stop)
+		require.Equal(t, 1, n)
+	})
+
+	for name, data := range map[string]string{
+		"not an object":     `["statements"]`,
+		"truncated":         `{"@id": "test", "statements": [{"status": "fixed"}`,
+		"invalid statement": `{"statements": [{"status": 42}]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.Error(t, streamStatements(strings.NewReader(data), func(vex.Statement) error { return nil }))
+		})
+	}
+
+	require.Error(t, StreamStatements("testdata/missing.json", func(vex.Statement) error { return nil }))
+}
+
+func TestStreamDocumentProducts(t *testing.T) {
+	impl := defaultVexCtlImplementation{}
+	for _, path := range []string{"testdata/v020-1.vex.json", "testdata/export.openvex.json"} {
+		t.Run(path, func(t *testing.T) {
+			doc, err := vex.Open(path)
+			require.NoError(t, err)
+			expected, err := impl.ListDocumentProducts(doc)
+			require.NoError(t, err)
+			products, err := impl.StreamDocumentProducts(path)
+			require.NoError(t, err)
+			require.Equal(t, expected, products)
+		})
+	}
+
+	_, err := impl.StreamDocumentProducts("testdata/missing.json")
+	require.Error(t, err)
+}
+
+func TestStreamFilter(t *testing.T) {
+	path := "testdata/export.openvex.json"
+	doc, err := vex.Open(path)
+	require.NoError(t, err)
+	require.NotEmpty(t, doc.Statements)
+
+	for _, tc := range []struct {
+		name string
+		spec FilterSpec
+	}{
+		{"no filter", FilterSpec{}},
+		{"status", FilterSpec{Statuses: []vex.Status{doc.Statements[0].Status}}},
+		{"vulnerability", FilterSpec{Vulnerabilities: []string{string(doc.Statements[0].Vulnerability.Name)}}},
+		{"no match", FilterSpec{Vulnerabilities: []string{"CVE-1999-0001"}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			expected, err := Filter(doc, tc.spec)
+			require.NoError(t, err)
+			statements := []vex.Statement{}
+			require.NoError(t, StreamFilter(path, tc.spec, func(s vex.Statement) error {
+				statements = append(statements, s)
+				return nil
+			}))
+			require.Equal(t, expected.Statements, statements)
+		})
+	}
+}
+
+// BenchmarkStreamStatements compares the memory held while going over the
+// products of a large document with StreamStatements and LoadFiles.
+func BenchmarkStreamStatements(b *testing.B) {
+	path := filepath.Join(b.TempDir(), "large.vex.json")
+	require.NoError(b, os.WriteFile(path, repeatedProductsDocument(5000, 20), os.FileMode(0o600)))
+
+	for _, mode := range []string{"stream", "load"} {
+		b.Run(mode, func(b *testing.B) {
+			var held int64
+			for i := 0; i < b.N; i++ {
+				var base, m runtime.MemStats
+				runtime.GC()
+				runtime.ReadMemStats(&base)
+
+				products := 0
+				var docs []*vex.VEX
+				switch mode {
+				case "stream":
+					require.NoError(b, StreamStatements(path, func(s vex.Statement) error {
+						products += len(s.Products)
+						return nil
+					}))
+				case "load":
+					var err error
+					impl := defaultVexCtlImplementation{}
+					docs, err = impl.LoadFiles(context.Background(), Options{}, []string{path})
+					require.NoError(b, err)
+					for j := range docs[0].Statements {
+						products += len(docs[0].Statements[j].Products)
+					}
+				}
+				require.Equal(b, 5000*20, products)
+
+				runtime.GC()
+				runtime.ReadMemStats(&m)
+				held += int64(m.HeapAlloc) - int64(base.HeapAlloc)
+				runtime.KeepAlive(docs)
+			}
+			b.ReportMetric(float64(held)/float64(b.N), "held-B/op")
+		})
+	}
+}
+
+func TestLoadStream(t *testing.T) {
+	paths := []string{"testdata/v020-1.vex.json", "testdata/v020-2.vex.json", "testdata/v001-1.vex.json"}
+	compact := []string{}
+	expectedIDs := []string{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		var b bytes.Buffer
+		require.NoError(t, json.Compact(&b, data))
+		compact = append(compact, b.String())
+		doc, err := vex.Open(path)
+		require.NoError(t, err)
+		expectedIDs = append(expectedIDs, doc.ID)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		stream string
+		errMsg string
+	}{
+		{"newline delimited", strings.Join(compact, "\n") + "\n", ""},
+		{"concatenated", strings.Join(compact, ""), ""},
+		{"array", "[\n" + strings.Join(compact, ",\n") + "\n]\n", ""},
+		{"array and objects", "[" + compact[0] + "]\n" + compact[1], "cannot be mixed"},
+		{"invalid json", compact[0] + "\n{", "decoding document #1"},
+		{"empty", "\n", "no VEX documents"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			docs, err := LoadStream(strings.NewReader(tc.stream))
+			if tc.errMsg != "" {
+				require.ErrorContains(t, err, tc.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			ids := []string{}
+			for _, doc := range docs {
+				ids = append(ids, doc.ID)
+			}
+			require.Equal(t, expectedIDs, ids)
+		})
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+const (
+	// DefaultFetchTimeout is the time allowed to download a VEX document
+	// from a URL when not set in the options.
+	DefaultFetchTimeout = 30 * time.Second
+
+	// DefaultMaxDocumentSize is the largest VEX document, in bytes, that is
+	// downloaded from a URL when not set in the options.
+	DefaultMaxDocumentSize = 10 << 20
+)
+
+// isURL returns true when uri is an http or https URL
+func isURL(uri string) bool {
+	u, err := url.Parse(uri)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// FetchVexData downloads the VEX document at an http(s) URL, following
+// redirects. The download is limited to opts.FetchTimeout and documents
+// larger than opts.MaxDocumentSize are rejected. The document is parsed
+// like vex.Open does with files, so all the formats it reads are supported.
+func (impl *defaultVexCtlImplementation) FetchVexData(ctx context.Context, opts Options, uri string) (*vex.VEX, error) {
+	timeout := opts.FetchTimeout
+	if timeout <= 0 {
+		timeout = DefaultFetchTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", uri, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: HTTP status %s", uri, resp.Status)
+	}
+
+	data, err := readLimited(resp.Body, opts.MaxDocumentSize)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", uri, err)
+	}
+	doc, err := parseVexData(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing VEX document from %s: %w", uri, err)
+	}
+	return doc, nil
+}
+
+// readLimited reads a VEX document from r, failing when it is larger than
+// maxSize bytes or DefaultMaxDocumentSize when maxSize is not set.
+func readLimited(r io.Reader, maxSize int64) ([]byte, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxDocumentSize
+	}
+	data, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("document is larger than %d bytes", maxSize)
+	}
+	return data, nil
+}
+
+// parseVexData parses a VEX document read from a stream. vex.Open detects
+// the document format and version from a file, so the data is written to a
+// temporary file to read it exactly like the documents on disk.
+func parseVexData(data []byte) (*vex.VEX, error) {
+	f, err := os.CreateTemp("", "vexctl-*.json")
+	if err != nil {
+		return nil, fmt.Errorf("creating temporary file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("writing temporary file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("closing temporary file: %w", err)
+	}
+	return vex.Open(f.Name())
+}
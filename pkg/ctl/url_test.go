@@ -0,0 +1,62 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchVexData(t *testing.T) {
+	doc, err := os.ReadFile("testdata/v020-1.vex.json")
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/valid.json", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write(doc)
+	})
+	mux.HandleFunc("/malformed.json", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"@context": "https://openvex.dev/ns/v0.2.0", "statements": [`))
+	})
+	mux.HandleFunc("/large.json", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat(" ", 2048)))
+	})
+	mux.Handle("/redirect", http.RedirectHandler("/valid.json", http.StatusFound))
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	impl := defaultVexCtlImplementation{}
+	for m, tc := range map[string]struct {
+		path    string
+		mustErr bool
+	}{
+		"valid document": {"/valid.json", false},
+		"redirect":       {"/redirect", false},
+		"malformed":      {"/malformed.json", true},
+		"not found":      {"/missing.json", true},
+		"too large":      {"/large.json", true},
+	} {
+		uri := s.URL + tc.path
+		st, err := impl.SourceType(uri)
+		require.NoError(t, err, m)
+		require.Equal(t, "url", st, m)
+
+		vexDoc, err := impl.FetchVexData(context.Background(), Options{MaxDocumentSize: 1024}, uri)
+		if tc.mustErr {
+			require.Error(t, err, m)
+			continue
+		}
+		require.NoError(t, err, m)
+		require.Len(t, vexDoc.Statements, 1, m)
+		require.Equal(t, "CVE-9876-54321", string(vexDoc.Statements[0].Vulnerability.Name), m)
+	}
+}
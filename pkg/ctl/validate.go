@@ -0,0 +1,114 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// Validate checks a VEX document against the required fields of the OpenVEX
+// spec. It returns all the problems found in the document, a valid document
+// returns an empty slice. Statement timestamps can be inherited from the
+// document so only statements without one in either place are reported.
+func Validate(doc *vex.VEX) []error {
+	if doc == nil {
+		return []error{errors.New("vex document is nil")}
+	}
+
+	errs := []error{}
+	if doc.Context == "" {
+		errs = append(errs, errors.New("document has no @context"))
+	}
+	if doc.ID == "" {
+		errs = append(errs, errors.New("document has no @id"))
+	}
+	if doc.Author == "" {
+		errs = append(errs, errors.New("document has no author"))
+	}
+	if doc.Version < 1 {
+		errs = append(errs, fmt.Errorf("document version must be 1 or higher (was %d)", doc.Version))
+	}
+
+	for i := range doc.Statements {
+		for _, err := range validateStatement(&doc.Statements[i], doc.Timestamp != nil) {
+			errs = append(errs, fmt.Errorf("statement #%d: %w", i, err))
+		}
+	}
+	return errs
+}
+
+// validateStatement returns the problems found in a statement. hasDocTime
+// tells if the statement can inherit the document timestamp.
+func validateStatement(s *vex.Statement, hasDocTime bool) []error {
+	errs := []error{}
+	if s.Vulnerability.Name == "" && s.Vulnerability.ID == "" {
+		errs = append(errs, errors.New("no vulnerability name or @id"))
+	}
+	if len(s.Products) == 0 {
+		errs = append(errs, errors.New("no products"))
+	}
+	for j, p := range s.Products {
+		if p.ID == "" && len(p.Identifiers) == 0 && len(p.Hashes) == 0 {
+			errs = append(errs, fmt.Errorf("product #%d has no @id, identifiers or hashes", j))
+		}
+	}
+	if s.Timestamp == nil && !hasDocTime {
+		errs = append(errs, errors.New("no timestamp in the statement or the document"))
+	}
+
+	switch s.Status {
+	case vex.StatusNotAffected:
+		if err := checkJustification(s); err != nil {
+			errs = append(errs, err)
+		}
+		if s.Justification != "" && !s.Justification.Valid() {
+			errs = append(errs, fmt.Errorf(
+				"invalid justification %q, must be one of [%s]", s.Justification, strings.Join(vex.Justifications(), ", "),
+			))
+		}
+	case vex.StatusAffected:
+		if s.ActionStatement == "" {
+			errs = append(errs, fmt.Errorf("status %q requires an action statement", s.Status))
+		}
+	case vex.StatusFixed, vex.StatusUnderInvestigation:
+	case "":
+		errs = append(errs, errors.New("no status"))
+	default:
+		errs = append(errs, fmt.Errorf(
+			"invalid status %q, must be one of [%s]", s.Status, strings.Join(vex.Statuses(), ", "),
+		))
+	}
+	return errs
+}
+
+// ValidateJustifications returns an error for each not_affected statement in
+// the document that has neither a justification nor an impact statement, one
+// of them is required by the OpenVEX spec.
+func ValidateJustifications(doc *vex.VEX) []error {
+	errs := []error{}
+	if doc == nil {
+		return errs
+	}
+	for i := range doc.Statements {
+		if err := checkJustification(&doc.Statements[i]); err != nil {
+			errs = append(errs, fmt.Errorf("statement #%d: %w", i, err))
+		}
+	}
+	return errs
+}
+
+// checkJustification returns an error if a not_affected statement is
+// missing both its justification and impact statement.
+func checkJustification(s *vex.Statement) error {
+	if s.Status == vex.StatusNotAffected && s.Justification == "" && s.ImpactStatement == "" {
+		return fmt.Errorf("status %q requires a justification or impact statement", s.Status)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+func TestValidate(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	product := []vex.Product{{Component: vex.Component{ID: "pkg:apk/wolfi/bash@1.0.0"}}}
+	newDoc := func(statements ...vex.Statement) *vex.VEX {
+		return &vex.VEX{
+			Metadata: vex.Metadata{
+				Context:   vex.Context,
+				ID:        "https://openvex.dev/docs/test",
+				Author:    "Test Author",
+				Version:   1,
+				Timestamp: &ts,
+			},
+			Statements: statements,
+		}
+	}
+
+	for _, tc := range []struct {
+		name     string
+		doc      *vex.VEX
+		expected []string
+	}{
+		{
+			"valid",
+			newDoc(
+				vex.Statement{
+					Vulnerability: vex.Vulnerability{Name: "CVE-2023-1234"},
+					Products:      product,
+					Status:        vex.StatusNotAffected,
+					Justification: vex.ComponentNotPresent,
+				},
+				vex.Statement{
+					Vulnerability:   vex.Vulnerability{Name: "CVE-2023-5678"},
+					Products:        product,
+					Status:          vex.StatusAffected,
+					ActionStatement: "Update to 1.0.1",
+				},
+			),
+			[]string{},
+		},
+		{"nil document", nil, []string{"vex document is nil"}},
+		{
+			"document metadata",
+			&vex.VEX{Statements: []vex.Statement{
+				{Vulnerability: vex.Vulnerability{Name: "CVE-2023-1234"}, Products: product, Status: vex.StatusFixed, Timestamp: &ts},
+			}},
+			[]string{
+				"document has no @context",
+				"document has no @id",
+				"document has no author",
+				"document version must be 1 or higher (was 0)",
+			},
+		},
+		{
+			"all statement errors are returned",
+			newDoc(
+				vex.Statement{Status: vex.StatusFixed},
+				vex.Statement{
+					Vulnerability: vex.Vulnerability{Name: "CVE-2023-1234"},
+					Products:      []vex.Product{{}},
+					Status:        vex.StatusNotAffected,
+				},
+				vex.Statement{
+					Vulnerability: vex.Vulnerability{Name: "CVE-2023-1234"},
+					Products:      product,
+					Status:        vex.StatusNotAffected,
+					Justification: "not_a_justification",
+				},
+				vex.Statement{Vulnerability: vex.Vulnerability{Name: "CVE-2023-1234"}, Products: product, Status: vex.StatusAffected},
+				vex.Statement{Vulnerability: vex.Vulnerability{Name: "CVE-2023-1234"}, Products: product, Status: "vulnerable"},
+			),
+			[]string{
+				"statement #0: no vulnerability name or @id",
+				"statement #0: no products",
+				"statement #1: product #0 has no @id, identifiers or hashes",
+				`statement #1: status "not_affected" requires a justification or impact statement`,
+				`statement #2: invalid justification "not_a_justification", must be one of [` +
+					"component_not_present, vulnerable_code_not_present, vulnerable_code_not_in_execute_path, " +
+					"vulnerable_code_cannot_be_controlled_by_adversary, inline_mitigations_already_exist]",
+				`statement #3: status "affected" requires an action statement`,
+				`statement #4: invalid status "vulnerable", must be one of [not_affected, affected, fixed, under_investigation]`,
+			},
+		},
+		{
+			"timestamps cascade from the document",
+			func() *vex.VEX {
+				doc := newDoc(
+					vex.Statement{Vulnerability: vex.Vulnerability{Name: "CVE-2023-1234"}, Products: product, Status: vex.StatusFixed, Timestamp: &ts},
+					vex.Statement{Vulnerability: vex.Vulnerability{Name: "CVE-2023-5678"}, Products: product, Status: vex.StatusFixed},
+				)
+				doc.Timestamp = nil
+				return doc
+			}(),
+			[]string{"statement #1: no timestamp in the statement or the document"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			errs := Validate(tc.doc)
+			msgs := []string{}
+			for _, err := range errs {
+				msgs = append(msgs, err.Error())
+			}
+			require.Equal(t, tc.expected, msgs)
+		})
+	}
+}
+
+func TestValidateJustifications(t *testing.T) {
+	product := []vex.Product{{Component: vex.Component{ID: "pkg:apk/wolfi/bash@1.0.0"}}}
+	doc := &vex.VEX{Statements: []vex.Statement{
+		{Products: product, Status: vex.StatusNotAffected, Justification: vex.ComponentNotPresent},
+		{Products: product, Status: vex.StatusNotAffected, ImpactStatement: "The code is not loaded"},
+		{Products: product, Status: vex.StatusNotAffected},
+		{Products: product, Status: vex.StatusAffected},
+	}}
+
+	errs := ValidateJustifications(doc)
+	require.Len(t, errs, 1)
+	require.EqualError(t, errs[0], `statement #2: status "not_affected" requires a justification or impact statement`)
+	require.Empty(t, ValidateJustifications(&vex.VEX{}))
+}
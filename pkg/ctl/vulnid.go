@@ -0,0 +1,74 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+// prefixedVulnIDRegexp matches identifiers made of a prefix naming the
+// database followed by the ID in it, eg CVE-2023-1234 or GHSA-xxxx-xxxx-xxxx
+var prefixedVulnIDRegexp = regexp.MustCompile(`^([A-Za-z]+)-(.+)$`)
+
+// cveSequenceRegexp matches the year and sequence number of a CVE ID
+var cveSequenceRegexp = regexp.MustCompile(`^(\d{4})-0*(\d+)$`)
+
+// CanonicalizeVulnID returns the canonical form of a vulnerability ID so
+// that the spellings of the same ID compare equal:
+//
+//   - Surrounding spaces are removed and the database prefix is upper cased
+//     (cve-2023-1234 becomes CVE-2023-1234).
+//   - CVE sequence numbers are zero-padded to the four digits required by the
+//     CVE ID syntax and longer ones lose their leading zeros, so CVE-2023-1
+//     and CVE-2023-00001 become CVE-2023-0001.
+//   - The rest of GHSA IDs is lower cased, as published by GitHub.
+//
+// The rest of the ID is kept as is. Identifiers without a prefix, like
+// vulnerability IRIs, are only trimmed.
+func CanonicalizeVulnID(raw string) string {
+	id := strings.TrimSpace(raw)
+	m := prefixedVulnIDRegexp.FindStringSubmatch(id)
+	if m == nil {
+		return id
+	}
+
+	prefix, rest := strings.ToUpper(m[1]), m[2]
+	switch prefix {
+	case "CVE":
+		if seq := cveSequenceRegexp.FindStringSubmatch(rest); seq != nil {
+			number := seq[2]
+			if len(number) < 4 {
+				number = strings.Repeat("0", 4-len(number)) + number
+			}
+			rest = seq[1] + "-" + number
+		}
+	case "GHSA":
+		rest = strings.ToLower(rest)
+	}
+	return prefix + "-" + rest
+}
+
+// vulnerabilityMatchesID returns true if id is the canonical form of the
+// vulnerability name, its IRI or one of its aliases.
+func vulnerabilityMatchesID(v *vex.Vulnerability, id string) bool {
+	id = CanonicalizeVulnID(id)
+	if id == "" {
+		return false
+	}
+	ids := []string{v.ID, string(v.Name)}
+	for _, alias := range v.Aliases {
+		ids = append(ids, string(alias))
+	}
+	for _, candidate := range ids {
+		if strings.EqualFold(CanonicalizeVulnID(candidate), id) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2024 The OpenVEX Authors
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ctl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/openvex/go-vex/pkg/vex"
+)
+
+func TestCanonicalizeVulnID(t *testing.T) {
+	for _, tc := range []struct {
+		raw      string
+		expected string
+	}{
+		{"CVE-2023-1234", "CVE-2023-1234"},
+		{"cve-2023-1234", "CVE-2023-1234"},
+		{" CVE-2023-1234\n", "CVE-2023-1234"},
+		{"cve-2023-1", "CVE-2023-0001"},
+		{"CVE-2023-0001", "CVE-2023-0001"},
+		{"CVE-2023-00001", "CVE-2023-0001"},
+		{"CVE-2023-123456", "CVE-2023-123456"},
+		{"CVE-2023-0123456", "CVE-2023-123456"},
+		{"CVE-2023-abc", "CVE-2023-abc"},
+		{"ghsa-XXXX-YYYY-ZZZZ", "GHSA-xxxx-yyyy-zzzz"},
+		{"go-2023-1234", "GO-2023-1234"},
+		{"RUSTSEC-2023-0001", "RUSTSEC-2023-0001"},
+		{"RHSA-2023:1234", "RHSA-2023:1234"},
+		{"https://nvd.nist.gov/vuln/detail/CVE-2023-1234", "https://nvd.nist.gov/vuln/detail/CVE-2023-1234"},
+		{"", ""},
+	} {
+		t.Run(tc.raw, func(t *testing.T) {
+			require.Equal(t, tc.expected, CanonicalizeVulnID(tc.raw))
+		})
+	}
+}
+
+func TestVulnerabilityMatchesID(t *testing.T) {
+	v := vex.Vulnerability{
+		Name:    "CVE-2023-0001",
+		Aliases: []vex.VulnerabilityID{"GHSA-abcd-efgh-ijkl"},
+	}
+	require.True(t, vulnerabilityMatchesID(&v, "cve-2023-1"))
+	require.True(t, vulnerabilityMatchesID(&v, "GHSA-ABCD-EFGH-IJKL"))
+	require.False(t, vulnerabilityMatchesID(&v, "CVE-2023-0010"))
+	require.False(t, vulnerabilityMatchesID(&v, " "))
+}